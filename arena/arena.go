@@ -0,0 +1,498 @@
+// Package arena simulates battles between wizards.
+//
+// A battle is a deterministic loop of ticks. On every tick each living
+// wizard is asked for an action based on the state at the start of the
+// tick, and then the actions are resolved in a fixed order: movement,
+// spell casting, damage, and finally mana and cooldown recovery. All
+// randomness comes from the battle's seed, so running a battle again
+// with the same wizards, scripts, map and seed reproduces it exactly.
+package arena
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+var (
+	ErrTooFewWizards   = errors.New("A battle needs at least two wizards.")
+	ErrDuplicateWizard = errors.New("A wizard cannot take part in the same battle twice.")
+	ErrDuplicateSpell  = errors.New("Every spell in a battle must have a unique name.")
+	ErrInvalidRules    = errors.New("The tick limit, maximum health and maximum mana must all be positive.")
+	ErrUnknownSpell    = errors.New("A wizard has equipped a spell that is not available in the battle.")
+)
+
+// Controller decides on a wizard's actions. In normal use this is an
+// interpreters.Sandbox wrapping the wizard's active script.
+type Controller interface {
+	Decide(view interpreters.View) (interpreters.Action, error)
+}
+
+type Participant struct {
+	WizardID   uint64
+	Name       string
+	Controller Controller
+
+	// Spells holds the names of the spells the wizard has equipped. If it
+	// is empty, the wizard may cast every spell in the battle.
+	Spells []string
+}
+
+// Rules are the parameters that apply to every wizard in a battle.
+type Rules struct {
+	MaxTicks  int
+	MaxHealth int
+	MaxMana   int
+	ManaRegen int // mana recovered by every living wizard at the end of each tick
+}
+
+var DefaultRules = Rules{
+	MaxTicks:  500,
+	MaxHealth: 100,
+	MaxMana:   100,
+	ManaRegen: 5,
+}
+
+type Config struct {
+	Map    Map
+	Spells []Spell
+	Rules  Rules
+	Seed   int64
+}
+
+// wizard is the mutable state of a single participant.
+type wizard struct {
+	Participant
+	position  interpreters.Position
+	health    int
+	mana      int
+	cooldowns map[string]int
+	spells    []*Spell
+	stats     WizardResult
+}
+
+func (w *wizard) canCast(spell *Spell) bool {
+	for _, equipped := range w.spells {
+		if equipped == spell {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *wizard) alive() bool {
+	return w.health > 0
+}
+
+type Battle struct {
+	config    Config
+	wizards   []*wizard
+	spells    map[string]*Spell
+	obstacles map[interpreters.Position]bool
+	rng       *rand.Rand
+	tick      int
+	result    *Result
+	observers []Observer
+}
+
+func New(config Config, participants []Participant) (*Battle, error) {
+	if len(participants) < 2 {
+		return nil, ErrTooFewWizards
+	}
+
+	rules := config.Rules
+	if rules.MaxTicks <= 0 || rules.MaxHealth <= 0 || rules.MaxMana <= 0 {
+		return nil, ErrInvalidRules
+	}
+
+	if err := config.Map.validate(len(participants)); err != nil {
+		return nil, err
+	}
+
+	spells := make(map[string]*Spell, len(config.Spells))
+	for i := range config.Spells {
+		spell := &config.Spells[i]
+		if _, exists := spells[spell.Name]; exists {
+			return nil, ErrDuplicateSpell
+		}
+		spells[spell.Name] = spell
+	}
+
+	battle := &Battle{
+		config:    config,
+		spells:    spells,
+		obstacles: config.Map.obstacleSet(),
+		rng:       rand.New(rand.NewSource(config.Seed)),
+	}
+
+	seen := make(map[uint64]bool, len(participants))
+	for i, participant := range participants {
+		if seen[participant.WizardID] {
+			return nil, ErrDuplicateWizard
+		}
+		seen[participant.WizardID] = true
+
+		equipped, err := battle.equippedSpells(participant)
+		if err != nil {
+			return nil, err
+		}
+
+		battle.wizards = append(battle.wizards, &wizard{
+			Participant: participant,
+			position:    config.Map.SpawnPoints[i],
+			health:      config.Rules.MaxHealth,
+			mana:        config.Rules.MaxMana,
+			cooldowns:   make(map[string]int),
+			spells:      equipped,
+			stats:       WizardResult{WizardID: participant.WizardID, Name: participant.Name},
+		})
+	}
+
+	return battle, nil
+}
+
+func (battle *Battle) equippedSpells(participant Participant) ([]*Spell, error) {
+	if len(participant.Spells) == 0 {
+		var equipped []*Spell
+		for i := range battle.config.Spells {
+			equipped = append(equipped, &battle.config.Spells[i])
+		}
+		return equipped, nil
+	}
+
+	equipped := make([]*Spell, 0, len(participant.Spells))
+	for _, name := range participant.Spells {
+		spell, exists := battle.spells[name]
+		if !exists {
+			return nil, ErrUnknownSpell
+		}
+		equipped = append(equipped, spell)
+	}
+	return equipped, nil
+}
+
+// Run simulates the battle until it finishes and returns the result.
+func (battle *Battle) Run() *Result {
+	for !battle.Step() {
+	}
+	return battle.result
+}
+
+// Tick returns the number of ticks that have been simulated so far.
+func (battle *Battle) Tick() int {
+	return battle.tick
+}
+
+// Result returns the outcome of the battle, or nil if it has not finished.
+func (battle *Battle) Result() *Result {
+	return battle.result
+}
+
+// Step simulates a single tick and reports whether the battle has finished.
+func (battle *Battle) Step() bool {
+	if battle.result != nil {
+		return true
+	}
+
+	if battle.tick == 0 {
+		battle.notifyStarted()
+	}
+
+	battle.tick++
+
+	// Wizards act in a different order every tick, so that no wizard
+	// gains a permanent advantage when two moves or casts conflict.
+	order := battle.turnOrder()
+	actions, failed := battle.collectActions(order)
+	battle.resolveMovement(order, actions)
+	battle.resolveCasting(order, actions)
+	battle.regenerate()
+
+	battle.result = battle.checkFinished()
+	battle.notifyTick(actions, failed)
+	return battle.result != nil
+}
+
+func (battle *Battle) turnOrder() []*wizard {
+	var order []*wizard
+	for _, w := range battle.wizards {
+		if w.alive() {
+			order = append(order, w)
+		}
+	}
+
+	battle.rng.Shuffle(len(order), func(i, j int) {
+		order[i], order[j] = order[j], order[i]
+	})
+	return order
+}
+
+func (battle *Battle) collectActions(order []*wizard) (map[*wizard]interpreters.Action, map[*wizard]bool) {
+	actions := make(map[*wizard]interpreters.Action, len(order))
+	failed := make(map[*wizard]bool)
+	for _, w := range order {
+		// Draw the random value even if the script does not use it,
+		// so that the sequence is unaffected by how scripts behave.
+		view := battle.view(w, battle.rng.Int63())
+
+		action, err := w.Controller.Decide(view)
+		if err != nil {
+			w.stats.Errors++
+			w.stats.LastError = err.Error()
+			action = interpreters.WaitAction()
+			failed[w] = true
+		}
+
+		actions[w] = action
+	}
+	return actions, failed
+}
+
+// view builds the read-only snapshot of the arena from the perspective of the given wizard.
+func (battle *Battle) view(self *wizard, random int64) interpreters.View {
+	view := interpreters.View{
+		Tick:      battle.tick,
+		MaxTicks:  battle.config.Rules.MaxTicks,
+		Width:     battle.config.Map.Width,
+		Height:    battle.config.Map.Height,
+		Obstacles: append([]interpreters.Position(nil), battle.config.Map.Obstacles...),
+		Self:      battle.wizardView(self),
+		Random:    random,
+	}
+
+	for _, w := range battle.wizards {
+		if w != self && w.alive() {
+			view.Opponents = append(view.Opponents, battle.wizardView(w))
+		}
+	}
+
+	for _, spell := range self.spells {
+		view.Spells = append(view.Spells, spell.view())
+	}
+
+	return view
+}
+
+func (battle *Battle) wizardView(w *wizard) interpreters.WizardView {
+	cooldowns := make(map[string]int, len(w.cooldowns))
+	for spell, ticks := range w.cooldowns {
+		cooldowns[spell] = ticks
+	}
+
+	return interpreters.WizardView{
+		ID:        w.WizardID,
+		Name:      w.Name,
+		Position:  w.position,
+		Health:    w.health,
+		MaxHealth: battle.config.Rules.MaxHealth,
+		Mana:      w.mana,
+		MaxMana:   battle.config.Rules.MaxMana,
+		Alive:     w.alive(),
+		Cooldowns: cooldowns,
+	}
+}
+
+// resolveMovement moves each wizard one square towards its target. A move
+// is blocked if the square is outside the map, contains an obstacle, or is
+// occupied by (or has already been claimed by) another wizard.
+func (battle *Battle) resolveMovement(order []*wizard, actions map[*wizard]interpreters.Action) {
+	occupied := make(map[interpreters.Position]bool, len(order))
+	for _, w := range order {
+		occupied[w.position] = true
+	}
+
+	for _, w := range order {
+		action := actions[w]
+		if action.Type != interpreters.Move {
+			continue
+		}
+
+		next, moved := step(w.position, action.Target)
+		if !moved {
+			continue
+		}
+
+		if !battle.config.Map.Contains(next) || battle.obstacles[next] || occupied[next] {
+			w.stats.Collisions++
+			continue
+		}
+
+		delete(occupied, w.position)
+		occupied[next] = true
+		w.position = next
+		w.stats.DistanceMoved++
+	}
+}
+
+// step returns the square one move closer to the target, moving along
+// whichever axis has the greater distance remaining.
+func step(from interpreters.Position, to interpreters.Position) (interpreters.Position, bool) {
+	dx, dy := to.X-from.X, to.Y-from.Y
+	if dx == 0 && dy == 0 {
+		return from, false
+	}
+
+	next := from
+	if abs(dx) >= abs(dy) {
+		next.X += sign(dx)
+	} else {
+		next.Y += sign(dy)
+	}
+	return next, true
+}
+
+// resolveCasting applies every valid cast. Effects are accumulated and
+// applied together, so wizards killed this tick still get to cast.
+func (battle *Battle) resolveCasting(order []*wizard, actions map[*wizard]interpreters.Action) {
+	changes := make(map[*wizard]int)
+
+	for _, caster := range order {
+		action := actions[caster]
+		if action.Type != interpreters.Cast {
+			continue
+		}
+
+		spell, exists := battle.spells[action.Spell]
+		if !exists || !caster.canCast(spell) || caster.cooldowns[spell.Name] > 0 || caster.mana < spell.ManaCost ||
+			interpreters.Distance(caster.position, action.Target) > spell.Range {
+			caster.stats.FailedCasts++
+			continue
+		}
+
+		caster.mana -= spell.ManaCost
+		if spell.Cooldown > 0 {
+			caster.cooldowns[spell.Name] = spell.Cooldown
+		}
+		caster.stats.SpellsCast++
+
+		for _, target := range battle.wizards {
+			if !target.alive() || !spell.affects(action.Target, target.position) {
+				continue
+			}
+
+			switch spell.Effect {
+			case Damage:
+				changes[target] -= spell.Power
+				target.stats.DamageTaken += spell.Power
+				if target != caster {
+					caster.stats.DamageDealt += spell.Power
+				}
+			case Heal:
+				changes[target] += spell.Power
+			}
+		}
+	}
+
+	// Apply the changes in participant order, so that the result does not
+	// depend on the iteration order of the map.
+	for _, w := range battle.wizards {
+		change, affected := changes[w]
+		if !affected {
+			continue
+		}
+
+		w.health = clamp(w.health+change, 0, battle.config.Rules.MaxHealth)
+		if !w.alive() {
+			w.stats.DeathTick = battle.tick
+		}
+	}
+}
+
+func (battle *Battle) regenerate() {
+	for _, w := range battle.wizards {
+		if !w.alive() {
+			continue
+		}
+
+		w.mana = clamp(w.mana+battle.config.Rules.ManaRegen, 0, battle.config.Rules.MaxMana)
+
+		for spell, ticks := range w.cooldowns {
+			if ticks <= 1 {
+				delete(w.cooldowns, spell)
+			} else {
+				w.cooldowns[spell] = ticks - 1
+			}
+		}
+	}
+}
+
+func (battle *Battle) checkFinished() *Result {
+	var survivors []*wizard
+	for _, w := range battle.wizards {
+		if w.alive() {
+			survivors = append(survivors, w)
+		}
+	}
+
+	switch {
+	case len(survivors) == 1:
+		return battle.newResult(survivors[0], LastWizardStanding)
+	case len(survivors) == 0:
+		return battle.newResult(nil, AllWizardsDefeated)
+	case battle.tick >= battle.config.Rules.MaxTicks:
+		// The wizard with the most health remaining wins, unless there is a tie
+		sort.SliceStable(survivors, func(i, j int) bool {
+			return survivors[i].health > survivors[j].health
+		})
+		if survivors[0].health == survivors[1].health {
+			return battle.newResult(nil, TickLimitReached)
+		}
+		return battle.newResult(survivors[0], TickLimitReached)
+	default:
+		return nil
+	}
+}
+
+func (battle *Battle) newResult(winner *wizard, reason EndReason) *Result {
+	result := &Result{
+		Seed:      battle.config.Seed,
+		MapName:   battle.config.Map.Name,
+		Ticks:     battle.tick,
+		EndReason: reason,
+	}
+
+	if winner != nil {
+		result.WinnerID = winner.WizardID
+	}
+
+	for _, w := range battle.wizards {
+		stats := w.stats
+		stats.Health = w.health
+		stats.Mana = w.mana
+		stats.Position = w.position
+		stats.Alive = w.alive()
+		result.Wizards = append(result.Wizards, stats)
+	}
+
+	return result
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func sign(value int) int {
+	switch {
+	case value < 0:
+		return -1
+	case value > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func clamp(value int, min int, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
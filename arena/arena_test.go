@@ -0,0 +1,218 @@
+package arena
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/crob1140/codewiz-server/interpreters"
+	_ "github.com/crob1140/codewiz-server/interpreters/lisp"
+)
+
+// testController returns the same action on every tick
+type testController struct {
+	action interpreters.Action
+}
+
+func (controller *testController) Decide(view interpreters.View) (interpreters.Action, error) {
+	return controller.action, nil
+}
+
+var testSpells = []Spell{
+	{Name: "fireball", ManaCost: 20, Cooldown: 2, Range: 6, Effect: Damage, Power: 25, Area: 1},
+	{Name: "spark", ManaCost: 5, Cooldown: 0, Range: 3, Effect: Damage, Power: 5, Area: 0},
+	{Name: "mend", ManaCost: 30, Cooldown: 5, Range: 0, Effect: Heal, Power: 20, Area: 0},
+}
+
+const testHunterScript = `
+(define (decide state)
+  (let ((self (get state 'self))
+        (target (car (get state 'opponents))))
+    (cond ((and (<= (distance self target) 6)
+                (not (has? (get self 'cooldowns) 'fireball))
+                (>= (get self 'mana) 20))
+           (cast "fireball" target))
+          ((<= (distance self target) 3) (cast "spark" target))
+          ((= (mod (get state 'random) 4) 0) (wait))
+          (else (move target)))))
+`
+
+func createTestConfig(seed int64) Config {
+	return Config{Map: DefaultMap, Spells: testSpells, Rules: DefaultRules, Seed: seed}
+}
+
+func createScriptedParticipants(t *testing.T, count int) []Participant {
+	var participants []Participant
+	for i := 1; i <= count; i++ {
+		script, err := interpreters.Compile("lisp", testHunterScript)
+		if err != nil {
+			t.Fatal(err)
+		}
+		participants = append(participants, Participant{
+			WizardID:   uint64(i),
+			Name:       "Hunter",
+			Controller: interpreters.NewSandbox(script, interpreters.DefaultLimits),
+		})
+	}
+	return participants
+}
+
+func TestBattle_Run_IsDeterministicForSeed(t *testing.T) {
+	first, err := New(createTestConfig(42), createScriptedParticipants(t, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := New(createTestConfig(42), createScriptedParticipants(t, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstResult := first.Run()
+	secondResult := second.Run()
+
+	if !reflect.DeepEqual(firstResult, secondResult) {
+		t.Fatalf("Battles with the same seed produced different results: [%v] and [%v]", firstResult, secondResult)
+	}
+
+	if firstResult.Ticks >= DefaultRules.MaxTicks {
+		t.Fatalf("Expected the hunters to finish the battle before the tick limit")
+	}
+}
+
+func TestBattle_Run_LastWizardStandingWins(t *testing.T) {
+	config := createTestConfig(1)
+	config.Map = Map{Width: 5, Height: 1, SpawnPoints: []interpreters.Position{{X: 0, Y: 0}, {X: 3, Y: 0}}}
+
+	attacker := &testController{interpreters.CastAction("spark", interpreters.Position{X: 3, Y: 0})}
+	defender := &testController{interpreters.WaitAction()}
+
+	battle, err := New(config, []Participant{
+		{WizardID: 1, Name: "Attacker", Controller: attacker},
+		{WizardID: 2, Name: "Defender", Controller: defender},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := battle.Run()
+	if result.WinnerID != 1 || result.EndReason != LastWizardStanding {
+		t.Fatalf("Expected the attacker to win by being the last wizard standing, got %+v", result)
+	}
+
+	// 100 health at 5 damage per tick
+	if result.Ticks != 20 {
+		t.Fatalf("Expected the battle to last 20 ticks, got %d", result.Ticks)
+	}
+
+	if result.Wizards[1].DeathTick != 20 || result.Wizards[0].DamageDealt != 100 {
+		t.Fatalf("Unexpected wizard statistics: %+v", result.Wizards)
+	}
+}
+
+func TestBattle_Run_DrawAtTickLimitWithEqualHealth(t *testing.T) {
+	config := createTestConfig(1)
+	config.Rules.MaxTicks = 10
+
+	battle, err := New(config, []Participant{
+		{WizardID: 1, Controller: &testController{interpreters.WaitAction()}},
+		{WizardID: 2, Controller: &testController{interpreters.WaitAction()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := battle.Run()
+	if !result.IsDraw() || result.EndReason != TickLimitReached || result.Ticks != 10 {
+		t.Fatalf("Expected a draw at the tick limit, got %+v", result)
+	}
+}
+
+func TestBattle_Step_MovesAreBlockedByObstaclesAndWizards(t *testing.T) {
+	config := createTestConfig(1)
+	config.Map = Map{
+		Width:       3,
+		Height:      1,
+		Obstacles:   []interpreters.Position{{X: 1, Y: 0}},
+		SpawnPoints: []interpreters.Position{{X: 0, Y: 0}, {X: 2, Y: 0}},
+	}
+
+	battle, err := New(config, []Participant{
+		{WizardID: 1, Controller: &testController{interpreters.MoveAction(interpreters.Position{X: 2, Y: 0})}},
+		{WizardID: 2, Controller: &testController{interpreters.MoveAction(interpreters.Position{X: 5, Y: 0})}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	battle.Step()
+	battle.Step()
+
+	for _, w := range battle.wizards {
+		if w.stats.DistanceMoved != 0 || w.stats.Collisions != 2 {
+			t.Fatalf("Expected wizard %d to be blocked on both ticks, got %+v", w.WizardID, w.stats)
+		}
+	}
+}
+
+func TestBattle_Step_CastingRequiresManaAndCooldown(t *testing.T) {
+	config := createTestConfig(1)
+	config.Rules.ManaRegen = 0
+	config.Map = Map{Width: 5, Height: 1, SpawnPoints: []interpreters.Position{{X: 0, Y: 0}, {X: 4, Y: 0}}}
+
+	battle, err := New(config, []Participant{
+		{WizardID: 1, Controller: &testController{interpreters.CastAction("fireball", interpreters.Position{X: 4, Y: 0})}},
+		{WizardID: 2, Controller: &testController{interpreters.WaitAction()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tick 1 casts, tick 2 is on cooldown, tick 3 casts again
+	for i := 0; i < 3; i++ {
+		battle.Step()
+	}
+
+	caster := battle.wizards[0]
+	if caster.stats.SpellsCast != 2 || caster.stats.FailedCasts != 1 || caster.mana != 60 {
+		t.Fatalf("Unexpected caster state: mana %d, stats %+v", caster.mana, caster.stats)
+	}
+
+	if battle.wizards[1].health != 50 {
+		t.Fatalf("Expected the target to have taken two fireballs, got health %d", battle.wizards[1].health)
+	}
+}
+
+func TestBattle_Step_OnlyEquippedSpellsCanBeCast(t *testing.T) {
+	config := createTestConfig(1)
+	config.Map = Map{Width: 5, Height: 1, SpawnPoints: []interpreters.Position{{X: 0, Y: 0}, {X: 3, Y: 0}}}
+
+	battle, err := New(config, []Participant{
+		{WizardID: 1, Spells: []string{"fireball"}, Controller: &testController{interpreters.CastAction("spark", interpreters.Position{X: 3, Y: 0})}},
+		{WizardID: 2, Controller: &testController{interpreters.WaitAction()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	battle.Step()
+
+	if battle.wizards[0].stats.FailedCasts != 1 || battle.wizards[1].health != DefaultRules.MaxHealth {
+		t.Fatalf("Expected the unequipped spell to fail, got %+v", battle.wizards[0].stats)
+	}
+}
+
+func TestNew_RejectsInvalidConfiguration(t *testing.T) {
+	participant := Participant{WizardID: 1, Controller: &testController{}}
+	if _, err := New(createTestConfig(1), []Participant{participant}); err != ErrTooFewWizards {
+		t.Fatalf("Expected ErrTooFewWizards, got %v", err)
+	}
+
+	if _, err := New(createTestConfig(1), []Participant{participant, participant}); err != ErrDuplicateWizard {
+		t.Fatalf("Expected ErrDuplicateWizard, got %v", err)
+	}
+
+	unknownSpell := Participant{WizardID: 2, Spells: []string{"teleport"}, Controller: &testController{}}
+	if _, err := New(createTestConfig(1), []Participant{participant, unknownSpell}); err != ErrUnknownSpell {
+		t.Fatalf("Expected ErrUnknownSpell, got %v", err)
+	}
+}
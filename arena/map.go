@@ -0,0 +1,76 @@
+package arena
+
+import (
+	"errors"
+
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+var (
+	ErrInvalidMapSize     = errors.New("The map must have a positive width and height.")
+	ErrTooFewSpawnPoints  = errors.New("The map does not have a spawn point for every wizard.")
+	ErrInvalidSpawnPoint  = errors.New("Every spawn point must be an unobstructed square inside the map.")
+	ErrObstacleOutOfRange = errors.New("Every obstacle must be inside the map.")
+)
+
+// Map describes the layout of an arena.
+type Map struct {
+	Name        string
+	Width       int
+	Height      int
+	Obstacles   []interpreters.Position
+	SpawnPoints []interpreters.Position
+}
+
+// DefaultMap is a small open arena with a few pillars for cover,
+// and spawn points in each corner.
+var DefaultMap = Map{
+	Name:   "pillars",
+	Width:  16,
+	Height: 16,
+	Obstacles: []interpreters.Position{
+		{X: 5, Y: 5}, {X: 10, Y: 5},
+		{X: 5, Y: 10}, {X: 10, Y: 10},
+	},
+	SpawnPoints: []interpreters.Position{
+		{X: 0, Y: 0}, {X: 15, Y: 15},
+		{X: 15, Y: 0}, {X: 0, Y: 15},
+	},
+}
+
+func (m *Map) Contains(position interpreters.Position) bool {
+	return position.X >= 0 && position.X < m.Width && position.Y >= 0 && position.Y < m.Height
+}
+
+func (m *Map) validate(wizardCount int) error {
+	if m.Width <= 0 || m.Height <= 0 {
+		return ErrInvalidMapSize
+	}
+
+	if len(m.SpawnPoints) < wizardCount {
+		return ErrTooFewSpawnPoints
+	}
+
+	obstacles := m.obstacleSet()
+	for _, obstacle := range m.Obstacles {
+		if !m.Contains(obstacle) {
+			return ErrObstacleOutOfRange
+		}
+	}
+
+	for _, spawnPoint := range m.SpawnPoints[:wizardCount] {
+		if !m.Contains(spawnPoint) || obstacles[spawnPoint] {
+			return ErrInvalidSpawnPoint
+		}
+	}
+
+	return nil
+}
+
+func (m *Map) obstacleSet() map[interpreters.Position]bool {
+	obstacles := make(map[interpreters.Position]bool, len(m.Obstacles))
+	for _, obstacle := range m.Obstacles {
+		obstacles[obstacle] = true
+	}
+	return obstacles
+}
@@ -0,0 +1,115 @@
+package arena
+
+import (
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+// Observer is notified as a battle progresses, so that it can be recorded
+// or broadcast without the battle engine knowing about either.
+//
+// The states passed to an observer are copies, and remain valid after the
+// observer returns.
+type Observer interface {
+	// BattleStarted is called once, before the first tick is simulated.
+	BattleStarted(config Config, state State)
+
+	// TickResolved is called after every tick with the action each living
+	// wizard chose and the state at the end of the tick.
+	TickResolved(state State, actions []TakenAction)
+
+	// BattleFinished is called once, after the final tick has been resolved.
+	BattleFinished(result *Result)
+}
+
+// State is a snapshot of every wizard in a battle, in participant order.
+type State struct {
+	Tick    int
+	Wizards []WizardState
+}
+
+type WizardState struct {
+	WizardID  uint64
+	Name      string
+	Position  interpreters.Position
+	Health    int
+	Mana      int
+	Cooldowns map[string]int // spells that are ready are omitted
+}
+
+func (state *WizardState) Alive() bool {
+	return state.Health > 0
+}
+
+// TakenAction is the action a wizard chose on a tick. Failed is set if the
+// script could not decide, in which case the wizard waited instead.
+type TakenAction struct {
+	WizardID uint64
+	Action   interpreters.Action
+	Failed   bool
+}
+
+// Observe registers an observer for the battle. Observers must be
+// registered before the first tick is simulated.
+func (battle *Battle) Observe(observer Observer) {
+	battle.observers = append(battle.observers, observer)
+}
+
+// State returns a snapshot of the wizards at the end of the latest tick.
+func (battle *Battle) State() State {
+	state := State{Tick: battle.tick, Wizards: make([]WizardState, len(battle.wizards))}
+	for i, w := range battle.wizards {
+		cooldowns := make(map[string]int, len(w.cooldowns))
+		for spell, ticks := range w.cooldowns {
+			cooldowns[spell] = ticks
+		}
+
+		state.Wizards[i] = WizardState{
+			WizardID:  w.WizardID,
+			Name:      w.Name,
+			Position:  w.position,
+			Health:    w.health,
+			Mana:      w.mana,
+			Cooldowns: cooldowns,
+		}
+	}
+	return state
+}
+
+func (battle *Battle) notifyStarted() {
+	if len(battle.observers) == 0 {
+		return
+	}
+
+	state := battle.State()
+	for _, observer := range battle.observers {
+		observer.BattleStarted(battle.config, state)
+	}
+}
+
+func (battle *Battle) notifyTick(actions map[*wizard]interpreters.Action, failed map[*wizard]bool) {
+	if len(battle.observers) == 0 {
+		return
+	}
+
+	// Report the actions in participant order rather than turn order,
+	// so that observers see a stable layout from tick to tick.
+	var taken []TakenAction
+	for _, w := range battle.wizards {
+		action, acted := actions[w]
+		if !acted {
+			continue
+		}
+		taken = append(taken, TakenAction{WizardID: w.WizardID, Action: action, Failed: failed[w]})
+	}
+
+	state := battle.State()
+	for _, observer := range battle.observers {
+		observer.TickResolved(state, taken)
+	}
+
+	if battle.result != nil {
+		for _, observer := range battle.observers {
+			observer.BattleFinished(battle.result)
+		}
+	}
+}
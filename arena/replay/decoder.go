@@ -0,0 +1,339 @@
+package replay
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+
+	"github.com/crob1140/codewiz-server/arena"
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+// Limits on the sizes read from a replay, so that corrupt input fails
+// cleanly instead of exhausting memory.
+const (
+	maxSpells  = 1024
+	maxWizards = 1024
+)
+
+// frame holds the decoded contents of a single tick. Keyframes have a
+// snapshot of every wizard, and other frames only have the changes.
+type frame struct {
+	tick     int
+	actions  []arena.TakenAction
+	snapshot []arena.WizardState
+	deltas   []wizardDelta
+}
+
+type wizardDelta struct {
+	index     int
+	mask      byte
+	position  interpreters.Position
+	health    int
+	mana      int
+	cooldowns map[string]int
+}
+
+// Decoder steps through a replay. It starts positioned at tick zero,
+// before any wizard has acted.
+type Decoder struct {
+	header  Header
+	outcome Outcome
+	frames  []frame
+	tick    int
+	wizards []arena.WizardState
+}
+
+// NewDecoder reads a complete replay from the reader.
+func NewDecoder(reader io.Reader) (*Decoder, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(reader, prefix[:]); err != nil {
+		return nil, ErrInvalidReplay
+	}
+
+	if [4]byte{prefix[0], prefix[1], prefix[2], prefix[3]} != magic {
+		return nil, ErrInvalidReplay
+	}
+
+	if prefix[4] != FormatVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	body, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, ErrInvalidReplay
+	}
+	defer body.Close()
+
+	d := &decoder{r: bufio.NewReader(body)}
+	decoder := &Decoder{header: Header{Version: FormatVersion}}
+	decoder.readHeader(d)
+
+	initial := frame{snapshot: decoder.readSnapshot(d)}
+	decoder.frames = append(decoder.frames, initial)
+
+	for d.err == nil {
+		kind := d.byte()
+		if kind == frameEnd {
+			decoder.outcome = Outcome{
+				Ticks:     int(d.uvarint()),
+				WinnerID:  d.uvarint(),
+				EndReason: d.string(),
+			}
+			break
+		}
+
+		if kind != frameKeyframe && kind != frameDelta {
+			d.fail(ErrInvalidReplay)
+			break
+		}
+
+		f := frame{tick: int(d.uvarint())}
+		if f.tick != len(decoder.frames) {
+			d.fail(ErrInvalidReplay)
+			break
+		}
+
+		f.actions = decoder.readActions(d)
+		if kind == frameKeyframe {
+			f.snapshot = decoder.readSnapshot(d)
+		} else {
+			f.deltas = decoder.readDelta(d)
+		}
+		decoder.frames = append(decoder.frames, f)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	decoder.wizards = copyWizards(initial.snapshot)
+	return decoder, nil
+}
+
+func (decoder *Decoder) Header() Header {
+	return decoder.header
+}
+
+func (decoder *Decoder) Outcome() Outcome {
+	return decoder.outcome
+}
+
+// Ticks returns the number of the last tick in the replay.
+func (decoder *Decoder) Ticks() int {
+	return len(decoder.frames) - 1
+}
+
+// Tick returns the tick the decoder is positioned at.
+func (decoder *Decoder) Tick() int {
+	return decoder.tick
+}
+
+// State returns the state of the wizards at the end of the current tick.
+func (decoder *Decoder) State() arena.State {
+	return arena.State{Tick: decoder.tick, Wizards: copyWizards(decoder.wizards)}
+}
+
+// Actions returns the actions that were taken during the current tick.
+func (decoder *Decoder) Actions() []arena.TakenAction {
+	return append([]arena.TakenAction(nil), decoder.frames[decoder.tick].actions...)
+}
+
+// StepForward moves to the next tick, and reports false if the decoder is
+// already at the end of the replay.
+func (decoder *Decoder) StepForward() bool {
+	if decoder.tick >= decoder.Ticks() {
+		return false
+	}
+
+	decoder.tick++
+	decoder.apply(decoder.frames[decoder.tick])
+	return true
+}
+
+// StepBackward moves to the previous tick, and reports false if the
+// decoder is already at the start of the replay.
+func (decoder *Decoder) StepBackward() bool {
+	if decoder.tick == 0 {
+		return false
+	}
+
+	decoder.Seek(decoder.tick - 1)
+	return true
+}
+
+// Seek moves to the given tick by starting from the closest keyframe
+// before it and applying the changes recorded since.
+func (decoder *Decoder) Seek(tick int) error {
+	if tick < 0 || tick > decoder.Ticks() {
+		return ErrTickOutOfRange
+	}
+
+	keyframe := tick
+	for decoder.frames[keyframe].snapshot == nil {
+		keyframe--
+	}
+
+	decoder.tick = keyframe
+	decoder.apply(decoder.frames[keyframe])
+	for decoder.tick < tick {
+		decoder.tick++
+		decoder.apply(decoder.frames[decoder.tick])
+	}
+
+	return nil
+}
+
+func (decoder *Decoder) apply(f frame) {
+	if f.snapshot != nil {
+		decoder.wizards = copyWizards(f.snapshot)
+		return
+	}
+
+	for _, delta := range f.deltas {
+		w := &decoder.wizards[delta.index]
+		if delta.mask&changedPosition != 0 {
+			w.Position = delta.position
+		}
+		if delta.mask&changedHealth != 0 {
+			w.Health = delta.health
+		}
+		if delta.mask&changedMana != 0 {
+			w.Mana = delta.mana
+		}
+		if delta.mask&changedCooldowns != 0 {
+			w.Cooldowns = delta.cooldowns
+		}
+	}
+}
+
+func (decoder *Decoder) readHeader(d *decoder) {
+	header := &decoder.header
+
+	// The keyframe interval is recorded so that it can be changed in future
+	// versions, but the decoder finds keyframes by their frame type instead.
+	d.uvarint()
+
+	header.Seed = d.varint()
+	header.MapName = d.string()
+	header.Width = d.int()
+	header.Height = d.int()
+	header.MaxTicks = d.int()
+	header.MaxHealth = d.int()
+	header.MaxMana = d.int()
+
+	spellCount := d.count(maxSpells)
+	for i := 0; i < spellCount; i++ {
+		header.Spells = append(header.Spells, d.string())
+	}
+
+	wizardCount := d.count(maxWizards)
+	for i := 0; i < wizardCount; i++ {
+		id := d.uvarint()
+		name := d.string()
+		header.Wizards = append(header.Wizards, WizardInfo{WizardID: id, Name: name})
+	}
+}
+
+func (decoder *Decoder) readActions(d *decoder) []arena.TakenAction {
+	count := d.count(len(decoder.header.Wizards))
+	actions := make([]arena.TakenAction, 0, count)
+
+	for i := 0; i < count && d.err == nil; i++ {
+		index := d.count(len(decoder.header.Wizards) - 1)
+		flags := d.byte()
+
+		taken := arena.TakenAction{
+			WizardID: decoder.header.Wizards[index].WizardID,
+			Failed:   flags&failedActionFlag != 0,
+		}
+
+		switch interpreters.ActionType(flags &^ failedActionFlag) {
+		case interpreters.Wait:
+			taken.Action = interpreters.WaitAction()
+		case interpreters.Move:
+			taken.Action = interpreters.MoveAction(d.position())
+		case interpreters.Cast:
+			spell := decoder.readSpellReference(d)
+			taken.Action = interpreters.CastAction(spell, d.position())
+		default:
+			d.fail(ErrInvalidReplay)
+		}
+
+		actions = append(actions, taken)
+	}
+
+	return actions
+}
+
+func (decoder *Decoder) readSpellReference(d *decoder) string {
+	reference := d.count(len(decoder.header.Spells))
+	if reference == 0 {
+		return d.string()
+	}
+	return decoder.header.Spells[reference-1]
+}
+
+func (decoder *Decoder) readSnapshot(d *decoder) []arena.WizardState {
+	wizards := make([]arena.WizardState, len(decoder.header.Wizards))
+	for i, info := range decoder.header.Wizards {
+		wizards[i] = arena.WizardState{
+			WizardID:  info.WizardID,
+			Name:      info.Name,
+			Position:  d.position(),
+			Health:    d.int(),
+			Mana:      d.int(),
+			Cooldowns: decoder.readCooldowns(d),
+		}
+	}
+	return wizards
+}
+
+func (decoder *Decoder) readDelta(d *decoder) []wizardDelta {
+	count := d.count(len(decoder.header.Wizards))
+	deltas := make([]wizardDelta, 0, count)
+
+	for i := 0; i < count && d.err == nil; i++ {
+		delta := wizardDelta{index: d.count(len(decoder.header.Wizards) - 1), mask: d.byte()}
+		if delta.mask&changedPosition != 0 {
+			delta.position = d.position()
+		}
+		if delta.mask&changedHealth != 0 {
+			delta.health = d.int()
+		}
+		if delta.mask&changedMana != 0 {
+			delta.mana = d.int()
+		}
+		if delta.mask&changedCooldowns != 0 {
+			delta.cooldowns = decoder.readCooldowns(d)
+		}
+		deltas = append(deltas, delta)
+	}
+
+	return deltas
+}
+
+func (decoder *Decoder) readCooldowns(d *decoder) map[string]int {
+	count := d.count(len(decoder.header.Spells))
+	cooldowns := make(map[string]int, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		index := d.count(len(decoder.header.Spells) - 1)
+		ticks := d.int()
+		if d.err == nil {
+			cooldowns[decoder.header.Spells[index]] = ticks
+		}
+	}
+	return cooldowns
+}
+
+func copyWizards(wizards []arena.WizardState) []arena.WizardState {
+	copied := make([]arena.WizardState, len(wizards))
+	for i, w := range wizards {
+		copied[i] = w
+		copied[i].Cooldowns = make(map[string]int, len(w.Cooldowns))
+		for spell, ticks := range w.Cooldowns {
+			copied[i].Cooldowns[spell] = ticks
+		}
+	}
+	return copied
+}
@@ -0,0 +1,217 @@
+// Package replay records battles into a compact binary format, and
+// decodes them again so that a battle can be stepped through tick by tick.
+//
+// A replay starts with an uncompressed header made up of the magic bytes
+// "CWRP" and a format version. The rest of the file is gzip-compressed and
+// holds the battle settings, a full snapshot of the starting state, and
+// then one frame per tick. Every frame records the actions the wizards
+// chose; most frames then only record the fields that changed during the
+// tick, but every KeyframeInterval ticks a full snapshot is written so that
+// a decoder can seek without replaying the whole battle. The file ends with
+// a frame holding the outcome of the battle.
+//
+// Integers are written as varints, and strings as a length followed by
+// their bytes.
+package replay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+// FormatVersion is the version of the replay format written by this package.
+const FormatVersion = 1
+
+// KeyframeInterval is the number of ticks between full snapshots.
+const KeyframeInterval = 50
+
+var magic = [4]byte{'C', 'W', 'R', 'P'}
+
+var (
+	ErrInvalidReplay      = errors.New("The data is not a valid replay.")
+	ErrUnsupportedVersion = errors.New("The replay was written in an unsupported format version.")
+	ErrNotFinished        = errors.New("The battle has not finished, so the replay is incomplete.")
+	ErrTickOutOfRange     = errors.New("The replay does not contain the requested tick.")
+)
+
+const (
+	frameKeyframe byte = iota + 1
+	frameDelta
+	frameEnd
+)
+
+// Bits of the mask written before each wizard in a delta frame.
+const (
+	changedPosition byte = 1 << iota
+	changedHealth
+	changedMana
+	changedCooldowns
+)
+
+// failedActionFlag is combined with the action type when the wizard's
+// script failed to decide.
+const failedActionFlag byte = 0x80
+
+// maxStringLength guards against allocating huge buffers for corrupt input.
+const maxStringLength = 1 << 16
+
+// Header describes the battle a replay was recorded from.
+type Header struct {
+	Version   int
+	Seed      int64
+	MapName   string
+	Width     int
+	Height    int
+	MaxTicks  int
+	MaxHealth int
+	MaxMana   int
+	Spells    []string
+	Wizards   []WizardInfo
+}
+
+type WizardInfo struct {
+	WizardID uint64
+	Name     string
+}
+
+// Outcome is how the recorded battle ended.
+type Outcome struct {
+	Ticks     int
+	WinnerID  uint64 // zero if the battle was a draw
+	EndReason string
+}
+
+// --------------------
+// - Primitive writing
+// --------------------
+
+// encoder writes the primitive values of the format, and remembers the first error.
+type encoder struct {
+	w       io.Writer
+	scratch [binary.MaxVarintLen64]byte
+	err     error
+}
+
+func (e *encoder) write(data []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(data)
+	}
+}
+
+func (e *encoder) byte(value byte) {
+	e.write([]byte{value})
+}
+
+func (e *encoder) uvarint(value uint64) {
+	n := binary.PutUvarint(e.scratch[:], value)
+	e.write(e.scratch[:n])
+}
+
+func (e *encoder) varint(value int64) {
+	n := binary.PutVarint(e.scratch[:], value)
+	e.write(e.scratch[:n])
+}
+
+func (e *encoder) int(value int) {
+	e.varint(int64(value))
+}
+
+func (e *encoder) string(value string) {
+	e.uvarint(uint64(len(value)))
+	e.write([]byte(value))
+}
+
+func (e *encoder) position(position interpreters.Position) {
+	e.int(position.X)
+	e.int(position.Y)
+}
+
+// --------------------
+// - Primitive reading
+// --------------------
+
+// decoder reads the primitive values of the format, and remembers the first error.
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrInvalidReplay
+		}
+		d.err = err
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	value, err := d.r.ReadByte()
+	if err != nil {
+		d.fail(err)
+	}
+	return value
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	value, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return value
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	value, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return value
+}
+
+func (d *decoder) int() int {
+	return int(d.varint())
+}
+
+// count reads a length, rejecting values that could not possibly be valid.
+func (d *decoder) count(max int) int {
+	value := d.uvarint()
+	if value > uint64(max) {
+		d.fail(ErrInvalidReplay)
+		return 0
+	}
+	return int(value)
+}
+
+func (d *decoder) string() string {
+	length := d.count(maxStringLength)
+	if d.err != nil || length == 0 {
+		return ""
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		d.fail(err)
+		return ""
+	}
+	return string(data)
+}
+
+func (d *decoder) position() interpreters.Position {
+	x := d.int()
+	y := d.int()
+	return interpreters.Position{X: x, Y: y}
+}
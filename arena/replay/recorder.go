@@ -0,0 +1,243 @@
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sort"
+
+	"github.com/crob1140/codewiz-server/arena"
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+// Recorder is an arena.Observer that encodes the battle it observes into
+// a replay. Register it with Battle.Observe before the battle is run.
+type Recorder struct {
+	buffer   bytes.Buffer
+	gzip     *gzip.Writer
+	encoder  *encoder
+	spells   map[string]int
+	previous arena.State
+	finished bool
+}
+
+func NewRecorder() *Recorder {
+	recorder := &Recorder{}
+	recorder.buffer.Write(magic[:])
+	recorder.buffer.WriteByte(FormatVersion)
+	recorder.gzip = gzip.NewWriter(&recorder.buffer)
+	recorder.encoder = &encoder{w: recorder.gzip}
+	return recorder
+}
+
+// Bytes returns the encoded replay. It fails if the battle has not finished.
+func (recorder *Recorder) Bytes() ([]byte, error) {
+	if recorder.encoder.err != nil {
+		return nil, recorder.encoder.err
+	}
+	if !recorder.finished {
+		return nil, ErrNotFinished
+	}
+	return recorder.buffer.Bytes(), nil
+}
+
+func (recorder *Recorder) BattleStarted(config arena.Config, state arena.State) {
+	e := recorder.encoder
+
+	e.uvarint(KeyframeInterval)
+	e.varint(config.Seed)
+	e.string(config.Map.Name)
+	e.int(config.Map.Width)
+	e.int(config.Map.Height)
+	e.int(config.Rules.MaxTicks)
+	e.int(config.Rules.MaxHealth)
+	e.int(config.Rules.MaxMana)
+
+	// Spells are referred to by their index in the rest of the replay
+	recorder.spells = make(map[string]int, len(config.Spells))
+	e.uvarint(uint64(len(config.Spells)))
+	for i, spell := range config.Spells {
+		recorder.spells[spell.Name] = i
+		e.string(spell.Name)
+	}
+
+	e.uvarint(uint64(len(state.Wizards)))
+	for _, w := range state.Wizards {
+		e.uvarint(w.WizardID)
+		e.string(w.Name)
+	}
+
+	recorder.writeSnapshot(state)
+	recorder.previous = state
+}
+
+func (recorder *Recorder) TickResolved(state arena.State, actions []arena.TakenAction) {
+	e := recorder.encoder
+
+	keyframe := state.Tick%KeyframeInterval == 0
+	if keyframe {
+		e.byte(frameKeyframe)
+	} else {
+		e.byte(frameDelta)
+	}
+	e.uvarint(uint64(state.Tick))
+
+	e.uvarint(uint64(len(actions)))
+	for _, taken := range actions {
+		recorder.writeAction(state, taken)
+	}
+
+	if keyframe {
+		recorder.writeSnapshot(state)
+	} else {
+		recorder.writeDelta(state)
+	}
+	recorder.previous = state
+}
+
+func (recorder *Recorder) BattleFinished(result *arena.Result) {
+	e := recorder.encoder
+	e.byte(frameEnd)
+	e.uvarint(uint64(result.Ticks))
+	e.uvarint(result.WinnerID)
+	e.string(string(result.EndReason))
+
+	if err := recorder.gzip.Close(); err != nil && e.err == nil {
+		e.err = err
+	}
+	recorder.finished = true
+}
+
+func (recorder *Recorder) writeAction(state arena.State, taken arena.TakenAction) {
+	e := recorder.encoder
+
+	e.uvarint(uint64(wizardIndex(state, taken.WizardID)))
+
+	actionType := byte(taken.Action.Type)
+	if taken.Failed {
+		actionType |= failedActionFlag
+	}
+	e.byte(actionType)
+
+	switch taken.Action.Type {
+	case interpreters.Cast:
+		// Scripts can ask for spells that do not exist, so unknown
+		// names are written out in full after a zero reference.
+		if index, exists := recorder.spells[taken.Action.Spell]; exists {
+			e.uvarint(uint64(index + 1))
+		} else {
+			e.uvarint(0)
+			e.string(taken.Action.Spell)
+		}
+		e.position(taken.Action.Target)
+	case interpreters.Move:
+		e.position(taken.Action.Target)
+	}
+}
+
+func (recorder *Recorder) writeSnapshot(state arena.State) {
+	e := recorder.encoder
+	for _, w := range state.Wizards {
+		e.position(w.Position)
+		e.int(w.Health)
+		e.int(w.Mana)
+		recorder.writeCooldowns(w.Cooldowns)
+	}
+}
+
+func (recorder *Recorder) writeDelta(state arena.State) {
+	e := recorder.encoder
+
+	masks := make([]byte, len(state.Wizards))
+	changed := 0
+	for i, w := range state.Wizards {
+		masks[i] = changes(recorder.previous.Wizards[i], w)
+		if masks[i] != 0 {
+			changed++
+		}
+	}
+
+	e.uvarint(uint64(changed))
+	for i, w := range state.Wizards {
+		mask := masks[i]
+		if mask == 0 {
+			continue
+		}
+
+		e.uvarint(uint64(i))
+		e.byte(mask)
+		if mask&changedPosition != 0 {
+			e.position(w.Position)
+		}
+		if mask&changedHealth != 0 {
+			e.int(w.Health)
+		}
+		if mask&changedMana != 0 {
+			e.int(w.Mana)
+		}
+		if mask&changedCooldowns != 0 {
+			recorder.writeCooldowns(w.Cooldowns)
+		}
+	}
+}
+
+// writeCooldowns writes the cooldowns sorted by spell index, so that the
+// same battle always produces the same bytes.
+func (recorder *Recorder) writeCooldowns(cooldowns map[string]int) {
+	e := recorder.encoder
+
+	indexes := make([]int, 0, len(cooldowns))
+	ticks := make(map[int]int, len(cooldowns))
+	for spell, remaining := range cooldowns {
+		index, exists := recorder.spells[spell]
+		if !exists {
+			continue
+		}
+		indexes = append(indexes, index)
+		ticks[index] = remaining
+	}
+	sort.Ints(indexes)
+
+	e.uvarint(uint64(len(indexes)))
+	for _, index := range indexes {
+		e.uvarint(uint64(index))
+		e.int(ticks[index])
+	}
+}
+
+func changes(previous arena.WizardState, current arena.WizardState) byte {
+	var mask byte
+	if previous.Position != current.Position {
+		mask |= changedPosition
+	}
+	if previous.Health != current.Health {
+		mask |= changedHealth
+	}
+	if previous.Mana != current.Mana {
+		mask |= changedMana
+	}
+	if !equalCooldowns(previous.Cooldowns, current.Cooldowns) {
+		mask |= changedCooldowns
+	}
+	return mask
+}
+
+func equalCooldowns(a map[string]int, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for spell, ticks := range a {
+		if remaining, exists := b[spell]; !exists || remaining != ticks {
+			return false
+		}
+	}
+	return true
+}
+
+func wizardIndex(state arena.State, wizardID uint64) int {
+	for i, w := range state.Wizards {
+		if w.WizardID == wizardID {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,176 @@
+package replay
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/crob1140/codewiz-server/arena"
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+// wanderer moves towards a fixed corner, and casts at its target whenever it can
+type wanderer struct {
+	target interpreters.Position
+}
+
+func (controller *wanderer) Decide(view interpreters.View) (interpreters.Action, error) {
+	for _, opponent := range view.Opponents {
+		if interpreters.Distance(view.Self.Position, opponent.Position) <= 3 {
+			return interpreters.CastAction("spark", opponent.Position), nil
+		}
+	}
+	if view.Tick%7 == 0 {
+		return interpreters.CastAction("unknown", view.Self.Position), nil
+	}
+	return interpreters.MoveAction(controller.target), nil
+}
+
+// stateCollector records every state the battle reports, for comparison with the decoder.
+type stateCollector struct {
+	states  []arena.State
+	actions [][]arena.TakenAction
+}
+
+func (collector *stateCollector) BattleStarted(config arena.Config, state arena.State) {
+	collector.states = append(collector.states, state)
+	collector.actions = append(collector.actions, nil)
+}
+
+func (collector *stateCollector) TickResolved(state arena.State, actions []arena.TakenAction) {
+	collector.states = append(collector.states, state)
+	collector.actions = append(collector.actions, actions)
+}
+
+func (collector *stateCollector) BattleFinished(result *arena.Result) {}
+
+func recordTestBattle(t *testing.T) ([]byte, *stateCollector, *arena.Result) {
+	config := arena.Config{
+		Map: arena.DefaultMap,
+		Spells: []arena.Spell{
+			{Name: "spark", ManaCost: 10, Cooldown: 2, Range: 3, Effect: arena.Damage, Power: 4},
+		},
+		Rules: arena.DefaultRules,
+		Seed:  7,
+	}
+
+	battle, err := arena.New(config, []arena.Participant{
+		{WizardID: 10, Name: "North", Controller: &wanderer{interpreters.Position{X: 15, Y: 15}}},
+		{WizardID: 20, Name: "South", Controller: &wanderer{interpreters.Position{X: 0, Y: 0}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := NewRecorder()
+	collector := &stateCollector{}
+	battle.Observe(recorder)
+	battle.Observe(collector)
+
+	if _, err := recorder.Bytes(); err != ErrNotFinished {
+		t.Fatalf("Expected ErrNotFinished before the battle has run, got %v", err)
+	}
+
+	result := battle.Run()
+
+	data, err := recorder.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, collector, result
+}
+
+func TestDecoder_StepForwardMatchesBattle(t *testing.T) {
+	data, collector, result := recordTestBattle(t)
+	if result.Ticks <= KeyframeInterval {
+		t.Fatalf("Expected the battle to outlast a keyframe interval, got %d ticks", result.Ticks)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoder.Ticks() != result.Ticks {
+		t.Fatalf("Expected %d ticks, got %d", result.Ticks, decoder.Ticks())
+	}
+
+	outcome := decoder.Outcome()
+	if outcome.WinnerID != result.WinnerID || outcome.EndReason != string(result.EndReason) {
+		t.Fatalf("Unexpected outcome %+v for result %+v", outcome, result)
+	}
+
+	header := decoder.Header()
+	if header.Seed != 7 || header.MapName != "pillars" || len(header.Wizards) != 2 || header.Wizards[1].Name != "South" {
+		t.Fatalf("Unexpected header %+v", header)
+	}
+
+	for tick := 0; ; tick++ {
+		if !reflect.DeepEqual(decoder.State(), collector.states[tick]) {
+			t.Fatalf("State at tick %d differs: got %+v want %+v", tick, decoder.State(), collector.states[tick])
+		}
+		if tick > 0 && !reflect.DeepEqual(decoder.Actions(), collector.actions[tick]) {
+			t.Fatalf("Actions at tick %d differ: got %+v want %+v", tick, decoder.Actions(), collector.actions[tick])
+		}
+		if !decoder.StepForward() {
+			break
+		}
+	}
+}
+
+func TestDecoder_SeekAndStepBackward(t *testing.T) {
+	data, collector, result := recordTestBattle(t)
+
+	decoder, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := decoder.Seek(result.Ticks); err != nil {
+		t.Fatal(err)
+	}
+
+	for tick := result.Ticks; tick > 0; tick-- {
+		if !reflect.DeepEqual(decoder.State(), collector.states[tick]) {
+			t.Fatalf("State at tick %d differs after stepping backward", tick)
+		}
+		if !decoder.StepBackward() {
+			t.Fatalf("Expected to step backward from tick %d", tick)
+		}
+	}
+
+	if decoder.StepBackward() {
+		t.Fatalf("Expected stepping backward from tick zero to fail")
+	}
+
+	if err := decoder.Seek(result.Ticks + 1); err != ErrTickOutOfRange {
+		t.Fatalf("Expected ErrTickOutOfRange, got %v", err)
+	}
+}
+
+func TestRecorder_IsDeterministic(t *testing.T) {
+	first, _, _ := recordTestBattle(t)
+	second, _, _ := recordTestBattle(t)
+
+	if !bytes.Equal(first, second) {
+		t.Fatalf("Recording the same battle twice produced different replays")
+	}
+}
+
+func TestNewDecoder_RejectsInvalidData(t *testing.T) {
+	data, _, _ := recordTestBattle(t)
+
+	if _, err := NewDecoder(bytes.NewReader([]byte("not a replay"))); err != ErrInvalidReplay {
+		t.Fatalf("Expected ErrInvalidReplay, got %v", err)
+	}
+
+	future := append([]byte(nil), data...)
+	future[4] = FormatVersion + 1
+	if _, err := NewDecoder(bytes.NewReader(future)); err != ErrUnsupportedVersion {
+		t.Fatalf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+
+	if _, err := NewDecoder(bytes.NewReader(data[:len(data)/2])); err == nil {
+		t.Fatalf("Expected a truncated replay to be rejected")
+	}
+}
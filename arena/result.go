@@ -0,0 +1,49 @@
+package arena
+
+import (
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+type EndReason string
+
+const (
+	LastWizardStanding EndReason = "last-wizard-standing"
+	AllWizardsDefeated EndReason = "all-wizards-defeated"
+	TickLimitReached   EndReason = "tick-limit-reached"
+)
+
+// Result is the outcome of a finished battle.
+type Result struct {
+	Seed      int64          `json:"seed"`
+	MapName   string         `json:"map"`
+	Ticks     int            `json:"ticks"`
+	WinnerID  uint64         `json:"winnerId"` // zero if the battle was a draw
+	EndReason EndReason      `json:"endReason"`
+	Wizards   []WizardResult `json:"wizards"`
+}
+
+func (result *Result) IsDraw() bool {
+	return result.WinnerID == 0
+}
+
+// WizardResult holds the final state and statistics of a single wizard.
+type WizardResult struct {
+	WizardID      uint64                `json:"wizardId"`
+	Name          string                `json:"name"`
+	Alive         bool                  `json:"alive"`
+	Health        int                   `json:"health"`
+	Mana          int                   `json:"mana"`
+	Position      interpreters.Position `json:"position"`
+	DeathTick     int                   `json:"deathTick,omitempty"`
+	DamageDealt   int                   `json:"damageDealt"`
+	DamageTaken   int                   `json:"damageTaken"`
+	SpellsCast    int                   `json:"spellsCast"`
+	FailedCasts   int                   `json:"failedCasts"`
+	DistanceMoved int                   `json:"distanceMoved"`
+	Collisions    int                   `json:"collisions"`
+
+	// Errors counts the ticks on which the wizard's script failed to
+	// decide, in which case the wizard waited instead.
+	Errors    int    `json:"errors"`
+	LastError string `json:"lastError,omitempty"`
+}
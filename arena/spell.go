@@ -0,0 +1,46 @@
+package arena
+
+import (
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+type EffectType string
+
+const (
+	Damage EffectType = "damage"
+	Heal   EffectType = "heal"
+)
+
+// Spell is the definition of a spell as the battle engine sees it.
+// Range is measured from the caster to the target square, and every
+// wizard within Area squares of the target is affected by the spell.
+type Spell struct {
+	Name     string
+	ManaCost int
+	Cooldown int
+	Range    int
+	Effect   EffectType
+	Power    int
+	Area     int
+}
+
+func (spell *Spell) view() interpreters.SpellView {
+	damage := spell.Power
+	if spell.Effect == Heal {
+		damage = -spell.Power
+	}
+
+	return interpreters.SpellView{
+		Name:     spell.Name,
+		ManaCost: spell.ManaCost,
+		Cooldown: spell.Cooldown,
+		Range:    spell.Range,
+		Damage:   damage,
+		Area:     spell.Area,
+	}
+}
+
+// affects reports whether a wizard standing at the position is caught by a spell aimed at the target.
+func (spell *Spell) affects(target interpreters.Position, position interpreters.Position) bool {
+	return interpreters.Distance(target, position) <= spell.Area
+}
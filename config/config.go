@@ -22,19 +22,26 @@ func init() {
 }
 
 func GetString(key string, defaultVal ...string) string {
-	if !viper.InConfig(key) && len(defaultVal) > 0 {
+	if !viper.IsSet(key) && len(defaultVal) > 0 {
 		return defaultVal[0]
 	}
 	return viper.GetString(key)
 }
 
 func GetBool(key string, defaultVal ...bool) bool {
-	if !viper.InConfig(key) && len(defaultVal) > 0 {
+	if !viper.IsSet(key) && len(defaultVal) > 0 {
 		return defaultVal[0]
 	}
 	return viper.GetBool(key)
 }
 
+func GetInt(key string, defaultVal ...int) int {
+	if !viper.IsSet(key) && len(defaultVal) > 0 {
+		return defaultVal[0]
+	}
+	return viper.GetInt(key)
+}
+
 func GetEnvironmentVariableName(key string) string {
 	return envPrefix + "_" + envReplacer.Replace(strings.ToUpper(key))
 }
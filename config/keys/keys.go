@@ -1,11 +1,32 @@
 package keys
 
 const (
+	AdminUsername = "admin.username"
 	Port = "port"
 	DatabaseDSN = "database.dsn"
 	DatabaseDriver = "database.driver"
 	DatabaseMigrationsPath = "database.migrations.path"
+	DatabaseQueryTimeout = "database.query.timeout"
 	LogLevel = "log.level"
+	MailSender = "mail.sender"
+	MailFrom = "mail.from"
+	MailDirectory = "mail.dir"
+	MailSMTPHost = "mail.smtp.host"
+	MailSMTPPort = "mail.smtp.port"
+	MailSMTPUsername = "mail.smtp.username"
+	MailSMTPPassword = "mail.smtp.password"
+	OIDCProviders = "oidc.providers"
+	OIDCProviderName = "oidc.%s.name"
+	OIDCProviderIssuer = "oidc.%s.issuer"
+	OIDCProviderClientID = "oidc.%s.client.id"
+	OIDCProviderClientSecret = "oidc.%s.client.secret"
+	OIDCProviderScopes = "oidc.%s.scopes"
+	ProxyTrusted = "proxy.trusted"
+	PublicURL = "public.url"
 	SessionSecure = "session.secure"
 	SessionKey = "session.key"
+	SpellsPath = "spells.path"
+	MatchmakingInterval = "matchmaking.interval"
+	TournamentInterval = "tournaments.interval"
+	WorkerCount = "workers.count"
 )
\ No newline at end of file
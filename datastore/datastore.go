@@ -1,6 +1,7 @@
 package datastore
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"github.com/go-gorp/gorp"
@@ -8,6 +9,8 @@ import (
 	_ "github.com/mattes/migrate/driver/sqlite3"
 	"github.com/mattes/migrate/migrate"
 	"reflect"
+	"regexp"
+	"strings"
 	"time"
 	"path/filepath"
 )
@@ -21,10 +24,35 @@ const (
 
 )
 
+// ErrConflict is returned by Update and Delete when the record has been
+// changed by someone else since it was read.
+var ErrConflict = errors.New("The record has been changed since it was read.")
+
 type DB struct {
 	*gorp.DbMap
 	driver string
 	dsn    string
+
+	// QueryTimeout is how long each query may run for before it is
+	// cancelled. Queries are never cancelled for taking too long if it is
+	// not positive.
+	QueryTimeout time.Duration
+
+	// The context that queries are run in, on the copies of the datastore
+	// returned by WithContext
+	ctx context.Context
+
+	// The transaction that queries are run in, on the copies of the
+	// datastore that are passed to WithTransaction callbacks
+	tx *transaction
+}
+
+type transaction struct {
+	*gorp.Transaction
+
+	// Functions that restore the records written in the transaction to
+	// how they were beforehand, in the order they were written
+	undo []func()
 }
 
 func Open(driver string, dsn string) (*DB, error) {
@@ -48,7 +76,190 @@ func (ds *DB) UpSync(migrationsPath string) ([]error, bool) {
 	return migrate.UpSync(ds.driver+"://"+ds.dsn, filepath.Join(migrationsPath, ds.driver))
 }
 
+// AddTableWithName maps the record type to the table. Records with a version
+// are updated with optimistic locking, so the table needs a Version column.
+func (ds *DB) AddTableWithName(record interface{}, name string) *gorp.TableMap {
+	table := ds.DbMap.AddTableWithName(record, name)
+	if _, hasVersion := reflect.New(reflect.TypeOf(record)).Interface().(VersionRecorder); hasVersion {
+		table.SetVersionCol("Version")
+	}
+	return table
+}
+
+// WithTransaction runs fn in a transaction, which is committed if fn
+// returns nil and rolled back otherwise. fn is given a copy of the
+// datastore that runs its queries in the transaction, and which DAOs can
+// be bound to with their WithTx methods. If the transaction is rolled back,
+// the fields that the datastore set on the records written in it, such as
+// their IDs and statuses, are restored as well. Calls made on a copy that
+// is already in a transaction join it.
+func (ds *DB) WithTransaction(fn func(tx *DB) error) error {
+	if ds.tx != nil {
+		return fn(ds)
+	}
+
+	// The transaction is rolled back if the context is cancelled, but it is
+	// not given the query timeout, which applies to each query in it
+	var gorpTx *gorp.Transaction
+	var err error
+	if ds.ctx != nil {
+		gorpTx, err = ds.DbMap.WithContext(ds.ctx).(*gorp.DbMap).Begin()
+	} else {
+		gorpTx, err = ds.DbMap.Begin()
+	}
+	if err != nil {
+		return err
+	}
+
+	tx := *ds
+	tx.tx = &transaction{Transaction: gorpTx}
+
+	// A panic in fn rolls back the transaction before carrying on, so that
+	// the connection is not left holding locks
+	defer func() {
+		if recovery := recover(); recovery != nil {
+			tx.tx.rollback()
+			panic(recovery)
+		}
+	}()
+
+	if err := fn(&tx); err != nil {
+		tx.tx.rollback()
+		return err
+	}
+
+	if err := gorpTx.Commit(); err != nil {
+		tx.tx.revert()
+		return err
+	}
+	return nil
+}
+
+func (tx *transaction) rollback() {
+	tx.Transaction.Rollback()
+	tx.revert()
+}
+
+func (tx *transaction) revert() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+	tx.undo = nil
+}
+
+// remember keeps a copy of the record if it is about to be written in a
+// transaction, so that it can be restored if the transaction is rolled back.
+func (ds *DB) remember(record interface{}) {
+	if ds.tx == nil {
+		return
+	}
+
+	value := reflect.ValueOf(record)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return
+	}
+
+	saved := reflect.New(value.Elem().Type()).Elem()
+	saved.Set(value.Elem())
+	ds.tx.undo = append(ds.tx.undo, func() {
+		value.Elem().Set(saved)
+	})
+}
+
+// WithContext returns a copy of the datastore whose queries are cancelled
+// along with ctx, such as when the client that made a request disconnects.
+func (ds *DB) WithContext(ctx context.Context) *DB {
+	bound := *ds
+	bound.ctx = ctx
+	return &bound
+}
+
+func (ds *DB) InsertContext(ctx context.Context, record interface{}) error {
+	return ds.WithContext(ctx).Insert(record)
+}
+
+func (ds *DB) UpdateContext(ctx context.Context, record interface{}) error {
+	return ds.WithContext(ctx).Update(record)
+}
+
+func (ds *DB) DeleteContext(ctx context.Context, record interface{}) error {
+	return ds.WithContext(ctx).Delete(record)
+}
+
+func (ds *DB) GetContext(ctx context.Context, record interface{}, whereClause string, args ...interface{}) (interface{}, error) {
+	return ds.WithContext(ctx).Get(record, whereClause, args...)
+}
+
+func (ds *DB) SelectContext(ctx context.Context, results interface{}, whereClause string, args ...interface{}) ([]interface{}, error) {
+	return ds.WithContext(ctx).Select(results, whereClause, args...)
+}
+
+// withTimeout returns a copy of the datastore whose queries are cancelled
+// once the query timeout has passed, and the function that releases its
+// timer. Operations that run several queries share the one timeout.
+func (ds *DB) withTimeout() (*DB, context.CancelFunc) {
+	if ds.QueryTimeout <= 0 {
+		return ds, func() {}
+	}
+
+	ctx := ds.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ds.QueryTimeout)
+	return ds.WithContext(ctx), cancel
+}
+
+// executor returns what queries should be run through, which is the
+// transaction if there is one.
+func (ds *DB) executor() gorp.SqlExecutor {
+	if ds.tx != nil {
+		if ds.ctx != nil {
+			return ds.tx.Transaction.WithContext(ds.ctx)
+		}
+		return ds.tx.Transaction
+	}
+
+	if ds.ctx != nil {
+		return ds.DbMap.WithContext(ds.ctx)
+	}
+	return ds.DbMap
+}
+
+func (ds *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ds, cancel := ds.withTimeout()
+	defer cancel()
+
+	return ds.executor().Exec(query, args...)
+}
+
+func (ds *DB) SelectInt(query string, args ...interface{}) (int64, error) {
+	ds, cancel := ds.withTimeout()
+	defer cancel()
+
+	return ds.executor().SelectInt(query, args...)
+}
+
+func (ds *DB) SelectStr(query string, args ...interface{}) (string, error) {
+	ds, cancel := ds.withTimeout()
+	defer cancel()
+
+	return ds.executor().SelectStr(query, args...)
+}
+
+func (ds *DB) SelectOne(holder interface{}, query string, args ...interface{}) error {
+	ds, cancel := ds.withTimeout()
+	defer cancel()
+
+	return ds.executor().SelectOne(holder, query, args...)
+}
+
 func (ds *DB) Insert(record interface{}) error {
+	ds, cancel := ds.withTimeout()
+	defer cancel()
+
+	ds.remember(record)
 
 	// Update the status, creation time and last modifed before insertion, so that the changes can be persisted
 	statusRecord, hasStatus := record.(StatusRecorder)
@@ -73,24 +284,35 @@ func (ds *DB) Insert(record interface{}) error {
 		lastUpdatedTimeRecord.SetLastUpdatedTime(now)
 	}
 
+	// The version is set by gorp as the record is written
+	versionRecord, hasVersion := record.(VersionRecorder)
+	var previousVersion int64
+	if hasVersion {
+		previousVersion = versionRecord.Version()
+	}
+
 	var err error
 	logicallyDeletableRecord, supportsLogicalDeletion := record.(LogicallyDeletable)
 	if supportsLogicalDeletion {
 		var existingRecord interface{}
-		existingRecord, err = ds.DbMap.Get(record, logicallyDeletableRecord.Keys()...)
+		existingRecord, err = ds.executor().Get(record, logicallyDeletableRecord.Keys()...)
 		if existingRecord != nil {
 			// No need to check validity, since all LogicallyDeletable records are also StatusRecorders
 			existingStatusRecorder := existingRecord.(StatusRecorder)
 			if existingStatusRecorder.Status() == Deleted {
+				// The deleted record is overwritten, which has to be done against its version
+				if hasVersion {
+					versionRecord.SetVersion(existingRecord.(VersionRecorder).Version())
+				}
 				err = ds.Update(record)
 			} else {
 				err = errors.New("A record with the same primary key already exists in the data store.")
 			}
 		} else {
-			err = ds.DbMap.Insert(record)
+			err = ds.executor().Insert(record)
 		}
 	} else {
-		err = ds.DbMap.Insert(record)
+		err = ds.executor().Insert(record)
 	}
 
 	if err != nil {
@@ -107,12 +329,21 @@ func (ds *DB) Insert(record interface{}) error {
 		if hasLastUpdatedTime {
 			lastUpdatedTimeRecord.SetLastUpdatedTime(previousLastUpdatedTime)
 		}
+
+		if hasVersion {
+			versionRecord.SetVersion(previousVersion)
+		}
 	}
 
 	return err
 }
 
 func (ds *DB) Update(record interface{}) error {
+	ds, cancel := ds.withTimeout()
+	defer cancel()
+
+	ds.remember(record)
+
 	now := getCurrentTime()
 	lastUpdatedTimeRecord, hasLastUpdatedTime := record.(LastUpdateTimeRecorder)
 	var previousLastUpdatedTime time.Time
@@ -121,7 +352,23 @@ func (ds *DB) Update(record interface{}) error {
 		lastUpdatedTimeRecord.SetLastUpdatedTime(now)
 	}
 
-	count, err := ds.DbMap.Update(record)
+	versionRecord, hasVersion := record.(VersionRecorder)
+	var previousVersion int64
+	if hasVersion {
+		previousVersion = versionRecord.Version()
+	}
+
+	count, err := ds.executor().Update(record)
+	if lockErr, isLockErr := err.(gorp.OptimisticLockError); isLockErr {
+		// gorp looks the record up again when the version does not match,
+		// to tell whether it has been changed or has gone entirely
+		if lockErr.RowExists {
+			err = ErrConflict
+		} else {
+			count, err = 0, nil
+		}
+	}
+
 	if err == nil && count == 0 {
 		err = errors.New("No records were affected by the update operation.")
 	}
@@ -130,12 +377,21 @@ func (ds *DB) Update(record interface{}) error {
 		if hasLastUpdatedTime {
 			lastUpdatedTimeRecord.SetLastUpdatedTime(previousLastUpdatedTime)
 		}
+
+		if hasVersion {
+			versionRecord.SetVersion(previousVersion)
+		}
 	}
 
 	return err
 }
 
 func (ds *DB) Delete(record interface{}) error {
+	ds, cancel := ds.withTimeout()
+	defer cancel()
+
+	ds.remember(record)
+
 	statusRecord, hasStatus := record.(StatusRecorder)
 	var previousStatus StatusCode
 	if hasStatus {
@@ -184,6 +440,8 @@ func (ds *DB) Get(record interface{}, whereClause string, args ...interface{}) (
 }
 
 func (ds *DB) Select(results interface{}, whereClause string, args ...interface{}) ([]interface{}, error) {
+	ds, cancel := ds.withTimeout()
+	defer cancel()
 
 	recordType := reflect.TypeOf(results)
 
@@ -199,11 +457,43 @@ func (ds *DB) Select(results interface{}, whereClause string, args ...interface{
 	logicallyDeletableRecord, supportsLogicalDeletion := recordPtr.(LogicallyDeletable)
 	if supportsLogicalDeletion {
 		statusColumn := logicallyDeletableRecord.StatusColumn()
-		whereClause = whereClause + " AND " + statusColumn + " <> ?"
-		args = append(args, Deleted)
+		whereClause, args = addCondition(whereClause, args, statusColumn+" <> ?", Deleted)
+	}
+
+	return ds.executor().Select(results, whereClause, args...)
+}
+
+var (
+	wherePattern    = regexp.MustCompile(`(?i)\sWHERE\s`)
+	trailingPattern = regexp.MustCompile(`(?i)\s(ORDER\s+BY|LIMIT)\s`)
+)
+
+// addCondition adds a condition with a single argument to a query's WHERE
+// clause, or gives the query a WHERE clause if it does not have one. The
+// condition goes before any ORDER BY or LIMIT at the end of the query, and
+// its argument before theirs, so queries can be ordered and paged in SQL.
+// The query must not have subqueries, or question marks other than its
+// placeholders.
+func addCondition(query string, args []interface{}, condition string, arg interface{}) (string, []interface{}) {
+	head, tail := query, ""
+	if loc := trailingPattern.FindStringIndex(query); loc != nil {
+		head, tail = query[:loc[0]], query[loc[0]:]
+	}
+
+	// The existing conditions are bracketed so that an OR in them cannot
+	// take precedence over the new condition
+	if loc := wherePattern.FindStringIndex(head); loc != nil {
+		head = head[:loc[1]] + "(" + head[loc[1]:] + ") AND " + condition
+	} else {
+		head = head + " WHERE " + condition
 	}
 
-	return ds.DbMap.Select(results, whereClause, args...)
+	split := len(args) - strings.Count(tail, "?")
+	combined := make([]interface{}, 0, len(args)+1)
+	combined = append(combined, args[:split]...)
+	combined = append(combined, arg)
+	combined = append(combined, args[split:]...)
+	return head + tail, combined
 }
 
 func getCurrentTime() time.Time {
@@ -1,6 +1,8 @@
 package datastore
 
 import (
+	"context"
+	"errors"
 	_ "github.com/mattn/go-sqlite3"
 	"reflect"
 	"testing"
@@ -303,6 +305,65 @@ func TestDB_Update_FailsOnMissingRecord(t *testing.T) {
 	}
 }
 
+func TestDB_Update_FailsOnStaleVersion(t *testing.T) {
+	ds, err := initTestDataStore()
+	defer closeTestDatastore(ds)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := &testRecord{BaseRecord: *NewRecord(), String: "ABC", Integer: 20}
+	if err := ds.Insert(record); err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Version() != 1 {
+		t.Fatalf("Expected a new record to have version 1, got %d", record.Version())
+	}
+
+	// Two copies are read, and the first one to be saved wins
+	first := &testRecord{}
+	second := &testRecord{}
+	if err := ds.SelectOne(first, "SELECT * FROM Test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.SelectOne(second, "SELECT * FROM Test"); err != nil {
+		t.Fatal(err)
+	}
+
+	first.String = "DEF"
+	if err := ds.Update(first); err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Version() != 2 {
+		t.Fatalf("Expected the update to increment the version, got %d", first.Version())
+	}
+
+	beforeUpdate := *second
+	second.String = "GHI"
+	if err := ds.Update(second); err != ErrConflict {
+		t.Fatalf("Expected ErrConflict, got %v", err)
+	}
+
+	if second.Version() != beforeUpdate.Version() || second.LastUpdatedTime() != beforeUpdate.LastUpdatedTime() {
+		t.Errorf("Stale record was modified by the failed update")
+	}
+
+	if err := ds.Delete(second); err != ErrConflict {
+		t.Fatalf("Expected ErrConflict, got %v", err)
+	}
+
+	persisted := &testRecord{}
+	if err := ds.SelectOne(persisted, "SELECT * FROM Test"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertEquals(first, persisted, t)
+}
+
 func TestDB_Delete_SucceedsOnExistingRecord(t *testing.T) {
 	ds, err := initTestDataStore()
 	defer closeTestDatastore(ds)
@@ -434,6 +495,210 @@ func TestDB_Get_MoreThanOneResult(t *testing.T) {
 	}
 }
 
+func TestDB_Select_OrdersAndLimitsActiveRecords(t *testing.T) {
+	ds, err := initTestDataStore()
+	defer closeTestDatastore(ds)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Insert a deleted record between active ones, so that the limit would
+	// include it if the status condition were applied after the limit
+	for i, status := range []StatusCode{Active, Deleted, Active, Active} {
+		record := &testRecord{BaseRecord: *NewRecord(), String: "ABC", Integer: i + 1}
+		record.SetStatus(status)
+		ds.DbMap.Insert(record)
+	}
+
+	var results []*testRecord
+	_, err = ds.Select(&results, "SELECT * FROM Test WHERE StringField = ? OR IntegerField = ? ORDER BY IntegerField DESC LIMIT ?", "ABC", -1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 || results[0].Integer != 4 || results[1].Integer != 3 {
+		t.Fatalf("Expected the two newest active records in descending order.")
+	}
+
+	results = nil
+	_, err = ds.Select(&results, "SELECT * FROM Test ORDER BY IntegerField LIMIT ?", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 || results[0].Integer != 1 || results[1].Integer != 3 {
+		t.Fatalf("Expected the two oldest active records in ascending order.")
+	}
+}
+
+func TestDB_WithTransaction_CommitsOnSuccess(t *testing.T) {
+	ds, err := initTestDataStore()
+	defer closeTestDatastore(ds)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &testRecord{BaseRecord: *NewRecord(), String: "ABC", Integer: 20}
+	second := &testRecord{BaseRecord: *NewRecord(), String: "DEF", Integer: 30}
+	err = ds.WithTransaction(func(tx *DB) error {
+		if err := tx.Insert(first); err != nil {
+			return err
+		}
+		return tx.Insert(second)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := ds.SelectInt("SELECT COUNT(*) FROM Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Fatalf("Expected both records to be committed, found %d", count)
+	}
+}
+
+func TestDB_WithTransaction_RollsBackOnError(t *testing.T) {
+	ds, err := initTestDataStore()
+	defer closeTestDatastore(ds)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing := &testRecord{BaseRecord: *NewRecord(), String: "ABC", Integer: 20}
+	if err := ds.Insert(existing); err != nil {
+		t.Fatal(err)
+	}
+	beforeUpdate := *existing
+
+	// The second insert breaks the CHECK constraint, so everything before it has to be undone
+	inserted := &testRecord{BaseRecord: *NewRecord(), String: "DEF", Integer: 30}
+	invalid := &testRecord{BaseRecord: *NewRecord(), String: "GHI", Integer: -1}
+	err = ds.WithTransaction(func(tx *DB) error {
+		existing.String = "Changed"
+		if err := tx.Update(existing); err != nil {
+			return err
+		}
+
+		if err := tx.Insert(inserted); err != nil {
+			return err
+		}
+		return tx.Insert(invalid)
+	})
+	if err == nil {
+		t.Fatalf("Expected the transaction to fail")
+	}
+
+	var persisted []*testRecord
+	if _, err := ds.Select(&persisted, "SELECT * FROM Test WHERE 1 = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(persisted) != 1 || persisted[0].String != "ABC" {
+		t.Fatalf("Expected only the original record to be persisted, found %v", persisted)
+	}
+
+	// The fields set in the transaction are put back, so that the records can be written again
+	if inserted.ID != 0 || inserted.Status() != Transient || !inserted.CreationTime().IsZero() {
+		t.Errorf("Inserted record was not restored: %v", inserted)
+	}
+
+	if invalid.ID != 0 || invalid.Status() != Transient {
+		t.Errorf("Invalid record was not restored: %v", invalid)
+	}
+
+	// Only the bookkeeping is restored, not the caller's own changes
+	beforeUpdate.String = "Changed"
+	assertEquals(&beforeUpdate, existing, t)
+}
+
+func TestDB_WithTransaction_JoinsOuterTransaction(t *testing.T) {
+	ds, err := initTestDataStore()
+	defer closeTestDatastore(ds)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := &testRecord{BaseRecord: *NewRecord(), String: "ABC", Integer: 20}
+	err = ds.WithTransaction(func(tx *DB) error {
+		err := tx.WithTransaction(func(inner *DB) error {
+			if inner != tx {
+				t.Errorf("Expected the inner call to run in the outer transaction")
+			}
+			return inner.Insert(record)
+		})
+		if err != nil {
+			return err
+		}
+		return errors.New("Outer transaction failed.")
+	})
+	if err == nil {
+		t.Fatalf("Expected the transaction to fail")
+	}
+
+	count, err := ds.SelectInt("SELECT COUNT(*) FROM Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 0 || record.ID != 0 {
+		t.Fatalf("Expected the inner insert to be rolled back with the outer transaction")
+	}
+}
+
+func TestDB_InsertContext_FailsOnCancelledContext(t *testing.T) {
+	ds, err := initTestDataStore()
+	defer closeTestDatastore(ds)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	record := &testRecord{BaseRecord: *NewRecord(), String: "ABC", Integer: 20}
+	if err := ds.InsertContext(ctx, record); err != context.Canceled {
+		t.Fatalf("Expected the insert to be cancelled, got %v", err)
+	}
+
+	if record.ID != 0 || record.Status() != Transient || !record.CreationTime().IsZero() {
+		t.Errorf("Cancelled record was not restored: %v", record)
+	}
+
+	// The datastore itself is not bound to the context
+	if err := ds.Insert(record); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_Select_FailsAfterQueryTimeout(t *testing.T) {
+	ds, err := initTestDataStore()
+	defer closeTestDatastore(ds)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds.QueryTimeout = time.Nanosecond
+
+	var records []*testRecord
+	if _, err := ds.Select(&records, "SELECT * FROM Test WHERE 1 = 1"); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the query to time out, got %v", err)
+	}
+
+	ds.QueryTimeout = time.Minute
+	if _, err := ds.SelectContext(context.Background(), &records, "SELECT * FROM Test WHERE 1 = 1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func initTestDataStore() (*DB, error) {
 	ds, err := Open("sqlite3", "file:test.db?cache=shared&mode=memory")
 	if err != nil {
@@ -447,6 +712,7 @@ func initTestDataStore() (*DB, error) {
 		CreationTime DATETIME,
 		DeletionTime DATETIME,
 		LastUpdatedTime DATETIME, 
+		Version INTEGER NOT NULL,
 		StringField VARCHAR(255),
 		IntegerField INTEGER
 		CHECK (IntegerField > 0)
@@ -465,3 +731,54 @@ func assertEquals(a interface{}, b interface{}, t *testing.T) {
 		t.Fatalf("Persisted copy [%v] is not equal to local copy [%v]", a, b)
 	}
 }
+
+func TestAddCondition(t *testing.T) {
+	tests := []struct {
+		query        string
+		args         []interface{}
+		expected     string
+		expectedArgs []interface{}
+	}{
+		{
+			"SELECT * FROM Test",
+			nil,
+			"SELECT * FROM Test WHERE Status <> ?",
+			[]interface{}{Deleted},
+		},
+		{
+			"SELECT * FROM Test WHERE A = ? OR B = ?",
+			[]interface{}{1, 2},
+			"SELECT * FROM Test WHERE (A = ? OR B = ?) AND Status <> ?",
+			[]interface{}{1, 2, Deleted},
+		},
+		{
+			"SELECT * FROM Test ORDER BY A DESC",
+			nil,
+			"SELECT * FROM Test WHERE Status <> ? ORDER BY A DESC",
+			[]interface{}{Deleted},
+		},
+		{
+			"SELECT * FROM Test LIMIT ?",
+			[]interface{}{10},
+			"SELECT * FROM Test WHERE Status <> ? LIMIT ?",
+			[]interface{}{Deleted, 10},
+		},
+		{
+			"SELECT * FROM Test where A > ? order by A limit ?",
+			[]interface{}{1, 10},
+			"SELECT * FROM Test where (A > ?) AND Status <> ? order by A limit ?",
+			[]interface{}{1, Deleted, 10},
+		},
+	}
+
+	for _, test := range tests {
+		query, args := addCondition(test.query, test.args, "Status <> ?", Deleted)
+		if query != test.expected {
+			t.Errorf("Unexpected query for %q: got %q want %q", test.query, query, test.expected)
+		}
+
+		if !reflect.DeepEqual(args, test.expectedArgs) {
+			t.Errorf("Unexpected arguments for %q: got %v want %v", test.query, args, test.expectedArgs)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS WizardScripts (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	WizardID INTEGER NOT NULL,
+	Version INTEGER NOT NULL,
+	Language VARCHAR(32) NOT NULL,
+	Source MEDIUMTEXT NOT NULL,
+	Checksum CHAR(64) NOT NULL,
+	AuthorID INTEGER NOT NULL,
+	CONSTRAINT pk_WizardScriptsID PRIMARY KEY (ID),
+	CONSTRAINT uk_WizardScriptsWizardIDAndVersion UNIQUE (WizardID,Version),
+	FOREIGN KEY (WizardID) REFERENCES Wizards(ID),
+	FOREIGN KEY (AuthorID) REFERENCES Users(ID)
+);
+
+CREATE INDEX ix_WizardScriptsWizardID ON WizardScripts(WizardID);
+
+ALTER TABLE Wizards ADD COLUMN ActiveScriptID INTEGER NOT NULL DEFAULT 0;
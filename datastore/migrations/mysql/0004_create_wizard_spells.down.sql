@@ -0,0 +1 @@
+DROP TABLE IF EXISTS WizardSpells;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS WizardSpells (
+	WizardID INTEGER NOT NULL,
+	Slot INTEGER NOT NULL,
+	SpellID VARCHAR(64) NOT NULL,
+	CONSTRAINT pk_WizardSpellsWizardIDAndSlot PRIMARY KEY (WizardID,Slot),
+	CONSTRAINT uk_WizardSpellsWizardIDAndSpellID UNIQUE (WizardID,SpellID),
+	FOREIGN KEY (WizardID) REFERENCES Wizards(ID)
+);
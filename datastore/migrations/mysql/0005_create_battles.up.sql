@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS Battles (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	Seed BIGINT NOT NULL,
+	MapName VARCHAR(64) NOT NULL,
+	SpellsVersion VARCHAR(64) NOT NULL,
+	Ticks INTEGER NOT NULL,
+	WinnerID INTEGER NOT NULL,
+	EndReason VARCHAR(32) NOT NULL,
+	CONSTRAINT pk_BattlesID PRIMARY KEY (ID)
+);
+
+CREATE TABLE IF NOT EXISTS BattleParticipants (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	BattleID INTEGER NOT NULL,
+	WizardID INTEGER NOT NULL,
+	ScriptID INTEGER NOT NULL,
+	Alive BOOLEAN NOT NULL,
+	Health INTEGER NOT NULL,
+	DamageDealt INTEGER NOT NULL,
+	DamageTaken INTEGER NOT NULL,
+	Errors INTEGER NOT NULL,
+	CONSTRAINT pk_BattleParticipantsID PRIMARY KEY (ID),
+	CONSTRAINT uk_BattleParticipantsBattleIDAndWizardID UNIQUE (BattleID,WizardID),
+	FOREIGN KEY (BattleID) REFERENCES Battles(ID),
+	FOREIGN KEY (WizardID) REFERENCES Wizards(ID),
+	FOREIGN KEY (ScriptID) REFERENCES WizardScripts(ID)
+);
+
+CREATE INDEX ix_BattleParticipantsWizardID ON BattleParticipants(WizardID);
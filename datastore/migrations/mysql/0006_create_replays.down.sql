@@ -0,0 +1 @@
+DROP TABLE IF EXISTS Replays;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS Replays (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	BattleID INTEGER NOT NULL,
+	FormatVersion INTEGER NOT NULL,
+	Data MEDIUMBLOB NOT NULL,
+	CONSTRAINT pk_ReplaysID PRIMARY KEY (ID),
+	CONSTRAINT uk_ReplaysBattleID UNIQUE (BattleID),
+	FOREIGN KEY (BattleID) REFERENCES Battles(ID)
+);
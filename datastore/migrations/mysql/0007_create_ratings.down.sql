@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ix_RatingHistoryWizardID;
+DROP TABLE IF EXISTS RatingHistory;
+DROP TABLE IF EXISTS Ratings;
\ No newline at end of file
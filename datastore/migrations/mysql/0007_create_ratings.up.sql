@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS Ratings (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	WizardID INTEGER NOT NULL,
+	Rating DOUBLE NOT NULL,
+	Deviation DOUBLE NOT NULL,
+	Volatility DOUBLE NOT NULL,
+	Games INTEGER NOT NULL,
+	CONSTRAINT pk_RatingsID PRIMARY KEY (ID),
+	CONSTRAINT uk_RatingsWizardID UNIQUE (WizardID),
+	FOREIGN KEY (WizardID) REFERENCES Wizards(ID)
+);
+
+CREATE TABLE IF NOT EXISTS RatingHistory (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	WizardID INTEGER NOT NULL,
+	BattleID INTEGER NOT NULL,
+	Rating DOUBLE NOT NULL,
+	Deviation DOUBLE NOT NULL,
+	Volatility DOUBLE NOT NULL,
+	`Change` DOUBLE NOT NULL,
+	CONSTRAINT pk_RatingHistoryID PRIMARY KEY (ID),
+	FOREIGN KEY (WizardID) REFERENCES Wizards(ID),
+	FOREIGN KEY (BattleID) REFERENCES Battles(ID)
+);
+
+CREATE INDEX ix_RatingHistoryWizardID ON RatingHistory(WizardID);
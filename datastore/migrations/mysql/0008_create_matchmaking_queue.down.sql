@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ix_MatchmakingQueueState;
+DROP TABLE IF EXISTS MatchmakingQueue;
\ No newline at end of file
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS Seasons (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	Name VARCHAR(128) NOT NULL,
+	StartTime DATETIME NOT NULL,
+	EndTime DATETIME NOT NULL,
+	Carryover DOUBLE NOT NULL,
+	ResetDeviation DOUBLE NOT NULL,
+	Started BOOLEAN NOT NULL DEFAULT 0,
+	CONSTRAINT pk_SeasonsID PRIMARY KEY (ID)
+);
+
+CREATE TABLE IF NOT EXISTS SeasonStandings (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	SeasonID INTEGER NOT NULL,
+	WizardID INTEGER NOT NULL,
+	`Rank` INTEGER NOT NULL,
+	Rating DOUBLE NOT NULL,
+	Deviation DOUBLE NOT NULL,
+	Games INTEGER NOT NULL,
+	Language VARCHAR(32) NOT NULL,
+	CONSTRAINT pk_SeasonStandingsID PRIMARY KEY (ID),
+	CONSTRAINT uk_SeasonStandingsSeasonIDAndWizardID UNIQUE (SeasonID,WizardID),
+	FOREIGN KEY (SeasonID) REFERENCES Seasons(ID),
+	FOREIGN KEY (WizardID) REFERENCES Wizards(ID)
+);
+
+ALTER TABLE Ratings ADD COLUMN SeasonID INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Ratings ADD COLUMN SeasonGames INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE RatingHistory ADD COLUMN SeasonID INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX ix_RatingsSeasonID ON Ratings(SeasonID);
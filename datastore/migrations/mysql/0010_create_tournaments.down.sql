@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS ix_TournamentMatchesTournamentID;
+DROP INDEX IF EXISTS ix_TournamentEntrantsTournamentID;
+DROP INDEX IF EXISTS ix_TournamentsState;
+DROP TABLE IF EXISTS TournamentMatches;
+DROP TABLE IF EXISTS TournamentEntrants;
+DROP TABLE IF EXISTS Tournaments;
\ No newline at end of file
@@ -0,0 +1,61 @@
+CREATE TABLE IF NOT EXISTS Tournaments (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	Name VARCHAR(128) NOT NULL,
+	Format VARCHAR(32) NOT NULL,
+	State VARCHAR(16) NOT NULL,
+	CreatorID INTEGER NOT NULL,
+	RegistrationDeadline DATETIME NOT NULL,
+	MaxEntrants INTEGER NOT NULL DEFAULT 0,
+	WinnerID INTEGER NOT NULL DEFAULT 0,
+	Reason VARCHAR(255) NOT NULL DEFAULT '',
+	CONSTRAINT pk_TournamentsID PRIMARY KEY (ID),
+	FOREIGN KEY (CreatorID) REFERENCES Users(ID)
+);
+
+CREATE TABLE IF NOT EXISTS TournamentEntrants (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	TournamentID INTEGER NOT NULL,
+	WizardID INTEGER NOT NULL,
+	OwnerID INTEGER NOT NULL,
+	Seed INTEGER NOT NULL DEFAULT 0,
+	CONSTRAINT pk_TournamentEntrantsID PRIMARY KEY (ID),
+	CONSTRAINT uk_TournamentEntrantsTournamentIDAndOwnerID UNIQUE (TournamentID,OwnerID),
+	FOREIGN KEY (TournamentID) REFERENCES Tournaments(ID),
+	FOREIGN KEY (WizardID) REFERENCES Wizards(ID),
+	FOREIGN KEY (OwnerID) REFERENCES Users(ID)
+);
+
+CREATE TABLE IF NOT EXISTS TournamentMatches (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	TournamentID INTEGER NOT NULL,
+	Bracket VARCHAR(16) NOT NULL,
+	Round INTEGER NOT NULL,
+	Slot INTEGER NOT NULL,
+	FirstSource VARCHAR(64) NOT NULL,
+	SecondSource VARCHAR(64) NOT NULL,
+	FirstWizardID INTEGER NOT NULL DEFAULT 0,
+	SecondWizardID INTEGER NOT NULL DEFAULT 0,
+	State VARCHAR(16) NOT NULL,
+	WinnerID INTEGER NOT NULL DEFAULT 0,
+	LoserID INTEGER NOT NULL DEFAULT 0,
+	BattleID INTEGER NOT NULL DEFAULT 0,
+	CONSTRAINT pk_TournamentMatchesID PRIMARY KEY (ID),
+	CONSTRAINT uk_TournamentMatchesKey UNIQUE (TournamentID,Bracket,Round,Slot),
+	FOREIGN KEY (TournamentID) REFERENCES Tournaments(ID)
+);
+
+CREATE INDEX ix_TournamentsState ON Tournaments(State);
+CREATE INDEX ix_TournamentEntrantsTournamentID ON TournamentEntrants(TournamentID);
+CREATE INDEX ix_TournamentMatchesTournamentID ON TournamentMatches(TournamentID);
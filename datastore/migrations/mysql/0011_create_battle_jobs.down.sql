@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ix_BattleJobsState;
+DROP TABLE IF EXISTS BattleJobs;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE Users DROP COLUMN TimeZone;
+ALTER TABLE Users DROP COLUMN Name;
\ No newline at end of file
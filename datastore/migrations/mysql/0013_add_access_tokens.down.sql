@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ix_AccessTokensUserID;
+DROP TABLE IF EXISTS AccessTokens;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE Users DROP COLUMN Roles;
\ No newline at end of file
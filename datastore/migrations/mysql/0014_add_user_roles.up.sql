@@ -0,0 +1 @@
+ALTER TABLE Users ADD COLUMN Roles VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ix_UserTokensUserID;
+DROP TABLE IF EXISTS UserTokens;
+ALTER TABLE Users DROP COLUMN EmailVerified;
\ No newline at end of file
@@ -0,0 +1,19 @@
+ALTER TABLE Users ADD COLUMN EmailVerified BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS UserTokens (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	UserID INTEGER NOT NULL,
+	Purpose VARCHAR(32) NOT NULL,
+	Hash CHAR(64) NOT NULL,
+	Email VARCHAR(254) NOT NULL,
+	ExpiryTime DATETIME,
+	CONSTRAINT pk_UserTokensID PRIMARY KEY (ID),
+	FOREIGN KEY (UserID) REFERENCES Users(ID),
+	CONSTRAINT uk_UserTokensHash UNIQUE (Hash)
+);
+
+CREATE INDEX ix_UserTokensUserID ON UserTokens(UserID);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS LoginAttempts (
+	ID INTEGER AUTO_INCREMENT,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	Username VARCHAR(128) NOT NULL,
+	UserID INTEGER NOT NULL,
+	IPAddress VARCHAR(45) NOT NULL,
+	Source VARCHAR(16) NOT NULL,
+	Outcome VARCHAR(16) NOT NULL,
+	Time DATETIME NOT NULL,
+	CONSTRAINT pk_LoginAttemptsID PRIMARY KEY (ID)
+);
+
+CREATE INDEX ix_LoginAttemptsUserID ON LoginAttempts(UserID);
+CREATE INDEX ix_LoginAttemptsUsername ON LoginAttempts(Username, Time);
+CREATE INDEX ix_LoginAttemptsIPAddress ON LoginAttempts(IPAddress, Time);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ix_IdentitiesUserID;
+DROP INDEX IF EXISTS ix_IdentitiesSubject;
+DROP TABLE IF EXISTS Identities;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE Users DROP COLUMN RecoveryCodes;
+ALTER TABLE Users DROP COLUMN TOTPCounter;
+ALTER TABLE Users DROP COLUMN TOTPSecret;
\ No newline at end of file
@@ -0,0 +1,21 @@
+ALTER TABLE UserTokens DROP COLUMN Version;
+ALTER TABLE Identities DROP COLUMN Version;
+ALTER TABLE Sessions DROP COLUMN Version;
+ALTER TABLE LoginAttempts DROP COLUMN Version;
+ALTER TABLE AccessTokens DROP COLUMN Version;
+ALTER TABLE BattleJobs DROP COLUMN Version;
+ALTER TABLE TournamentMatches DROP COLUMN Version;
+ALTER TABLE TournamentEntrants DROP COLUMN Version;
+ALTER TABLE Tournaments DROP COLUMN Version;
+ALTER TABLE SeasonStandings DROP COLUMN Version;
+ALTER TABLE Seasons DROP COLUMN Version;
+ALTER TABLE MatchmakingQueue DROP COLUMN Version;
+ALTER TABLE RatingHistory DROP COLUMN Version;
+ALTER TABLE Ratings DROP COLUMN Version;
+ALTER TABLE Replays DROP COLUMN Version;
+ALTER TABLE BattleParticipants DROP COLUMN Version;
+ALTER TABLE Battles DROP COLUMN Version;
+ALTER TABLE WizardScripts DROP COLUMN Version;
+ALTER TABLE WizardScripts RENAME COLUMN Revision TO Version;
+ALTER TABLE Wizards DROP COLUMN Version;
+ALTER TABLE Users DROP COLUMN Version;
\ No newline at end of file
@@ -0,0 +1,21 @@
+ALTER TABLE Users ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Wizards ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE WizardScripts RENAME COLUMN Version TO Revision;
+ALTER TABLE WizardScripts ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Battles ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE BattleParticipants ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Replays ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Ratings ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE RatingHistory ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE MatchmakingQueue ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Seasons ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE SeasonStandings ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Tournaments ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE TournamentEntrants ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE TournamentMatches ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE BattleJobs ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE AccessTokens ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE LoginAttempts ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Sessions ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Identities ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE UserTokens ADD COLUMN Version BIGINT NOT NULL DEFAULT 1;
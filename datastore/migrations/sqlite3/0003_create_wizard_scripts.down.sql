@@ -0,0 +1,3 @@
+ALTER TABLE Wizards DROP COLUMN ActiveScriptID;
+DROP INDEX IF EXISTS ix_WizardScriptsWizardID;
+DROP TABLE IF EXISTS WizardScripts;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ix_BattleParticipantsWizardID;
+DROP TABLE IF EXISTS BattleParticipants;
+DROP TABLE IF EXISTS Battles;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS Replays (
+	ID INTEGER PRIMARY KEY,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	BattleID INTEGER NOT NULL,
+	FormatVersion INTEGER NOT NULL,
+	Data BLOB NOT NULL,
+	CONSTRAINT uk_ReplaysBattleID UNIQUE (BattleID),
+	FOREIGN KEY (BattleID) REFERENCES Battles(ID)
+);
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS Ratings (
+	ID INTEGER PRIMARY KEY,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	WizardID INTEGER NOT NULL,
+	Rating DOUBLE NOT NULL,
+	Deviation DOUBLE NOT NULL,
+	Volatility DOUBLE NOT NULL,
+	Games INTEGER NOT NULL,
+	CONSTRAINT uk_RatingsWizardID UNIQUE (WizardID),
+	FOREIGN KEY (WizardID) REFERENCES Wizards(ID)
+);
+
+CREATE TABLE IF NOT EXISTS RatingHistory (
+	ID INTEGER PRIMARY KEY,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	WizardID INTEGER NOT NULL,
+	BattleID INTEGER NOT NULL,
+	Rating DOUBLE NOT NULL,
+	Deviation DOUBLE NOT NULL,
+	Volatility DOUBLE NOT NULL,
+	`Change` DOUBLE NOT NULL,
+	FOREIGN KEY (WizardID) REFERENCES Wizards(ID),
+	FOREIGN KEY (BattleID) REFERENCES Battles(ID)
+);
+
+CREATE INDEX ix_RatingHistoryWizardID ON RatingHistory(WizardID);
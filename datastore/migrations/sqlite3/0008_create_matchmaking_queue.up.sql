@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS MatchmakingQueue (
+	ID INTEGER PRIMARY KEY,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	WizardID INTEGER NOT NULL,
+	OwnerID INTEGER NOT NULL,
+	State VARCHAR(16) NOT NULL,
+	BattleID INTEGER NOT NULL DEFAULT 0,
+	Reason VARCHAR(255) NOT NULL DEFAULT '',
+	FOREIGN KEY (WizardID) REFERENCES Wizards(ID),
+	FOREIGN KEY (OwnerID) REFERENCES Users(ID)
+);
+
+CREATE INDEX ix_MatchmakingQueueState ON MatchmakingQueue(State);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS ix_RatingsSeasonID;
+ALTER TABLE RatingHistory DROP COLUMN SeasonID;
+ALTER TABLE Ratings DROP COLUMN SeasonGames;
+ALTER TABLE Ratings DROP COLUMN SeasonID;
+DROP TABLE IF EXISTS SeasonStandings;
+DROP TABLE IF EXISTS Seasons;
\ No newline at end of file
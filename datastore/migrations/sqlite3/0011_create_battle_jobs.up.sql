@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS BattleJobs (
+	ID INTEGER PRIMARY KEY,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	OwnerID INTEGER NOT NULL,
+	WizardIDs VARCHAR(255) NOT NULL,
+	Seed BIGINT NOT NULL,
+	State VARCHAR(16) NOT NULL,
+	Attempts INTEGER NOT NULL DEFAULT 0,
+	LeaseExpiry DATETIME,
+	BattleID INTEGER NOT NULL DEFAULT 0,
+	Reason VARCHAR(255) NOT NULL DEFAULT '',
+	FOREIGN KEY (OwnerID) REFERENCES Users(ID)
+);
+
+CREATE INDEX ix_BattleJobsState ON BattleJobs(State);
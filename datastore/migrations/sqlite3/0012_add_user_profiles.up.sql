@@ -0,0 +1,2 @@
+ALTER TABLE Users ADD COLUMN Name VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE Users ADD COLUMN TimeZone VARCHAR(64) NOT NULL DEFAULT 'UTC';
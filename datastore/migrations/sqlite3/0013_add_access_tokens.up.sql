@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS AccessTokens (
+	ID INTEGER PRIMARY KEY,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	UserID INTEGER NOT NULL,
+	Name VARCHAR(64) NOT NULL,
+	Hash CHAR(64) NOT NULL,
+	Scopes VARCHAR(255) NOT NULL,
+	ExpiryTime DATETIME,
+	FOREIGN KEY (UserID) REFERENCES Users(ID),
+	CONSTRAINT uk_AccessTokensHash UNIQUE (Hash)
+);
+
+CREATE INDEX ix_AccessTokensUserID ON AccessTokens(UserID);
@@ -0,0 +1 @@
+ALTER TABLE Users DROP COLUMN Disabled;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE Users ADD COLUMN Disabled BOOLEAN NOT NULL DEFAULT 0;
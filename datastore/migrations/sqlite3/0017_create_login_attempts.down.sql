@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS ix_LoginAttemptsIPAddress;
+DROP INDEX IF EXISTS ix_LoginAttemptsUsername;
+DROP INDEX IF EXISTS ix_LoginAttemptsUserID;
+DROP TABLE IF EXISTS LoginAttempts;
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS LoginAttempts (
+	ID INTEGER PRIMARY KEY,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	Username VARCHAR(128) NOT NULL,
+	UserID INTEGER NOT NULL,
+	IPAddress VARCHAR(45) NOT NULL,
+	Source VARCHAR(16) NOT NULL,
+	Outcome VARCHAR(16) NOT NULL,
+	Time DATETIME NOT NULL
+);
+
+CREATE INDEX ix_LoginAttemptsUserID ON LoginAttempts(UserID);
+CREATE INDEX ix_LoginAttemptsUsername ON LoginAttempts(Username, Time);
+CREATE INDEX ix_LoginAttemptsIPAddress ON LoginAttempts(IPAddress, Time);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ix_SessionsUserID;
+DROP TABLE IF EXISTS Sessions;
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS Sessions (
+	ID INTEGER PRIMARY KEY,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	UserID INTEGER NOT NULL,
+	Hash CHAR(64) NOT NULL,
+	Data TEXT NOT NULL,
+	UserAgent VARCHAR(255) NOT NULL,
+	IPAddress VARCHAR(45) NOT NULL,
+	LastSeenTime DATETIME NOT NULL,
+	ExpiryTime DATETIME NOT NULL,
+	CONSTRAINT uk_SessionsHash UNIQUE (Hash)
+);
+
+CREATE INDEX ix_SessionsUserID ON Sessions(UserID);
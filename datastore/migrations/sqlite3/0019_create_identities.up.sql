@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS Identities (
+	ID INTEGER PRIMARY KEY,
+	CreationTime DATETIME,
+	LastUpdatedTime DATETIME,
+	DeletionTime DATETIME,
+	Status INTEGER,
+	UserID INTEGER NOT NULL,
+	Provider VARCHAR(32) NOT NULL,
+	Subject VARCHAR(255) NOT NULL,
+	Email VARCHAR(254),
+	LastLoginTime DATETIME NOT NULL
+);
+
+CREATE INDEX ix_IdentitiesSubject ON Identities(Provider, Subject);
+CREATE INDEX ix_IdentitiesUserID ON Identities(UserID);
@@ -0,0 +1,3 @@
+ALTER TABLE Users ADD COLUMN TOTPSecret VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE Users ADD COLUMN TOTPCounter BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE Users ADD COLUMN RecoveryCodes VARCHAR(1024) NOT NULL DEFAULT '';
@@ -31,12 +31,22 @@ type LastUpdateTimeRecorder interface {
 	SetLastUpdatedTime(time.Time)
 }
 
+// VersionRecorder is implemented by records that are updated with
+// optimistic locking. The version goes up by one on every update, and an
+// update or delete of a record whose version is out of date fails with
+// ErrConflict.
+type VersionRecorder interface {
+	Version() int64
+	SetVersion(int64)
+}
+
 type BaseFields struct {
 	ID              uint64        `db:"ID, autoincrement, primarykey"`
 	Status          StatusCode    `db:"Status"`
 	CreationTime    gorp.NullTime `db:"CreationTime"`
 	LastUpdatedTime gorp.NullTime `db:"LastUpdatedTime"`
 	DeletionTime    gorp.NullTime `db:"DeletionTime"`
+	Version         int64         `db:"Version"`
 }
 
 type BaseRecord struct {
@@ -98,3 +108,11 @@ func (record *BaseRecord) LastUpdatedTime() time.Time {
 func (record *BaseRecord) SetLastUpdatedTime(time time.Time) {
 	record.BaseFields.LastUpdatedTime = gorp.NullTime{Time: time, Valid: !time.IsZero()}
 }
+
+func (record *BaseRecord) Version() int64 {
+	return record.BaseFields.Version
+}
+
+func (record *BaseRecord) SetVersion(version int64) {
+	record.BaseFields.Version = version
+}
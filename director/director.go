@@ -0,0 +1,288 @@
+// Package director runs tournaments: it closes registration once the
+// deadline has passed, generates the bracket, fights each match as soon as
+// its wizards are known and publishes the results.
+package director
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/battles"
+	"github.com/crob1140/codewiz-server/models/ratings"
+	"github.com/crob1140/codewiz-server/models/tournaments"
+	"github.com/crob1140/codewiz-server/models/wizards"
+	"github.com/crob1140/codewiz-server/simulator"
+)
+
+const (
+	DefaultInterval = 30 * time.Second
+)
+
+// Director periodically checks every open and running tournament.
+// Tournament battles are unranked, so they do not change any ratings.
+type Director struct {
+	TournamentDao *tournaments.Dao
+	WizardDao     *wizards.Dao
+	RatingDao     *ratings.Dao
+	BattleDao     *battles.Dao
+	Simulator     *simulator.Simulator
+
+	Interval time.Duration
+
+	rng  *rand.Rand
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func New(tournamentDao *tournaments.Dao, wizardDao *wizards.Dao, ratingDao *ratings.Dao, battleDao *battles.Dao, simulator *simulator.Simulator) *Director {
+	return &Director{
+		TournamentDao: tournamentDao,
+		WizardDao:     wizardDao,
+		RatingDao:     ratingDao,
+		BattleDao:     battleDao,
+		Simulator:     simulator,
+		Interval:      DefaultInterval,
+		rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Start begins running tournaments in the background until Stop is called.
+func (director *Director) Start() {
+	director.stop = make(chan struct{})
+	director.done.Add(1)
+
+	go func() {
+		defer director.done.Done()
+
+		ticker := time.NewTicker(director.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-director.stop:
+				return
+			case <-ticker.C:
+				if err := director.Run(); err != nil {
+					log.Error("Failed to run tournaments", log.Fields{"error": err})
+				}
+			}
+		}
+	}()
+}
+
+// Stop waits for any battle in progress to finish and then stops running tournaments.
+func (director *Director) Stop() {
+	close(director.stop)
+	director.done.Wait()
+}
+
+// Run starts every tournament whose registration has closed, and plays
+// every match that is ready in the running tournaments.
+func (director *Director) Run() error {
+	now := time.Now()
+
+	open, err := director.TournamentDao.GetByState(tournaments.Registration)
+	if err != nil {
+		return err
+	}
+
+	for _, tournament := range open {
+		if tournament.RegistrationDeadline.After(now) {
+			continue
+		}
+
+		if err := director.begin(tournament); err != nil {
+			log.Error("Failed to start tournament", log.Fields{"tournament": tournament.ID, "error": err})
+		}
+	}
+
+	running, err := director.TournamentDao.GetByState(tournaments.Running)
+	if err != nil {
+		return err
+	}
+
+	for _, tournament := range running {
+		if err := director.advance(tournament); err != nil {
+			log.Error("Failed to advance tournament", log.Fields{"tournament": tournament.ID, "error": err})
+		}
+	}
+
+	return nil
+}
+
+// begin seeds the entrants by rating and generates the bracket. A
+// tournament without enough entrants is cancelled instead.
+func (director *Director) begin(tournament *tournaments.Tournament) error {
+	entrants, err := director.TournamentDao.GetEntrants(tournament.ID)
+	if err != nil {
+		return err
+	}
+
+	matches, err := tournaments.Generate(tournament.Format, len(entrants))
+	if err == tournaments.ErrTooFewEntrants {
+		tournament.State = tournaments.Cancelled
+		tournament.Reason = "Not enough wizards registered before the deadline."
+		return director.TournamentDao.Update(tournament)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := director.seed(entrants); err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		match.TournamentID = tournament.ID
+		if err := director.TournamentDao.InsertMatch(match); err != nil {
+			return err
+		}
+	}
+
+	tournament.State = tournaments.Running
+	return director.TournamentDao.Update(tournament)
+}
+
+// seed orders the entrants by rating, with earlier registrations ahead of
+// later ones when the ratings are equal.
+func (director *Director) seed(entrants []*tournaments.Entrant) error {
+	scores := make(map[uint64]float64, len(entrants))
+	for _, entrant := range entrants {
+		rating, err := director.RatingDao.GetOrCreate(entrant.WizardID)
+		if err != nil {
+			return err
+		}
+		scores[entrant.WizardID] = rating.Rating
+	}
+
+	sort.SliceStable(entrants, func(i, j int) bool {
+		return scores[entrants[i].WizardID] > scores[entrants[j].WizardID]
+	})
+
+	for i, entrant := range entrants {
+		entrant.Seed = i + 1
+		if err := director.TournamentDao.UpdateEntrant(entrant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advance plays matches until none are ready, and publishes the results
+// once every match has been decided.
+func (director *Director) advance(tournament *tournaments.Tournament) error {
+	entrants, err := director.TournamentDao.GetEntrants(tournament.ID)
+	if err != nil {
+		return err
+	}
+
+	matches, err := director.TournamentDao.GetMatches(tournament.ID)
+	if err != nil {
+		return err
+	}
+
+	seeds := make(map[uint64]int, len(entrants))
+	for _, entrant := range entrants {
+		seeds[entrant.WizardID] = entrant.Seed
+	}
+
+	for {
+		for _, match := range tournaments.Resolve(matches, entrants) {
+			if err := director.TournamentDao.UpdateMatch(match); err != nil {
+				return err
+			}
+		}
+
+		played := false
+		for _, match := range matches {
+			if match.State != tournaments.Ready {
+				continue
+			}
+
+			if err := director.play(tournament, match, seeds); err != nil {
+				return err
+			}
+			if err := director.TournamentDao.UpdateMatch(match); err != nil {
+				return err
+			}
+			played = true
+		}
+
+		if !played {
+			break
+		}
+	}
+
+	if !tournaments.Done(matches) {
+		return nil
+	}
+
+	standings := tournaments.Standings(tournament.Format, matches, entrants)
+	tournament.State = tournaments.Finished
+	tournament.WinnerID = standings[0].WizardID
+	return director.TournamentDao.Update(tournament)
+}
+
+// play fights a match's battle. Wizards that have been deleted or no longer
+// have an active script forfeit the match.
+func (director *Director) play(tournament *tournaments.Tournament, match *tournaments.Match, seeds map[uint64]int) error {
+	var forfeits []uint64
+	for _, wizardID := range []uint64{match.FirstWizardID, match.SecondWizardID} {
+		wizard, err := director.WizardDao.GetByID(wizardID)
+		if err != nil {
+			return err
+		}
+		if wizard == nil || wizard.ActiveScriptID == 0 {
+			forfeits = append(forfeits, wizardID)
+		}
+	}
+
+	if len(forfeits) > 0 {
+		match.Forfeit(forfeits...)
+		return nil
+	}
+
+	battle, err := director.Simulator.Run([]uint64{match.FirstWizardID, match.SecondWizardID}, director.rng.Int63())
+	if err != nil {
+		return err
+	}
+
+	winnerID := battle.WinnerID
+	if winnerID == 0 && tournament.Format != tournaments.RoundRobin {
+		if winnerID, err = director.breakTie(battle, match, seeds); err != nil {
+			return err
+		}
+	}
+
+	match.Record(battle.ID, winnerID)
+	return nil
+}
+
+// breakTie decides a drawn elimination match in favour of the wizard with
+// more health remaining, or the higher seed if their health is equal.
+func (director *Director) breakTie(battle *battles.Battle, match *tournaments.Match, seeds map[uint64]int) (uint64, error) {
+	participants, err := director.BattleDao.GetParticipants(battle.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	health := make(map[uint64]int, len(participants))
+	for _, participant := range participants {
+		health[participant.WizardID] = participant.Health
+	}
+
+	first, second := match.FirstWizardID, match.SecondWizardID
+	switch {
+	case health[first] > health[second]:
+		return first, nil
+	case health[second] > health[first]:
+		return second, nil
+	case seeds[second] < seeds[first]:
+		return second, nil
+	default:
+		return first, nil
+	}
+}
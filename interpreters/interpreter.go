@@ -0,0 +1,206 @@
+package interpreters
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownLanguage = errors.New("No interpreter has been registered for the requested language.")
+	ErrNoDecision      = errors.New("The script did not return an action.")
+)
+
+// Interpreter compiles wizard AI scripts written in a single language.
+// Implementations are registered by language name, so that new languages
+// can be supported without any changes to the battle code.
+type Interpreter interface {
+	// Language returns the name the interpreter is registered under.
+	Language() string
+
+	// Validate checks that the source is well-formed and defines the
+	// entry point, without preparing it for execution.
+	Validate(source string) error
+
+	// Compile turns the source into a Script that can be asked for a
+	// decision on every tick of a battle.
+	Compile(source string) (Script, error)
+}
+
+// Script is a compiled wizard AI. A script may keep state between calls
+// to Decide, so each wizard in a battle needs its own instance.
+//
+// Scripts must report the resources they use to the meter, and should
+// normally be run inside a Sandbox rather than called directly.
+type Script interface {
+	Decide(view View, meter Meter) (Action, error)
+}
+
+// ---------------------
+// - Arena state views
+// ---------------------
+
+// View is the read-only snapshot of the arena that is handed to a script
+// when it is asked to decide on its next action. Views are rebuilt by the
+// arena on every tick, so changes made by a script are never observed by
+// the battle itself.
+type View struct {
+	Tick      int
+	MaxTicks  int
+	Width     int
+	Height    int
+	Obstacles []Position
+	Self      WizardView
+	Opponents []WizardView
+	Spells    []SpellView
+
+	// Random is a value drawn from the battle's seeded source, giving
+	// scripts access to randomness without breaking determinism.
+	Random int64
+}
+
+type Position struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Distance returns the number of single-square moves needed to travel
+// between two positions, ignoring obstacles.
+func Distance(from Position, to Position) int {
+	return abs(from.X-to.X) + abs(from.Y-to.Y)
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+type WizardView struct {
+	ID        uint64
+	Name      string
+	Position  Position
+	Health    int
+	MaxHealth int
+	Mana      int
+	MaxMana   int
+	Alive     bool
+
+	// Cooldowns holds the number of ticks remaining before each spell
+	// can be cast again. Spells that are ready are omitted.
+	Cooldowns map[string]int
+}
+
+type SpellView struct {
+	Name     string
+	ManaCost int
+	Cooldown int
+	Range    int
+	Damage   int
+	Area     int
+}
+
+// ----------
+// - Actions
+// ----------
+
+type ActionType uint
+
+const (
+	Wait ActionType = iota // the zero-value, so an empty Action does nothing
+	Move
+	Cast
+)
+
+func (actionType ActionType) String() string {
+	switch actionType {
+	case Move:
+		return "move"
+	case Cast:
+		return "cast"
+	default:
+		return "wait"
+	}
+}
+
+// Action is the decision a script makes for a single tick. Move actions
+// step the wizard one square towards Target, and Cast actions aim Spell
+// at Target.
+type Action struct {
+	Type   ActionType
+	Spell  string
+	Target Position
+}
+
+func WaitAction() Action {
+	return Action{Type: Wait}
+}
+
+func MoveAction(target Position) Action {
+	return Action{Type: Move, Target: target}
+}
+
+func CastAction(spell string, target Position) Action {
+	return Action{Type: Cast, Spell: spell, Target: target}
+}
+
+// -----------
+// - Registry
+// -----------
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]Interpreter)
+)
+
+// Register makes an interpreter available under its language name.
+// It is intended to be called from the init function of the package
+// that implements the interpreter, and panics if the name is taken.
+func Register(interpreter Interpreter) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	language := interpreter.Language()
+	if _, exists := registry[language]; exists {
+		panic("interpreters: Register called twice for language " + language)
+	}
+
+	registry[language] = interpreter
+}
+
+func Get(language string) (Interpreter, error) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	interpreter, exists := registry[language]
+	if !exists {
+		return nil, ErrUnknownLanguage
+	}
+
+	return interpreter, nil
+}
+
+// Languages returns the names of all registered interpreters in sorted order.
+func Languages() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	languages := make([]string, 0, len(registry))
+	for language := range registry {
+		languages = append(languages, language)
+	}
+
+	sort.Strings(languages)
+	return languages
+}
+
+// Compile looks up the interpreter for the given language and uses it to compile the source.
+func Compile(language string, source string) (Script, error) {
+	interpreter, err := Get(language)
+	if err != nil {
+		return nil, err
+	}
+
+	return interpreter.Compile(source)
+}
@@ -0,0 +1,554 @@
+package lisp
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+var builtins = map[Symbol]func(*machine, []Value) (Value, error){
+	// Arithmetic
+	"+":   arithmetic("+", 0, func(a, b int64) (int64, error) { return a + b, nil }),
+	"*":   arithmetic("*", 1, func(a, b int64) (int64, error) { return a * b, nil }),
+	"-":   subtract,
+	"/":   binaryInteger("/", divide),
+	"mod": binaryInteger("mod", modulo),
+	"abs": abs,
+	"min": arithmetic("min", 0, func(a, b int64) (int64, error) {
+		if b < a {
+			return b, nil
+		}
+		return a, nil
+	}),
+	"max": arithmetic("max", 0, func(a, b int64) (int64, error) {
+		if b > a {
+			return b, nil
+		}
+		return a, nil
+	}),
+
+	// Comparison
+	"=":      comparison("=", func(a, b int64) bool { return a == b }),
+	"<":      comparison("<", func(a, b int64) bool { return a < b }),
+	">":      comparison(">", func(a, b int64) bool { return a > b }),
+	"<=":     comparison("<=", func(a, b int64) bool { return a <= b }),
+	">=":     comparison(">=", func(a, b int64) bool { return a >= b }),
+	"not":    not,
+	"eq?":    equal,
+	"equal?": equal,
+
+	// Type predicates
+	"null?":      predicate(func(v Value) bool { return v == nil }),
+	"pair?":      predicate(func(v Value) bool { _, ok := v.(*Pair); return ok }),
+	"integer?":   predicate(func(v Value) bool { _, ok := v.(int64); return ok }),
+	"string?":    predicate(func(v Value) bool { _, ok := v.(string); return ok }),
+	"symbol?":    predicate(func(v Value) bool { _, ok := v.(Symbol); return ok }),
+	"record?":    predicate(func(v Value) bool { _, ok := v.(Record); return ok }),
+	"procedure?": predicate(isProcedure),
+
+	// Lists
+	"list":    listBuiltin,
+	"cons":    consBuiltin,
+	"car":     car,
+	"cdr":     cdr,
+	"length":  length,
+	"nth":     nth,
+	"append":  appendBuiltin,
+	"reverse": reverse,
+	"map":     mapBuiltin,
+	"filter":  filter,
+	"foldl":   foldl,
+	"apply":   applyBuiltin,
+
+	// Strings
+	"string-append": stringAppend,
+
+	// Records
+	"get":  get,
+	"has?": has,
+
+	// Arena helpers
+	"distance": distance,
+
+	// Actions
+	"wait": wait,
+	"move": move,
+	"cast": cast,
+}
+
+func isProcedure(value Value) bool {
+	switch value.(type) {
+	case *Lambda, *Builtin:
+		return true
+	}
+	return false
+}
+
+func expectArgs(name string, args []Value, count int) error {
+	if len(args) != count {
+		return runtimeErrorf("%s expects %d arguments but was given %d", name, count, len(args))
+	}
+	return nil
+}
+
+func integerArg(name string, value Value) (int64, error) {
+	integer, ok := value.(int64)
+	if !ok {
+		return 0, runtimeErrorf("%s expects integer arguments but was given %s", name, typeName(value))
+	}
+	return integer, nil
+}
+
+func arithmetic(name string, identity int64, op func(int64, int64) (int64, error)) func(*machine, []Value) (Value, error) {
+	return func(m *machine, args []Value) (Value, error) {
+		if len(args) == 0 {
+			return identity, nil
+		}
+
+		result, err := integerArg(name, args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, arg := range args[1:] {
+			operand, err := integerArg(name, arg)
+			if err != nil {
+				return nil, err
+			}
+			if result, err = op(result, operand); err != nil {
+				return nil, err
+			}
+		}
+
+		return result, nil
+	}
+}
+
+func subtract(m *machine, args []Value) (Value, error) {
+	if len(args) == 1 {
+		value, err := integerArg("-", args[0])
+		return -value, err
+	}
+	return arithmetic("-", 0, func(a, b int64) (int64, error) { return a - b, nil })(m, args)
+}
+
+func binaryInteger(name string, op func(int64, int64) (int64, error)) func(*machine, []Value) (Value, error) {
+	return func(m *machine, args []Value) (Value, error) {
+		if err := expectArgs(name, args, 2); err != nil {
+			return nil, err
+		}
+		return arithmetic(name, 0, op)(m, args)
+	}
+}
+
+func divide(a, b int64) (int64, error) {
+	if b == 0 {
+		return 0, runtimeErrorf("division by zero")
+	}
+	return a / b, nil
+}
+
+func modulo(a, b int64) (int64, error) {
+	if b == 0 {
+		return 0, runtimeErrorf("division by zero")
+	}
+	result := a % b
+	if result != 0 && (result < 0) != (b < 0) {
+		result += b
+	}
+	return result, nil
+}
+
+func abs(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("abs", args, 1); err != nil {
+		return nil, err
+	}
+	value, err := integerArg("abs", args[0])
+	if value < 0 {
+		value = -value
+	}
+	return value, err
+}
+
+func comparison(name string, compare func(int64, int64) bool) func(*machine, []Value) (Value, error) {
+	return func(m *machine, args []Value) (Value, error) {
+		if len(args) < 2 {
+			return nil, runtimeErrorf("%s expects at least 2 arguments", name)
+		}
+
+		previous, err := integerArg(name, args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		result := true
+		for _, arg := range args[1:] {
+			current, err := integerArg(name, arg)
+			if err != nil {
+				return nil, err
+			}
+			result = result && compare(previous, current)
+			previous = current
+		}
+
+		return result, nil
+	}
+}
+
+func not(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("not", args, 1); err != nil {
+		return nil, err
+	}
+	return !truthy(args[0]), nil
+}
+
+func equal(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("equal?", args, 2); err != nil {
+		return nil, err
+	}
+	return reflect.DeepEqual(args[0], args[1]), nil
+}
+
+func predicate(test func(Value) bool) func(*machine, []Value) (Value, error) {
+	return func(m *machine, args []Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, runtimeErrorf("predicates expect 1 argument but were given %d", len(args))
+		}
+		return test(args[0]), nil
+	}
+}
+
+func listBuiltin(m *machine, args []Value) (Value, error) {
+	if err := m.allocateList(len(args)); err != nil {
+		return nil, err
+	}
+	return list(args...), nil
+}
+
+func consBuiltin(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("cons", args, 2); err != nil {
+		return nil, err
+	}
+	if err := m.allocateList(1); err != nil {
+		return nil, err
+	}
+	return cons(args[0], args[1]), nil
+}
+
+func pairArg(name string, value Value) (*Pair, error) {
+	pair, ok := value.(*Pair)
+	if !ok {
+		return nil, runtimeErrorf("%s expects a non-empty list but was given %s", name, typeName(value))
+	}
+	return pair, nil
+}
+
+func listArg(name string, value Value) ([]Value, error) {
+	values, ok := toSlice(value)
+	if !ok {
+		return nil, runtimeErrorf("%s expects a list but was given %s", name, typeName(value))
+	}
+	return values, nil
+}
+
+func car(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("car", args, 1); err != nil {
+		return nil, err
+	}
+	pair, err := pairArg("car", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return pair.Car, nil
+}
+
+func cdr(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("cdr", args, 1); err != nil {
+		return nil, err
+	}
+	pair, err := pairArg("cdr", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return pair.Cdr, nil
+}
+
+func length(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("length", args, 1); err != nil {
+		return nil, err
+	}
+	values, err := listArg("length", args[0])
+	return int64(len(values)), err
+}
+
+func nth(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("nth", args, 2); err != nil {
+		return nil, err
+	}
+	values, err := listArg("nth", args[0])
+	if err != nil {
+		return nil, err
+	}
+	index, err := integerArg("nth", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= int64(len(values)) {
+		return nil, runtimeErrorf("nth index %d is out of range", index)
+	}
+	return values[index], nil
+}
+
+func appendBuiltin(m *machine, args []Value) (Value, error) {
+	var combined []Value
+	for _, arg := range args {
+		values, err := listArg("append", arg)
+		if err != nil {
+			return nil, err
+		}
+		combined = append(combined, values...)
+	}
+	if err := m.allocateList(len(combined)); err != nil {
+		return nil, err
+	}
+	return list(combined...), nil
+}
+
+func reverse(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("reverse", args, 1); err != nil {
+		return nil, err
+	}
+	values, err := listArg("reverse", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := m.allocateList(len(values)); err != nil {
+		return nil, err
+	}
+	var result Value
+	for _, value := range values {
+		result = cons(value, result)
+	}
+	return result, nil
+}
+
+func mapBuiltin(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("map", args, 2); err != nil {
+		return nil, err
+	}
+	values, err := listArg("map", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := m.allocateList(len(values)); err != nil {
+		return nil, err
+	}
+	results := make([]Value, len(values))
+	for i, value := range values {
+		if results[i], err = m.apply(args[0], []Value{value}); err != nil {
+			return nil, err
+		}
+	}
+	return list(results...), nil
+}
+
+func filter(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("filter", args, 2); err != nil {
+		return nil, err
+	}
+	values, err := listArg("filter", args[1])
+	if err != nil {
+		return nil, err
+	}
+	var results []Value
+	for _, value := range values {
+		keep, err := m.apply(args[0], []Value{value})
+		if err != nil {
+			return nil, err
+		}
+		if truthy(keep) {
+			results = append(results, value)
+		}
+	}
+	if err := m.allocateList(len(results)); err != nil {
+		return nil, err
+	}
+	return list(results...), nil
+}
+
+func foldl(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("foldl", args, 3); err != nil {
+		return nil, err
+	}
+	values, err := listArg("foldl", args[2])
+	if err != nil {
+		return nil, err
+	}
+	accumulator := args[1]
+	for _, value := range values {
+		if accumulator, err = m.apply(args[0], []Value{accumulator, value}); err != nil {
+			return nil, err
+		}
+	}
+	return accumulator, nil
+}
+
+func applyBuiltin(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("apply", args, 2); err != nil {
+		return nil, err
+	}
+	values, err := listArg("apply", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return m.apply(args[0], values)
+}
+
+func stringAppend(m *machine, args []Value) (Value, error) {
+	var builder strings.Builder
+	for _, arg := range args {
+		str, ok := arg.(string)
+		if !ok {
+			return nil, runtimeErrorf("string-append expects strings but was given %s", typeName(arg))
+		}
+		if err := m.meter.Allocate(int64(len(str))); err != nil {
+			return nil, err
+		}
+		builder.WriteString(str)
+	}
+	return builder.String(), nil
+}
+
+func fieldName(name string, value Value) (string, error) {
+	switch field := value.(type) {
+	case Symbol:
+		return string(field), nil
+	case string:
+		return field, nil
+	default:
+		return "", runtimeErrorf("%s expects a field name but was given %s", name, typeName(value))
+	}
+}
+
+func get(m *machine, args []Value) (Value, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, runtimeErrorf("get expects 2 or 3 arguments but was given %d", len(args))
+	}
+	record, ok := args[0].(Record)
+	if !ok {
+		return nil, runtimeErrorf("get expects a record but was given %s", typeName(args[0]))
+	}
+	field, err := fieldName("get", args[1])
+	if err != nil {
+		return nil, err
+	}
+	value, exists := record[field]
+	if !exists {
+		if len(args) == 3 {
+			return args[2], nil
+		}
+		return nil, runtimeErrorf("record has no field '%s'", field)
+	}
+	return value, nil
+}
+
+func has(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("has?", args, 2); err != nil {
+		return nil, err
+	}
+	record, ok := args[0].(Record)
+	if !ok {
+		return nil, runtimeErrorf("has? expects a record but was given %s", typeName(args[0]))
+	}
+	field, err := fieldName("has?", args[1])
+	if err != nil {
+		return nil, err
+	}
+	_, exists := record[field]
+	return exists, nil
+}
+
+// positionArgs accepts either a record with x and y fields, or two integers.
+func positionArgs(name string, args []Value) (interpreters.Position, []Value, error) {
+	if len(args) == 0 {
+		return interpreters.Position{}, nil, runtimeErrorf("%s expects a position", name)
+	}
+
+	if record, ok := args[0].(Record); ok {
+		// Allow wizards to be passed directly, since they hold their position as a field
+		if position, ok := record["position"].(Record); ok {
+			record = position
+		}
+		x, xErr := integerArg(name, record["x"])
+		y, yErr := integerArg(name, record["y"])
+		if xErr != nil || yErr != nil {
+			return interpreters.Position{}, nil, runtimeErrorf("%s expects a record with x and y fields", name)
+		}
+		return interpreters.Position{X: int(x), Y: int(y)}, args[1:], nil
+	}
+
+	if len(args) < 2 {
+		return interpreters.Position{}, nil, runtimeErrorf("%s expects x and y coordinates", name)
+	}
+	x, err := integerArg(name, args[0])
+	if err != nil {
+		return interpreters.Position{}, nil, err
+	}
+	y, err := integerArg(name, args[1])
+	if err != nil {
+		return interpreters.Position{}, nil, err
+	}
+	return interpreters.Position{X: int(x), Y: int(y)}, args[2:], nil
+}
+
+func distance(m *machine, args []Value) (Value, error) {
+	from, rest, err := positionArgs("distance", args)
+	if err != nil {
+		return nil, err
+	}
+	to, rest, err := positionArgs("distance", rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, runtimeErrorf("distance was given too many arguments")
+	}
+	return int64(interpreters.Distance(from, to)), nil
+}
+
+func wait(m *machine, args []Value) (Value, error) {
+	if err := expectArgs("wait", args, 0); err != nil {
+		return nil, err
+	}
+	return interpreters.WaitAction(), nil
+}
+
+func move(m *machine, args []Value) (Value, error) {
+	target, rest, err := positionArgs("move", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, runtimeErrorf("move was given too many arguments")
+	}
+	return interpreters.MoveAction(target), nil
+}
+
+func cast(m *machine, args []Value) (Value, error) {
+	if len(args) == 0 {
+		return nil, runtimeErrorf("cast expects a spell name and a target")
+	}
+	spell, err := fieldName("cast", args[0])
+	if err != nil {
+		return nil, err
+	}
+	target, rest, err := positionArgs("cast", args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, runtimeErrorf("cast was given too many arguments")
+	}
+	return interpreters.CastAction(spell, target), nil
+}
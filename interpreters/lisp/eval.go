@@ -0,0 +1,426 @@
+package lisp
+
+import (
+	"fmt"
+
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+// maxDepth bounds the nesting of evaluations regardless of the meter's
+// limits, so that runaway recursion can never exhaust the Go stack.
+const maxDepth = 10000
+
+// Approximate sizes used when reporting allocations to the meter
+const (
+	pairSize  = 32
+	envSize   = 64
+	entrySize = 32
+)
+
+// RuntimeError describes a problem that occurred while evaluating a script.
+type RuntimeError struct {
+	Message string
+}
+
+func (err *RuntimeError) Error() string {
+	return err.Message
+}
+
+func runtimeErrorf(format string, args ...interface{}) error {
+	return &RuntimeError{Message: fmt.Sprintf(format, args...)}
+}
+
+// machine holds the state of a single evaluation.
+type machine struct {
+	depth int
+	meter interpreters.Meter
+}
+
+func newMachine(meter interpreters.Meter) *machine {
+	return &machine{meter: meter}
+}
+
+func (m *machine) eval(expr Value, env *Env) (Value, error) {
+	m.depth++
+	defer func() { m.depth-- }()
+	if m.depth > maxDepth {
+		return nil, interpreters.ErrCallDepthLimit
+	}
+
+	// A frame counts towards the script's call depth once it starts
+	// evaluating a procedure body. Tail calls reuse the frame, so they
+	// do not increase the depth any further.
+	inProcedure := false
+	defer func() {
+		if inProcedure {
+			m.meter.Leave()
+		}
+	}()
+
+	// Expressions in tail position are evaluated by looping rather than
+	// recursing, so that iterative procedures run in constant stack space.
+	for {
+		if err := m.meter.Step(); err != nil {
+			return nil, err
+		}
+
+		switch e := expr.(type) {
+		case Symbol:
+			value, ok := env.lookup(e)
+			if !ok {
+				return nil, runtimeErrorf("undefined symbol '%s'", e)
+			}
+			return value, nil
+
+		case *Pair:
+			// handled below
+
+		default:
+			// Everything other than symbols and lists evaluates to itself
+			return expr, nil
+		}
+
+		pair := expr.(*Pair)
+		args, ok := toSlice(pair.Cdr)
+		if !ok {
+			return nil, runtimeErrorf("cannot evaluate improper list %s", format(expr))
+		}
+
+		if name, isSymbol := pair.Car.(Symbol); isSymbol {
+			switch name {
+			case "quote":
+				if len(args) != 1 {
+					return nil, runtimeErrorf("quote expects 1 argument")
+				}
+				return args[0], nil
+
+			case "if":
+				if len(args) < 2 || len(args) > 3 {
+					return nil, runtimeErrorf("if expects 2 or 3 arguments")
+				}
+				test, err := m.eval(args[0], env)
+				if err != nil {
+					return nil, err
+				}
+				if truthy(test) {
+					expr = args[1]
+				} else if len(args) == 3 {
+					expr = args[2]
+				} else {
+					return false, nil
+				}
+				continue
+
+			case "cond":
+				next, done, result, err := m.evalCond(args, env)
+				if err != nil || done {
+					return result, err
+				}
+				expr = next
+				continue
+
+			case "and", "or":
+				if len(args) == 0 {
+					return name == "and", nil
+				}
+				var result Value
+				var err error
+				shortCircuited := false
+				for _, arg := range args[:len(args)-1] {
+					if result, err = m.eval(arg, env); err != nil {
+						return nil, err
+					}
+					if truthy(result) == (name == "or") {
+						shortCircuited = true
+						break
+					}
+				}
+				if shortCircuited {
+					return result, nil
+				}
+				expr = args[len(args)-1]
+				continue
+
+			case "define":
+				return m.evalDefine(args, env)
+
+			case "set!":
+				if len(args) != 2 {
+					return nil, runtimeErrorf("set! expects 2 arguments")
+				}
+				target, ok := args[0].(Symbol)
+				if !ok {
+					return nil, runtimeErrorf("set! expects a symbol")
+				}
+				value, err := m.eval(args[1], env)
+				if err != nil {
+					return nil, err
+				}
+				if !env.set(target, value) {
+					return nil, runtimeErrorf("cannot set undefined symbol '%s'", target)
+				}
+				return value, nil
+
+			case "lambda":
+				if len(args) < 2 {
+					return nil, runtimeErrorf("lambda expects a parameter list and a body")
+				}
+				return m.makeLambda("lambda", args[0], args[1:], env)
+
+			case "let":
+				if len(args) < 2 {
+					return nil, runtimeErrorf("let expects bindings and a body")
+				}
+				bindings, ok := toSlice(args[0])
+				if !ok {
+					return nil, runtimeErrorf("let expects a list of bindings")
+				}
+				if err := m.allocateEnv(len(bindings)); err != nil {
+					return nil, err
+				}
+				letEnv := newEnv(env)
+				for _, binding := range bindings {
+					parts, ok := toSlice(binding)
+					if !ok || len(parts) != 2 {
+						return nil, runtimeErrorf("let bindings must have the form (name value)")
+					}
+					name, ok := parts[0].(Symbol)
+					if !ok {
+						return nil, runtimeErrorf("let binding names must be symbols")
+					}
+					value, err := m.eval(parts[1], env)
+					if err != nil {
+						return nil, err
+					}
+					letEnv.define(name, value)
+				}
+				if err := m.evalAllButLast(args[1:], letEnv); err != nil {
+					return nil, err
+				}
+				expr, env = args[len(args)-1], letEnv
+				continue
+
+			case "begin":
+				if len(args) == 0 {
+					return nil, nil
+				}
+				if err := m.evalAllButLast(args, env); err != nil {
+					return nil, err
+				}
+				expr = args[len(args)-1]
+				continue
+			}
+		}
+
+		// Procedure application
+		procedure, err := m.eval(pair.Car, env)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]Value, len(args))
+		for i, arg := range args {
+			if values[i], err = m.eval(arg, env); err != nil {
+				return nil, err
+			}
+		}
+
+		switch p := procedure.(type) {
+		case *Builtin:
+			return p.Fn(m, values)
+		case *Lambda:
+			if !inProcedure {
+				if err := m.meter.Enter(); err != nil {
+					return nil, err
+				}
+				inProcedure = true
+			}
+			callEnv, err := m.bindArguments(p, values)
+			if err != nil {
+				return nil, err
+			}
+			if err := m.evalAllButLast(p.Body, callEnv); err != nil {
+				return nil, err
+			}
+			expr, env = p.Body[len(p.Body)-1], callEnv
+		default:
+			return nil, runtimeErrorf("cannot call %s", typeName(procedure))
+		}
+	}
+}
+
+// apply calls a procedure with already-evaluated arguments.
+func (m *machine) apply(procedure Value, args []Value) (Value, error) {
+	switch p := procedure.(type) {
+	case *Builtin:
+		return p.Fn(m, args)
+	case *Lambda:
+		if err := m.meter.Enter(); err != nil {
+			return nil, err
+		}
+		defer m.meter.Leave()
+
+		callEnv, err := m.bindArguments(p, args)
+		if err != nil {
+			return nil, err
+		}
+		var result Value
+		for _, expr := range p.Body {
+			if result, err = m.eval(expr, callEnv); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	default:
+		return nil, runtimeErrorf("cannot call %s", typeName(procedure))
+	}
+}
+
+func (m *machine) evalAllButLast(exprs []Value, env *Env) error {
+	for _, expr := range exprs[:len(exprs)-1] {
+		if _, err := m.eval(expr, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalCond returns either the expression in tail position that should
+// be evaluated next, or the final result if no further evaluation is needed.
+func (m *machine) evalCond(clauses []Value, env *Env) (Value, bool, Value, error) {
+	for _, clause := range clauses {
+		parts, ok := toSlice(clause)
+		if !ok || len(parts) == 0 {
+			return nil, true, nil, runtimeErrorf("cond clauses must be non-empty lists")
+		}
+
+		var test Value
+		if parts[0] == Symbol("else") {
+			test = true
+		} else {
+			var err error
+			if test, err = m.eval(parts[0], env); err != nil {
+				return nil, true, nil, err
+			}
+		}
+
+		if truthy(test) {
+			if len(parts) == 1 {
+				return nil, true, test, nil
+			}
+			if err := m.evalAllButLast(parts[1:], env); err != nil {
+				return nil, true, nil, err
+			}
+			return parts[len(parts)-1], false, nil, nil
+		}
+	}
+
+	return nil, true, false, nil
+}
+
+func (m *machine) evalDefine(args []Value, env *Env) (Value, error) {
+	if len(args) < 2 {
+		return nil, runtimeErrorf("define expects a name and a value")
+	}
+
+	switch target := args[0].(type) {
+	case Symbol:
+		if len(args) != 2 {
+			return nil, runtimeErrorf("define expects a single value")
+		}
+		value, err := m.eval(args[1], env)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.meter.Allocate(entrySize); err != nil {
+			return nil, err
+		}
+		if lambda, ok := value.(*Lambda); ok && lambda.Name == "lambda" {
+			lambda.Name = string(target)
+		}
+		env.define(target, value)
+		return target, nil
+
+	case *Pair:
+		// (define (name params...) body...)
+		name, ok := target.Car.(Symbol)
+		if !ok {
+			return nil, runtimeErrorf("procedure names must be symbols")
+		}
+		lambda, err := m.makeLambda(string(name), target.Cdr, args[1:], env)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.meter.Allocate(entrySize); err != nil {
+			return nil, err
+		}
+		env.define(name, lambda)
+		return name, nil
+
+	default:
+		return nil, runtimeErrorf("cannot define %s", typeName(target))
+	}
+}
+
+func (m *machine) makeLambda(name string, params Value, body []Value, env *Env) (*Lambda, error) {
+	if err := m.meter.Allocate(envSize); err != nil {
+		return nil, err
+	}
+
+	lambda := &Lambda{Name: name, Body: body, Env: env}
+
+	// Parameters may be a proper list, an improper list ending in a rest
+	// parameter, or a single symbol that collects every argument.
+	for params != nil {
+		switch p := params.(type) {
+		case Symbol:
+			lambda.Rest = p
+			params = nil
+		case *Pair:
+			param, ok := p.Car.(Symbol)
+			if !ok {
+				return nil, runtimeErrorf("parameter names must be symbols")
+			}
+			lambda.Params = append(lambda.Params, param)
+			params = p.Cdr
+		default:
+			return nil, runtimeErrorf("invalid parameter list")
+		}
+	}
+
+	return lambda, nil
+}
+
+func (m *machine) bindArguments(lambda *Lambda, args []Value) (*Env, error) {
+	if len(args) < len(lambda.Params) || (lambda.Rest == "" && len(args) > len(lambda.Params)) {
+		return nil, runtimeErrorf("%s expects %d arguments but was given %d", lambda.Name, len(lambda.Params), len(args))
+	}
+
+	if err := m.allocateEnv(len(args)); err != nil {
+		return nil, err
+	}
+
+	env := newEnv(lambda.Env)
+	for i, param := range lambda.Params {
+		env.define(param, args[i])
+	}
+
+	if lambda.Rest != "" {
+		rest := args[len(lambda.Params):]
+		if err := m.meter.Allocate(int64(len(rest)) * pairSize); err != nil {
+			return nil, err
+		}
+		env.define(lambda.Rest, list(rest...))
+	}
+
+	return env, nil
+}
+
+func (m *machine) allocateEnv(entries int) error {
+	return m.meter.Allocate(envSize + int64(entries)*entrySize)
+}
+
+// allocateList reports the memory needed for a new list of the given length.
+func (m *machine) allocateList(length int) error {
+	return m.meter.Allocate(int64(length) * pairSize)
+}
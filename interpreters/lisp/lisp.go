@@ -0,0 +1,210 @@
+// Package lisp implements a small, embedded Lisp dialect for writing
+// wizard AI. Scripts must define a procedure named decide that takes
+// the current arena state as a record and returns an action:
+//
+//	(define (decide state)
+//	  (let ((target (car (get state 'opponents))))
+//	    (if (<= (distance (get state 'self) target) 3)
+//	        (cast "fireball" target)
+//	        (move target))))
+//
+// Top-level definitions are evaluated once, before the first decision,
+// and global variables keep their values between ticks. Every evaluation
+// step, procedure call and allocation is reported to the meter, so that
+// scripts can be run safely inside an interpreters.Sandbox.
+package lisp
+
+import (
+	"errors"
+
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+const (
+	Language = "lisp"
+
+	entryPoint = Symbol("decide")
+)
+
+var ErrMissingEntryPoint = errors.New("The script must define a procedure named 'decide' that takes a single argument.")
+
+func init() {
+	interpreters.Register(&Interpreter{})
+}
+
+type Interpreter struct{}
+
+func (interpreter *Interpreter) Language() string {
+	return Language
+}
+
+func (interpreter *Interpreter) Validate(source string) error {
+	_, err := parse(source)
+	return err
+}
+
+func (interpreter *Interpreter) Compile(source string) (interpreters.Script, error) {
+	forms, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Script{forms: forms}, nil
+}
+
+// parse reads the source and checks that it contains a suitable entry point.
+func parse(source string) ([]Value, error) {
+	forms, err := read(source)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, form := range forms {
+		if definesEntryPoint(form) {
+			return forms, nil
+		}
+	}
+
+	return nil, ErrMissingEntryPoint
+}
+
+// definesEntryPoint reports whether the form is (define (decide x) ...) or (define decide (lambda (x) ...)).
+func definesEntryPoint(form Value) bool {
+	parts, ok := toSlice(form)
+	if !ok || len(parts) < 3 || parts[0] != Symbol("define") {
+		return false
+	}
+
+	if signature, ok := toSlice(parts[1]); ok && len(signature) == 2 {
+		return signature[0] == entryPoint
+	}
+
+	if parts[1] != entryPoint || len(parts) != 3 {
+		return false
+	}
+
+	lambda, ok := toSlice(parts[2])
+	if !ok || len(lambda) < 3 || lambda[0] != Symbol("lambda") {
+		return false
+	}
+
+	params, ok := toSlice(lambda[1])
+	return ok && len(params) == 1
+}
+
+type Script struct {
+	forms   []Value
+	globals *Env
+	initErr error
+}
+
+func (script *Script) Decide(view interpreters.View, meter interpreters.Meter) (interpreters.Action, error) {
+	m := newMachine(meter)
+
+	// The top-level forms are evaluated on the first decision rather than
+	// at compile time, so that they run under the same conditions as decide.
+	if script.globals == nil && script.initErr == nil {
+		script.globals, script.initErr = script.initGlobals(m)
+	}
+
+	if script.initErr != nil {
+		return interpreters.Action{}, script.initErr
+	}
+
+	decide, _ := script.globals.lookup(entryPoint)
+	result, err := m.apply(decide, []Value{viewToRecord(view)})
+	if err != nil {
+		return interpreters.Action{}, err
+	}
+
+	action, ok := result.(interpreters.Action)
+	if !ok {
+		return interpreters.Action{}, interpreters.ErrNoDecision
+	}
+
+	return action, nil
+}
+
+func (script *Script) initGlobals(m *machine) (*Env, error) {
+	globals := newEnv(nil)
+	for name, fn := range builtins {
+		globals.define(name, &Builtin{Name: string(name), Fn: fn})
+	}
+
+	for _, form := range script.forms {
+		if _, err := m.eval(form, globals); err != nil {
+			return nil, err
+		}
+	}
+
+	if decide, _ := globals.lookup(entryPoint); !isProcedure(decide) {
+		return nil, ErrMissingEntryPoint
+	}
+
+	return globals, nil
+}
+
+// --------------------
+// - State conversion
+// --------------------
+
+func viewToRecord(view interpreters.View) Record {
+	opponents := make([]Value, len(view.Opponents))
+	for i, opponent := range view.Opponents {
+		opponents[i] = wizardToRecord(opponent)
+	}
+
+	obstacles := make([]Value, len(view.Obstacles))
+	for i, obstacle := range view.Obstacles {
+		obstacles[i] = positionToRecord(obstacle)
+	}
+
+	spells := make([]Value, len(view.Spells))
+	for i, spell := range view.Spells {
+		spells[i] = Record{
+			"name":      spell.Name,
+			"mana-cost": int64(spell.ManaCost),
+			"cooldown":  int64(spell.Cooldown),
+			"range":     int64(spell.Range),
+			"damage":    int64(spell.Damage),
+			"area":      int64(spell.Area),
+		}
+	}
+
+	return Record{
+		"tick":      int64(view.Tick),
+		"max-ticks": int64(view.MaxTicks),
+		"width":     int64(view.Width),
+		"height":    int64(view.Height),
+		"obstacles": list(obstacles...),
+		"self":      wizardToRecord(view.Self),
+		"opponents": list(opponents...),
+		"spells":    list(spells...),
+		"random":    view.Random,
+	}
+}
+
+func wizardToRecord(wizard interpreters.WizardView) Record {
+	cooldowns := make(Record, len(wizard.Cooldowns))
+	for spell, ticks := range wizard.Cooldowns {
+		cooldowns[spell] = int64(ticks)
+	}
+
+	return Record{
+		"id":         int64(wizard.ID),
+		"name":       wizard.Name,
+		"position":   positionToRecord(wizard.Position),
+		"x":          int64(wizard.Position.X),
+		"y":          int64(wizard.Position.Y),
+		"health":     int64(wizard.Health),
+		"max-health": int64(wizard.MaxHealth),
+		"mana":       int64(wizard.Mana),
+		"max-mana":   int64(wizard.MaxMana),
+		"alive":      wizard.Alive,
+		"cooldowns":  cooldowns,
+	}
+}
+
+func positionToRecord(position interpreters.Position) Record {
+	return Record{"x": int64(position.X), "y": int64(position.Y)}
+}
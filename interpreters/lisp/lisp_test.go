@@ -0,0 +1,191 @@
+package lisp
+
+import (
+	"testing"
+
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+const testScript = `
+; Remember how many times we have been asked to decide
+(define turns 0)
+
+(define (closest self opponents)
+  (foldl (lambda (best candidate)
+           (if (< (distance self candidate) (distance self best)) candidate best))
+         (car opponents)
+         (cdr opponents)))
+
+(define (decide state)
+  (set! turns (+ turns 1))
+  (let ((self (get state 'self))
+        (target (closest (get state 'self) (get state 'opponents))))
+    (cond ((= turns 1) (wait))
+          ((<= (distance self target) 3) (cast "fireball" target))
+          (else (move target)))))
+`
+
+func createTestView() interpreters.View {
+	return interpreters.View{
+		Tick:     1,
+		MaxTicks: 100,
+		Width:    10,
+		Height:   10,
+		Self: interpreters.WizardView{
+			ID:       1,
+			Name:     "Self",
+			Position: interpreters.Position{X: 0, Y: 0},
+			Health:   100,
+			Alive:    true,
+		},
+		Opponents: []interpreters.WizardView{
+			{ID: 2, Name: "Far", Position: interpreters.Position{X: 9, Y: 9}, Alive: true},
+			{ID: 3, Name: "Near", Position: interpreters.Position{X: 5, Y: 0}, Alive: true},
+		},
+	}
+}
+
+func TestInterpreter_IsRegistered(t *testing.T) {
+	interpreter, err := interpreters.Get(Language)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if interpreter.Language() != Language {
+		t.Fatalf("Registered interpreter has language %s, expected %s", interpreter.Language(), Language)
+	}
+}
+
+func TestScript_Decide_KeepsGlobalsBetweenTicks(t *testing.T) {
+	script, err := interpreters.Compile(Language, testScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	view := createTestView()
+
+	// The first decision should be to wait, based on the turn counter
+	action, err := script.Decide(view, interpreters.NoLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.Type != interpreters.Wait {
+		t.Fatalf("Expected the first action to be wait, got %v", action.Type)
+	}
+
+	// The second decision should move towards the closest opponent
+	action, err = script.Decide(view, interpreters.NoLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := interpreters.MoveAction(interpreters.Position{X: 5, Y: 0})
+	if action != expected {
+		t.Fatalf("Expected %v, got %v", expected, action)
+	}
+
+	// Once in range, the script should cast
+	view.Self.Position = interpreters.Position{X: 3, Y: 0}
+	action, err = script.Decide(view, interpreters.NoLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = interpreters.CastAction("fireball", interpreters.Position{X: 5, Y: 0})
+	if action != expected {
+		t.Fatalf("Expected %v, got %v", expected, action)
+	}
+}
+
+func TestInterpreter_Validate_RejectsMissingEntryPoint(t *testing.T) {
+	interpreter := &Interpreter{}
+	err := interpreter.Validate(`(define (think state) (wait))`)
+	if err != ErrMissingEntryPoint {
+		t.Fatalf("Expected ErrMissingEntryPoint, got %v", err)
+	}
+}
+
+func TestInterpreter_Validate_ReportsSyntaxErrorPosition(t *testing.T) {
+	interpreter := &Interpreter{}
+	err := interpreter.Validate("(define (decide state)\n  (wait)")
+
+	syntaxErr, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("Expected a SyntaxError, got %v", err)
+	}
+
+	if syntaxErr.Line != 1 || syntaxErr.Column != 1 {
+		t.Fatalf("Expected the error to point at the unclosed list, got line %d column %d", syntaxErr.Line, syntaxErr.Column)
+	}
+}
+
+func TestScript_Decide_FailsWhenNoActionReturned(t *testing.T) {
+	script, err := interpreters.Compile(Language, `(define (decide state) 42)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = script.Decide(createTestView(), interpreters.NoLimits)
+	if err != interpreters.ErrNoDecision {
+		t.Fatalf("Expected ErrNoDecision, got %v", err)
+	}
+}
+
+func TestScript_Decide_TailCallsRunInConstantStack(t *testing.T) {
+	script, err := interpreters.Compile(Language, `
+		(define (count-down n)
+		  (if (= n 0) (wait) (count-down (- n 1))))
+		(define (decide state) (count-down 100000))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = script.Decide(createTestView(), interpreters.NoLimits); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScript_Decide_ReportsRunawayRecursion(t *testing.T) {
+	script, err := interpreters.Compile(Language, `
+		(define (forever n) (+ 1 (forever n)))
+		(define (decide state) (forever 1))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = script.Decide(createTestView(), interpreters.NoLimits); err == nil {
+		t.Fatalf("Expected unbounded recursion to return an error")
+	}
+}
+
+func TestScript_Decide_InfiniteLoopIsStoppedBySandbox(t *testing.T) {
+	script, err := interpreters.Compile(Language, `
+		(define (loop) (loop))
+		(define (decide state) (loop))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every call allocates an environment, so leave memory and time
+	// unlimited to make sure it is the instruction limit that stops the loop
+	limits := interpreters.DefaultLimits
+	limits.MaxMemory = 0
+	limits.MaxTime = 0
+
+	sandbox := interpreters.NewSandbox(script, limits)
+	if _, err = sandbox.Decide(createTestView()); err != interpreters.ErrInstructionLimit {
+		t.Fatalf("Expected ErrInstructionLimit, got %v", err)
+	}
+}
+
+func TestScript_Decide_RecursionIsLimitedBySandbox(t *testing.T) {
+	script, err := interpreters.Compile(Language, `
+		(define (forever n) (+ 1 (forever n)))
+		(define (decide state) (forever 1))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sandbox := interpreters.NewSandbox(script, interpreters.DefaultLimits)
+	if _, err = sandbox.Decide(createTestView()); err != interpreters.ErrCallDepthLimit {
+		t.Fatalf("Expected ErrCallDepthLimit, got %v", err)
+	}
+}
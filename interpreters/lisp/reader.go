@@ -0,0 +1,193 @@
+package lisp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SyntaxError describes a problem found while reading source code.
+type SyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (err *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", err.Line, err.Column, err.Message)
+}
+
+type reader struct {
+	source []rune
+	offset int
+	line   int
+	column int
+}
+
+// read parses every top-level form in the source.
+func read(source string) ([]Value, error) {
+	r := &reader{source: []rune(source), line: 1, column: 1}
+
+	var forms []Value
+	for {
+		r.skipWhitespace()
+		if r.done() {
+			return forms, nil
+		}
+
+		form, err := r.readForm()
+		if err != nil {
+			return nil, err
+		}
+		forms = append(forms, form)
+	}
+}
+
+func (r *reader) done() bool {
+	return r.offset >= len(r.source)
+}
+
+func (r *reader) peek() rune {
+	return r.source[r.offset]
+}
+
+func (r *reader) next() rune {
+	ch := r.source[r.offset]
+	r.offset++
+	if ch == '\n' {
+		r.line++
+		r.column = 1
+	} else {
+		r.column++
+	}
+	return ch
+}
+
+func (r *reader) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: r.line, Column: r.column, Message: fmt.Sprintf(format, args...)}
+}
+
+func (r *reader) skipWhitespace() {
+	for !r.done() {
+		ch := r.peek()
+		if ch == ';' {
+			for !r.done() && r.peek() != '\n' {
+				r.next()
+			}
+		} else if unicode.IsSpace(ch) {
+			r.next()
+		} else {
+			return
+		}
+	}
+}
+
+func (r *reader) readForm() (Value, error) {
+	switch ch := r.peek(); ch {
+	case '(':
+		r.next()
+		return r.readList()
+	case ')':
+		return nil, r.errorf("unexpected ')'")
+	case '\'':
+		r.next()
+		r.skipWhitespace()
+		if r.done() {
+			return nil, r.errorf("unexpected end of input after quote")
+		}
+		quoted, err := r.readForm()
+		if err != nil {
+			return nil, err
+		}
+		return list(Symbol("quote"), quoted), nil
+	case '"':
+		r.next()
+		return r.readString()
+	default:
+		return r.readAtom()
+	}
+}
+
+func (r *reader) readList() (Value, error) {
+	startLine, startColumn := r.line, r.column-1
+
+	var items []Value
+	for {
+		r.skipWhitespace()
+		if r.done() {
+			return nil, &SyntaxError{Line: startLine, Column: startColumn, Message: "unclosed '('"}
+		}
+
+		if r.peek() == ')' {
+			r.next()
+			return list(items...), nil
+		}
+
+		item, err := r.readForm()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+func (r *reader) readString() (Value, error) {
+	var builder strings.Builder
+	for {
+		if r.done() {
+			return nil, r.errorf("unterminated string")
+		}
+
+		ch := r.next()
+		switch ch {
+		case '"':
+			return builder.String(), nil
+		case '\\':
+			if r.done() {
+				return nil, r.errorf("unterminated string")
+			}
+			switch escaped := r.next(); escaped {
+			case 'n':
+				builder.WriteRune('\n')
+			case 't':
+				builder.WriteRune('\t')
+			case '"', '\\':
+				builder.WriteRune(escaped)
+			default:
+				return nil, r.errorf("unknown escape sequence '\\%c'", escaped)
+			}
+		default:
+			builder.WriteRune(ch)
+		}
+	}
+}
+
+func (r *reader) readAtom() (Value, error) {
+	start := r.offset
+	for !r.done() {
+		ch := r.peek()
+		if unicode.IsSpace(ch) || ch == '(' || ch == ')' || ch == '"' || ch == ';' || ch == '\'' {
+			break
+		}
+		r.next()
+	}
+
+	token := string(r.source[start:r.offset])
+	switch token {
+	case "#t", "#true":
+		return true, nil
+	case "#f", "#false":
+		return false, nil
+	}
+
+	if number, err := strconv.ParseInt(token, 10, 64); err == nil {
+		return number, nil
+	}
+
+	if strings.HasPrefix(token, "#") {
+		return nil, r.errorf("unknown literal '%s'", token)
+	}
+
+	return Symbol(token), nil
+}
@@ -0,0 +1,196 @@
+package lisp
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+// Values are represented using plain Go types where possible:
+//
+//	integers  int64
+//	booleans  bool
+//	strings   string
+//	symbols   Symbol
+//	lists     *Pair, with nil as the empty list
+//	records   Record
+//	actions   interpreters.Action
+//	functions *Lambda or *Builtin
+type Value interface{}
+
+type Symbol string
+
+type Pair struct {
+	Car Value
+	Cdr Value
+}
+
+// Record is an immutable set of named fields, used to expose the arena
+// state to scripts. Fields are read with (get record 'field).
+type Record map[string]Value
+
+type Lambda struct {
+	Name   string
+	Params []Symbol
+	Rest   Symbol // the variadic parameter, if any
+	Body   []Value
+	Env    *Env
+}
+
+type Builtin struct {
+	Name string
+	Fn   func(machine *machine, args []Value) (Value, error)
+}
+
+func cons(car Value, cdr Value) *Pair {
+	return &Pair{Car: car, Cdr: cdr}
+}
+
+func list(values ...Value) Value {
+	var result Value
+	for i := len(values) - 1; i >= 0; i-- {
+		result = cons(values[i], result)
+	}
+	return result
+}
+
+// toSlice converts a proper list into a slice, returning false if the value is not a list.
+func toSlice(value Value) ([]Value, bool) {
+	var values []Value
+	for value != nil {
+		pair, ok := value.(*Pair)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, pair.Car)
+		value = pair.Cdr
+	}
+	return values, true
+}
+
+// truthy follows the convention that only false and the empty list are false.
+func truthy(value Value) bool {
+	if value == nil {
+		return false
+	}
+
+	if b, ok := value.(bool); ok {
+		return b
+	}
+
+	return true
+}
+
+func typeName(value Value) string {
+	switch value.(type) {
+	case nil:
+		return "empty list"
+	case int64:
+		return "integer"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case Symbol:
+		return "symbol"
+	case *Pair:
+		return "list"
+	case Record:
+		return "record"
+	case interpreters.Action:
+		return "action"
+	case *Lambda, *Builtin:
+		return "procedure"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func format(value Value) string {
+	switch v := value.(type) {
+	case nil:
+		return "()"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		if v {
+			return "#t"
+		}
+		return "#f"
+	case string:
+		return strconv.Quote(v)
+	case Symbol:
+		return string(v)
+	case *Pair:
+		var parts []string
+		var current Value = v
+		for current != nil {
+			pair, ok := current.(*Pair)
+			if !ok {
+				parts = append(parts, ".", format(current))
+				break
+			}
+			parts = append(parts, format(pair.Car))
+			current = pair.Cdr
+		}
+		return "(" + strings.Join(parts, " ") + ")"
+	case Record:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			parts = append(parts, key+": "+format(v[key]))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case interpreters.Action:
+		return "#<action " + v.Type.String() + ">"
+	case *Lambda:
+		return "#<procedure " + v.Name + ">"
+	case *Builtin:
+		return "#<builtin " + v.Name + ">"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ---------------
+// - Environments
+// ---------------
+
+type Env struct {
+	vars   map[Symbol]Value
+	parent *Env
+}
+
+func newEnv(parent *Env) *Env {
+	return &Env{vars: make(map[Symbol]Value), parent: parent}
+}
+
+func (env *Env) lookup(name Symbol) (Value, bool) {
+	for current := env; current != nil; current = current.parent {
+		if value, ok := current.vars[name]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (env *Env) define(name Symbol, value Value) {
+	env.vars[name] = value
+}
+
+func (env *Env) set(name Symbol, value Value) bool {
+	for current := env; current != nil; current = current.parent {
+		if _, ok := current.vars[name]; ok {
+			current.vars[name] = value
+			return true
+		}
+	}
+	return false
+}
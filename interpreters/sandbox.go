@@ -0,0 +1,218 @@
+package interpreters
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+)
+
+var (
+	ErrInstructionLimit = errors.New("The script exceeded the maximum number of instructions allowed per tick.")
+	ErrMemoryLimit      = errors.New("The script exceeded the maximum amount of memory allowed per tick.")
+	ErrCallDepthLimit   = errors.New("The script exceeded the maximum call depth.")
+	ErrTimeLimit        = errors.New("The script stopped responding.")
+	ErrScriptCrashed    = errors.New("The script crashed unexpectedly.")
+)
+
+// IsLimitError reports whether the error was caused by the script exceeding
+// one of its resource limits, rather than by a mistake in the script itself.
+func IsLimitError(err error) bool {
+	switch err {
+	case ErrInstructionLimit, ErrMemoryLimit, ErrCallDepthLimit, ErrTimeLimit:
+		return true
+	}
+	return false
+}
+
+// Limits describes the resources a script may use while making a single
+// decision. A zero value for any field means that resource is unlimited.
+//
+// Only the instruction, memory and call depth limits decide whether a
+// script is stopped, since they are counted the same way however busy the
+// server is, and a battle must play out the same way every time it is run
+// with the same seed. MaxTime is a safety net for interpreter bugs that
+// stop the script being metered, and should be well above the time that
+// the other limits allow. A script stopped by it fails with ErrTimeLimit,
+// and the battle it was in cannot be decided.
+type Limits struct {
+	MaxInstructions int64
+	MaxMemory       int64 // approximate bytes allocated
+	MaxCallDepth    int
+	MaxTime         time.Duration
+}
+
+var DefaultLimits = Limits{
+	MaxInstructions: 100000,
+	MaxMemory:       16 * 1024 * 1024,
+	MaxCallDepth:    256,
+	MaxTime:         time.Second,
+}
+
+// Meter is used by interpreters to report the resources consumed by a
+// script. Each method returns an error once a limit has been exceeded,
+// and the interpreter must stop executing the script and return that
+// error from Decide.
+type Meter interface {
+	// Step is called for every instruction the script executes.
+	Step() error
+
+	// Allocate is called whenever the script allocates memory.
+	Allocate(bytes int64) error
+
+	// Enter and Leave are called when the script enters and leaves a procedure.
+	Enter() error
+	Leave()
+}
+
+type noLimits struct{}
+
+func (noLimits) Step() error          { return nil }
+func (noLimits) Allocate(int64) error { return nil }
+func (noLimits) Enter() error         { return nil }
+func (noLimits) Leave()               {}
+
+// NoLimits is a Meter that never stops a script. It should only be used
+// for trusted scripts, such as those in tests.
+var NoLimits Meter = noLimits{}
+
+// ----------
+// - Budget
+// ----------
+
+// cancelCheckInterval is the number of steps between checks of whether
+// the sandbox has given up on the script, which keeps the cost of metering
+// low for scripts that run many instructions.
+const cancelCheckInterval = 1024
+
+// budget is the Meter for a single decision made inside a sandbox.
+type budget struct {
+	limits       Limits
+	instructions int64
+	memory       int64
+	depth        int
+	cancelled    int32
+}
+
+func newBudget(limits Limits) *budget {
+	return &budget{limits: limits}
+}
+
+func (meter *budget) Step() error {
+	meter.instructions++
+	if meter.limits.MaxInstructions > 0 && meter.instructions > meter.limits.MaxInstructions {
+		return ErrInstructionLimit
+	}
+
+	if meter.instructions%cancelCheckInterval == 0 && atomic.LoadInt32(&meter.cancelled) != 0 {
+		return ErrTimeLimit
+	}
+
+	return nil
+}
+
+func (meter *budget) Allocate(bytes int64) error {
+	meter.memory += bytes
+	if meter.limits.MaxMemory > 0 && meter.memory > meter.limits.MaxMemory {
+		return ErrMemoryLimit
+	}
+	return nil
+}
+
+func (meter *budget) Enter() error {
+	meter.depth++
+	if meter.limits.MaxCallDepth > 0 && meter.depth > meter.limits.MaxCallDepth {
+		return ErrCallDepthLimit
+	}
+	return nil
+}
+
+func (meter *budget) Leave() {
+	meter.depth--
+}
+
+// cancel makes the next cancellation check fail, stopping a script that
+// has been abandoned by the sandbox.
+func (meter *budget) cancel() {
+	atomic.StoreInt32(&meter.cancelled, 1)
+}
+
+// -----------
+// - Sandbox
+// -----------
+
+// Sandbox runs a script with hard limits on the resources it may use per
+// decision. If the script exceeds a limit or crashes, it is killed and
+// every later decision returns the error that killed it, so that a
+// misbehaving script can never hang or take down the server.
+type Sandbox struct {
+	script Script
+	limits Limits
+	killed error
+}
+
+func NewSandbox(script Script, limits Limits) *Sandbox {
+	return &Sandbox{script: script, limits: limits}
+}
+
+type decision struct {
+	action Action
+	err    error
+}
+
+// Decide asks the script for its next action. Errors caused by mistakes in
+// the script are returned without killing it, so it can recover next tick.
+func (sandbox *Sandbox) Decide(view View) (Action, error) {
+	if sandbox.killed != nil {
+		return Action{}, sandbox.killed
+	}
+
+	meter := newBudget(sandbox.limits)
+	result := make(chan decision, 1)
+
+	go func() {
+		defer func() {
+			if recovery := recover(); recovery != nil {
+				log.Error("Script panicked inside sandbox", log.Fields{
+					"error": fmt.Sprint(recovery),
+					"stack": string(debug.Stack()),
+				})
+				result <- decision{err: ErrScriptCrashed}
+			}
+		}()
+
+		action, err := sandbox.script.Decide(view, meter)
+		result <- decision{action: action, err: err}
+	}()
+
+	// The timer guarantees that the caller is released even if the
+	// interpreter stops reporting steps
+	var timeout <-chan time.Time
+	if sandbox.limits.MaxTime > 0 {
+		timer := time.NewTimer(sandbox.limits.MaxTime)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var outcome decision
+	select {
+	case outcome = <-result:
+	case <-timeout:
+		meter.cancel()
+		outcome = decision{err: ErrTimeLimit}
+	}
+
+	if IsLimitError(outcome.err) || outcome.err == ErrScriptCrashed {
+		sandbox.killed = outcome.err
+	}
+
+	return outcome.action, outcome.err
+}
+
+// Killed returns the error that killed the script, or nil if it is still running.
+func (sandbox *Sandbox) Killed() error {
+	return sandbox.killed
+}
@@ -0,0 +1,107 @@
+package interpreters
+
+import (
+	"testing"
+	"time"
+)
+
+// testScript runs the given function as its decision logic
+type testScript func(meter Meter) error
+
+func (script testScript) Decide(view View, meter Meter) (Action, error) {
+	if err := script(meter); err != nil {
+		return Action{}, err
+	}
+	return WaitAction(), nil
+}
+
+var testLimits = Limits{
+	MaxInstructions: 1000,
+	MaxMemory:       1024,
+	MaxCallDepth:    10,
+	MaxTime:         50 * time.Millisecond,
+}
+
+func assertKilledWith(t *testing.T, script Script, expected error) {
+	sandbox := NewSandbox(script, testLimits)
+
+	if _, err := sandbox.Decide(View{}); err != expected {
+		t.Fatalf("Expected %v, got %v", expected, err)
+	}
+
+	if sandbox.Killed() != expected {
+		t.Fatalf("Expected the sandbox to be killed with %v, got %v", expected, sandbox.Killed())
+	}
+
+	// Once killed, the script should never be run again
+	if _, err := sandbox.Decide(View{}); err != expected {
+		t.Fatalf("Expected later decisions to fail with %v, got %v", expected, err)
+	}
+}
+
+func TestSandbox_Decide_SucceedsWithinLimits(t *testing.T) {
+	sandbox := NewSandbox(testScript(func(meter Meter) error {
+		for i := 0; i < 100; i++ {
+			if err := meter.Step(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}), testLimits)
+
+	// Limits apply per decision, so repeated decisions should all succeed
+	for tick := 0; tick < 50; tick++ {
+		if _, err := sandbox.Decide(View{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSandbox_Decide_StopsInfiniteLoop(t *testing.T) {
+	assertKilledWith(t, testScript(func(meter Meter) error {
+		for {
+			if err := meter.Step(); err != nil {
+				return err
+			}
+		}
+	}), ErrInstructionLimit)
+}
+
+func TestSandbox_Decide_StopsExcessiveAllocation(t *testing.T) {
+	assertKilledWith(t, testScript(func(meter Meter) error {
+		for {
+			if err := meter.Allocate(100); err != nil {
+				return err
+			}
+		}
+	}), ErrMemoryLimit)
+}
+
+func TestSandbox_Decide_StopsDeepRecursion(t *testing.T) {
+	var recurse func(meter Meter) error
+	recurse = func(meter Meter) error {
+		if err := meter.Enter(); err != nil {
+			return err
+		}
+		defer meter.Leave()
+		return recurse(meter)
+	}
+
+	assertKilledWith(t, testScript(recurse), ErrCallDepthLimit)
+}
+
+func TestSandbox_Decide_StopsUnresponsiveScript(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	assertKilledWith(t, testScript(func(meter Meter) error {
+		<-release
+		return nil
+	}), ErrTimeLimit)
+}
+
+func TestSandbox_Decide_RecoversFromPanic(t *testing.T) {
+	assertKilledWith(t, testScript(func(meter Meter) error {
+		panic("interpreter bug")
+	}), ErrScriptCrashed)
+}
@@ -0,0 +1,225 @@
+// Package live broadcasts battles to spectators while they are being
+// fought.
+package live
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/crob1140/codewiz-server/arena"
+)
+
+const (
+	DefaultBufferSize = 64
+)
+
+// Hub keeps track of the battles that are being broadcast, keyed by the ID
+// of the job running each one. Spectators may start watching a battle
+// before it has started, so that they do not miss the beginning.
+type Hub struct {
+	BufferSize int // how many messages a spectator can fall behind by before it is resynchronised; must be positive
+
+	mutex      sync.Mutex
+	broadcasts map[uint64]*Broadcast
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		BufferSize: DefaultBufferSize,
+		broadcasts: make(map[uint64]*Broadcast),
+	}
+}
+
+// Open returns the broadcast for a battle that is about to be fought. The
+// broadcast should be registered as an observer of the battle, and Close
+// must be called once the battle is over.
+func (hub *Hub) Open(id uint64) *Broadcast {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	broadcast := hub.get(id)
+	broadcast.opened = true
+	return broadcast
+}
+
+// Close disconnects every spectator of a battle. Spectators that join
+// after this are left waiting for a battle that will not start, so the
+// outcome of the battle should be saved before it is closed.
+func (hub *Hub) Close(id uint64) {
+	hub.mutex.Lock()
+	broadcast, ok := hub.broadcasts[id]
+	delete(hub.broadcasts, id)
+	hub.mutex.Unlock()
+
+	if ok {
+		broadcast.close()
+	}
+}
+
+// Watch adds a spectator to a battle. If the battle has already started,
+// the spectator is sent a snapshot of it straight away.
+func (hub *Hub) Watch(id uint64) *Spectator {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	spectator := &Spectator{id: id, messages: make(chan []byte, hub.BufferSize)}
+	hub.get(id).add(spectator)
+	return spectator
+}
+
+// Leave removes a spectator from the battle it is watching.
+func (hub *Hub) Leave(spectator *Spectator) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	broadcast, ok := hub.broadcasts[spectator.id]
+	if !ok {
+		return
+	}
+
+	// Nobody is waiting for a battle that has not been opened yet
+	if broadcast.remove(spectator) == 0 && !broadcast.opened {
+		delete(hub.broadcasts, spectator.id)
+	}
+}
+
+func (hub *Hub) get(id uint64) *Broadcast {
+	broadcast, ok := hub.broadcasts[id]
+	if !ok {
+		broadcast = &Broadcast{spectators: make(map[*Spectator]bool)}
+		hub.broadcasts[id] = broadcast
+	}
+	return broadcast
+}
+
+// Spectator receives the encoded messages of a single battle.
+type Spectator struct {
+	id       uint64
+	messages chan []byte
+}
+
+// Messages returns the channel the spectator's messages are sent on. It is
+// closed when the battle is over.
+func (spectator *Spectator) Messages() <-chan []byte {
+	return spectator.messages
+}
+
+// Broadcast is an arena.Observer that sends the battle it observes to its
+// spectators. Sending never blocks the battle: a spectator that is too
+// slow to keep up has its backlog discarded and is sent a snapshot
+// instead, so it skips ahead to the current tick.
+type Broadcast struct {
+	mutex      sync.Mutex
+	spectators map[*Spectator]bool
+	opened     bool
+	closed     bool
+
+	arena  *Arena
+	state  *State
+	result *arena.Result
+}
+
+func (broadcast *Broadcast) BattleStarted(config arena.Config, state arena.State) {
+	broadcast.mutex.Lock()
+	defer broadcast.mutex.Unlock()
+
+	broadcast.arena = toArena(config)
+	broadcast.state = toState(state)
+	broadcast.send(broadcast.snapshot())
+}
+
+func (broadcast *Broadcast) TickResolved(state arena.State, actions []arena.TakenAction) {
+	broadcast.mutex.Lock()
+	defer broadcast.mutex.Unlock()
+
+	broadcast.state = toState(state)
+	broadcast.send(Message{Type: TickMessage, State: broadcast.state, Actions: toActions(actions)})
+}
+
+func (broadcast *Broadcast) BattleFinished(result *arena.Result) {
+	broadcast.mutex.Lock()
+	defer broadcast.mutex.Unlock()
+
+	broadcast.result = result
+	broadcast.send(Message{Type: FinishMessage, Result: result})
+}
+
+// snapshot describes the battle so far, including its result if it has
+// finished.
+func (broadcast *Broadcast) snapshot() Message {
+	return Message{
+		Type:   SnapshotMessage,
+		Arena:  broadcast.arena,
+		State:  broadcast.state,
+		Result: broadcast.result,
+	}
+}
+
+// send must be called with the mutex held.
+func (broadcast *Broadcast) send(message Message) {
+	data, _ := json.Marshal(message)
+
+	var snapshot []byte
+	for spectator := range broadcast.spectators {
+		select {
+		case spectator.messages <- data:
+			continue
+		default:
+		}
+
+		if snapshot == nil {
+			snapshot, _ = json.Marshal(broadcast.snapshot())
+		}
+		resync(spectator, snapshot)
+	}
+}
+
+// resync replaces a spectator's backlog with a snapshot. The broadcast is
+// the only sender, so the channel cannot fill up again in between.
+func resync(spectator *Spectator, snapshot []byte) {
+drain:
+	for {
+		select {
+		case <-spectator.messages:
+		default:
+			break drain
+		}
+	}
+	spectator.messages <- snapshot
+}
+
+func (broadcast *Broadcast) add(spectator *Spectator) {
+	broadcast.mutex.Lock()
+	defer broadcast.mutex.Unlock()
+
+	if broadcast.closed {
+		close(spectator.messages)
+		return
+	}
+
+	broadcast.spectators[spectator] = true
+	if broadcast.state != nil {
+		data, _ := json.Marshal(broadcast.snapshot())
+		spectator.messages <- data
+	}
+}
+
+// remove returns the number of spectators that are left.
+func (broadcast *Broadcast) remove(spectator *Spectator) int {
+	broadcast.mutex.Lock()
+	defer broadcast.mutex.Unlock()
+
+	delete(broadcast.spectators, spectator)
+	return len(broadcast.spectators)
+}
+
+func (broadcast *Broadcast) close() {
+	broadcast.mutex.Lock()
+	defer broadcast.mutex.Unlock()
+
+	broadcast.closed = true
+	for spectator := range broadcast.spectators {
+		close(spectator.messages)
+	}
+	broadcast.spectators = nil
+}
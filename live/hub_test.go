@@ -0,0 +1,138 @@
+package live
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/crob1140/codewiz-server/arena"
+)
+
+func createTestState(tick int) arena.State {
+	return arena.State{Tick: tick, Wizards: []arena.WizardState{
+		{WizardID: 1, Name: "First", Health: 100},
+		{WizardID: 2, Name: "Second", Health: 100 - tick},
+	}}
+}
+
+func receive(t *testing.T, spectator *Spectator) Message {
+	select {
+	case data, ok := <-spectator.Messages():
+		if !ok {
+			t.Fatal("Expected a message, but the spectator was disconnected")
+		}
+
+		var message Message
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatal(err)
+		}
+		return message
+	default:
+		t.Fatal("Expected a message, but none was sent")
+	}
+	return Message{}
+}
+
+func assertNoMessages(t *testing.T, spectator *Spectator) {
+	select {
+	case <-spectator.Messages():
+		t.Fatal("Expected no messages")
+	default:
+	}
+}
+
+func assertDisconnected(t *testing.T, spectator *Spectator) {
+	select {
+	case _, ok := <-spectator.Messages():
+		if ok {
+			t.Fatal("Expected the spectator to be disconnected")
+		}
+	default:
+		t.Fatal("Expected the spectator to be disconnected")
+	}
+}
+
+func TestHub_Watch_WaitsForBattleToStart(t *testing.T) {
+	hub := NewHub()
+	spectator := hub.Watch(1)
+	assertNoMessages(t, spectator)
+
+	broadcast := hub.Open(1)
+	broadcast.BattleStarted(arena.Config{Map: arena.DefaultMap, Rules: arena.DefaultRules}, createTestState(0))
+
+	message := receive(t, spectator)
+	if message.Type != SnapshotMessage || message.Arena == nil || message.Arena.Width != arena.DefaultMap.Width {
+		t.Errorf("Expected a snapshot of the arena, got %+v", message)
+	}
+
+	broadcast.TickResolved(createTestState(1), []arena.TakenAction{{WizardID: 1}})
+	message = receive(t, spectator)
+	if message.Type != TickMessage || message.State.Tick != 1 || len(message.Actions) != 1 || message.Actions[0].Type != "wait" {
+		t.Errorf("Expected the first tick, got %+v", message)
+	}
+
+	broadcast.BattleFinished(&arena.Result{WinnerID: 1})
+	message = receive(t, spectator)
+	if message.Type != FinishMessage || message.Result == nil || message.Result.WinnerID != 1 {
+		t.Errorf("Expected the result, got %+v", message)
+	}
+
+	hub.Close(1)
+	assertDisconnected(t, spectator)
+}
+
+func TestHub_Watch_SendsSnapshotToLateJoiners(t *testing.T) {
+	hub := NewHub()
+	broadcast := hub.Open(1)
+	broadcast.BattleStarted(arena.Config{Map: arena.DefaultMap}, createTestState(0))
+	for tick := 1; tick <= 5; tick++ {
+		broadcast.TickResolved(createTestState(tick), nil)
+	}
+
+	spectator := hub.Watch(1)
+	message := receive(t, spectator)
+	if message.Type != SnapshotMessage || message.Arena == nil || message.State.Tick != 5 {
+		t.Errorf("Expected a snapshot of the fifth tick, got %+v", message)
+	}
+	assertNoMessages(t, spectator)
+}
+
+func TestBroadcast_SlowSpectatorIsResynchronised(t *testing.T) {
+	hub := NewHub()
+	hub.BufferSize = 2
+
+	broadcast := hub.Open(1)
+	slow := hub.Watch(1)
+	broadcast.BattleStarted(arena.Config{Map: arena.DefaultMap}, createTestState(0))
+
+	// The broadcast must never wait for a spectator that is not reading
+	for tick := 1; tick <= 10; tick++ {
+		broadcast.TickResolved(createTestState(tick), nil)
+	}
+
+	fast := hub.Watch(1)
+	receive(t, fast)
+
+	message := receive(t, slow)
+	if message.Type != SnapshotMessage || message.State.Tick != 10 {
+		t.Errorf("Expected the backlog to be replaced by a snapshot of the latest tick, got %+v", message)
+	}
+	assertNoMessages(t, slow)
+}
+
+func TestHub_Leave_ForgetsUnopenedBattles(t *testing.T) {
+	hub := NewHub()
+	spectator := hub.Watch(1)
+	hub.Leave(spectator)
+
+	if len(hub.broadcasts) != 0 {
+		t.Errorf("Expected the battle to be forgotten once nobody was waiting for it")
+	}
+
+	hub.Open(2)
+	spectator = hub.Watch(2)
+	hub.Leave(spectator)
+
+	if len(hub.broadcasts) != 1 {
+		t.Errorf("Expected the opened battle to be kept until it is closed")
+	}
+}
@@ -0,0 +1,106 @@
+package live
+
+import (
+	"github.com/crob1140/codewiz-server/arena"
+	"github.com/crob1140/codewiz-server/interpreters"
+)
+
+// Message types sent to spectators.
+const (
+	// SnapshotMessage describes the arena and the latest state of the
+	// battle. It is sent when the battle starts, when a spectator joins a
+	// battle that has already started, and when a spectator falls so far
+	// behind that the messages it missed were discarded.
+	SnapshotMessage = "snapshot"
+
+	// TickMessage holds the actions taken on a tick and the state at the
+	// end of it.
+	TickMessage = "tick"
+
+	// FinishMessage holds the result of the battle. It is the last message
+	// sent before the spectator is disconnected.
+	FinishMessage = "finish"
+)
+
+// Message is a single update sent to spectators as JSON.
+type Message struct {
+	Type    string        `json:"type"`
+	Arena   *Arena        `json:"arena,omitempty"`
+	State   *State        `json:"state,omitempty"`
+	Actions []Action      `json:"actions,omitempty"`
+	Result  *arena.Result `json:"result,omitempty"`
+}
+
+// Arena describes the map and rules the battle is fought with.
+type Arena struct {
+	Map       string                  `json:"map"`
+	Width     int                     `json:"width"`
+	Height    int                     `json:"height"`
+	Obstacles []interpreters.Position `json:"obstacles"`
+	MaxTicks  int                     `json:"maxTicks"`
+	MaxHealth int                     `json:"maxHealth"`
+	MaxMana   int                     `json:"maxMana"`
+}
+
+type State struct {
+	Tick    int      `json:"tick"`
+	Wizards []Wizard `json:"wizards"`
+}
+
+type Wizard struct {
+	WizardID  uint64                `json:"wizardId"`
+	Name      string                `json:"name"`
+	Position  interpreters.Position `json:"position"`
+	Health    int                   `json:"health"`
+	Mana      int                   `json:"mana"`
+	Cooldowns map[string]int        `json:"cooldowns,omitempty"`
+}
+
+type Action struct {
+	WizardID uint64                `json:"wizardId"`
+	Type     string                `json:"type"`
+	Spell    string                `json:"spell,omitempty"`
+	Target   interpreters.Position `json:"target"`
+	Failed   bool                  `json:"failed,omitempty"`
+}
+
+func toArena(config arena.Config) *Arena {
+	return &Arena{
+		Map:       config.Map.Name,
+		Width:     config.Map.Width,
+		Height:    config.Map.Height,
+		Obstacles: config.Map.Obstacles,
+		MaxTicks:  config.Rules.MaxTicks,
+		MaxHealth: config.Rules.MaxHealth,
+		MaxMana:   config.Rules.MaxMana,
+	}
+}
+
+func toState(state arena.State) *State {
+	wizards := make([]Wizard, len(state.Wizards))
+	for i, w := range state.Wizards {
+		wizards[i] = Wizard{
+			WizardID:  w.WizardID,
+			Name:      w.Name,
+			Position:  w.Position,
+			Health:    w.Health,
+			Mana:      w.Mana,
+			Cooldowns: w.Cooldowns,
+		}
+	}
+	return &State{Tick: state.Tick, Wizards: wizards}
+}
+
+func toActions(taken []arena.TakenAction) []Action {
+	actions := make([]Action, len(taken))
+	for i, t := range taken {
+		actions[i] = Action{
+			WizardID: t.WizardID,
+			Type:     t.Action.Type.String(),
+			Spell:    t.Action.Spell,
+			Target:   t.Action.Target,
+			Failed:   t.Failed,
+		}
+	}
+	return actions
+}
@@ -9,6 +9,7 @@ var theLevel Level
 
 type Logger struct {
 	*logrus.Logger
+	recent *recentHook
 }
 
 type Fields logrus.Fields
@@ -44,13 +45,21 @@ func NewLogger() *Logger {
 	// TODO: these should be args
 	logger.Formatter = &logrus.JSONFormatter{}
 	logger.Level = logrus.InfoLevel
-	return &Logger{logger}
+
+	recent := newRecentHook(RecentSize)
+	logger.Hooks.Add(recent)
+	return &Logger{logger, recent}
 }
 
 func (logger *Logger) SetLevel(level Level) {
 	logger.Logger.Level = logrus.Level(level)
 }
 
+// Recent returns the most recent error entries, newest first.
+func (logger *Logger) Recent() []Record {
+	return logger.recent.Records()
+}
+
 func (logger *Logger) Panic(message interface{}, fields ...Fields) {
 	var log logrus.FieldLogger = logger.Logger
 	if len(fields) > 0 {
@@ -114,6 +123,10 @@ func ParseLevel(levelName string) (Level, error) {
 	return Level(level), err
 }
 
+func Recent() []Record {
+	return theInstance.Recent()
+}
+
 func Panic(message interface{}, fields ...Fields) {
 	theInstance.Panic(message, fields...)
 }
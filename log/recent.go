@@ -0,0 +1,73 @@
+package log
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// RecentSize is the number of error entries that are kept in memory.
+const RecentSize = 100
+
+// Record is an error entry that is kept in memory, so that admins can see
+// recent problems without access to the server's output.
+type Record struct {
+	Time    time.Time
+	Level   string
+	Message string
+	Fields  Fields
+}
+
+// recentHook keeps the most recent error entries in a ring buffer.
+type recentHook struct {
+	mutex   sync.Mutex
+	records []Record
+	next    int
+}
+
+func newRecentHook(size int) *recentHook {
+	return &recentHook{records: make([]Record, 0, size)}
+}
+
+func (hook *recentHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.ErrorLevel, logrus.FatalLevel, logrus.PanicLevel}
+}
+
+func (hook *recentHook) Fire(entry *logrus.Entry) error {
+	fields := make(Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		fields[key] = value
+	}
+
+	record := Record{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+		Fields:  fields,
+	}
+
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+
+	if len(hook.records) < cap(hook.records) {
+		hook.records = append(hook.records, record)
+	} else {
+		hook.records[hook.next] = record
+	}
+	hook.next = (hook.next + 1) % cap(hook.records)
+	return nil
+}
+
+// Records returns the entries that have been kept, newest first.
+func (hook *recentHook) Records() []Record {
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+
+	records := make([]Record, 0, len(hook.records))
+	for i := 1; i <= len(hook.records); i++ {
+		index := (hook.next - i + len(hook.records)) % len(hook.records)
+		records = append(records, hook.records[index])
+	}
+	return records
+}
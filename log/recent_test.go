@@ -0,0 +1,31 @@
+package log
+
+import (
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+func TestLogger_Recent(t *testing.T) {
+	logger := NewLogger()
+	logger.Out = ioutil.Discard
+
+	logger.Info("Not an error")
+	for i := 0; i < RecentSize+5; i++ {
+		logger.Error("Failure "+strconv.Itoa(i), Fields{"attempt": i})
+	}
+
+	records := logger.Recent()
+	if len(records) != RecentSize {
+		t.Fatalf("Expected %d records, got %d", RecentSize, len(records))
+	}
+
+	newest, oldest := records[0], records[len(records)-1]
+	if newest.Message != "Failure 104" || newest.Fields["attempt"] != 104 || newest.Level != "error" {
+		t.Errorf("Expected the newest error first, got %+v", newest)
+	}
+
+	if oldest.Message != "Failure 5" {
+		t.Errorf("Expected the oldest errors to be dropped, got %+v", oldest)
+	}
+}
@@ -0,0 +1,62 @@
+package mail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+)
+
+// FileSender writes each message to its own file in a directory instead of
+// delivering it, so that the links in them can be followed during
+// development. The files are named so that they sort in the order they
+// were sent.
+type FileSender struct {
+	Dir  string
+	From string
+
+	mutex sync.Mutex
+	count int
+}
+
+func NewFileSender(dir string, from string) *FileSender {
+	return &FileSender{Dir: dir, From: from}
+}
+
+func (sender *FileSender) Send(message Message) error {
+	now := time.Now()
+	data, err := format(sender.From, message, now)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(sender.Dir, 0700); err != nil {
+		return err
+	}
+
+	// The counter keeps the names unique when messages are sent at the
+	// same time
+	sender.mutex.Lock()
+	sender.count++
+	name := now.UTC().Format("20060102T150405.000000000Z") + "-" + strconv.Itoa(sender.count) + ".eml"
+	sender.mutex.Unlock()
+
+	return ioutil.WriteFile(filepath.Join(sender.Dir, name), data, 0600)
+}
+
+// LogSender writes messages to the log at the info level. It is used when
+// no other sender has been configured.
+type LogSender struct{}
+
+func (sender LogSender) Send(message Message) error {
+	log.Info("Email was logged instead of being sent", log.Fields{
+		"to":      message.To,
+		"subject": message.Subject,
+		"body":    message.Body,
+	})
+	return nil
+}
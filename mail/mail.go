@@ -0,0 +1,49 @@
+// Package mail sends emails to users, such as the links that verify their
+// address or let them reset a forgotten password.
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages. The server picks an implementation from its
+// configuration, so that development and tests do not need a mail server.
+type Sender interface {
+	Send(message Message) error
+}
+
+// format builds the message in the format expected by mail servers. The
+// recipient and subject are checked for line breaks, since they would
+// otherwise let a user add their own headers to the message.
+func format(from string, message Message, date time.Time) ([]byte, error) {
+	if _, err := mail.ParseAddress(message.To); err != nil {
+		return nil, errors.New("Recipient is not a valid email address.")
+	}
+
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return nil, errors.New("Message headers must not contain line breaks.")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from + "\r\n")
+	buf.WriteString("To: " + message.To + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	buf.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.Replace(message.Body, "\n", "\r\n", -1))
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,77 @@
+package mail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2016, time.June, 1, 12, 0, 0, 0, time.UTC)
+	data, err := format("CodeWiz <noreply@codewiz.test>", Message{To: "test@test.com", Subject: "Hello", Body: "Line one\nLine two"}, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "From: CodeWiz <noreply@codewiz.test>\r\n" +
+		"To: test@test.com\r\n" +
+		"Subject: Hello\r\n" +
+		"Date: Wed, 01 Jun 2016 12:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Line one\r\nLine two"
+	if string(data) != expected {
+		t.Errorf("Unexpected message: got %q want %q", data, expected)
+	}
+}
+
+func TestFormat_RejectsHeaderInjection(t *testing.T) {
+	messages := []Message{
+		{To: "test@test.com\r\nBcc: victim@test.com", Subject: "Hello"},
+		{To: "test@test.com", Subject: "Hello\r\nBcc: victim@test.com"},
+		{To: "not an address", Subject: "Hello"},
+	}
+
+	for _, message := range messages {
+		if _, err := format("noreply@codewiz.test", message, time.Now()); err == nil {
+			t.Errorf("Expected %+v to be rejected", message)
+		}
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "codewiz-mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sender := NewFileSender(filepath.Join(dir, "outbox"), "noreply@codewiz.test")
+	for _, subject := range []string{"First", "Second"} {
+		if err := sender.Send(Message{To: "test@test.com", Subject: subject, Body: "Body"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "outbox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 messages to be written, got %d", len(files))
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "outbox", files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "Subject: First\r\n") {
+		t.Errorf("Expected the first message to be written first, got %q", data)
+	}
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPSender delivers messages through a mail server. The server must
+// support STARTTLS if a username is given, since the credentials would
+// otherwise be sent in the clear.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string // no authentication is attempted if this is empty
+	Password string
+	From     string
+}
+
+func NewSMTPSender(host string, port int, username string, password string, from string) *SMTPSender {
+	return &SMTPSender{Host: host, Port: port, Username: username, Password: password, From: from}
+}
+
+func (sender *SMTPSender) Send(message Message) error {
+	from, err := mail.ParseAddress(sender.From)
+	if err != nil {
+		return err
+	}
+
+	data, err := format(sender.From, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if sender.Username != "" {
+		auth = smtp.PlainAuth("", sender.Username, sender.Password, sender.Host)
+	}
+
+	address := net.JoinHostPort(sender.Host, strconv.Itoa(sender.Port))
+	to, _ := mail.ParseAddress(message.To)
+	return smtp.SendMail(address, auth, from.Address, []string{to.Address}, data)
+}
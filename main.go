@@ -1,14 +1,39 @@
 package main
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
 	"github.com/crob1140/codewiz-server/log"
 	"github.com/crob1140/codewiz-server/config"
 	"github.com/crob1140/codewiz-server/config/keys"
 	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/mail"
+	"github.com/crob1140/codewiz-server/models/spells"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/oidc"
+	_ "github.com/crob1140/codewiz-server/interpreters/lisp"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+const (
+	defaultSpellsPath = "models/spells/resources/spells.json"
+	defaultQueryTimeout = "30s"
+	defaultMatchmakingInterval = "10s"
+	defaultTournamentInterval = "30s"
+	defaultWorkerCount = 4
+	defaultMailSender = "log"
+	defaultMailFrom = "CodeWiz <noreply@localhost>"
+	defaultMailDirectory = "mail"
+	defaultSMTPPort = 587
+	defaultOIDCScopes = "email profile"
+)
+
+// Identity provider names are used in URLs and environment variable names.
+var providerNamePattern = regexp.MustCompile("^[a-z0-9]+$")
+
 func main() {
 
 	initLogger()
@@ -42,7 +67,58 @@ func main() {
 		}
 	}
 
-	server := NewServer(ds)
+	queryTimeout := config.GetString(keys.DatabaseQueryTimeout, defaultQueryTimeout)
+	ds.QueryTimeout, err = time.ParseDuration(queryTimeout)
+	if err != nil {
+		log.Fatal("Invalid database query timeout", log.Fields{
+			"timeout" : queryTimeout,
+			"error" : err,
+		})
+	}
+
+	spellsPath := config.GetString(keys.SpellsPath, defaultSpellsPath)
+	catalogue, err := spells.LoadCatalogue(spellsPath)
+	if err != nil {
+		log.Fatal("Failed to load spell definitions", log.Fields{
+			"path" : spellsPath,
+			"error" : err,
+		})
+	}
+
+	if adminUsername := config.GetString(keys.AdminUsername); adminUsername != "" {
+		grantAdminRole(users.NewDao(ds), adminUsername)
+	}
+
+	server := NewServer(ds, catalogue, newMailSender(), newIdentityProviders())
+
+	matchmakingInterval := config.GetString(keys.MatchmakingInterval, defaultMatchmakingInterval)
+	server.Matcher.Interval, err = time.ParseDuration(matchmakingInterval)
+	if err != nil {
+		log.Fatal("Invalid matchmaking interval", log.Fields{
+			"interval" : matchmakingInterval,
+			"error" : err,
+		})
+	}
+	server.Matcher.Start()
+
+	tournamentInterval := config.GetString(keys.TournamentInterval, defaultTournamentInterval)
+	server.Director.Interval, err = time.ParseDuration(tournamentInterval)
+	if err != nil {
+		log.Fatal("Invalid tournament interval", log.Fields{
+			"interval" : tournamentInterval,
+			"error" : err,
+		})
+	}
+	server.Director.Start()
+
+	server.Workers.Size = config.GetInt(keys.WorkerCount, defaultWorkerCount)
+	if server.Workers.Size < 1 {
+		log.Fatal("Invalid worker count", log.Fields{
+			"count" : server.Workers.Size,
+		})
+	}
+	server.Workers.Start()
+	server.CleanUpSessions(sessionCleanupInterval)
 
 	log.Info("Server is now listening for requests", log.Fields{
 		"port" : port,
@@ -66,6 +142,105 @@ func initLogger() {
 	log.SetLevel(level)
 }
 
+// newMailSender creates the sender chosen in the configuration. Emails are
+// only logged by default, so that development servers do not need a mail
+// server.
+func newMailSender() mail.Sender {
+	from := config.GetString(keys.MailFrom, defaultMailFrom)
+
+	switch senderName := config.GetString(keys.MailSender, defaultMailSender); senderName {
+	case "smtp":
+		host := config.GetString(keys.MailSMTPHost)
+		assertConfigExists(keys.MailSMTPHost, host)
+
+		return mail.NewSMTPSender(host,
+			config.GetInt(keys.MailSMTPPort, defaultSMTPPort),
+			config.GetString(keys.MailSMTPUsername),
+			config.GetString(keys.MailSMTPPassword),
+			from)
+	case "file":
+		return mail.NewFileSender(config.GetString(keys.MailDirectory, defaultMailDirectory), from)
+	case "log":
+		return mail.LogSender{}
+	default:
+		log.Fatal("Unrecognised mail sender", log.Fields{
+			"sender" : senderName,
+		})
+		return nil
+	}
+}
+
+// newIdentityProviders creates a client for each of the providers that users
+// can log in with instead of a password. There are none by default.
+func newIdentityProviders() []*oidc.Provider {
+	var providers []*oidc.Provider
+	seen := make(map[string]bool)
+
+	for _, name := range strings.Split(config.GetString(keys.OIDCProviders), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if !providerNamePattern.MatchString(name) || seen[name] {
+			log.Fatal("Invalid identity provider name", log.Fields{
+				"provider" : name,
+			})
+		}
+		seen[name] = true
+
+		key := func(format string) string {
+			return fmt.Sprintf(format, name)
+		}
+
+		issuer := config.GetString(key(keys.OIDCProviderIssuer))
+		assertConfigExists(key(keys.OIDCProviderIssuer), issuer)
+
+		clientID := config.GetString(key(keys.OIDCProviderClientID))
+		assertConfigExists(key(keys.OIDCProviderClientID), clientID)
+
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name : name,
+			DisplayName : config.GetString(key(keys.OIDCProviderName), name),
+			Issuer : issuer,
+			ClientID : clientID,
+			ClientSecret : config.GetString(key(keys.OIDCProviderClientSecret)),
+			Scopes : strings.Fields(config.GetString(key(keys.OIDCProviderScopes), defaultOIDCScopes)),
+		}))
+	}
+
+	return providers
+}
+
+// grantAdminRole makes the given user an admin, so that a new server has
+// someone who can grant roles to everyone else.
+func grantAdminRole(userDao *users.Dao, username string) {
+	user, err := userDao.GetByUsername(username)
+	if err != nil {
+		log.Fatal("Failed to fetch admin user from datastore", log.Fields{
+			"username" : username,
+			"error" : err,
+		})
+	}
+
+	if user == nil {
+		log.Warn("Admin user does not exist yet", log.Fields{
+			"username" : username,
+		})
+		return
+	}
+
+	if !user.HasRole(users.Admin) {
+		user.SetRoles(append(user.Granted(), users.Admin))
+		if err := userDao.Update(user); err != nil {
+			log.Fatal("Failed to grant admin role", log.Fields{
+				"username" : username,
+				"error" : err,
+			})
+		}
+	}
+}
+
 func assertConfigExists(key string, value string) {
 	if value == "" {
 		log.Fatal("Missing environment variable.", log.Fields{
@@ -0,0 +1,260 @@
+// Package matchmaker pairs wizards waiting in the ranked queue, runs their
+// battles and updates their ratings with the results.
+package matchmaker
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/battles"
+	"github.com/crob1140/codewiz-server/models/matchmaking"
+	"github.com/crob1140/codewiz-server/models/ratings"
+	"github.com/crob1140/codewiz-server/models/seasons"
+	"github.com/crob1140/codewiz-server/simulator"
+)
+
+const (
+	DefaultInterval     = 10 * time.Second
+	DefaultRatingWindow = 100.0
+	DefaultWindowGrowth = 50.0
+)
+
+// Matcher periodically scans the queue for pairs of wizards with similar
+// ratings. Wizards that have waited a long time are matched against a
+// wider range of ratings, so that nobody waits forever.
+type Matcher struct {
+	QueueDao  *matchmaking.Dao
+	RatingDao *ratings.Dao
+	Simulator *simulator.Simulator
+	Seasons   *seasons.Scheduler
+
+	Interval     time.Duration
+	RatingWindow float64 // the largest rating difference for wizards that have just joined
+	WindowGrowth float64 // how much the window widens for every minute spent waiting
+
+	rng  *rand.Rand
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func New(queueDao *matchmaking.Dao, ratingDao *ratings.Dao, simulator *simulator.Simulator, scheduler *seasons.Scheduler) *Matcher {
+	return &Matcher{
+		QueueDao:     queueDao,
+		RatingDao:    ratingDao,
+		Simulator:    simulator,
+		Seasons:      scheduler,
+		Interval:     DefaultInterval,
+		RatingWindow: DefaultRatingWindow,
+		WindowGrowth: DefaultWindowGrowth,
+		rng:          rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Start begins matching in the background until Stop is called.
+func (matcher *Matcher) Start() {
+	matcher.stop = make(chan struct{})
+	matcher.done.Add(1)
+
+	go func() {
+		defer matcher.done.Done()
+
+		ticker := time.NewTicker(matcher.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-matcher.stop:
+				return
+			case <-ticker.C:
+				if err := matcher.Match(); err != nil {
+					log.Error("Failed to match wizards in the queue", log.Fields{"error": err})
+				}
+			}
+		}
+	}()
+}
+
+// Stop waits for any battle in progress to finish and then stops matching.
+func (matcher *Matcher) Stop() {
+	close(matcher.stop)
+	matcher.done.Wait()
+}
+
+// candidate is a queue entry along with the rating used to match it.
+type candidate struct {
+	entry  *matchmaking.Entry
+	rating *ratings.Rating
+	window float64
+}
+
+// Match pairs up as many waiting wizards as possible and fights their battles.
+// Seasons are started here too, so that no rating can change while the
+// season's reset is being applied.
+func (matcher *Matcher) Match() error {
+	now := time.Now()
+
+	var seasonID uint64
+	season, err := matcher.Seasons.Advance(now)
+	if err != nil {
+		return err
+	}
+	if season != nil {
+		seasonID = season.ID
+	}
+
+	entries, err := matcher.QueueDao.GetWaiting()
+	if err != nil {
+		return err
+	}
+
+	candidates := make([]*candidate, 0, len(entries))
+	for _, entry := range entries {
+		rating, err := matcher.RatingDao.GetOrCreate(entry.WizardID)
+		if err != nil {
+			return err
+		}
+
+		waited := now.Sub(entry.CreationTime()).Minutes()
+		candidates = append(candidates, &candidate{
+			entry:  entry,
+			rating: rating,
+			window: matcher.RatingWindow + math.Max(waited, 0)*matcher.WindowGrowth,
+		})
+	}
+
+	for _, pair := range pairCandidates(candidates) {
+		matcher.fight(pair[0], pair[1], seasonID)
+	}
+
+	return nil
+}
+
+// pairCandidates greedily pairs each candidate with the closest rated
+// candidate that either of them would accept. Wizards belonging to the
+// same player are never matched against each other.
+func pairCandidates(candidates []*candidate) [][2]*candidate {
+	sorted := append([]*candidate(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].rating.Rating < sorted[j].rating.Rating
+	})
+
+	var pairs [][2]*candidate
+	paired := make(map[*candidate]bool, len(sorted))
+	for i, first := range sorted {
+		if paired[first] {
+			continue
+		}
+
+		for _, second := range sorted[i+1:] {
+			if paired[second] || second.entry.OwnerID == first.entry.OwnerID {
+				continue
+			}
+
+			difference := second.rating.Rating - first.rating.Rating
+			if difference > math.Max(first.window, second.window) {
+				// The candidates are sorted, so nobody further along is closer
+				break
+			}
+
+			paired[first] = true
+			paired[second] = true
+			pairs = append(pairs, [2]*candidate{first, second})
+			break
+		}
+	}
+
+	return pairs
+}
+
+func (matcher *Matcher) fight(first *candidate, second *candidate, seasonID uint64) {
+	wizardIDs := []uint64{first.entry.WizardID, second.entry.WizardID}
+	_, err := matcher.Simulator.RunAndRecord(wizardIDs, matcher.rng.Int63(), func(tx *datastore.DB, battle *battles.Battle) error {
+		return matcher.recordResult(tx, battle, first, second, seasonID)
+	})
+	if err == nil {
+		return
+	}
+
+	log.Error("Failed to run ranked battle", log.Fields{
+		"wizards": wizardIDs,
+		"error":   err,
+	})
+
+	// Only the wizard that stopped the battle from being fought is taken out
+	// of the queue. If the server was at fault, both keep waiting and are
+	// matched again.
+	var wizardErr *simulator.WizardError
+	if !errors.As(err, &wizardErr) {
+		return
+	}
+
+	for _, fighter := range []*candidate{first, second} {
+		if fighter.entry.WizardID == wizardErr.WizardID {
+			matcher.leaveQueue(fighter.entry, matchmaking.Failed, 0, err.Error())
+		}
+	}
+}
+
+// recordResult updates both wizards' ratings and rating history, and takes
+// them out of the queue, in the transaction that saves the battle. A failure
+// part of the way through would otherwise leave a battle that nobody was
+// rated for, one wizard rated for a battle that the other was not, or both
+// waiting to fight again.
+func (matcher *Matcher) recordResult(tx *datastore.DB, battle *battles.Battle, first *candidate, second *candidate, seasonID uint64) error {
+	ratingDao := matcher.RatingDao.WithTx(tx)
+	queueDao := matcher.QueueDao.WithTx(tx)
+
+	// Both wizards are rated against the other's rating from before the battle
+	firstBefore, secondBefore := first.rating.Glicko(), second.rating.Glicko()
+	firstScore := score(battle, first.entry.WizardID)
+
+	results := []ratings.Result{
+		{Opponent: secondBefore, Score: firstScore},
+		{Opponent: firstBefore, Score: 1 - firstScore},
+	}
+
+	for i, fighter := range []*candidate{first, second} {
+		history := fighter.rating.Record(battle.ID, seasonID, results[i])
+		if err := ratingDao.Save(fighter.rating); err != nil {
+			return err
+		}
+
+		if err := ratingDao.InsertHistory(history); err != nil {
+			return err
+		}
+
+		fighter.entry.State = matchmaking.Matched
+		fighter.entry.BattleID = battle.ID
+		if err := queueDao.Update(fighter.entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func score(battle *battles.Battle, wizardID uint64) float64 {
+	switch battle.WinnerID {
+	case 0:
+		return ratings.Draw
+	case wizardID:
+		return ratings.Win
+	default:
+		return ratings.Loss
+	}
+}
+
+func (matcher *Matcher) leaveQueue(entry *matchmaking.Entry, state matchmaking.State, battleID uint64, reason string) {
+	entry.State = state
+	entry.BattleID = battleID
+	entry.Reason = reason
+
+	if err := matcher.QueueDao.Update(entry); err != nil {
+		log.Error("Failed to update matchmaking queue entry", log.Fields{"entry": entry.ID, "error": err})
+	}
+}
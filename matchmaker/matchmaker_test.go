@@ -0,0 +1,171 @@
+package matchmaker
+
+import (
+	"testing"
+
+	"github.com/crob1140/codewiz-server/config"
+	"github.com/crob1140/codewiz-server/config/keys"
+	"github.com/crob1140/codewiz-server/datastore"
+	_ "github.com/crob1140/codewiz-server/interpreters/lisp"
+	"github.com/crob1140/codewiz-server/models/battles"
+	"github.com/crob1140/codewiz-server/models/matchmaking"
+	"github.com/crob1140/codewiz-server/models/ratings"
+	"github.com/crob1140/codewiz-server/models/replays"
+	"github.com/crob1140/codewiz-server/models/spells"
+	"github.com/crob1140/codewiz-server/models/wizards"
+	"github.com/crob1140/codewiz-server/simulator"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func createTestCandidate(wizardID uint64, ownerID uint64, rating float64, window float64) *candidate {
+	return &candidate{
+		entry:  matchmaking.NewEntry(wizardID, ownerID),
+		rating: &ratings.Rating{WizardID: wizardID, Rating: rating},
+		window: window,
+	}
+}
+
+func assertPaired(t *testing.T, pairs [][2]*candidate, expected ...[2]uint64) {
+	if len(pairs) != len(expected) {
+		t.Fatalf("Expected %d pairs, got %d", len(expected), len(pairs))
+	}
+
+	for i, pair := range pairs {
+		if pair[0].entry.WizardID != expected[i][0] || pair[1].entry.WizardID != expected[i][1] {
+			t.Errorf("Expected pair %d to be %v, got [%d %d]", i, expected[i], pair[0].entry.WizardID, pair[1].entry.WizardID)
+		}
+	}
+}
+
+func TestPairCandidates_PairsClosestRatings(t *testing.T) {
+	pairs := pairCandidates([]*candidate{
+		createTestCandidate(1, 1, 1500, 100),
+		createTestCandidate(2, 2, 1900, 100),
+		createTestCandidate(3, 3, 1550, 100),
+		createTestCandidate(4, 4, 1950, 100),
+	})
+
+	assertPaired(t, pairs, [2]uint64{1, 3}, [2]uint64{2, 4})
+}
+
+func TestPairCandidates_RespectsRatingWindow(t *testing.T) {
+	pairs := pairCandidates([]*candidate{
+		createTestCandidate(1, 1, 1500, 100),
+		createTestCandidate(2, 2, 1700, 100),
+	})
+	assertPaired(t, pairs)
+
+	// A wizard that has waited long enough accepts the wider difference
+	pairs = pairCandidates([]*candidate{
+		createTestCandidate(1, 1, 1500, 250),
+		createTestCandidate(2, 2, 1700, 100),
+	})
+	assertPaired(t, pairs, [2]uint64{1, 2})
+}
+
+func TestPairCandidates_SkipsWizardsWithTheSameOwner(t *testing.T) {
+	pairs := pairCandidates([]*candidate{
+		createTestCandidate(1, 1, 1500, 100),
+		createTestCandidate(2, 1, 1510, 100),
+		createTestCandidate(3, 2, 1560, 100),
+	})
+
+	assertPaired(t, pairs, [2]uint64{1, 3})
+}
+
+// createTestMatcher returns a matcher whose battles are fought and saved in
+// a database of their own.
+func createTestMatcher(t *testing.T) (*Matcher, *wizards.Dao) {
+	// Each test has its own database, since the migrations can only be
+	// applied once
+	ds, err := datastore.Open("sqlite3", "file:"+t.Name()+".db?cache=shared&mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationsPath := config.GetString(keys.DatabaseMigrationsPath, "../datastore/migrations")
+	if errs, ok := ds.UpSync(migrationsPath); !ok {
+		t.Fatal(errs)
+	}
+
+	catalogue, err := spells.LoadCatalogue("../models/spells/resources/spells.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wizardDao := wizards.NewDao(ds)
+	battleSimulator := simulator.New(wizardDao, battles.NewDao(ds), replays.NewDao(ds), catalogue)
+	return New(matchmaking.NewDao(ds), ratings.NewDao(ds), battleSimulator, nil), wizardDao
+}
+
+// queueTestWizard creates a wizard, with an active script if one is given,
+// and puts it in the queue.
+func queueTestWizard(t *testing.T, matcher *Matcher, wizardDao *wizards.Dao, ownerID uint64, source string) *candidate {
+	wizard := wizards.NewWizard("Wizard", "M", ownerID)
+	if err := wizardDao.Insert(wizard); err != nil {
+		t.Fatal(err)
+	}
+
+	if source != "" {
+		script := wizards.NewWizardScript(wizard.ID, ownerID, "lisp", source)
+		if err := wizardDao.InsertScript(script); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := wizardDao.SetActiveScript(wizard, script); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entry := matchmaking.NewEntry(wizard.ID, ownerID)
+	if err := matcher.QueueDao.Insert(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	rating, err := matcher.RatingDao.GetOrCreate(wizard.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &candidate{entry: entry, rating: rating, window: matcher.RatingWindow}
+}
+
+func assertState(t *testing.T, matcher *Matcher, fighter *candidate, expected matchmaking.State) {
+	entry, err := matcher.QueueDao.GetByID(fighter.entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.State != expected {
+		t.Errorf("Unexpected state for wizard %d: got %v want %v", entry.WizardID, entry.State, expected)
+	}
+}
+
+const testSource = `(define (decide state) (wait))`
+
+func TestMatcher_FightFailsOnlyTheWizardAtFault(t *testing.T) {
+	matcher, wizardDao := createTestMatcher(t)
+	ready := queueTestWizard(t, matcher, wizardDao, 1, testSource)
+	unready := queueTestWizard(t, matcher, wizardDao, 2, "")
+
+	matcher.fight(ready, unready, 0)
+
+	assertState(t, matcher, ready, matchmaking.Waiting)
+	assertState(t, matcher, unready, matchmaking.Failed)
+}
+
+func TestMatcher_FightKeepsBothWaitingWhenTheServerFails(t *testing.T) {
+	matcher, wizardDao := createTestMatcher(t)
+	first := queueTestWizard(t, matcher, wizardDao, 1, testSource)
+	second := queueTestWizard(t, matcher, wizardDao, 2, testSource)
+
+	// The battle is fought, but cannot be saved
+	if _, err := matcher.QueueDao.DB.Exec("DROP TABLE Replays"); err != nil {
+		t.Fatal(err)
+	}
+
+	matcher.fight(first, second, 0)
+
+	assertState(t, matcher, first, matchmaking.Waiting)
+	assertState(t, matcher, second, matchmaking.Waiting)
+}
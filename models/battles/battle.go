@@ -0,0 +1,59 @@
+package battles
+
+import (
+	"github.com/crob1140/codewiz-server/arena"
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+// Battle is the stored outcome of a battle that has been run.
+type Battle struct {
+	datastore.BaseRecord
+	Seed          int64  `db:"Seed"`
+	MapName       string `db:"MapName"`
+	SpellsVersion string `db:"SpellsVersion"` // the version of the spell catalogue in effect
+	Ticks         int    `db:"Ticks"`
+	WinnerID      uint64 `db:"WinnerID"` // zero if the battle was a draw
+	EndReason     string `db:"EndReason"`
+}
+
+// Participant records how a single wizard fared in a battle, and which
+// version of its script it was running at the time.
+type Participant struct {
+	datastore.BaseRecord
+	BattleID    uint64 `db:"BattleID"`
+	WizardID    uint64 `db:"WizardID"`
+	ScriptID    uint64 `db:"ScriptID"`
+	Alive       bool   `db:"Alive"`
+	Health      int    `db:"Health"`
+	DamageDealt int    `db:"DamageDealt"`
+	DamageTaken int    `db:"DamageTaken"`
+	Errors      int    `db:"Errors"`
+}
+
+func NewBattle(result *arena.Result, spellsVersion string) *Battle {
+	return &Battle{
+		Seed:          result.Seed,
+		MapName:       result.MapName,
+		SpellsVersion: spellsVersion,
+		Ticks:         result.Ticks,
+		WinnerID:      result.WinnerID,
+		EndReason:     string(result.EndReason),
+	}
+}
+
+func NewParticipant(battleID uint64, scriptID uint64, result arena.WizardResult) *Participant {
+	return &Participant{
+		BattleID:    battleID,
+		WizardID:    result.WizardID,
+		ScriptID:    scriptID,
+		Alive:       result.Alive,
+		Health:      result.Health,
+		DamageDealt: result.DamageDealt,
+		DamageTaken: result.DamageTaken,
+		Errors:      result.Errors,
+	}
+}
+
+func (battle *Battle) IsDraw() bool {
+	return battle.WinnerID == 0
+}
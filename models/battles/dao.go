@@ -0,0 +1,49 @@
+package battles
+
+import (
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Battle{}, "Battles")
+	db.AddTableWithName(Participant{}, "BattleParticipants")
+	return &Dao{DB: db}
+}
+
+// WithTx returns a copy of the DAO that runs its queries in the given
+// transaction, see datastore.DB.WithTransaction.
+func (dao *Dao) WithTx(tx *datastore.DB) *Dao {
+	return &Dao{DB: tx}
+}
+
+func (dao *Dao) GetByID(id uint64) (*Battle, error) {
+	battle, err := dao.DB.Get(Battle{}, "SELECT * FROM Battles WHERE ID = ?", id)
+	if err != nil || battle == nil {
+		return nil, err
+	}
+	return battle.(*Battle), err
+}
+
+func (dao *Dao) Insert(battle *Battle) error {
+	return dao.DB.Insert(battle)
+}
+
+func (dao *Dao) InsertParticipant(participant *Participant) error {
+	return dao.DB.Insert(participant)
+}
+
+func (dao *Dao) GetParticipants(battleID uint64) ([]*Participant, error) {
+	var participants []*Participant
+	_, err := dao.DB.Select(&participants, "SELECT * FROM BattleParticipants WHERE BattleID = ?", battleID)
+	return participants, err
+}
+
+func (dao *Dao) GetByWizardID(wizardID uint64) ([]*Battle, error) {
+	var battles []*Battle
+	_, err := dao.DB.Select(&battles, "SELECT * FROM Battles WHERE ID IN (SELECT BattleID FROM BattleParticipants WHERE WizardID = ?)", wizardID)
+	return battles, err
+}
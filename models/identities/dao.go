@@ -0,0 +1,59 @@
+package identities
+
+import (
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Identity{}, "Identities")
+	return &Dao{DB: db}
+}
+
+// WithTx returns a copy of the DAO that runs its queries in the given
+// transaction, see datastore.DB.WithTransaction.
+func (dao *Dao) WithTx(tx *datastore.DB) *Dao {
+	return &Dao{DB: tx}
+}
+
+func (dao *Dao) GetByID(id uint64) (*Identity, error) {
+	identity, err := dao.DB.Get(Identity{}, "SELECT * FROM Identities WHERE ID = ?", id)
+	if err != nil || identity == nil {
+		return nil, err
+	}
+	return identity.(*Identity), nil
+}
+
+// GetBySubject returns the identity for the provider's account, or nil if
+// the account has not been linked to a user.
+func (dao *Dao) GetBySubject(provider string, subject string) (*Identity, error) {
+	identity, err := dao.DB.Get(Identity{}, "SELECT * FROM Identities WHERE Provider = ? AND Subject = ?", provider, subject)
+	if err != nil || identity == nil {
+		return nil, err
+	}
+	return identity.(*Identity), nil
+}
+
+// GetByUserID returns the identities linked to the user, in the order they
+// were linked.
+func (dao *Dao) GetByUserID(userID uint64) ([]*Identity, error) {
+	var found []*Identity
+	_, err := dao.DB.Select(&found, "SELECT * FROM Identities WHERE UserID = ? ORDER BY ID", userID)
+	return found, err
+}
+
+func (dao *Dao) Insert(identity *Identity) error {
+	return dao.DB.Insert(identity)
+}
+
+func (dao *Dao) Update(identity *Identity) error {
+	return dao.DB.Update(identity)
+}
+
+// Delete unlinks the provider's account from the user.
+func (dao *Dao) Delete(identity *Identity) error {
+	return dao.DB.Delete(identity)
+}
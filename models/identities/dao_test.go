@@ -0,0 +1,81 @@
+package identities
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/config"
+	"github.com/crob1140/codewiz-server/config/keys"
+	"github.com/crob1140/codewiz-server/datastore"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func createTestDao(t *testing.T) *Dao {
+	ds, err := datastore.Open("sqlite3", "file:"+t.Name()+".db?cache=shared&mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationsPath := config.GetString(keys.DatabaseMigrationsPath, "../../datastore/migrations")
+	if errs, ok := ds.UpSync(migrationsPath); !ok {
+		t.Fatal(errs)
+	}
+	return NewDao(ds)
+}
+
+func TestDao_GetBySubject(t *testing.T) {
+	dao := createTestDao(t)
+	now := time.Now()
+
+	linked := NewIdentity(1, "google", "1234", "wizard@test.com", now)
+	if err := dao.Insert(linked); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same subject at another provider is a different account
+	if err := dao.Insert(NewIdentity(2, "github", "1234", "other@test.com", now)); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := dao.GetBySubject("google", "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found == nil || found.UserID != 1 {
+		t.Fatalf("Expected the google account to be linked to user 1, got %+v", found)
+	}
+
+	// Unlinked accounts can be linked again, to the same user or another
+	if err := dao.Delete(found); err != nil {
+		t.Fatal(err)
+	}
+
+	if found, err = dao.GetBySubject("google", "1234"); err != nil || found != nil {
+		t.Fatalf("Expected the account to be unlinked, got %+v, %v", found, err)
+	}
+
+	if err := dao.Insert(NewIdentity(3, "google", "1234", "wizard@test.com", now)); err != nil {
+		t.Errorf("Expected the account to be linked again, got %v", err)
+	}
+}
+
+func TestDao_GetByUserID(t *testing.T) {
+	dao := createTestDao(t)
+	now := time.Now()
+
+	for _, provider := range []string{"google", "github"} {
+		if err := dao.Insert(NewIdentity(1, provider, provider+"-subject", "", now)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := dao.GetByUserID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 2 || found[0].Provider != "google" || found[1].Provider != "github" {
+		t.Errorf("Expected both identities in the order they were linked, got %+v", found)
+	}
+}
@@ -0,0 +1,28 @@
+// Package identities links users to the accounts they have with external
+// identity providers, so that they can log in without a password.
+package identities
+
+import (
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Identity struct {
+	datastore.BaseRecord
+	UserID        uint64    `db:"UserID"`
+	Provider      string    `db:"Provider"` // the name of the provider in the server's configuration
+	Subject       string    `db:"Subject"`  // the provider's ID for the account, which never changes
+	Email         string    `db:"Email"`    // the address the provider had for the account when it was last used
+	LastLoginTime time.Time `db:"LastLoginTime"`
+}
+
+func NewIdentity(userID uint64, provider string, subject string, email string, now time.Time) *Identity {
+	return &Identity{
+		UserID:        userID,
+		Provider:      provider,
+		Subject:       subject,
+		Email:         email,
+		LastLoginTime: now,
+	}
+}
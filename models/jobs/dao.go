@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Job{}, "BattleJobs")
+	return &Dao{DB: db}
+}
+
+func (dao *Dao) GetByID(id uint64) (*Job, error) {
+	job, err := dao.DB.Get(Job{}, "SELECT * FROM BattleJobs WHERE ID = ?", id)
+	if err != nil || job == nil {
+		return nil, err
+	}
+	return job.(*Job), err
+}
+
+// GetClaimable returns the jobs that a worker could start at the given
+// time, oldest first.
+func (dao *Dao) GetClaimable(t time.Time) ([]*Job, error) {
+	var jobs []*Job
+	_, err := dao.DB.Select(&jobs, "SELECT * FROM BattleJobs WHERE (State = ? OR (State = ? AND LeaseExpiry < ?)) ORDER BY ID", Queued, Running, t.UTC())
+	return jobs, err
+}
+
+// GetFailed returns the jobs that have run out of attempts, most recent
+// first.
+func (dao *Dao) GetFailed() ([]*Job, error) {
+	var jobs []*Job
+	_, err := dao.DB.Select(&jobs, "SELECT * FROM BattleJobs WHERE State = ? ORDER BY ID DESC", Failed)
+	return jobs, err
+}
+
+func (dao *Dao) Insert(job *Job) error {
+	return dao.DB.Insert(job)
+}
+
+func (dao *Dao) Update(job *Job) error {
+	return dao.DB.Update(job)
+}
+
+// Claim marks the job as running under a new lease, and reports false if
+// another worker claimed it first. The check and the update happen in a
+// single statement, so that two workers can never run the same job. The
+// job's version goes up too, so that a worker whose lease has expired gets
+// datastore.ErrConflict when it tries to save the job.
+func (dao *Dao) Claim(job *Job, t time.Time, lease time.Duration) (bool, error) {
+	now := t.UTC()
+	expiry := now.Add(lease)
+
+	result, err := dao.DB.Exec("UPDATE BattleJobs SET State = ?, Attempts = Attempts + 1, LeaseExpiry = ?, LastUpdatedTime = ?, Version = Version + 1 "+
+		"WHERE ID = ? AND Attempts = ? AND (State = ? OR (State = ? AND LeaseExpiry < ?))",
+		Running, expiry, now, job.ID, job.Attempts, Queued, Running, now)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+
+	job.State = Running
+	job.Attempts++
+	job.LeaseExpiry = expiry
+	job.SetLastUpdatedTime(now)
+	job.SetVersion(job.Version() + 1)
+	return true, nil
+}
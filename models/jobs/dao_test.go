@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/config"
+	"github.com/crob1140/codewiz-server/config/keys"
+	"github.com/crob1140/codewiz-server/datastore"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func createTestDao(t *testing.T) *Dao {
+	// Each test has its own database, since the migrations can only be
+	// applied once
+	ds, err := datastore.Open("sqlite3", "file:"+t.Name()+".db?cache=shared&mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationsPath := config.GetString(keys.DatabaseMigrationsPath, "../../datastore/migrations")
+	if errs, ok := ds.UpSync(migrationsPath); !ok {
+		t.Fatal(errs)
+	}
+	return NewDao(ds)
+}
+
+func TestDao_StaleWorkerCannotSaveReclaimedJob(t *testing.T) {
+	dao := createTestDao(t)
+	now := time.Now()
+
+	job := NewJob(1, []uint64{1, 2}, 42)
+	if err := dao.Insert(job); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, _ := dao.GetByID(job.ID)
+	if claimed, err := dao.Claim(stale, now, time.Minute); err != nil || !claimed {
+		t.Fatalf("Expected the first worker to claim the job, got %v (%v)", claimed, err)
+	}
+
+	// The first worker's lease expires before it finishes, and another
+	// worker claims the job
+	current, _ := dao.GetByID(job.ID)
+	if claimed, err := dao.Claim(current, now.Add(2*time.Minute), time.Minute); err != nil || !claimed {
+		t.Fatalf("Expected the second worker to claim the job, got %v (%v)", claimed, err)
+	}
+
+	stale.State = Finished
+	if err := dao.Update(stale); err != datastore.ErrConflict {
+		t.Errorf("Unexpected error from the stale worker: got %v want %v", err, datastore.ErrConflict)
+	}
+
+	current.State = Finished
+	if err := dao.Update(current); err != nil {
+		t.Errorf("Expected the current worker to save the job, got %v", err)
+	}
+
+	saved, _ := dao.GetByID(job.ID)
+	if saved.Attempts != 2 || saved.Version() != current.Version() {
+		t.Errorf("Expected the job saved by the current worker, got attempt %d at version %d", saved.Attempts, saved.Version())
+	}
+}
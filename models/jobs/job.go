@@ -0,0 +1,73 @@
+// Package jobs stores battles that have been requested but not yet run, so
+// that they can be simulated in the background and survive restarts.
+package jobs
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type State string
+
+const (
+	Queued   State = "queued"
+	Running  State = "running"
+	Finished State = "finished"
+	Failed   State = "failed"
+)
+
+// Job is a request to fight a battle between the given wizards. A running
+// job holds a lease, and if its worker crashes before the lease expires the
+// job is picked up again by another worker.
+type Job struct {
+	datastore.BaseRecord
+	OwnerID     uint64    `db:"OwnerID"`
+	Wizards     string    `db:"WizardIDs"` // comma separated, in the order the wizards spawn
+	Seed        int64     `db:"Seed"`
+	State       State     `db:"State"`
+	Attempts    int       `db:"Attempts"`
+	LeaseExpiry time.Time `db:"LeaseExpiry"`
+	BattleID    uint64    `db:"BattleID"` // zero until the battle has been fought
+	Reason      string    `db:"Reason"`   // why the job failed, if it did
+}
+
+func NewJob(ownerID uint64, wizardIDs []uint64, seed int64) *Job {
+	ids := make([]string, len(wizardIDs))
+	for i, wizardID := range wizardIDs {
+		ids[i] = strconv.FormatUint(wizardID, 10)
+	}
+
+	return &Job{
+		OwnerID: ownerID,
+		Wizards: strings.Join(ids, ","),
+		Seed:    seed,
+		State:   Queued,
+	}
+}
+
+func (job *Job) WizardIDs() []uint64 {
+	var wizardIDs []uint64
+	for _, id := range strings.Split(job.Wizards, ",") {
+		if wizardID, err := strconv.ParseUint(id, 10, 64); err == nil {
+			wizardIDs = append(wizardIDs, wizardID)
+		}
+	}
+	return wizardIDs
+}
+
+// Claimable reports whether a worker can start the job at the given time,
+// either because it is waiting or because its previous worker abandoned it.
+func (job *Job) Claimable(t time.Time) bool {
+	return job.State == Queued || job.State == Running && job.LeaseExpiry.Before(t)
+}
+
+// Requeue puts a failed job back in the queue with a fresh set of attempts.
+func (job *Job) Requeue() {
+	job.State = Queued
+	job.Attempts = 0
+	job.LeaseExpiry = time.Time{}
+	job.Reason = ""
+}
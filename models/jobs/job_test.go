@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJob_WizardIDsRoundTrip(t *testing.T) {
+	job := NewJob(1, []uint64{12, 7, 300}, 42)
+
+	if ids := job.WizardIDs(); !reflect.DeepEqual(ids, []uint64{12, 7, 300}) {
+		t.Fatalf("Expected the wizards to be kept in order, got %v", ids)
+	}
+}
+
+func TestJob_Claimable(t *testing.T) {
+	now := time.Now()
+	job := NewJob(1, []uint64{1, 2}, 42)
+
+	if !job.Claimable(now) {
+		t.Fatalf("Expected a queued job to be claimable")
+	}
+
+	job.State = Running
+	job.LeaseExpiry = now.Add(time.Minute)
+	if job.Claimable(now) {
+		t.Fatalf("Expected a running job with a current lease not to be claimable")
+	}
+
+	if !job.Claimable(now.Add(2 * time.Minute)) {
+		t.Fatalf("Expected a running job with an expired lease to be claimable")
+	}
+
+	job.State = Finished
+	if job.Claimable(now.Add(2 * time.Minute)) {
+		t.Fatalf("Expected a finished job not to be claimable")
+	}
+}
+
+func TestJob_Requeue(t *testing.T) {
+	job := NewJob(1, []uint64{1, 2}, 42)
+	job.State = Failed
+	job.Attempts = 3
+	job.Reason = "The battle could not be simulated."
+
+	job.Requeue()
+	if !job.Claimable(time.Now()) || job.Attempts != 0 || job.Reason != "" {
+		t.Errorf("Expected the job to be queued again with no attempts, got %+v", job)
+	}
+}
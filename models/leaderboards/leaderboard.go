@@ -0,0 +1,195 @@
+// Package leaderboards ranks wizards by rating, either across all time or
+// within a single season.
+package leaderboards
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("The leaderboard cursor is not valid.")
+
+// Query selects a page of a leaderboard. The zero value is the first page
+// of the global leaderboard.
+type Query struct {
+	SeasonID uint64 // zero for the global leaderboard
+	Language string // only include wizards whose active script is in this language
+	From     time.Time
+	To       time.Time // only include wizards that played a ranked battle in this range
+	Cursor   string    // the NextCursor of the previous page
+	Limit    int
+}
+
+type Entry struct {
+	Rank       int     `db:"-"`
+	WizardID   uint64  `db:"WizardID"`
+	WizardName string  `db:"WizardName"`
+	OwnerID    uint64  `db:"OwnerID"`
+	Rating     float64 `db:"Rating"`
+	Deviation  float64 `db:"Deviation"`
+	Games      int     `db:"Games"`
+	Language   string  `db:"Language"`
+}
+
+type Page struct {
+	Entries    []*Entry
+	NextCursor string // empty if this is the last page
+}
+
+// cursor marks the last entry of a page. Pages are ordered by rating and
+// then wizard ID, so the next page starts after this position.
+type cursor struct {
+	rank     int
+	rating   float64
+	wizardID uint64
+}
+
+func (c cursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%v:%d", c.rank, c.rating, c.wizardID)))
+}
+
+func decodeCursor(encoded string) (cursor, error) {
+	var c cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if _, err := fmt.Sscanf(string(data), "%d:%g:%d", &c.rank, &c.rating, &c.wizardID); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	return &Dao{DB: db}
+}
+
+// Get returns a page of the leaderboard. Seasons that are still running
+// are ranked from the live ratings, and seasons that have ended are ranked
+// from their archived standings.
+func (dao *Dao) Get(query Query, archived bool) (*Page, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	var after *cursor
+	if query.Cursor != "" {
+		c, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &c
+	}
+
+	sql, args := buildQuery(query, archived, after, limit+1)
+
+	var entries []*Entry
+	if _, err := dao.DB.Select(&entries, sql, args...); err != nil {
+		return nil, err
+	}
+
+	rank := 0
+	if after != nil {
+		rank = after.rank
+	}
+	for _, entry := range entries {
+		rank++
+		entry.Rank = rank
+	}
+
+	// One extra entry is fetched to find out whether there is another page
+	page := &Page{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		last := page.Entries[limit-1]
+		page.NextCursor = cursor{rank: last.Rank, rating: last.Rating, wizardID: last.WizardID}.encode()
+	}
+
+	return page, nil
+}
+
+func buildQuery(query Query, archived bool, after *cursor, limit int) (string, []interface{}) {
+	var sql string
+	var conditions []string
+	var args []interface{}
+
+	if archived {
+		sql = "SELECT r.WizardID AS WizardID, w.Name AS WizardName, w.OwnerID AS OwnerID, r.Rating AS Rating, " +
+			"r.Deviation AS Deviation, r.Games AS Games, r.Language AS Language " +
+			"FROM SeasonStandings r JOIN Wizards w ON w.ID = r.WizardID"
+
+		conditions = append(conditions, "r.SeasonID = ?")
+		args = append(args, query.SeasonID)
+		if query.Language != "" {
+			conditions = append(conditions, "r.Language = ?")
+			args = append(args, query.Language)
+		}
+	} else {
+		games := "r.Games"
+		if query.SeasonID != 0 {
+			games = "r.SeasonGames"
+		}
+
+		sql = "SELECT r.WizardID AS WizardID, w.Name AS WizardName, w.OwnerID AS OwnerID, r.Rating AS Rating, " +
+			"r.Deviation AS Deviation, " + games + " AS Games, COALESCE(s.Language, '') AS Language " +
+			"FROM Ratings r JOIN Wizards w ON w.ID = r.WizardID LEFT JOIN WizardScripts s ON s.ID = w.ActiveScriptID"
+
+		conditions = append(conditions, games+" > 0")
+		if query.SeasonID != 0 {
+			conditions = append(conditions, "r.SeasonID = ?")
+			args = append(args, query.SeasonID)
+		}
+		if query.Language != "" {
+			conditions = append(conditions, "s.Language = ?")
+			args = append(args, query.Language)
+		}
+	}
+
+	conditions = append(conditions, "r.Status <> ?", "w.Status <> ?")
+	args = append(args, datastore.Deleted, datastore.Deleted)
+
+	if !query.From.IsZero() || !query.To.IsZero() {
+		played := "EXISTS (SELECT 1 FROM RatingHistory h WHERE h.WizardID = r.WizardID"
+		if query.SeasonID != 0 {
+			played += " AND h.SeasonID = ?"
+			args = append(args, query.SeasonID)
+		}
+		if !query.From.IsZero() {
+			played += " AND h.CreationTime >= ?"
+			args = append(args, query.From.UTC())
+		}
+		if !query.To.IsZero() {
+			played += " AND h.CreationTime < ?"
+			args = append(args, query.To.UTC())
+		}
+		conditions = append(conditions, played+")")
+	}
+
+	if after != nil {
+		conditions = append(conditions, "(r.Rating < ? OR (r.Rating = ? AND r.WizardID > ?))")
+		args = append(args, after.rating, after.rating, after.wizardID)
+	}
+
+	sql += " WHERE " + strings.Join(conditions, " AND ")
+	sql += fmt.Sprintf(" ORDER BY r.Rating DESC, r.WizardID ASC LIMIT %d", limit)
+	return sql, args
+}
@@ -0,0 +1,283 @@
+package leaderboards
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/config"
+	"github.com/crob1140/codewiz-server/config/keys"
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/models/ratings"
+	"github.com/crob1140/codewiz-server/models/seasons"
+	"github.com/crob1140/codewiz-server/models/wizards"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	original := cursor{rank: 50, rating: 1623.4567891234, wizardID: 42}
+
+	decoded, err := decodeCursor(original.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded != original {
+		t.Fatalf("Expected %+v, got %+v", original, decoded)
+	}
+}
+
+func TestDecodeCursor_RejectsGarbage(t *testing.T) {
+	for _, encoded := range []string{"!!!", "bm90IGEgY3Vyc29y"} {
+		if _, err := decodeCursor(encoded); err != ErrInvalidCursor {
+			t.Errorf("Expected ErrInvalidCursor for %q, got %v", encoded, err)
+		}
+	}
+}
+
+// testBoard creates the wizards and ratings that leaderboards are built from.
+type testBoard struct {
+	t          *testing.T
+	dao        *Dao
+	wizardDao  *wizards.Dao
+	ratingDao  *ratings.Dao
+	seasonDao  *seasons.Dao
+	nextWizard int
+}
+
+func createTestBoard(t *testing.T) *testBoard {
+	// Each test has its own database, since the migrations can only be
+	// applied once
+	ds, err := datastore.Open("sqlite3", "file:"+t.Name()+".db?cache=shared&mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationsPath := config.GetString(keys.DatabaseMigrationsPath, "../../datastore/migrations")
+	if errs, ok := ds.UpSync(migrationsPath); !ok {
+		t.Fatal(errs)
+	}
+
+	return &testBoard{
+		t:         t,
+		dao:       NewDao(ds),
+		wizardDao: wizards.NewDao(ds),
+		ratingDao: ratings.NewDao(ds),
+		seasonDao: seasons.NewDao(ds),
+	}
+}
+
+// addWizard creates a wizard whose active script is in the given language,
+// or that has no active script if the language is empty.
+func (board *testBoard) addWizard(language string) *wizards.Wizard {
+	board.nextWizard++
+	wizard := wizards.NewWizard(fmt.Sprintf("Wizard %d", board.nextWizard), "F", 1)
+	if err := board.wizardDao.Insert(wizard); err != nil {
+		board.t.Fatal(err)
+	}
+
+	if language != "" {
+		// Scripts are stored directly, since only some languages have an
+		// interpreter registered in this package's tests
+		script := wizards.NewWizardScript(wizard.ID, 1, language, "source")
+		script.Revision = 1
+		if err := board.wizardDao.DB.Insert(script); err != nil {
+			board.t.Fatal(err)
+		}
+
+		if err := board.wizardDao.SetActiveScript(wizard, script); err != nil {
+			board.t.Fatal(err)
+		}
+	}
+	return wizard
+}
+
+// addRating creates a wizard with the given rating, who has played games
+// ranked battles in total and seasonGames of them in the given season.
+func (board *testBoard) addRating(language string, rating float64, games int, seasonID uint64, seasonGames int) *wizards.Wizard {
+	wizard := board.addWizard(language)
+
+	stored := ratings.NewRating(wizard.ID)
+	stored.Rating = rating
+	stored.Games = games
+	stored.SeasonID = seasonID
+	stored.SeasonGames = seasonGames
+	if err := board.ratingDao.Save(stored); err != nil {
+		board.t.Fatal(err)
+	}
+	return wizard
+}
+
+// addBattle records that the wizard played a ranked battle at the given time.
+func (board *testBoard) addBattle(wizard *wizards.Wizard, seasonID uint64, t time.Time) {
+	history := &ratings.History{WizardID: wizard.ID, BattleID: 1, SeasonID: seasonID}
+	if err := board.ratingDao.InsertHistory(history); err != nil {
+		board.t.Fatal(err)
+	}
+
+	// The creation time is always set to the current time on insertion
+	if _, err := board.dao.DB.Exec("UPDATE RatingHistory SET CreationTime = ? WHERE ID = ?", t.UTC(), history.ID); err != nil {
+		board.t.Fatal(err)
+	}
+}
+
+func (board *testBoard) get(query Query, archived bool) *Page {
+	page, err := board.dao.Get(query, archived)
+	if err != nil {
+		board.t.Fatal(err)
+	}
+	return page
+}
+
+func assertEntries(t *testing.T, page *Page, expected ...*wizards.Wizard) {
+	if len(page.Entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), len(page.Entries))
+	}
+
+	for i, entry := range page.Entries {
+		if entry.WizardID != expected[i].ID {
+			t.Errorf("Expected entry %d to be wizard %d, got wizard %d", i, expected[i].ID, entry.WizardID)
+		}
+	}
+}
+
+func TestDao_GetRanksPlayedWizardsByRating(t *testing.T) {
+	board := createTestBoard(t)
+	low := board.addRating("lisp", 1400, 3, 0, 0)
+	high := board.addRating("lisp", 1600, 5, 0, 0)
+	board.addRating("lisp", 1700, 0, 0, 0)
+
+	deleted := board.addRating("lisp", 1800, 2, 0, 0)
+	if err := board.wizardDao.Delete(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	page := board.get(Query{}, false)
+	assertEntries(t, page, high, low)
+
+	if page.Entries[0].Rank != 1 || page.Entries[1].Rank != 2 || page.Entries[0].Games != 5 || page.NextCursor != "" {
+		t.Errorf("Unexpected entries: got %+v and %+v", page.Entries[0], page.Entries[1])
+	}
+}
+
+func TestDao_GetFiltersBySeason(t *testing.T) {
+	board := createTestBoard(t)
+	current := board.addRating("lisp", 1500, 10, 2, 4)
+	board.addRating("lisp", 1600, 10, 1, 6)
+	board.addRating("lisp", 1700, 10, 2, 0)
+
+	page := board.get(Query{SeasonID: 2}, false)
+	assertEntries(t, page, current)
+
+	if page.Entries[0].Games != 4 {
+		t.Errorf("Expected only the season's games to be counted, got %d", page.Entries[0].Games)
+	}
+}
+
+func TestDao_GetFiltersByLanguage(t *testing.T) {
+	board := createTestBoard(t)
+	lisp := board.addRating("lisp", 1500, 1, 0, 0)
+	other := board.addRating("scheme", 1600, 1, 0, 0)
+	unscripted := board.addRating("", 1700, 1, 0, 0)
+
+	page := board.get(Query{Language: "lisp"}, false)
+	assertEntries(t, page, lisp)
+
+	page = board.get(Query{}, false)
+	assertEntries(t, page, unscripted, other, lisp)
+	if page.Entries[0].Language != "" || page.Entries[1].Language != "scheme" {
+		t.Errorf("Unexpected languages: got %q and %q", page.Entries[0].Language, page.Entries[1].Language)
+	}
+}
+
+func TestDao_GetFiltersByTimeRange(t *testing.T) {
+	board := createTestBoard(t)
+	now := time.Now()
+
+	recent := board.addRating("lisp", 1500, 1, 1, 1)
+	board.addBattle(recent, 1, now.Add(-time.Hour))
+
+	old := board.addRating("lisp", 1600, 1, 1, 1)
+	board.addBattle(old, 1, now.Add(-48*time.Hour))
+
+	future := board.addRating("lisp", 1700, 1, 1, 1)
+	board.addBattle(future, 1, now.Add(time.Hour))
+
+	otherSeason := board.addRating("lisp", 1800, 1, 1, 1)
+	board.addBattle(otherSeason, 2, now.Add(-time.Hour))
+
+	assertEntries(t, board.get(Query{From: now.Add(-24 * time.Hour), To: now}, false), otherSeason, recent)
+	assertEntries(t, board.get(Query{From: now.Add(-24 * time.Hour)}, false), otherSeason, future, recent)
+	assertEntries(t, board.get(Query{To: now}, false), otherSeason, old, recent)
+
+	// Within a season, only the battles of that season count
+	assertEntries(t, board.get(Query{SeasonID: 1, From: now.Add(-24 * time.Hour), To: now}, false), recent)
+}
+
+func TestDao_GetArchivedSeason(t *testing.T) {
+	board := createTestBoard(t)
+	first := board.addWizard("lisp")
+	second := board.addWizard("scheme")
+	other := board.addWizard("lisp")
+
+	// The live ratings have changed since the season ended
+	board.addRating("lisp", 2000, 50, 2, 10)
+
+	standings := []*seasons.Standing{
+		{SeasonID: 1, WizardID: first.ID, Rank: 2, Rating: 1500, Games: 7, Language: "lisp"},
+		{SeasonID: 1, WizardID: second.ID, Rank: 1, Rating: 1600, Games: 9, Language: "scheme"},
+		{SeasonID: 2, WizardID: other.ID, Rank: 1, Rating: 1700, Games: 3, Language: "lisp"},
+	}
+	for _, standing := range standings {
+		if err := board.seasonDao.InsertStanding(standing); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page := board.get(Query{SeasonID: 1}, true)
+	assertEntries(t, page, second, first)
+	if page.Entries[0].Games != 9 || page.Entries[0].Language != "scheme" {
+		t.Errorf("Expected the archived standing, got %+v", page.Entries[0])
+	}
+
+	// The language is the one the wizard used when the season ended
+	assertEntries(t, board.get(Query{SeasonID: 1, Language: "lisp"}, true), first)
+}
+
+func TestDao_GetPagesAcrossTiedRatings(t *testing.T) {
+	board := createTestBoard(t)
+
+	var expected []*wizards.Wizard
+	expected = append(expected, board.addRating("lisp", 1600, 1, 0, 0))
+	for i := 0; i < 5; i++ {
+		expected = append(expected, board.addRating("lisp", 1500, 1, 0, 0))
+	}
+	expected = append(expected, board.addRating("lisp", 1400, 1, 0, 0))
+
+	for _, limit := range []int{1, 2, 3, 4} {
+		var seen []*Entry
+		query := Query{Limit: limit}
+		for {
+			page := board.get(query, false)
+			seen = append(seen, page.Entries...)
+			if page.NextCursor == "" {
+				break
+			}
+
+			if len(seen) > len(expected) {
+				t.Fatalf("Expected paging to stop after %d entries with a limit of %d", len(expected), limit)
+			}
+			query.Cursor = page.NextCursor
+		}
+
+		if len(seen) != len(expected) {
+			t.Fatalf("Expected %d entries with a limit of %d, got %d", len(expected), limit, len(seen))
+		}
+
+		for i, entry := range seen {
+			if entry.WizardID != expected[i].ID || entry.Rank != i+1 {
+				t.Errorf("Expected rank %d to be wizard %d with a limit of %d, got wizard %d at rank %d", i+1, expected[i].ID, limit, entry.WizardID, entry.Rank)
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Package logins keeps an audit trail of login attempts, and uses it to slow
+// down anyone trying to guess passwords.
+package logins
+
+import (
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+// Outcomes of a login attempt. Throttled attempts were turned away without
+// checking the password, so they do not count as failures.
+const (
+	Succeeded = "succeeded"
+	Failed    = "failed"
+	Throttled = "throttled"
+)
+
+// Sources are where a login attempt was made.
+const (
+	Web      = "web"
+	API      = "api"
+	External = "external" // through an identity provider, see package oidc
+)
+
+// maxUsernameLength matches the Users table, so that a long username
+// cannot stop an attempt from being recorded.
+const maxUsernameLength = 128
+
+type Attempt struct {
+	datastore.BaseRecord
+	Username  string    `db:"Username"` // as it was entered, so it may not belong to anyone
+	UserID    uint64    `db:"UserID"`   // zero if no user has the username
+	IPAddress string    `db:"IPAddress"`
+	Source    string    `db:"Source"`
+	Outcome   string    `db:"Outcome"`
+	Time      time.Time `db:"Time"`
+}
+
+func NewAttempt(username string, userID uint64, ipAddress string, source string, outcome string, t time.Time) *Attempt {
+	if len(username) > maxUsernameLength {
+		username = username[:maxUsernameLength]
+	}
+
+	return &Attempt{
+		Username:  username,
+		UserID:    userID,
+		IPAddress: ipAddress,
+		Source:    source,
+		Outcome:   outcome,
+		Time:      t,
+	}
+}
@@ -0,0 +1,54 @@
+package logins
+
+import (
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Attempt{}, "LoginAttempts")
+	return &Dao{DB: db}
+}
+
+func (dao *Dao) Insert(attempt *Attempt) error {
+	return dao.DB.Insert(attempt)
+}
+
+// GetRecentByUsername returns up to limit of the failed and successful
+// attempts to log in with the username since the given time, newest first.
+func (dao *Dao) GetRecentByUsername(username string, since time.Time, limit int) ([]*Attempt, error) {
+	return dao.selectNewestFirst("SELECT * FROM LoginAttempts WHERE Username = ? AND Time >= ? AND Outcome IN (?, ?)", limit, username, since, Failed, Succeeded)
+}
+
+// GetRecentFailuresByIPAddress returns up to limit of the failed attempts to
+// log in from the address since the given time, newest first.
+func (dao *Dao) GetRecentFailuresByIPAddress(ipAddress string, since time.Time, limit int) ([]*Attempt, error) {
+	return dao.selectNewestFirst("SELECT * FROM LoginAttempts WHERE IPAddress = ? AND Time >= ? AND Outcome = ?", limit, ipAddress, since, Failed)
+}
+
+// GetLatestByUsername returns the most recent attempt to log in with the
+// username, or nil if there has been none.
+func (dao *Dao) GetLatestByUsername(username string) (*Attempt, error) {
+	attempts, err := dao.selectNewestFirst("SELECT * FROM LoginAttempts WHERE Username = ?", 1, username)
+	if err != nil || len(attempts) == 0 {
+		return nil, err
+	}
+	return attempts[0], nil
+}
+
+// GetByUserID returns up to limit of the most recent attempts to log in as
+// the user, newest first.
+func (dao *Dao) GetByUserID(userID uint64, limit int) ([]*Attempt, error) {
+	return dao.selectNewestFirst("SELECT * FROM LoginAttempts WHERE UserID = ?", limit, userID)
+}
+
+func (dao *Dao) selectNewestFirst(query string, limit int, args ...interface{}) ([]*Attempt, error) {
+	var attempts []*Attempt
+	_, err := dao.DB.Select(&attempts, query+" ORDER BY Time DESC, ID DESC LIMIT ?", append(args, limit)...)
+	return attempts, err
+}
@@ -0,0 +1,143 @@
+package logins
+
+import (
+	"time"
+)
+
+// Policy decides how long to wait before another login attempt is allowed,
+// based on the number of failed attempts so far.
+type Policy struct {
+	FreeAttempts     int           // failures that are allowed without any delay
+	BaseDelay        time.Duration // delay after the first failure past the free attempts, which doubles with each one after
+	LockoutThreshold int           // failures after which the delay is always the lockout duration
+	LockoutDuration  time.Duration
+	Window           time.Duration // how far back failures are counted
+}
+
+var (
+	// AccountPolicy protects a single account from having its password
+	// guessed. A successful login resets the count.
+	AccountPolicy = Policy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		Window:           24 * time.Hour,
+	}
+
+	// AddressPolicy protects against one address guessing the passwords of
+	// many accounts. Successful logins do not reset the count, since they
+	// could be to an account the attacker owns.
+	AddressPolicy = Policy{
+		FreeAttempts:     20,
+		BaseDelay:        time.Second,
+		LockoutThreshold: 100,
+		LockoutDuration:  time.Hour,
+		Window:           time.Hour,
+	}
+)
+
+// Delay returns how long to wait after the last failure before another
+// attempt is allowed.
+func (policy Policy) Delay(failures int) time.Duration {
+	if failures < policy.FreeAttempts {
+		return 0
+	}
+
+	if failures >= policy.LockoutThreshold {
+		return policy.LockoutDuration
+	}
+
+	delay := policy.BaseDelay
+	for i := policy.FreeAttempts; i < failures && delay < policy.LockoutDuration; i++ {
+		delay *= 2
+	}
+
+	if delay > policy.LockoutDuration {
+		return policy.LockoutDuration
+	}
+	return delay
+}
+
+// Guard records login attempts and decides whether new ones are allowed.
+type Guard struct {
+	Dao     *Dao
+	Account Policy
+	Address Policy
+}
+
+func NewGuard(dao *Dao) *Guard {
+	return &Guard{Dao: dao, Account: AccountPolicy, Address: AddressPolicy}
+}
+
+// Check returns how long the caller has to wait before trying to log in as
+// the user from the address, or zero if they can try now. It also returns
+// the number of failed attempts since the user last logged in, so that
+// callers that log in on every request, such as the API, only need to
+// record a success when it resets them.
+func (guard *Guard) Check(username string, ipAddress string, now time.Time) (time.Duration, int, error) {
+	// Failures past the lockout threshold make no difference to the delay,
+	// so no more than that are loaded
+	byUsername, err := guard.Dao.GetRecentByUsername(username, now.Add(-guard.Account.Window), guard.Account.LockoutThreshold+1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	accountFailures, lastFailure := countFailures(byUsername, true)
+	wait := lastFailure.Add(guard.Account.Delay(accountFailures)).Sub(now)
+
+	byAddress, err := guard.Dao.GetRecentFailuresByIPAddress(ipAddress, now.Add(-guard.Address.Window), guard.Address.LockoutThreshold+1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	addressFailures, lastFailure := countFailures(byAddress, false)
+	if addressWait := lastFailure.Add(guard.Address.Delay(addressFailures)).Sub(now); addressWait > wait {
+		wait = addressWait
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, accountFailures, nil
+}
+
+// Record adds the attempt to the audit trail. A throttled attempt is not
+// added if the last attempt with the username was throttled from the same
+// address, so that hammering an account does not fill the audit trail.
+func (guard *Guard) Record(attempt *Attempt) error {
+	if attempt.Outcome == Throttled {
+		latest, err := guard.Dao.GetLatestByUsername(attempt.Username)
+		if err != nil {
+			return err
+		}
+
+		if latest != nil && latest.Outcome == Throttled && latest.IPAddress == attempt.IPAddress {
+			return nil
+		}
+	}
+
+	return guard.Dao.Insert(attempt)
+}
+
+// countFailures counts the failed attempts, which must be ordered newest
+// first, and returns the time of the most recent one. If resetOnSuccess is
+// set, only the failures since the last successful attempt are counted.
+func countFailures(attempts []*Attempt, resetOnSuccess bool) (int, time.Time) {
+	failures := 0
+	var lastFailure time.Time
+	for _, attempt := range attempts {
+		if attempt.Outcome == Succeeded && resetOnSuccess {
+			break
+		}
+
+		if attempt.Outcome == Failed {
+			if failures == 0 {
+				lastFailure = attempt.Time
+			}
+			failures++
+		}
+	}
+
+	return failures, lastFailure
+}
@@ -0,0 +1,147 @@
+package logins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/config"
+	"github.com/crob1140/codewiz-server/config/keys"
+	"github.com/crob1140/codewiz-server/datastore"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func createTestGuard(t *testing.T) *Guard {
+	// Each test has its own database, since the migrations can only be
+	// applied once
+	ds, err := datastore.Open("sqlite3", "file:"+t.Name()+".db?cache=shared&mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationsPath := config.GetString(keys.DatabaseMigrationsPath, "../../datastore/migrations")
+	if errs, ok := ds.UpSync(migrationsPath); !ok {
+		t.Fatal(errs)
+	}
+	return NewGuard(NewDao(ds))
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	policy := Policy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		LockoutThreshold: 10,
+		LockoutDuration:  time.Minute,
+	}
+
+	expected := map[int]time.Duration{
+		0:  0,
+		2:  0,
+		3:  time.Second,
+		4:  2 * time.Second,
+		6:  8 * time.Second,
+		9:  time.Minute, // 64 seconds is capped at the lockout duration
+		10: time.Minute,
+		50: time.Minute,
+	}
+
+	for failures, delay := range expected {
+		if actual := policy.Delay(failures); actual != delay {
+			t.Errorf("Unexpected delay after %d failures: got %v want %v", failures, actual, delay)
+		}
+	}
+}
+
+func TestCountFailures(t *testing.T) {
+	now := time.Date(2016, time.June, 1, 12, 0, 0, 0, time.UTC)
+	attempts := []*Attempt{
+		NewAttempt("TestUser", 1, "127.0.0.1", Web, Throttled, now),
+		NewAttempt("TestUser", 1, "127.0.0.1", Web, Failed, now.Add(-time.Minute)),
+		NewAttempt("TestUser", 1, "127.0.0.1", Web, Failed, now.Add(-2*time.Minute)),
+		NewAttempt("TestUser", 1, "127.0.0.1", Web, Succeeded, now.Add(-3*time.Minute)),
+		NewAttempt("TestUser", 1, "127.0.0.1", Web, Failed, now.Add(-4*time.Minute)),
+	}
+
+	failures, lastFailure := countFailures(attempts, true)
+	if failures != 2 || !lastFailure.Equal(now.Add(-time.Minute)) {
+		t.Errorf("Expected 2 failures since the last success, got %d ending at %v", failures, lastFailure)
+	}
+
+	failures, _ = countFailures(attempts, false)
+	if failures != 3 {
+		t.Errorf("Expected successes to be ignored, got %d failures", failures)
+	}
+
+	if failures, lastFailure := countFailures(nil, true); failures != 0 || !lastFailure.IsZero() {
+		t.Errorf("Expected no failures, got %d", failures)
+	}
+}
+
+func TestNewAttempt_TruncatesUsername(t *testing.T) {
+	long := make([]byte, 500)
+	for i := range long {
+		long[i] = 'a'
+	}
+
+	if attempt := NewAttempt(string(long), 0, "127.0.0.1", API, Failed, time.Now()); len(attempt.Username) != maxUsernameLength {
+		t.Errorf("Expected the username to be truncated, got %d characters", len(attempt.Username))
+	}
+}
+
+func TestGuard_Check(t *testing.T) {
+	guard := createTestGuard(t)
+	now := time.Now().UTC()
+
+	// Throttled attempts and attempts before the last success are ignored,
+	// as are failures past the lockout threshold
+	guard.Dao.Insert(NewAttempt("Guessed", 1, "192.0.2.1", Web, Failed, now.Add(-time.Hour)))
+	guard.Dao.Insert(NewAttempt("Guessed", 1, "192.0.2.1", Web, Succeeded, now.Add(-time.Hour+time.Second)))
+	for i := 0; i < guard.Account.LockoutThreshold+5; i++ {
+		guard.Dao.Insert(NewAttempt("Guessed", 1, "192.0.2.2", Web, Failed, now.Add(-time.Duration(30-i)*time.Second)))
+		guard.Dao.Insert(NewAttempt("Guessed", 1, "192.0.2.2", Web, Throttled, now.Add(-time.Duration(30-i)*time.Second)))
+	}
+
+	wait, failures, err := guard.Check("Guessed", "192.0.2.3", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failures != guard.Account.LockoutThreshold+1 {
+		t.Errorf("Unexpected number of failures: got %v want %v", failures, guard.Account.LockoutThreshold+1)
+	}
+
+	if wait <= guard.Account.LockoutDuration-time.Minute || wait > guard.Account.LockoutDuration {
+		t.Errorf("Expected the account to be locked out, got a wait of %v", wait)
+	}
+
+	if wait, failures, err := guard.Check("Unknown", "192.0.2.3", now); err != nil || wait != 0 || failures != 0 {
+		t.Errorf("Expected no wait for another account, got %v after %v failures (%v)", wait, failures, err)
+	}
+}
+
+func TestGuard_RecordCoalescesThrottledAttempts(t *testing.T) {
+	guard := createTestGuard(t)
+	now := time.Now().UTC()
+
+	attempts := []*Attempt{
+		NewAttempt("Hammered", 1, "192.0.2.1", API, Failed, now),
+		NewAttempt("Hammered", 1, "192.0.2.1", API, Throttled, now.Add(time.Second)),
+		NewAttempt("Hammered", 1, "192.0.2.1", API, Throttled, now.Add(2*time.Second)),
+		NewAttempt("Hammered", 1, "192.0.2.1", API, Throttled, now.Add(3*time.Second)),
+		NewAttempt("Hammered", 1, "192.0.2.2", API, Throttled, now.Add(4*time.Second)),
+	}
+
+	for _, attempt := range attempts {
+		if err := guard.Record(attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorded, err := guard.Dao.GetByUserID(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorded) != 3 || recorded[0].IPAddress != "192.0.2.2" || recorded[1].Outcome != Throttled || recorded[2].Outcome != Failed {
+		t.Errorf("Expected repeated throttled attempts from one address to be recorded once, got %d attempts", len(recorded))
+	}
+}
@@ -0,0 +1,65 @@
+package matchmaking
+
+import (
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Entry{}, "MatchmakingQueue")
+	return &Dao{DB: db}
+}
+
+// WithTx returns a copy of the DAO that runs its queries in the given
+// transaction, see datastore.DB.WithTransaction.
+func (dao *Dao) WithTx(tx *datastore.DB) *Dao {
+	return &Dao{DB: tx}
+}
+
+func (dao *Dao) GetByID(id uint64) (*Entry, error) {
+	entry, err := dao.DB.Get(Entry{}, "SELECT * FROM MatchmakingQueue WHERE ID = ?", id)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return entry.(*Entry), err
+}
+
+// GetWaiting returns every entry still in the queue, oldest first.
+func (dao *Dao) GetWaiting() ([]*Entry, error) {
+	var entries []*Entry
+	_, err := dao.DB.Select(&entries, "SELECT * FROM MatchmakingQueue WHERE State = ? ORDER BY ID", Waiting)
+	return entries, err
+}
+
+// GetWaitingByWizardID returns the wizard's entry in the queue, or nil if it is not queued.
+func (dao *Dao) GetWaitingByWizardID(wizardID uint64) (*Entry, error) {
+	entry, err := dao.DB.Get(Entry{}, "SELECT * FROM MatchmakingQueue WHERE WizardID = ? AND State = ?", wizardID, Waiting)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return entry.(*Entry), err
+}
+
+// CancelWaiting takes the wizard out of the queue if it is waiting, and
+// does nothing otherwise.
+func (dao *Dao) CancelWaiting(wizardID uint64, reason string) error {
+	entry, err := dao.GetWaitingByWizardID(wizardID)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	entry.State = Cancelled
+	entry.Reason = reason
+	return dao.Update(entry)
+}
+
+func (dao *Dao) Insert(entry *Entry) error {
+	return dao.DB.Insert(entry)
+}
+
+func (dao *Dao) Update(entry *Entry) error {
+	return dao.DB.Update(entry)
+}
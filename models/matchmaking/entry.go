@@ -0,0 +1,30 @@
+package matchmaking
+
+import (
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type State string
+
+const (
+	Waiting   State = "waiting"
+	Matched   State = "matched"
+	Failed    State = "failed"
+	Cancelled State = "cancelled"
+)
+
+// Entry is a wizard waiting in the ranked matchmaking queue. Entries are
+// kept after they leave the queue, so that players can find the battle
+// their wizard was matched into.
+type Entry struct {
+	datastore.BaseRecord
+	WizardID uint64 `db:"WizardID"`
+	OwnerID  uint64 `db:"OwnerID"`
+	State    State  `db:"State"`
+	BattleID uint64 `db:"BattleID"` // zero until the wizard has been matched
+	Reason   string `db:"Reason"`   // why the entry failed, if it did
+}
+
+func NewEntry(wizardID uint64, ownerID uint64) *Entry {
+	return &Entry{WizardID: wizardID, OwnerID: ownerID, State: Waiting}
+}
@@ -0,0 +1,71 @@
+package ratings
+
+import (
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Rating{}, "Ratings")
+	db.AddTableWithName(History{}, "RatingHistory")
+	return &Dao{DB: db}
+}
+
+// WithTx returns a copy of the DAO that runs its queries in the given
+// transaction, see datastore.DB.WithTransaction.
+func (dao *Dao) WithTx(tx *datastore.DB) *Dao {
+	return &Dao{DB: tx}
+}
+
+func (dao *Dao) GetByWizardID(wizardID uint64) (*Rating, error) {
+	rating, err := dao.DB.Get(Rating{}, "SELECT * FROM Ratings WHERE WizardID = ?", wizardID)
+	if err != nil || rating == nil {
+		return nil, err
+	}
+	return rating.(*Rating), err
+}
+
+// GetOrCreate returns the wizard's stored rating, or an unsaved default
+// rating if the wizard has not played a ranked battle.
+func (dao *Dao) GetOrCreate(wizardID uint64) (*Rating, error) {
+	rating, err := dao.GetByWizardID(wizardID)
+	if err != nil || rating != nil {
+		return rating, err
+	}
+	return NewRating(wizardID), nil
+}
+
+func (dao *Dao) GetAll() ([]*Rating, error) {
+	var ratings []*Rating
+	_, err := dao.DB.Select(&ratings, "SELECT * FROM Ratings")
+	return ratings, err
+}
+
+// GetBySeasonID returns the ratings of every wizard that has played in the season.
+func (dao *Dao) GetBySeasonID(seasonID uint64) ([]*Rating, error) {
+	var ratings []*Rating
+	_, err := dao.DB.Select(&ratings, "SELECT * FROM Ratings WHERE SeasonID = ? AND SeasonGames > 0", seasonID)
+	return ratings, err
+}
+
+// Save inserts the rating if it is new, and updates it otherwise.
+func (dao *Dao) Save(rating *Rating) error {
+	if rating.ID == 0 {
+		return dao.DB.Insert(rating)
+	}
+	return dao.DB.Update(rating)
+}
+
+func (dao *Dao) InsertHistory(history *History) error {
+	return dao.DB.Insert(history)
+}
+
+// GetHistory returns the wizard's rating changes, newest first.
+func (dao *Dao) GetHistory(wizardID uint64) ([]*History, error) {
+	var history []*History
+	_, err := dao.DB.Select(&history, "SELECT * FROM RatingHistory WHERE WizardID = ? ORDER BY ID DESC", wizardID)
+	return history, err
+}
@@ -0,0 +1,138 @@
+package ratings
+
+import (
+	"math"
+)
+
+// Parameters of the Glicko-2 rating system, as recommended in
+// Glickman's paper "Example of the Glicko-2 system".
+const (
+	DefaultRating     = 1500.0
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+
+	// tau constrains how quickly volatility can change. Smaller values
+	// stop a handful of surprising results from moving ratings too far.
+	tau = 0.5
+
+	// scale converts between the Glicko and Glicko-2 scales.
+	scale = 173.7178
+
+	convergenceTolerance = 0.000001
+)
+
+// Glicko is a player's rating under the Glicko-2 system, expressed on the
+// familiar Glicko scale where new players start at 1500.
+type Glicko struct {
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+}
+
+// NewGlicko returns the rating given to players with no history.
+func NewGlicko() Glicko {
+	return Glicko{Rating: DefaultRating, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+}
+
+// Result is the outcome of a single game against an opponent. Score is
+// 1 for a win, 0.5 for a draw and 0 for a loss.
+type Result struct {
+	Opponent Glicko
+	Score    float64
+}
+
+const (
+	Win  = 1.0
+	Draw = 0.5
+	Loss = 0.0
+)
+
+// Update returns the rating after a rating period in which the given
+// games were played. A period with no games only increases the deviation,
+// reflecting the growing uncertainty about an inactive player.
+func (player Glicko) Update(results []Result) Glicko {
+	mu := (player.Rating - DefaultRating) / scale
+	phi := player.Deviation / scale
+	sigma := player.Volatility
+
+	if len(results) == 0 {
+		return Glicko{
+			Rating:     player.Rating,
+			Deviation:  math.Sqrt(phi*phi+sigma*sigma) * scale,
+			Volatility: sigma,
+		}
+	}
+
+	// Estimated variance of the rating based on the game outcomes, and the
+	// estimated improvement in rating compared to what was expected.
+	var varianceSum, improvementSum float64
+	for _, result := range results {
+		opponentMu := (result.Opponent.Rating - DefaultRating) / scale
+		opponentPhi := result.Opponent.Deviation / scale
+
+		g := gFactor(opponentPhi)
+		e := expectedScore(mu, opponentMu, g)
+		varianceSum += g * g * e * (1 - e)
+		improvementSum += g * (result.Score - e)
+	}
+
+	v := 1 / varianceSum
+	delta := v * improvementSum
+
+	newSigma := newVolatility(phi, sigma, v, delta)
+
+	preRatingPhi := math.Sqrt(phi*phi + newSigma*newSigma)
+	newPhi := 1 / math.Sqrt(1/(preRatingPhi*preRatingPhi)+1/v)
+	newMu := mu + newPhi*newPhi*improvementSum
+
+	return Glicko{
+		Rating:     newMu*scale + DefaultRating,
+		Deviation:  newPhi * scale,
+		Volatility: newSigma,
+	}
+}
+
+func gFactor(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expectedScore(mu float64, opponentMu float64, g float64) float64 {
+	return 1 / (1 + math.Exp(-g*(mu-opponentMu)))
+}
+
+// newVolatility finds the updated volatility using the Illinois algorithm,
+// as described in step 5 of the Glicko-2 paper.
+func newVolatility(phi float64, sigma float64, v float64, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		denominator := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*denominator*denominator) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > convergenceTolerance {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA = fA / 2
+		}
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
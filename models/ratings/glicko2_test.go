@@ -0,0 +1,47 @@
+package ratings
+
+import (
+	"math"
+	"testing"
+)
+
+func assertClose(t *testing.T, name string, got float64, want float64, tolerance float64) {
+	if math.Abs(got-want) > tolerance {
+		t.Errorf("Unexpected %s: got %f want %f", name, got, want)
+	}
+}
+
+// TestGlicko_Update_MatchesPaperExample checks the worked example from
+// Glickman's "Example of the Glicko-2 system".
+func TestGlicko_Update_MatchesPaperExample(t *testing.T) {
+	player := Glicko{Rating: 1500, Deviation: 200, Volatility: 0.06}
+
+	updated := player.Update([]Result{
+		{Opponent: Glicko{Rating: 1400, Deviation: 30, Volatility: 0.06}, Score: Win},
+		{Opponent: Glicko{Rating: 1550, Deviation: 100, Volatility: 0.06}, Score: Loss},
+		{Opponent: Glicko{Rating: 1700, Deviation: 300, Volatility: 0.06}, Score: Loss},
+	})
+
+	assertClose(t, "rating", updated.Rating, 1464.06, 0.01)
+	assertClose(t, "deviation", updated.Deviation, 151.52, 0.01)
+	assertClose(t, "volatility", updated.Volatility, 0.05999, 0.00001)
+}
+
+func TestGlicko_Update_InactivityIncreasesDeviation(t *testing.T) {
+	player := Glicko{Rating: 1700, Deviation: 50, Volatility: 0.06}
+
+	updated := player.Update(nil)
+	if updated.Rating != player.Rating || updated.Deviation <= player.Deviation {
+		t.Fatalf("Expected only the deviation to grow, got %+v", updated)
+	}
+}
+
+func TestGlicko_Update_DrawBetweenEqualsChangesNothing(t *testing.T) {
+	player := NewGlicko()
+
+	updated := player.Update([]Result{{Opponent: NewGlicko(), Score: Draw}})
+	assertClose(t, "rating", updated.Rating, DefaultRating, 0.000001)
+	if updated.Deviation >= player.Deviation {
+		t.Fatalf("Expected playing a game to reduce the deviation, got %f", updated.Deviation)
+	}
+}
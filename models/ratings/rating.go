@@ -0,0 +1,74 @@
+package ratings
+
+import (
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+// Rating is the current ranked rating of a wizard. Wizards that have not
+// played a ranked battle do not have a stored rating.
+type Rating struct {
+	datastore.BaseRecord
+	WizardID   uint64  `db:"WizardID"`
+	Rating     float64 `db:"Rating"`
+	Deviation  float64 `db:"Deviation"`
+	Volatility float64 `db:"Volatility"`
+	Games      int     `db:"Games"`
+
+	// SeasonID is the season the rating was last played or reset in, and
+	// SeasonGames counts the ranked battles played during that season.
+	SeasonID    uint64 `db:"SeasonID"`
+	SeasonGames int    `db:"SeasonGames"`
+}
+
+// History records a wizard's rating after a ranked battle, so that
+// players can see how their wizard's rating has changed over time.
+type History struct {
+	datastore.BaseRecord
+	WizardID   uint64  `db:"WizardID"`
+	BattleID   uint64  `db:"BattleID"`
+	SeasonID   uint64  `db:"SeasonID"` // zero if the battle was not played during a season
+	Rating     float64 `db:"Rating"`
+	Deviation  float64 `db:"Deviation"`
+	Volatility float64 `db:"Volatility"`
+	Change     float64 `db:"Change"`
+}
+
+func NewRating(wizardID uint64) *Rating {
+	rating := &Rating{WizardID: wizardID}
+	rating.SetGlicko(NewGlicko())
+	return rating
+}
+
+func (rating *Rating) Glicko() Glicko {
+	return Glicko{Rating: rating.Rating, Deviation: rating.Deviation, Volatility: rating.Volatility}
+}
+
+func (rating *Rating) SetGlicko(glicko Glicko) {
+	rating.Rating = glicko.Rating
+	rating.Deviation = glicko.Deviation
+	rating.Volatility = glicko.Volatility
+}
+
+// Record updates the rating with the outcome of a ranked battle played
+// during the given season, and returns the history entry describing the change.
+func (rating *Rating) Record(battleID uint64, seasonID uint64, result Result) *History {
+	if rating.SeasonID != seasonID {
+		rating.SeasonID = seasonID
+		rating.SeasonGames = 0
+	}
+
+	previous := rating.Rating
+	rating.SetGlicko(rating.Glicko().Update([]Result{result}))
+	rating.Games++
+	rating.SeasonGames++
+
+	return &History{
+		WizardID:   rating.WizardID,
+		BattleID:   battleID,
+		SeasonID:   seasonID,
+		Rating:     rating.Rating,
+		Deviation:  rating.Deviation,
+		Volatility: rating.Volatility,
+		Change:     rating.Rating - previous,
+	}
+}
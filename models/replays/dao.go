@@ -0,0 +1,36 @@
+package replays
+
+import (
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Replay{}, "Replays")
+	return &Dao{DB: db}
+}
+
+// WithTx returns a copy of the DAO that runs its queries in the given
+// transaction, see datastore.DB.WithTransaction.
+func (dao *Dao) WithTx(tx *datastore.DB) *Dao {
+	return &Dao{DB: tx}
+}
+
+func (dao *Dao) GetByBattleID(battleID uint64) (*Replay, error) {
+	replay, err := dao.DB.Get(Replay{}, "SELECT * FROM Replays WHERE BattleID = ?", battleID)
+	if err != nil || replay == nil {
+		return nil, err
+	}
+	return replay.(*Replay), err
+}
+
+func (dao *Dao) Insert(replay *Replay) error {
+	return dao.DB.Insert(replay)
+}
+
+func (dao *Dao) Delete(replay *Replay) error {
+	return dao.DB.Delete(replay)
+}
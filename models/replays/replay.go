@@ -0,0 +1,19 @@
+package replays
+
+import (
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+// Replay holds the encoded recording of a battle. The data is in the
+// format written by the arena/replay package, and is stored as-is so that
+// it can be streamed straight to clients.
+type Replay struct {
+	datastore.BaseRecord
+	BattleID      uint64 `db:"BattleID"`
+	FormatVersion int    `db:"FormatVersion"`
+	Data          []byte `db:"Data"`
+}
+
+func NewReplay(battleID uint64, formatVersion int, data []byte) *Replay {
+	return &Replay{BattleID: battleID, FormatVersion: formatVersion, Data: data}
+}
@@ -0,0 +1,66 @@
+package seasons
+
+import (
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Season{}, "Seasons")
+	db.AddTableWithName(Standing{}, "SeasonStandings")
+	return &Dao{DB: db}
+}
+
+func (dao *Dao) GetByID(id uint64) (*Season, error) {
+	season, err := dao.DB.Get(Season{}, "SELECT * FROM Seasons WHERE ID = ?", id)
+	if err != nil || season == nil {
+		return nil, err
+	}
+	return season.(*Season), err
+}
+
+// GetAll returns every season, oldest first.
+func (dao *Dao) GetAll() ([]*Season, error) {
+	var seasons []*Season
+	_, err := dao.DB.Select(&seasons, "SELECT * FROM Seasons ORDER BY StartTime")
+	return seasons, err
+}
+
+// GetAt returns the season that is running at the given time, or nil if
+// there is a break between seasons.
+func (dao *Dao) GetAt(t time.Time) (*Season, error) {
+	seasons, err := dao.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, season := range seasons {
+		if season.Contains(t) {
+			return season, nil
+		}
+	}
+	return nil, nil
+}
+
+func (dao *Dao) Insert(season *Season) error {
+	return dao.DB.Insert(season)
+}
+
+func (dao *Dao) Update(season *Season) error {
+	return dao.DB.Update(season)
+}
+
+func (dao *Dao) InsertStanding(standing *Standing) error {
+	return dao.DB.Insert(standing)
+}
+
+// HasStandings reports whether the season has ended and had its final standings archived.
+func (dao *Dao) HasStandings(seasonID uint64) (bool, error) {
+	count, err := dao.DB.SelectInt("SELECT COUNT(*) FROM SeasonStandings WHERE SeasonID = ? AND Status <> ?", seasonID, datastore.Deleted)
+	return count > 0, err
+}
@@ -0,0 +1,129 @@
+package seasons
+
+import (
+	"sort"
+	"time"
+
+	"github.com/crob1140/codewiz-server/models/ratings"
+	"github.com/crob1140/codewiz-server/models/wizards"
+)
+
+// Scheduler starts seasons when they are due. Starting a season archives
+// the final standings of the previous season and applies the new season's
+// soft reset to every rating.
+type Scheduler struct {
+	Dao       *Dao
+	RatingDao *ratings.Dao
+	WizardDao *wizards.Dao
+}
+
+func NewScheduler(dao *Dao, ratingDao *ratings.Dao, wizardDao *wizards.Dao) *Scheduler {
+	return &Scheduler{Dao: dao, RatingDao: ratingDao, WizardDao: wizardDao}
+}
+
+// Advance starts the season running at the given time if it has not been
+// started yet, and returns it. It returns nil if no season is running.
+func (scheduler *Scheduler) Advance(now time.Time) (*Season, error) {
+	current, err := scheduler.Dao.GetAt(now)
+	if err != nil || current == nil || current.Started {
+		return current, err
+	}
+
+	previous, err := scheduler.latestStarted(current)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous != nil {
+		if err := scheduler.archive(previous); err != nil {
+			return nil, err
+		}
+	}
+
+	all, err := scheduler.RatingDao.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rating := range all {
+		rating.SetGlicko(current.Reset(rating.Glicko()))
+		rating.SeasonID = current.ID
+		rating.SeasonGames = 0
+		if err := scheduler.RatingDao.Save(rating); err != nil {
+			return nil, err
+		}
+	}
+
+	current.Started = true
+	if err := scheduler.Dao.Update(current); err != nil {
+		return nil, err
+	}
+
+	return current, nil
+}
+
+func (scheduler *Scheduler) latestStarted(current *Season) (*Season, error) {
+	all, err := scheduler.Dao.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *Season
+	for _, season := range all {
+		if season.Started && season.ID != current.ID {
+			latest = season
+		}
+	}
+	return latest, nil
+}
+
+// archive saves the final standings of a season from the ratings of the
+// wizards that played in it.
+func (scheduler *Scheduler) archive(season *Season) error {
+	played, err := scheduler.RatingDao.GetBySeasonID(season.ID)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(played, func(i, j int) bool {
+		if played[i].Rating != played[j].Rating {
+			return played[i].Rating > played[j].Rating
+		}
+		return played[i].WizardID < played[j].WizardID
+	})
+
+	for i, rating := range played {
+		language, err := scheduler.activeLanguage(rating.WizardID)
+		if err != nil {
+			return err
+		}
+
+		err = scheduler.Dao.InsertStanding(&Standing{
+			SeasonID:  season.ID,
+			WizardID:  rating.WizardID,
+			Rank:      i + 1,
+			Rating:    rating.Rating,
+			Deviation: rating.Deviation,
+			Games:     rating.SeasonGames,
+			Language:  language,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (scheduler *Scheduler) activeLanguage(wizardID uint64) (string, error) {
+	wizard, err := scheduler.WizardDao.GetByID(wizardID)
+	if err != nil || wizard == nil {
+		return "", err
+	}
+
+	script, err := scheduler.WizardDao.GetActiveScript(wizard)
+	if err != nil || script == nil {
+		return "", err
+	}
+	return script.Language, nil
+}
@@ -0,0 +1,71 @@
+package seasons
+
+import (
+	"math"
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/models/ratings"
+)
+
+// Season is a period of ranked play. When a season begins, every rating is
+// pulled part of the way back towards the default, so that established
+// wizards keep an advantage but new players have a chance to catch up.
+type Season struct {
+	datastore.BaseRecord
+	Name      string    `db:"Name"`
+	StartTime time.Time `db:"StartTime"`
+	EndTime   time.Time `db:"EndTime"`
+
+	// Carryover is the fraction of each wizard's distance from the default
+	// rating that survives the reset, between 0 (a hard reset) and 1.
+	Carryover float64 `db:"Carryover"`
+
+	// ResetDeviation is the minimum deviation after the reset, so that
+	// ratings settle quickly during the first battles of the season.
+	ResetDeviation float64 `db:"ResetDeviation"`
+
+	// Started is set once the reset has been applied.
+	Started bool `db:"Started"`
+}
+
+const (
+	DefaultCarryover      = 0.75
+	DefaultResetDeviation = 150.0
+)
+
+func NewSeason(name string, startTime time.Time, endTime time.Time) *Season {
+	return &Season{
+		Name:           name,
+		StartTime:      startTime.UTC(),
+		EndTime:        endTime.UTC(),
+		Carryover:      DefaultCarryover,
+		ResetDeviation: DefaultResetDeviation,
+	}
+}
+
+// Contains reports whether the time falls within the season.
+func (season *Season) Contains(t time.Time) bool {
+	return !t.Before(season.StartTime) && t.Before(season.EndTime)
+}
+
+// Reset applies the season's soft-reset policy to a rating.
+func (season *Season) Reset(glicko ratings.Glicko) ratings.Glicko {
+	return ratings.Glicko{
+		Rating:     ratings.DefaultRating + (glicko.Rating-ratings.DefaultRating)*season.Carryover,
+		Deviation:  math.Min(math.Max(glicko.Deviation, season.ResetDeviation), ratings.DefaultDeviation),
+		Volatility: glicko.Volatility,
+	}
+}
+
+// Standing is a wizard's final position in a season that has ended.
+type Standing struct {
+	datastore.BaseRecord
+	SeasonID  uint64  `db:"SeasonID"`
+	WizardID  uint64  `db:"WizardID"`
+	Rank      int     `db:"Rank"`
+	Rating    float64 `db:"Rating"`
+	Deviation float64 `db:"Deviation"`
+	Games     int     `db:"Games"`
+	Language  string  `db:"Language"` // the language of the wizard's active script when the season ended
+}
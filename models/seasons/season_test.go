@@ -0,0 +1,31 @@
+package seasons
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/models/ratings"
+)
+
+func TestSeason_Reset_PullsRatingsTowardsDefault(t *testing.T) {
+	season := NewSeason("Spring", time.Now(), time.Now().Add(time.Hour))
+
+	strong := season.Reset(ratings.Glicko{Rating: 1900, Deviation: 60, Volatility: 0.06})
+	if strong.Rating != 1800 || strong.Deviation != DefaultResetDeviation {
+		t.Fatalf("Unexpected reset for a strong rating: %+v", strong)
+	}
+
+	weak := season.Reset(ratings.Glicko{Rating: 1300, Deviation: 340, Volatility: 0.06})
+	if weak.Rating != 1350 || weak.Deviation != 340 {
+		t.Fatalf("Unexpected reset for a weak rating: %+v", weak)
+	}
+}
+
+func TestSeason_Contains(t *testing.T) {
+	start := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	season := NewSeason("Winter", start, start.AddDate(0, 3, 0))
+
+	if !season.Contains(start) || season.Contains(start.AddDate(0, 3, 0)) || season.Contains(start.Add(-time.Second)) {
+		t.Fatalf("Expected the season to include its start time but not its end time")
+	}
+}
@@ -0,0 +1,48 @@
+package seasons
+
+import (
+	"github.com/crob1140/codewiz-server/models"
+)
+
+type Validator struct {
+	Dao *Dao
+}
+
+func NewValidator(dao *Dao) *Validator {
+	return &Validator{Dao: dao}
+}
+
+func (validator *Validator) Validate(season *Season) (models.ValidationErrors, error) {
+
+	errs := make(models.ValidationErrors)
+
+	if season.Name == "" {
+		errs.Add("Name", "This field cannot be empty.")
+	}
+
+	if !season.EndTime.After(season.StartTime) {
+		errs.Add("EndTime", "The season must end after it starts.")
+	}
+
+	if season.Carryover < 0 || season.Carryover > 1 {
+		errs.Add("Carryover", "Must be between 0 and 1.")
+	}
+
+	if season.ResetDeviation < 0 {
+		errs.Add("ResetDeviation", "Cannot be negative.")
+	}
+
+	existing, err := validator.Dao.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, other := range existing {
+		if other.ID != season.ID && season.StartTime.Before(other.EndTime) && other.StartTime.Before(season.EndTime) {
+			errs.Add("StartTime", "The season overlaps with "+other.Name+".")
+			break
+		}
+	}
+
+	return errs, nil
+}
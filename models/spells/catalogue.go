@@ -0,0 +1,162 @@
+package spells
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/crob1140/codewiz-server/arena"
+)
+
+// FormatVersion is the version of the definition file format understood by this package.
+const FormatVersion = 1
+
+var idPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// definitionFile is the on-disk representation of the catalogue.
+type definitionFile struct {
+	FormatVersion  int      `json:"formatVersion"`
+	Version        string   `json:"version"`
+	MaxEquipped    int      `json:"maxEquipped"`
+	DefaultLoadout []string `json:"defaultLoadout"`
+	Spells         []Spell  `json:"spells"`
+}
+
+// Catalogue is the set of spells that exist in the game. It is loaded from
+// a definition file, so that spells can be rebalanced without code changes.
+type Catalogue struct {
+	version        string
+	maxEquipped    int
+	defaultLoadout []string
+	spells         []*Spell
+	byID           map[string]*Spell
+}
+
+func LoadCatalogue(path string) (*Catalogue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadCatalogue(file)
+}
+
+func ReadCatalogue(reader io.Reader) (*Catalogue, error) {
+	var definitions definitionFile
+	if err := json.NewDecoder(reader).Decode(&definitions); err != nil {
+		return nil, err
+	}
+
+	if definitions.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("Unsupported spell definition format version %d.", definitions.FormatVersion)
+	}
+
+	if definitions.MaxEquipped <= 0 {
+		return nil, fmt.Errorf("The maximum number of equipped spells must be positive.")
+	}
+
+	catalogue := &Catalogue{
+		version:     definitions.Version,
+		maxEquipped: definitions.MaxEquipped,
+		byID:        make(map[string]*Spell, len(definitions.Spells)),
+	}
+
+	for i := range definitions.Spells {
+		spell := &definitions.Spells[i]
+		if err := validateDefinition(spell); err != nil {
+			return nil, err
+		}
+
+		if _, exists := catalogue.byID[spell.ID]; exists {
+			return nil, fmt.Errorf("Spell '%s' is defined more than once.", spell.ID)
+		}
+
+		catalogue.spells = append(catalogue.spells, spell)
+		catalogue.byID[spell.ID] = spell
+	}
+
+	if errs := catalogue.ValidateLoadout(definitions.DefaultLoadout); len(errs) != 0 {
+		return nil, fmt.Errorf("Invalid default loadout: %s", errs[0])
+	}
+	catalogue.defaultLoadout = definitions.DefaultLoadout
+
+	return catalogue, nil
+}
+
+func validateDefinition(spell *Spell) error {
+	if !idPattern.MatchString(spell.ID) {
+		return fmt.Errorf("Spell ID '%s' must be lowercase letters, numbers and hyphens.", spell.ID)
+	}
+
+	if spell.Effect != arena.Damage && spell.Effect != arena.Heal {
+		return fmt.Errorf("Spell '%s' has an unknown effect type '%s'.", spell.ID, spell.Effect)
+	}
+
+	if spell.ManaCost < 0 || spell.Cooldown < 0 || spell.Range < 0 || spell.Power < 0 || spell.Area < 0 {
+		return fmt.Errorf("Spell '%s' cannot have negative values.", spell.ID)
+	}
+
+	return nil
+}
+
+// Version identifies the revision of the definitions, so that battle
+// records can note which balance changes were in effect.
+func (catalogue *Catalogue) Version() string {
+	return catalogue.version
+}
+
+func (catalogue *Catalogue) MaxEquipped() int {
+	return catalogue.maxEquipped
+}
+
+// All returns every spell in the order they are defined.
+func (catalogue *Catalogue) All() []*Spell {
+	return catalogue.spells
+}
+
+// Get returns the spell with the given ID, or nil if it does not exist.
+func (catalogue *Catalogue) Get(id string) *Spell {
+	return catalogue.byID[id]
+}
+
+// ValidateLoadout returns a description of each problem with the set of spells a wizard wants to equip.
+func (catalogue *Catalogue) ValidateLoadout(spellIDs []string) []string {
+	var problems []string
+
+	if len(spellIDs) > catalogue.maxEquipped {
+		problems = append(problems, fmt.Sprintf("A wizard cannot equip more than %d spells.", catalogue.maxEquipped))
+	}
+
+	seen := make(map[string]bool, len(spellIDs))
+	for _, id := range spellIDs {
+		if catalogue.byID[id] == nil {
+			problems = append(problems, fmt.Sprintf("Spell '%s' does not exist.", id))
+		} else if seen[id] {
+			problems = append(problems, fmt.Sprintf("Spell '%s' is equipped more than once.", id))
+		}
+		seen[id] = true
+	}
+
+	return problems
+}
+
+// Loadout returns the spells a wizard will take into battle, falling back
+// to the default loadout if the wizard has not equipped any.
+func (catalogue *Catalogue) Loadout(spellIDs []string) []string {
+	if len(spellIDs) == 0 {
+		return catalogue.defaultLoadout
+	}
+	return spellIDs
+}
+
+// Arena returns the battle engine definitions of every spell in the catalogue.
+func (catalogue *Catalogue) Arena() []arena.Spell {
+	spells := make([]arena.Spell, len(catalogue.spells))
+	for i, spell := range catalogue.spells {
+		spells[i] = spell.Arena()
+	}
+	return spells
+}
@@ -0,0 +1,70 @@
+package spells
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDefinitions = `{
+	"formatVersion": 1,
+	"version": "test",
+	"maxEquipped": 2,
+	"defaultLoadout": ["spark"],
+	"spells": [
+		{"id": "spark", "name": "Spark", "manaCost": 5, "range": 3, "effect": "damage", "power": 5},
+		{"id": "mend", "name": "Mend", "manaCost": 30, "cooldown": 5, "effect": "heal", "power": 20}
+	]
+}`
+
+func TestLoadCatalogue_DefaultDefinitionsAreValid(t *testing.T) {
+	catalogue, err := LoadCatalogue("resources/spells.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(catalogue.All()) == 0 {
+		t.Fatalf("Expected the default catalogue to contain spells")
+	}
+}
+
+func TestReadCatalogue_IndexesSpellsByID(t *testing.T) {
+	catalogue, err := ReadCatalogue(strings.NewReader(testDefinitions))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spell := catalogue.Get("mend")
+	if spell == nil || spell.Name != "Mend" || spell.Cooldown != 5 {
+		t.Fatalf("Unexpected spell returned for 'mend': %+v", spell)
+	}
+
+	if catalogue.Get("meteor") != nil {
+		t.Fatalf("Expected no spell to be returned for an unknown ID")
+	}
+}
+
+func TestReadCatalogue_RejectsUnknownEffect(t *testing.T) {
+	definitions := strings.Replace(testDefinitions, `"heal"`, `"teleport"`, 1)
+	if _, err := ReadCatalogue(strings.NewReader(definitions)); err == nil {
+		t.Fatalf("Expected an error for an unknown effect type")
+	}
+}
+
+func TestCatalogue_ValidateLoadout(t *testing.T) {
+	catalogue, err := ReadCatalogue(strings.NewReader(testDefinitions))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if problems := catalogue.ValidateLoadout([]string{"spark", "mend"}); len(problems) != 0 {
+		t.Fatalf("Expected a valid loadout, got %v", problems)
+	}
+
+	if problems := catalogue.ValidateLoadout([]string{"spark", "spark"}); len(problems) != 1 {
+		t.Fatalf("Expected duplicate spells to be rejected, got %v", problems)
+	}
+
+	if problems := catalogue.ValidateLoadout([]string{"spark", "mend", "meteor"}); len(problems) != 2 {
+		t.Fatalf("Expected too many spells and an unknown spell to be rejected, got %v", problems)
+	}
+}
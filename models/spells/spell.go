@@ -0,0 +1,33 @@
+package spells
+
+import (
+	"github.com/crob1140/codewiz-server/arena"
+)
+
+// Spell is a single entry in the spell catalogue.
+type Spell struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	ManaCost    int              `json:"manaCost"`
+	Cooldown    int              `json:"cooldown"`
+	Range       int              `json:"range"`
+	Effect      arena.EffectType `json:"effect"`
+	Power       int              `json:"power"`
+	Area        int              `json:"area"`
+}
+
+// Arena converts the spell into the definition used by the battle engine.
+// Spells are identified by their ID inside a battle, since that is the
+// name scripts use when casting them.
+func (spell *Spell) Arena() arena.Spell {
+	return arena.Spell{
+		Name:     spell.ID,
+		ManaCost: spell.ManaCost,
+		Cooldown: spell.Cooldown,
+		Range:    spell.Range,
+		Effect:   spell.Effect,
+		Power:    spell.Power,
+		Area:     spell.Area,
+	}
+}
@@ -0,0 +1,49 @@
+package tokens
+
+import (
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(AccessToken{}, "AccessTokens")
+	return &Dao{DB: db}
+}
+
+func (dao *Dao) GetByID(id uint64) (*AccessToken, error) {
+	token, err := dao.DB.Get(AccessToken{}, "SELECT * FROM AccessTokens WHERE ID = ?", id)
+	if err != nil || token == nil {
+		return nil, err
+	}
+	return token.(*AccessToken), err
+}
+
+// GetBySecret returns the token with the given secret, or nil if there is
+// none or it has been revoked.
+func (dao *Dao) GetBySecret(secret string) (*AccessToken, error) {
+	token, err := dao.DB.Get(AccessToken{}, "SELECT * FROM AccessTokens WHERE Hash = ?", Hash(secret))
+	if err != nil || token == nil {
+		return nil, err
+	}
+	return token.(*AccessToken), err
+}
+
+// GetByUserID returns the user's tokens that have not been revoked, oldest
+// first.
+func (dao *Dao) GetByUserID(userID uint64) ([]*AccessToken, error) {
+	var tokens []*AccessToken
+	_, err := dao.DB.Select(&tokens, "SELECT * FROM AccessTokens WHERE UserID = ? ORDER BY ID", userID)
+	return tokens, err
+}
+
+func (dao *Dao) Insert(token *AccessToken) error {
+	return dao.DB.Insert(token)
+}
+
+// Delete revokes the token.
+func (dao *Dao) Delete(token *AccessToken) error {
+	return dao.DB.Delete(token)
+}
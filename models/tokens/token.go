@@ -0,0 +1,89 @@
+// Package tokens stores personal access tokens, which let scripts and bots
+// use the API on a user's behalf without knowing their password.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/models/users"
+)
+
+// Scopes limit what a token can be used for.
+const (
+	WizardsRead  = "wizards:read"
+	WizardsWrite = "wizards:write"
+	BattlesRun   = "battles:run"
+	Admin        = "admin"   // only useful to admins, see users.Admin
+	Account      = "account" // the owner's profile, and listing and revoking their tokens
+)
+
+var Scopes = []string{WizardsRead, WizardsWrite, BattlesRun, Admin, Account}
+
+// secretPrefix makes tokens easy to recognise, for example by secret
+// scanners in CI logs.
+const secretPrefix = "cwz_"
+
+// AccessToken is a named token that belongs to a user. Only a hash of the
+// secret is stored, so the secret is shown once when the token is created
+// and cannot be recovered afterwards.
+type AccessToken struct {
+	datastore.BaseRecord
+	UserID     uint64      `db:"UserID"`
+	Name       string      `db:"Name"`
+	Hash       string      `db:"Hash"`
+	Scopes     string      `db:"Scopes"`     // comma separated
+	ExpiryTime time.Time   `db:"ExpiryTime"` // zero if the token never expires
+	Owner      *users.User `db:"-"`          // set when the token is used to authenticate
+}
+
+// NewAccessToken creates a token along with its secret.
+func NewAccessToken(userID uint64, name string, scopes []string, expiryTime time.Time) (*AccessToken, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	secret := secretPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	token := &AccessToken{
+		UserID:     userID,
+		Name:       name,
+		Hash:       Hash(secret),
+		Scopes:     strings.Join(scopes, ","),
+		ExpiryTime: expiryTime,
+	}
+	return token, secret, nil
+}
+
+// Hash returns the form of a secret that is stored. Secrets are random, so
+// a fast unsalted hash is enough, and it keeps token checks cheap.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (token *AccessToken) ScopeList() []string {
+	if token.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(token.Scopes, ",")
+}
+
+func (token *AccessToken) HasScope(scope string) bool {
+	for _, granted := range token.ScopeList() {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the token can no longer be used at the given time.
+func (token *AccessToken) Expired(t time.Time) bool {
+	return !token.ExpiryTime.IsZero() && !token.ExpiryTime.After(t)
+}
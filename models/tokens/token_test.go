@@ -0,0 +1,87 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAccessToken_StoresOnlyHash(t *testing.T) {
+	token, secret, err := NewAccessToken(1, "CI", []string{WizardsRead, BattlesRun}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(secret, secretPrefix) || strings.Contains(token.Hash, secret) {
+		t.Fatalf("Expected a prefixed secret that is not stored, got secret %v and hash %v", secret, token.Hash)
+	}
+
+	if token.Hash != Hash(secret) {
+		t.Errorf("Expected the stored hash to match the secret")
+	}
+
+	_, other, err := NewAccessToken(1, "CI", []string{WizardsRead}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other == secret {
+		t.Errorf("Expected every token to have a different secret")
+	}
+}
+
+func TestAccessToken_HasScope(t *testing.T) {
+	token, _, err := NewAccessToken(1, "CI", []string{WizardsRead, BattlesRun}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !token.HasScope(WizardsRead) || !token.HasScope(BattlesRun) {
+		t.Errorf("Expected the granted scopes to be held, got %v", token.Scopes)
+	}
+
+	if token.HasScope(WizardsWrite) {
+		t.Errorf("Expected scopes that were not granted to be refused, got %v", token.Scopes)
+	}
+}
+
+func TestAccessToken_Expired(t *testing.T) {
+	now := time.Now()
+	token, _, err := NewAccessToken(1, "CI", []string{WizardsRead}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Expired(now.AddDate(100, 0, 0)) {
+		t.Errorf("Expected a token without an expiry time to never expire")
+	}
+
+	token.ExpiryTime = now.Add(time.Hour)
+	if token.Expired(now) || !token.Expired(now.Add(time.Hour)) {
+		t.Errorf("Expected the token to expire at %v", token.ExpiryTime)
+	}
+}
+
+func TestValidator_Validate(t *testing.T) {
+	now := time.Now()
+	token, _, err := NewAccessToken(1, "", []string{WizardsRead, "everything"}, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := NewValidator().Validate(token, now)
+	for _, field := range []string{"Name", "Scopes", "ExpiryTime"} {
+		if len(errs[field]) == 0 {
+			t.Errorf("Expected %v to be reported as invalid, got %v", field, errs)
+		}
+	}
+
+	token, _, err = NewAccessToken(1, "CI", []string{WizardsRead}, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := NewValidator().Validate(token, now); len(errs) != 0 {
+		t.Errorf("Expected the token to be valid, got %v", errs)
+	}
+}
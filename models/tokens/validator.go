@@ -0,0 +1,54 @@
+package tokens
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/crob1140/codewiz-server/models"
+)
+
+const maxNameLength = 64
+
+type Validator struct {
+}
+
+func NewValidator() *Validator {
+	return &Validator{}
+}
+
+// Validate checks a token that is about to be created at the given time.
+func (validator *Validator) Validate(token *AccessToken, t time.Time) models.ValidationErrors {
+	errs := make(models.ValidationErrors)
+
+	if token.Name == "" {
+		errs.Add("Name", "This field cannot be empty.")
+	} else if len(token.Name) > maxNameLength {
+		errs.Add("Name", fmt.Sprintf("Name must not exceed %d characters.", maxNameLength))
+	}
+
+	scopes := token.ScopeList()
+	if len(scopes) == 0 {
+		errs.Add("Scopes", "At least one scope must be granted.")
+	}
+
+	for _, scope := range scopes {
+		if !isScope(scope) {
+			errs.Add("Scopes", fmt.Sprintf("Unrecognised scope '%s'.", scope))
+		}
+	}
+
+	if token.Expired(t) {
+		errs.Add("ExpiryTime", "The expiry time must be in the future.")
+	}
+
+	return errs
+}
+
+func isScope(scope string) bool {
+	for _, known := range Scopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,350 @@
+package tournaments
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	ErrTooFewEntrants = errors.New("A tournament needs at least two entrants.")
+	ErrUnknownFormat  = errors.New("The tournament format is not recognised.")
+)
+
+// Generate creates every match of a tournament with the given number of
+// entrants. Elimination brackets are padded to a power of two, and the
+// missing seeds become byes for the top seeds.
+func Generate(format Format, entrants int) ([]*Match, error) {
+	if entrants < 2 {
+		return nil, ErrTooFewEntrants
+	}
+
+	switch format {
+	case SingleElimination:
+		return generateWinnersBracket(entrants), nil
+	case DoubleElimination:
+		return generateDoubleElimination(entrants), nil
+	case RoundRobin:
+		return generateRoundRobin(entrants), nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// bracketSize returns the smallest power of two that fits every entrant.
+func bracketSize(entrants int) int {
+	size := 2
+	for size < entrants {
+		size *= 2
+	}
+	return size
+}
+
+// seedOrder lists the seeds in bracket order, so that the top seeds can
+// only meet in the later rounds: 1 v 8, 4 v 5, 2 v 7, 3 v 6 and so on.
+func seedOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		count := len(order) * 2
+		next := make([]int, 0, count)
+		for _, seed := range order {
+			next = append(next, seed, count+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+func generateWinnersBracket(entrants int) []*Match {
+	size := bracketSize(entrants)
+	order := seedOrder(size)
+
+	var matches []*Match
+	for slot := 0; slot < size/2; slot++ {
+		key := Key{Winners, 1, slot}
+		matches = append(matches, newMatch(key, SeedSource(order[2*slot]), SeedSource(order[2*slot+1])))
+	}
+
+	for round := 2; size>>uint(round) > 0; round++ {
+		for slot := 0; slot < size>>uint(round); slot++ {
+			key := Key{Winners, round, slot}
+			matches = append(matches, newMatch(key,
+				WinnerOf(Key{Winners, round - 1, 2 * slot}),
+				WinnerOf(Key{Winners, round - 1, 2*slot + 1})))
+		}
+	}
+
+	return matches
+}
+
+// generateDoubleElimination adds a losers bracket to the winners bracket.
+// The losers of the first winners round play each other, and the losers of
+// every later winners round join the losers bracket in alternate rounds.
+// The winners of both brackets meet in the grand final, which is played a
+// second time if the wizard from the losers bracket wins the first.
+func generateDoubleElimination(entrants int) []*Match {
+	matches := generateWinnersBracket(entrants)
+
+	size := bracketSize(entrants)
+	winnersRounds := 0
+	for n := size; n > 1; n /= 2 {
+		winnersRounds++
+	}
+
+	finalist := LoserOf(Key{Winners, 1, 0})
+	if winnersRounds > 1 {
+		for slot := 0; slot < size/4; slot++ {
+			key := Key{Losers, 1, slot}
+			matches = append(matches, newMatch(key,
+				LoserOf(Key{Winners, 1, 2 * slot}),
+				LoserOf(Key{Winners, 1, 2*slot + 1})))
+		}
+
+		for stage := 1; stage < winnersRounds; stage++ {
+			// Wizards dropping from the winners bracket are fed in reverse
+			// order on alternate stages, to avoid immediate rematches
+			round := 2 * stage
+			count := size >> uint(stage+1)
+			for slot := 0; slot < count; slot++ {
+				dropped := slot
+				if stage%2 == 1 {
+					dropped = count - 1 - slot
+				}
+
+				key := Key{Losers, round, slot}
+				matches = append(matches, newMatch(key,
+					WinnerOf(Key{Losers, round - 1, slot}),
+					LoserOf(Key{Winners, stage + 1, dropped})))
+			}
+
+			if stage == winnersRounds-1 {
+				break
+			}
+
+			for slot := 0; slot < count/2; slot++ {
+				key := Key{Losers, round + 1, slot}
+				matches = append(matches, newMatch(key,
+					WinnerOf(Key{Losers, round, 2 * slot}),
+					WinnerOf(Key{Losers, round, 2*slot + 1})))
+			}
+		}
+
+		finalist = WinnerOf(Key{Losers, 2 * (winnersRounds - 1), 0})
+	}
+
+	grandFinal := Key{Final, 1, 0}
+	matches = append(matches, newMatch(grandFinal, WinnerOf(Key{Winners, winnersRounds, 0}), finalist))
+	matches = append(matches, newMatch(Key{Final, 2, 0}, WinnerOf(grandFinal), LoserOf(grandFinal)))
+	return matches
+}
+
+// generateRoundRobin schedules every pair of entrants exactly once using
+// the circle method. With an odd number of entrants, one sits out each round.
+func generateRoundRobin(entrants int) []*Match {
+	seeds := make([]int, 0, entrants+1)
+	for seed := 1; seed <= entrants; seed++ {
+		seeds = append(seeds, seed)
+	}
+	if entrants%2 == 1 {
+		seeds = append(seeds, 0)
+	}
+
+	var matches []*Match
+	count := len(seeds)
+	for round := 1; round < count; round++ {
+		slot := 0
+		for i := 0; i < count/2; i++ {
+			first, second := seeds[i], seeds[count-1-i]
+			if first == 0 || second == 0 {
+				continue
+			}
+
+			matches = append(matches, newMatch(Key{Group, round, slot}, SeedSource(first), SeedSource(second)))
+			slot++
+		}
+
+		// Keep the first seed in place and rotate everyone else
+		last := seeds[count-1]
+		copy(seeds[2:], seeds[1:count-1])
+		seeds[1] = last
+	}
+
+	return matches
+}
+
+// Resolve fills in the wizards of every match whose earlier matches have
+// been decided, and returns the matches that changed. Matches missing a
+// wizard are decided as walkovers straight away, which may in turn resolve
+// more matches. Entrants must have been seeded.
+func Resolve(matches []*Match, entrants []*Entrant) []*Match {
+	bySeed := make(map[int]uint64, len(entrants))
+	for _, entrant := range entrants {
+		bySeed[entrant.Seed] = entrant.WizardID
+	}
+
+	byKey := make(map[Key]*Match, len(matches))
+	for _, match := range matches {
+		byKey[match.Key()] = match
+	}
+
+	lookup := func(source Source) (uint64, bool) {
+		if seed := source.Seed(); seed != 0 {
+			return bySeed[seed], true
+		}
+
+		key, winner, ok := source.Match()
+		earlier := byKey[key]
+		if !ok || earlier == nil || !earlier.State.Decided() {
+			return 0, false
+		}
+		if winner {
+			return earlier.WinnerID, true
+		}
+		return earlier.LoserID, true
+	}
+
+	var changed []*Match
+	for progress := true; progress; {
+		progress = false
+		for _, match := range matches {
+			if match.State != Pending {
+				continue
+			}
+
+			first, firstKnown := lookup(match.FirstSource)
+			second, secondKnown := lookup(match.SecondSource)
+			if !firstKnown || !secondKnown {
+				continue
+			}
+
+			match.FirstWizardID = first
+			match.SecondWizardID = second
+			switch {
+			case isUnneededReset(match, byKey):
+				// Nobody lost the match, so it is not counted in the standings
+				match.Forfeit()
+				match.WinnerID = first
+			case first != 0 && second != 0:
+				match.State = Ready
+			case first != 0:
+				match.Forfeit(second)
+			case second != 0:
+				match.Forfeit(first)
+			default:
+				match.Forfeit(first, second)
+			}
+
+			changed = append(changed, match)
+			progress = true
+		}
+	}
+
+	return changed
+}
+
+// isUnneededReset reports whether the match is the second grand final and
+// the first was won by the wizard from the winners bracket, who has not
+// lost a match in the tournament.
+func isUnneededReset(match *Match, byKey map[Key]*Match) bool {
+	if match.Key() != (Key{Final, 2, 0}) {
+		return false
+	}
+
+	first := byKey[Key{Final, 1, 0}]
+	return first.SecondWizardID == 0 || first.WinnerID != first.SecondWizardID
+}
+
+// Done reports whether every match has been decided.
+func Done(matches []*Match) bool {
+	for _, match := range matches {
+		if !match.State.Decided() {
+			return false
+		}
+	}
+	return true
+}
+
+// Standing is an entrant's record in a tournament, and their place among
+// the other entrants.
+type Standing struct {
+	Place    int
+	WizardID uint64
+	Seed     int
+	Wins     int
+	Draws    int
+	Losses   int
+	Points   float64 // one for a win and a half for a draw
+}
+
+// Standings ranks the entrants by their results so far. Round robin
+// entrants are ranked by points, and elimination entrants by how few
+// matches they lost and then how far they progressed, so that the
+// champion of a finished tournament is always placed first. Byes are not
+// counted as wins.
+func Standings(format Format, matches []*Match, entrants []*Entrant) []*Standing {
+	standings := make([]*Standing, 0, len(entrants))
+	byWizard := make(map[uint64]*Standing, len(entrants))
+	for _, entrant := range entrants {
+		standing := &Standing{WizardID: entrant.WizardID, Seed: entrant.Seed}
+		standings = append(standings, standing)
+		byWizard[entrant.WizardID] = standing
+	}
+
+	for _, match := range matches {
+		if !match.State.Decided() || (match.State == Walkover && match.LoserID == 0) {
+			continue
+		}
+
+		if match.WinnerID == 0 {
+			for _, wizardID := range []uint64{match.FirstWizardID, match.SecondWizardID} {
+				if standing := byWizard[wizardID]; standing != nil {
+					standing.Draws++
+					standing.Points += 0.5
+				}
+			}
+			continue
+		}
+
+		if standing := byWizard[match.WinnerID]; standing != nil {
+			standing.Wins++
+			standing.Points++
+		}
+		if standing := byWizard[match.LoserID]; standing != nil {
+			standing.Losses++
+		}
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if format == RoundRobin {
+			if a.Points != b.Points {
+				return a.Points > b.Points
+			}
+		} else if a.Losses != b.Losses {
+			return a.Losses < b.Losses
+		}
+
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		return a.Seed < b.Seed
+	})
+
+	for i, standing := range standings {
+		standing.Place = i + 1
+	}
+	return standings
+}
+
+// SortMatches orders matches by bracket, round and slot.
+func SortMatches(matches []*Match) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Bracket.order() != b.Bracket.order() {
+			return a.Bracket.order() < b.Bracket.order()
+		}
+		if a.Round != b.Round {
+			return a.Round < b.Round
+		}
+		return a.Slot < b.Slot
+	})
+}
@@ -0,0 +1,181 @@
+package tournaments
+
+import (
+	"reflect"
+	"testing"
+)
+
+// createTestEntrants seeds wizards so that wizard N is seed N.
+func createTestEntrants(count int) []*Entrant {
+	entrants := make([]*Entrant, count)
+	for i := range entrants {
+		entrants[i] = &Entrant{WizardID: uint64(i + 1), Seed: i + 1}
+	}
+	return entrants
+}
+
+// playTestTournament resolves and plays matches until the tournament is
+// done, using the decide function to pick the winner of each battle.
+func playTestTournament(t *testing.T, format Format, entrants []*Entrant, decide func(first uint64, second uint64) uint64) ([]*Match, int) {
+	matches, err := Generate(format, len(entrants))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	battles := 0
+	for !Done(matches) {
+		Resolve(matches, entrants)
+
+		played := false
+		for _, match := range matches {
+			if match.State == Ready {
+				battles++
+				match.Record(uint64(battles), decide(match.FirstWizardID, match.SecondWizardID))
+				played = true
+			}
+		}
+
+		if !played && !Done(matches) {
+			t.Fatalf("The tournament stalled with undecided matches")
+		}
+	}
+
+	return matches, battles
+}
+
+func lowerSeedWins(first uint64, second uint64) uint64 {
+	if first < second {
+		return first
+	}
+	return second
+}
+
+func TestSeedOrder(t *testing.T) {
+	expected := []int{1, 8, 4, 5, 2, 7, 3, 6}
+	if order := seedOrder(8); !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Expected %v, got %v", expected, order)
+	}
+}
+
+func TestGenerate_RejectsTooFewEntrants(t *testing.T) {
+	if _, err := Generate(SingleElimination, 1); err != ErrTooFewEntrants {
+		t.Fatalf("Expected ErrTooFewEntrants, got %v", err)
+	}
+
+	if _, err := Generate(Format("swiss"), 4); err != ErrUnknownFormat {
+		t.Fatalf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestSingleElimination_GivesByesToTopSeeds(t *testing.T) {
+	entrants := createTestEntrants(5)
+	matches, battles := playTestTournament(t, SingleElimination, entrants, lowerSeedWins)
+
+	// Eight slots for five entrants leaves three byes, so only four battles are fought
+	if len(matches) != 7 || battles != 4 {
+		t.Fatalf("Expected 7 matches and 4 battles, got %d and %d", len(matches), battles)
+	}
+
+	standings := Standings(SingleElimination, matches, entrants)
+	if standings[0].WizardID != 1 || standings[0].Losses != 0 || standings[1].WizardID != 2 {
+		t.Fatalf("Unexpected standings: first %+v, second %+v", *standings[0], *standings[1])
+	}
+}
+
+func TestDoubleElimination_EveryoneLosesTwiceExceptTheChampion(t *testing.T) {
+	for _, count := range []int{2, 3, 4, 6, 8, 13} {
+		entrants := createTestEntrants(count)
+		matches, _ := playTestTournament(t, DoubleElimination, entrants, lowerSeedWins)
+
+		standings := Standings(DoubleElimination, matches, entrants)
+		if standings[0].WizardID != 1 || standings[0].Losses != 0 {
+			t.Fatalf("Expected the top seed to win %d entrants undefeated, got %+v", count, *standings[0])
+		}
+
+		for _, standing := range standings[1:] {
+			if standing.Losses != 2 {
+				t.Fatalf("Expected wizard %d of %d to be eliminated after two losses, got %d", standing.WizardID, count, standing.Losses)
+			}
+		}
+	}
+}
+
+func TestDoubleElimination_ResetsTheGrandFinal(t *testing.T) {
+	entrants := createTestEntrants(4)
+
+	// The second seed wins every match except its first against the top seed
+	lostOnce := false
+	matches, _ := playTestTournament(t, DoubleElimination, entrants, func(first uint64, second uint64) uint64 {
+		if (first == 2 || second == 2) && (first == 1 || second == 1) {
+			if !lostOnce {
+				lostOnce = true
+				return 1
+			}
+			return 2
+		}
+		return lowerSeedWins(first, second)
+	})
+
+	for _, match := range matches {
+		if match.Key() == (Key{Final, 2, 0}) && (match.State != Played || match.WinnerID != 2) {
+			t.Fatalf("Expected the reset grand final to be played and won by wizard 2, got %+v", *match)
+		}
+	}
+
+	standings := Standings(DoubleElimination, matches, entrants)
+	if standings[0].WizardID != 2 || standings[1].WizardID != 1 {
+		t.Fatalf("Expected wizard 2 to win ahead of wizard 1, got %d and %d", standings[0].WizardID, standings[1].WizardID)
+	}
+}
+
+func TestRoundRobin_PairsEveryoneOnce(t *testing.T) {
+	for _, count := range []int{2, 5, 6} {
+		entrants := createTestEntrants(count)
+		matches, battles := playTestTournament(t, RoundRobin, entrants, lowerSeedWins)
+
+		if battles != count*(count-1)/2 {
+			t.Fatalf("Expected %d battles for %d entrants, got %d", count*(count-1)/2, count, battles)
+		}
+
+		seen := make(map[[2]uint64]bool)
+		for _, match := range matches {
+			pair := [2]uint64{lowerSeedWins(match.FirstWizardID, match.SecondWizardID), match.FirstWizardID + match.SecondWizardID}
+			if seen[pair] {
+				t.Fatalf("Wizards %d and %d were paired twice", match.FirstWizardID, match.SecondWizardID)
+			}
+			seen[pair] = true
+		}
+
+		standings := Standings(RoundRobin, matches, entrants)
+		for i, standing := range standings {
+			if standing.WizardID != uint64(i+1) || standing.Points != float64(count-1-i) {
+				t.Fatalf("Unexpected standing at place %d: %+v", i+1, *standing)
+			}
+		}
+	}
+}
+
+func TestStandings_CountsDrawsAsHalfPoints(t *testing.T) {
+	entrants := createTestEntrants(3)
+	matches, _ := playTestTournament(t, RoundRobin, entrants, func(first uint64, second uint64) uint64 {
+		return 0
+	})
+
+	for _, standing := range Standings(RoundRobin, matches, entrants) {
+		if standing.Draws != 2 || standing.Points != 1 {
+			t.Fatalf("Expected two draws for every wizard, got %+v", *standing)
+		}
+	}
+}
+
+func TestSource_RoundTrips(t *testing.T) {
+	if seed := SeedSource(12).Seed(); seed != 12 {
+		t.Fatalf("Expected seed 12, got %d", seed)
+	}
+
+	key := Key{Losers, 3, 1}
+	parsed, winner, ok := LoserOf(key).Match()
+	if !ok || winner || parsed != key {
+		t.Fatalf("Expected to parse %v as a loser source, got %v %v %v", key, parsed, winner, ok)
+	}
+}
@@ -0,0 +1,89 @@
+package tournaments
+
+import (
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Tournament{}, "Tournaments")
+	db.AddTableWithName(Entrant{}, "TournamentEntrants")
+	db.AddTableWithName(Match{}, "TournamentMatches")
+	return &Dao{DB: db}
+}
+
+func (dao *Dao) GetByID(id uint64) (*Tournament, error) {
+	tournament, err := dao.DB.Get(Tournament{}, "SELECT * FROM Tournaments WHERE ID = ?", id)
+	if err != nil || tournament == nil {
+		return nil, err
+	}
+	return tournament.(*Tournament), err
+}
+
+// GetAll returns every tournament, with the latest registration deadline first.
+func (dao *Dao) GetAll() ([]*Tournament, error) {
+	var tournaments []*Tournament
+	_, err := dao.DB.Select(&tournaments, "SELECT * FROM Tournaments ORDER BY RegistrationDeadline DESC")
+	return tournaments, err
+}
+
+func (dao *Dao) GetByState(state State) ([]*Tournament, error) {
+	var tournaments []*Tournament
+	_, err := dao.DB.Select(&tournaments, "SELECT * FROM Tournaments WHERE State = ?", state)
+	return tournaments, err
+}
+
+func (dao *Dao) Insert(tournament *Tournament) error {
+	return dao.DB.Insert(tournament)
+}
+
+func (dao *Dao) Update(tournament *Tournament) error {
+	return dao.DB.Update(tournament)
+}
+
+// GetEntrants returns the tournament's entrants in the order they registered.
+func (dao *Dao) GetEntrants(tournamentID uint64) ([]*Entrant, error) {
+	var entrants []*Entrant
+	_, err := dao.DB.Select(&entrants, "SELECT * FROM TournamentEntrants WHERE TournamentID = ? ORDER BY ID", tournamentID)
+	return entrants, err
+}
+
+// GetEntrantByOwnerID returns the wizard the user entered into the tournament, or nil if they have not entered.
+func (dao *Dao) GetEntrantByOwnerID(tournamentID uint64, ownerID uint64) (*Entrant, error) {
+	entrant, err := dao.DB.Get(Entrant{}, "SELECT * FROM TournamentEntrants WHERE TournamentID = ? AND OwnerID = ?", tournamentID, ownerID)
+	if err != nil || entrant == nil {
+		return nil, err
+	}
+	return entrant.(*Entrant), err
+}
+
+func (dao *Dao) InsertEntrant(entrant *Entrant) error {
+	return dao.DB.Insert(entrant)
+}
+
+func (dao *Dao) UpdateEntrant(entrant *Entrant) error {
+	return dao.DB.Update(entrant)
+}
+
+// GetMatches returns the tournament's matches ordered by bracket, round and slot.
+func (dao *Dao) GetMatches(tournamentID uint64) ([]*Match, error) {
+	var matches []*Match
+	_, err := dao.DB.Select(&matches, "SELECT * FROM TournamentMatches WHERE TournamentID = ?", tournamentID)
+	if err != nil {
+		return nil, err
+	}
+
+	SortMatches(matches)
+	return matches, nil
+}
+
+func (dao *Dao) InsertMatch(match *Match) error {
+	return dao.DB.Insert(match)
+}
+
+func (dao *Dao) UpdateMatch(match *Match) error {
+	return dao.DB.Update(match)
+}
@@ -0,0 +1,190 @@
+package tournaments
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Bracket string
+
+const (
+	Winners Bracket = "winners"
+	Losers  Bracket = "losers"
+	Final   Bracket = "final" // the grand final of a double elimination tournament
+	Group   Bracket = "group" // every match of a round robin tournament
+)
+
+// order is used to sort matches so that brackets are listed in the order they are played.
+func (bracket Bracket) order() int {
+	switch bracket {
+	case Winners, Group:
+		return 0
+	case Losers:
+		return 1
+	default:
+		return 2
+	}
+}
+
+type MatchState string
+
+const (
+	Pending  MatchState = "pending"  // waiting for earlier matches to decide its wizards
+	Ready    MatchState = "ready"    // both wizards are known, and the battle can be fought
+	Played   MatchState = "played"   // the battle has been fought
+	Walkover MatchState = "walkover" // decided without a battle, because a wizard was missing or forfeited
+)
+
+// Decided reports whether the match has a result.
+func (state MatchState) Decided() bool {
+	return state == Played || state == Walkover
+}
+
+// Key identifies a match within its tournament.
+type Key struct {
+	Bracket Bracket
+	Round   int // starting from 1
+	Slot    int // starting from 0
+}
+
+func (key Key) String() string {
+	return fmt.Sprintf("%s.%d.%d", key.Bracket, key.Round, key.Slot)
+}
+
+func parseKey(s string) (Key, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Key{}, false
+	}
+
+	round, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Key{}, false
+	}
+
+	slot, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return Key{}, false
+	}
+
+	return Key{Bracket: Bracket(parts[0]), Round: round, Slot: slot}, true
+}
+
+// Source describes where one side of a match gets its wizard from: either
+// a seed, or the winner or loser of an earlier match.
+type Source string
+
+const (
+	seedSource   = "seed"
+	winnerSource = "winner"
+	loserSource  = "loser"
+)
+
+func SeedSource(seed int) Source {
+	return Source(seedSource + ":" + strconv.Itoa(seed))
+}
+
+func WinnerOf(key Key) Source {
+	return Source(winnerSource + ":" + key.String())
+}
+
+func LoserOf(key Key) Source {
+	return Source(loserSource + ":" + key.String())
+}
+
+// Seed returns the seed the source refers to, or zero if it refers to a match.
+func (source Source) Seed() int {
+	kind, value := source.split()
+	if kind != seedSource {
+		return 0
+	}
+	seed, _ := strconv.Atoi(value)
+	return seed
+}
+
+// Match returns the earlier match the source refers to, and whether the
+// source takes that match's winner rather than its loser.
+func (source Source) Match() (Key, bool, bool) {
+	kind, value := source.split()
+	if kind != winnerSource && kind != loserSource {
+		return Key{}, false, false
+	}
+	key, ok := parseKey(value)
+	return key, kind == winnerSource, ok
+}
+
+func (source Source) split() (string, string) {
+	parts := strings.SplitN(string(source), ":", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// Match is a single pairing in a tournament's bracket. Every match is
+// created when the bracket is generated, and its wizards are filled in as
+// the matches it depends on are decided.
+type Match struct {
+	datastore.BaseRecord
+	TournamentID   uint64     `db:"TournamentID"`
+	Bracket        Bracket    `db:"Bracket"`
+	Round          int        `db:"Round"`
+	Slot           int        `db:"Slot"`
+	FirstSource    Source     `db:"FirstSource"`
+	SecondSource   Source     `db:"SecondSource"`
+	FirstWizardID  uint64     `db:"FirstWizardID"`
+	SecondWizardID uint64     `db:"SecondWizardID"`
+	State          MatchState `db:"State"`
+	WinnerID       uint64     `db:"WinnerID"` // zero for a drawn round robin match, or a walkover with no wizards
+	LoserID        uint64     `db:"LoserID"`
+	BattleID       uint64     `db:"BattleID"`
+}
+
+func newMatch(key Key, first Source, second Source) *Match {
+	return &Match{
+		Bracket:      key.Bracket,
+		Round:        key.Round,
+		Slot:         key.Slot,
+		FirstSource:  first,
+		SecondSource: second,
+		State:        Pending,
+	}
+}
+
+func (match *Match) Key() Key {
+	return Key{Bracket: match.Bracket, Round: match.Round, Slot: match.Slot}
+}
+
+// Record stores the result of the match's battle. The winner is zero for a draw.
+func (match *Match) Record(battleID uint64, winnerID uint64) {
+	match.State = Played
+	match.BattleID = battleID
+	match.WinnerID = winnerID
+	match.LoserID = 0
+
+	switch winnerID {
+	case match.FirstWizardID:
+		match.LoserID = match.SecondWizardID
+	case match.SecondWizardID:
+		match.LoserID = match.FirstWizardID
+	}
+}
+
+// Forfeit decides the match without a battle against the given wizards.
+// If both wizards forfeit, nobody advances from the match.
+func (match *Match) Forfeit(wizardIDs ...uint64) {
+	match.State = Walkover
+	match.WinnerID = 0
+	match.LoserID = 0
+
+	if len(wizardIDs) == 1 {
+		match.LoserID = wizardIDs[0]
+		match.WinnerID = match.FirstWizardID
+		if wizardIDs[0] == match.FirstWizardID {
+			match.WinnerID = match.SecondWizardID
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Package tournaments organises wizards into brackets and tracks the
+// matches between them until a champion is decided.
+package tournaments
+
+import (
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+type Format string
+
+const (
+	SingleElimination Format = "single_elimination"
+	DoubleElimination Format = "double_elimination"
+	RoundRobin        Format = "round_robin"
+)
+
+// Formats lists every supported format, in the order they are offered to users.
+var Formats = []Format{SingleElimination, DoubleElimination, RoundRobin}
+
+func (format Format) Valid() bool {
+	for _, known := range Formats {
+		if format == known {
+			return true
+		}
+	}
+	return false
+}
+
+type State string
+
+const (
+	Registration State = "registration"
+	Running      State = "running"
+	Finished     State = "finished"
+	Cancelled    State = "cancelled"
+)
+
+// Tournament accepts entrants until its registration deadline, after which
+// its bracket is generated and the matches are fought automatically.
+type Tournament struct {
+	datastore.BaseRecord
+	Name                 string    `db:"Name"`
+	Format               Format    `db:"Format"`
+	State                State     `db:"State"`
+	CreatorID            uint64    `db:"CreatorID"`
+	RegistrationDeadline time.Time `db:"RegistrationDeadline"`
+	MaxEntrants          int       `db:"MaxEntrants"` // zero if there is no limit
+	WinnerID             uint64    `db:"WinnerID"`    // the winning wizard, once the tournament has finished
+	Reason               string    `db:"Reason"`      // why the tournament was cancelled, if it was
+}
+
+func NewTournament(name string, format Format, registrationDeadline time.Time, creatorID uint64) *Tournament {
+	return &Tournament{
+		Name:                 name,
+		Format:               format,
+		State:                Registration,
+		CreatorID:            creatorID,
+		RegistrationDeadline: registrationDeadline.UTC(),
+	}
+}
+
+// IsOpen reports whether wizards can still register at the given time.
+func (tournament *Tournament) IsOpen(t time.Time) bool {
+	return tournament.State == Registration && t.Before(tournament.RegistrationDeadline)
+}
+
+// Entrant is a wizard registered in a tournament. Players may only enter
+// one of their wizards into each tournament.
+type Entrant struct {
+	datastore.BaseRecord
+	TournamentID uint64 `db:"TournamentID"`
+	WizardID     uint64 `db:"WizardID"`
+	OwnerID      uint64 `db:"OwnerID"`
+	Seed         int    `db:"Seed"` // zero until the bracket is generated, with 1 as the top seed
+}
+
+func NewEntrant(tournamentID uint64, wizardID uint64, ownerID uint64) *Entrant {
+	return &Entrant{TournamentID: tournamentID, WizardID: wizardID, OwnerID: ownerID}
+}
@@ -0,0 +1,38 @@
+package tournaments
+
+import (
+	"time"
+
+	"github.com/crob1140/codewiz-server/models"
+)
+
+type Validator struct {
+	Dao *Dao
+}
+
+func NewValidator(dao *Dao) *Validator {
+	return &Validator{Dao: dao}
+}
+
+func (validator *Validator) Validate(tournament *Tournament) (models.ValidationErrors, error) {
+
+	errs := make(models.ValidationErrors)
+
+	if tournament.Name == "" {
+		errs.Add("Name", "This field cannot be empty.")
+	}
+
+	if !tournament.Format.Valid() {
+		errs.Add("Format", "Must be one of single_elimination, double_elimination or round_robin.")
+	}
+
+	if tournament.ID == 0 && !tournament.RegistrationDeadline.After(time.Now()) {
+		errs.Add("RegistrationDeadline", "The registration deadline must be in the future.")
+	}
+
+	if tournament.MaxEntrants < 0 || tournament.MaxEntrants == 1 {
+		errs.Add("MaxEntrants", "Must be zero for no limit, or at least two.")
+	}
+
+	return errs, nil
+}
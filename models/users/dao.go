@@ -1,7 +1,10 @@
 package users
 
 import (
+	"context"
 	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/models"
+	"strings"
 )
 
 type Dao struct {
@@ -13,6 +16,18 @@ func NewDao(db *datastore.DB) *Dao {
 	return &Dao{DB : db}
 }
 
+// WithTx returns a copy of the DAO that runs its queries in the given
+// transaction, see datastore.DB.WithTransaction.
+func (dao *Dao) WithTx(tx *datastore.DB) *Dao {
+	return &Dao{DB : tx}
+}
+
+// WithContext returns a copy of the DAO whose queries are cancelled along
+// with ctx, see datastore.DB.WithContext.
+func (dao *Dao) WithContext(ctx context.Context) *Dao {
+	return &Dao{DB : dao.DB.WithContext(ctx)}
+}
+
 func (dao *Dao) GetByID(id uint64) (*User, error) {
 	user, err := dao.DB.Get(User{}, "SELECT * FROM Users WHERE ID = ?", id)
 	if err != nil || user == nil {
@@ -29,6 +44,57 @@ func (dao *Dao) GetByUsername(username string) (*User, error) {
 	return user.(*User), err
 }
 
+// GetByEmail returns every user registered with the email address, since
+// addresses do not have to be unique.
+func (dao *Dao) GetByEmail(email string) ([]*User, error) {
+	var users []*User
+	_, err := dao.DB.Select(&users, "SELECT * FROM Users WHERE Email = ?", email)
+	return users, err
+}
+
+// Search returns up to limit users whose username, name or email address
+// contains the search text, in the order they registered, starting after
+// the user with the given ID. An empty search matches every user.
+func (dao *Dao) Search(search string, afterID uint64, limit int) ([]*User, error) {
+	pattern := "%" + escapeLike(search) + "%"
+
+	var users []*User
+	_, err := dao.DB.Select(&users, "SELECT * FROM Users WHERE ID > ? AND (Username LIKE ? ESCAPE '!' OR Name LIKE ? ESCAPE '!' OR Email LIKE ? ESCAPE '!') ORDER BY ID LIMIT ?", afterID, pattern, pattern, pattern, limit)
+	return users, err
+}
+
+// IsUsernameTaken reports whether another user has the given username.
+// Deleted users are included, since their usernames stay reserved.
+func (dao *Dao) IsUsernameTaken(username string, userID uint64) (bool, error) {
+	count, err := dao.DB.SelectInt("SELECT COUNT(*) FROM Users WHERE Username = ? AND ID <> ?", username, userID)
+	return count > 0, err
+}
+
+// InsertValid inserts the user if they pass validation, and returns the
+// problems otherwise. Both happen in one transaction, so that a username
+// that is free when it is checked is still free when it is inserted. If a
+// concurrent registration takes it first anyway, the insert fails on the
+// unique constraint, and the user is checked again so that the clash is
+// reported as a problem rather than an error.
+func (dao *Dao) InsertValid(user *User) (models.ValidationErrors, error) {
+	var validationErrs models.ValidationErrors
+	err := dao.DB.WithTransaction(func(tx *datastore.DB) error {
+		var err error
+		validationErrs, err = NewValidator(dao.WithTx(tx)).Validate(user)
+		if err != nil || len(validationErrs) != 0 {
+			return err
+		}
+		return dao.WithTx(tx).Insert(user)
+	})
+
+	if err != nil && len(validationErrs) == 0 {
+		if recheckErrs, recheckErr := NewValidator(dao).Validate(user); recheckErr == nil && len(recheckErrs) != 0 {
+			return recheckErrs, nil
+		}
+	}
+	return validationErrs, err
+}
+
 func (dao *Dao) Update(user *User) error {
 	return dao.DB.Update(user)
 }
@@ -40,4 +106,11 @@ func (dao *Dao) Delete(user *User) error {
 func (dao *Dao) Insert(user *User) error {
 	err := dao.DB.Insert(user)
 	return err
-}	
\ No newline at end of file
+}
+
+// escapeLike stops the wildcards in a search from being interpreted by LIKE.
+// The escape character is '!' because backslashes are treated differently
+// by each database.
+func escapeLike(search string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(search)
+}
\ No newline at end of file
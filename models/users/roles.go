@@ -1,15 +1,70 @@
 package users
 
+import (
+	"strings"
+)
+
 const (
 	Visitor = "visitor"
 	Standard = "standard"
+	Moderator = "moderator"
 	Admin = "admin"
 )
 
+// GrantableRoles are the roles that are stored against a user. Every
+// logged in user has the standard role, and nobody else has the visitor role.
+var GrantableRoles = []string{Moderator, Admin}
+
 func (user *User) Roles() []string {
 	if user == nil {
 		return []string{Visitor}
 	}
 
-	return []string{Standard}
-}
\ No newline at end of file
+	return append([]string{Standard}, user.Granted()...)
+}
+
+func (user *User) HasRole(role string) bool {
+	for _, userRole := range user.Roles() {
+		if userRole == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasAnyRole reports whether the user has at least one of the given roles.
+func (user *User) HasAnyRole(roles ...string) bool {
+	for _, role := range roles {
+		if user.HasRole(role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetRoles replaces the roles that have been granted to the user. Roles
+// that cannot be granted are reported by the validator.
+func (user *User) SetRoles(roles []string) {
+	user.GrantedRoles = strings.Join(roles, ",")
+}
+
+// Granted returns the roles that have been granted to the user on top of
+// the standard role.
+func (user *User) Granted() []string {
+	if user.GrantedRoles == "" {
+		return []string{}
+	}
+	return strings.Split(user.GrantedRoles, ",")
+}
+
+func IsGrantable(role string) bool {
+	for _, grantable := range GrantableRoles {
+		if role == grantable {
+			return true
+		}
+	}
+
+	return false
+}
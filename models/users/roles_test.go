@@ -0,0 +1,28 @@
+package users
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUser_Roles(t *testing.T) {
+	var visitor *User
+	if roles := visitor.Roles(); !reflect.DeepEqual(roles, []string{Visitor}) {
+		t.Errorf("Expected visitors to only have the visitor role, got %v", roles)
+	}
+
+	user := NewUser("TestUser", "testpassword", "test@test.com")
+	if roles := user.Roles(); !reflect.DeepEqual(roles, []string{Standard}) {
+		t.Errorf("Expected new users to only have the standard role, got %v", roles)
+	}
+
+	user.SetRoles([]string{Moderator, Admin})
+	if !user.HasRole(Standard) || !user.HasRole(Moderator) || !user.HasRole(Admin) {
+		t.Errorf("Expected the granted roles to be added to the standard role, got %v", user.Roles())
+	}
+
+	user.SetRoles(nil)
+	if user.HasAnyRole(Moderator, Admin) {
+		t.Errorf("Expected the granted roles to be removed, got %v", user.Roles())
+	}
+}
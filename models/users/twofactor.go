@@ -0,0 +1,123 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/crob1140/codewiz-server/totp"
+)
+
+// RecoveryCodeCount is how many recovery codes a user is given. Each one can
+// be used once in place of a code from their authenticator app, in case
+// they lose it.
+const RecoveryCodeCount = 10
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorEnabled reports whether the user has to enter a code from their
+// authenticator app as well as their password to log in.
+func (user *User) TwoFactorEnabled() bool {
+	return user.TOTPSecret != ""
+}
+
+// EnableTwoFactor turns on two-factor authentication with a secret that the
+// user has proved they have set up by entering the code for the given
+// period. It returns a new set of recovery codes, which are only stored as
+// hashes and so have to be shown to the user straight away.
+func (user *User) EnableTwoFactor(secret string, counter int64) ([]string, error) {
+	codes, err := user.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPSecret = secret
+	user.TOTPCounter = counter
+	return codes, nil
+}
+
+func (user *User) DisableTwoFactor() {
+	user.TOTPSecret = ""
+	user.TOTPCounter = 0
+	user.RecoveryCodes = ""
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes, so that any
+// that they have written down stop working.
+func (user *User) GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	user.RecoveryCodes = strings.Join(hashes, ",")
+	return codes, nil
+}
+
+// RecoveryCodesLeft returns how many of the user's recovery codes have not
+// been used.
+func (user *User) RecoveryCodesLeft() int {
+	if user.RecoveryCodes == "" {
+		return 0
+	}
+	return len(strings.Split(user.RecoveryCodes, ","))
+}
+
+// VerifySecondFactor checks a code from the user's authenticator app, or
+// one of their recovery codes. Either kind of code can only be used once,
+// so the user has to be saved afterwards if it is accepted.
+func (user *User) VerifySecondFactor(code string, now time.Time) bool {
+	if !user.TwoFactorEnabled() {
+		return false
+	}
+
+	if counter, ok := totp.Validate(user.TOTPSecret, code, now, user.TOTPCounter); ok {
+		user.TOTPCounter = counter
+		return true
+	}
+
+	return user.useRecoveryCode(code)
+}
+
+func (user *User) useRecoveryCode(code string) bool {
+	if user.RecoveryCodes == "" {
+		return false
+	}
+
+	hash := hashRecoveryCode(code)
+	hashes := strings.Split(user.RecoveryCodes, ",")
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			user.RecoveryCodes = strings.Join(append(hashes[:i], hashes[i+1:]...), ",")
+			return true
+		}
+	}
+	return false
+}
+
+// hashRecoveryCode ignores the case of the code and the characters that
+// users may type between its groups. The codes are random enough that a
+// fast hash is safe.
+func hashRecoveryCode(code string) string {
+	normalised := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+
+	sum := sha256.Sum256([]byte(normalised))
+	return hex.EncodeToString(sum[:])
+}
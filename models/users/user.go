@@ -5,19 +5,40 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	DefaultTimeZone = "UTC"
+)
+
 type User struct {
 	datastore.BaseRecord
 	Username string `db:"Username"`
 	Email string 	`db:"Email"`
 	HashedPassword string `db:"Password"`
+	Name string `db:"Name"` // the display name, which may be empty
+	TimeZone string `db:"TimeZone"` // an IANA time zone name
+	GrantedRoles string `db:"Roles"` // comma separated, see Roles
+	Disabled bool `db:"Disabled"` // disabled users cannot log in
+	EmailVerified bool `db:"EmailVerified"` // unverified users cannot enter ranked play
+	TOTPSecret string `db:"TOTPSecret"` // empty unless two-factor authentication is enabled, see TwoFactorEnabled
+	TOTPCounter int64 `db:"TOTPCounter"` // the period of the last code that was used
+	RecoveryCodes string `db:"RecoveryCodes"` // comma separated hashes of the unused recovery codes
 }
 
 func NewUser(username string, password string, email string) *User {
-	user := &User{Username : username, Email : email}
+	user := &User{Username : username, Email : email, TimeZone : DefaultTimeZone}
 	user.SetPassword(password)
 	return user
 }
 
+// SetEmail changes the user's email address. The new address has to be
+// verified again, even if the old one had been.
+func (user *User) SetEmail(email string) {
+	if email != user.Email {
+		user.Email = email
+		user.EmailVerified = false
+	}
+}
+
 func (user *User) SetPassword(password string) error {
 	pass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -0,0 +1,69 @@
+package users
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/totp"
+)
+
+func TestUser_SetEmail(t *testing.T) {
+	user := NewUser("TestUser", "testpassword", "test@test.com")
+	user.EmailVerified = true
+
+	user.SetEmail("test@test.com")
+	if !user.EmailVerified {
+		t.Errorf("Expected the address to stay verified when it is unchanged")
+	}
+
+	user.SetEmail("changed@test.com")
+	if user.Email != "changed@test.com" || user.EmailVerified {
+		t.Errorf("Expected the new address to need verifying, got %+v", user)
+	}
+}
+
+func TestUser_VerifySecondFactor(t *testing.T) {
+	user := NewUser("TestUser", "testpassword", "test@test.com")
+	now := time.Unix(1500000000, 0)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := totp.Code(secret, totp.Counter(now))
+	if user.VerifySecondFactor(code, now) {
+		t.Fatal("Expected codes to be rejected before two-factor authentication is enabled")
+	}
+
+	recoveryCodes, err := user.EnableTwoFactor(secret, totp.Counter(now)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recoveryCodes) != RecoveryCodeCount || user.RecoveryCodesLeft() != RecoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %d", RecoveryCodeCount, len(recoveryCodes))
+	}
+
+	if !user.VerifySecondFactor(code, now) {
+		t.Error("Expected the current code to be accepted")
+	}
+
+	if user.VerifySecondFactor(code, now) {
+		t.Error("Expected the current code to be rejected once it has been used")
+	}
+
+	if !user.VerifySecondFactor(strings.ToUpper(recoveryCodes[3]), now) || user.RecoveryCodesLeft() != RecoveryCodeCount-1 {
+		t.Error("Expected a recovery code to be accepted in any case")
+	}
+
+	if user.VerifySecondFactor(recoveryCodes[3], now) {
+		t.Error("Expected a recovery code to be rejected once it has been used")
+	}
+
+	user.DisableTwoFactor()
+	if user.TwoFactorEnabled() || user.VerifySecondFactor(recoveryCodes[4], now) {
+		t.Error("Expected recovery codes to stop working once two-factor authentication is disabled")
+	}
+}
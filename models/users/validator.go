@@ -3,6 +3,12 @@ package users
 import (
 	"github.com/crob1140/codewiz-server/models"
 	"net/mail"
+	"time"
+)
+
+const (
+	maxNameLength = 128
+	minPasswordLength = 8
 )
 
 type Validator struct {
@@ -31,15 +37,46 @@ func (validator *Validator) Validate(user *User) (models.ValidationErrors, error
 		errs.Add("Email", "Invalid email address.")
 	}
 
-	savedUser, err := validator.Dao.GetByUsername(user.Username)
+	if len(user.Name) > maxNameLength {
+		errs.Add("Name", "Name must not exceed 128 characters.")
+	}
+
+	if _, err := time.LoadLocation(user.TimeZone); err != nil || user.TimeZone == "" || user.TimeZone == "Local" {
+		errs.Add("TimeZone", "Unrecognised time zone.")
+	}
+
+	granted := make(map[string]bool)
+	for _, role := range user.Granted() {
+		if !IsGrantable(role) {
+			errs.Add("Roles", "Unrecognised role '" + role + "'.")
+		} else if granted[role] {
+			errs.Add("Roles", "Role '" + role + "' was given more than once.")
+		}
+		granted[role] = true
+	}
+
+	taken, err := validator.Dao.IsUsernameTaken(user.Username, user.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	if savedUser != nil && savedUser.ID != user.ID {
+	if taken {
 		errs.Add("Username", "A user with this username already exists.")
 	}
 
 	return errs, nil
 
+}
+
+// ValidatePassword checks a new password before it is hashed, since the
+// hash does not reveal whether the password was empty or too short.
+func (validator *Validator) ValidatePassword(password string) models.ValidationErrors {
+
+	errs := make(models.ValidationErrors)
+
+	if len(password) < minPasswordLength {
+		errs.Add("Password", "Password must be at least 8 characters.")
+	}
+
+	return errs
 }
\ No newline at end of file
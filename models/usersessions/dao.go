@@ -0,0 +1,90 @@
+package usersessions
+
+import (
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/models/tokens"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Session{}, "Sessions")
+	return &Dao{DB: db}
+}
+
+// WithTx returns a copy of the DAO that runs its queries in the given
+// transaction, see datastore.DB.WithTransaction.
+func (dao *Dao) WithTx(tx *datastore.DB) *Dao {
+	return &Dao{DB: tx}
+}
+
+func (dao *Dao) GetByID(id uint64) (*Session, error) {
+	session, err := dao.DB.Get(Session{}, "SELECT * FROM Sessions WHERE ID = ?", id)
+	if err != nil || session == nil {
+		return nil, err
+	}
+	return session.(*Session), err
+}
+
+// GetBySecret returns the session with the given secret, or nil if there is
+// none or it has been revoked.
+func (dao *Dao) GetBySecret(secret string) (*Session, error) {
+	session, err := dao.DB.Get(Session{}, "SELECT * FROM Sessions WHERE Hash = ?", tokens.Hash(secret))
+	if err != nil || session == nil {
+		return nil, err
+	}
+	return session.(*Session), err
+}
+
+// GetByUserID returns the user's sessions, including any that have expired
+// but not been revoked, most recently seen first.
+func (dao *Dao) GetByUserID(userID uint64) ([]*Session, error) {
+	var sessions []*Session
+	_, err := dao.DB.Select(&sessions, "SELECT * FROM Sessions WHERE UserID = ? ORDER BY LastSeenTime DESC", userID)
+	return sessions, err
+}
+
+func (dao *Dao) Insert(session *Session) error {
+	return dao.DB.Insert(session)
+}
+
+func (dao *Dao) Update(session *Session) error {
+	return dao.DB.Update(session)
+}
+
+// Delete revokes the session, which logs out whoever is using it.
+func (dao *Dao) Delete(session *Session) error {
+	return dao.DB.Delete(session)
+}
+
+// DeleteByUserID revokes all of the user's sessions, for example after
+// their password changes.
+func (dao *Dao) DeleteByUserID(userID uint64) error {
+	sessions, err := dao.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := dao.DB.Delete(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteExpired removes the sessions that expired before the given time,
+// including any that were revoked, and returns how many were removed.
+// Unlike Delete, the sessions are removed from the datastore, since they
+// can never be used again.
+func (dao *Dao) DeleteExpired(t time.Time) (int64, error) {
+	result, err := dao.DB.Exec("DELETE FROM Sessions WHERE ExpiryTime < ?", t.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,41 @@
+// Package usersessions stores website sessions in the datastore, so that
+// users can see where they are logged in and revoke sessions they do not
+// recognise.
+package usersessions
+
+import (
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+// maxUserAgentLength matches the Sessions table, since user agents can be
+// arbitrarily long.
+const maxUserAgentLength = 255
+
+// Session is a website session. The cookie holds a secret that identifies
+// the session, and only a hash of the secret is stored, so that the
+// sessions cannot be taken over by anyone who can read the datastore.
+type Session struct {
+	datastore.BaseRecord
+	UserID       uint64    `db:"UserID"` // zero until a user logs in
+	Hash         string    `db:"Hash"`
+	Data         string    `db:"Data"` // the encoded session values
+	UserAgent    string    `db:"UserAgent"`
+	IPAddress    string    `db:"IPAddress"`
+	LastSeenTime time.Time `db:"LastSeenTime"`
+	ExpiryTime   time.Time `db:"ExpiryTime"`
+}
+
+func (session *Session) Expired(t time.Time) bool {
+	return !t.Before(session.ExpiryTime)
+}
+
+// SetUserAgent records the browser that the session is used from, so that
+// users can tell their sessions apart.
+func (session *Session) SetUserAgent(userAgent string) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	session.UserAgent = userAgent
+}
@@ -0,0 +1,217 @@
+package usersessions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/models/tokens"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// lastSeenInterval limits how often the last seen time is written,
+	// since a session is loaded on every page.
+	lastSeenInterval = time.Minute
+
+	// defaultLifetime is how long a session is kept for if its cookie
+	// only lasts until the browser is closed.
+	defaultLifetime = 24 * time.Hour
+)
+
+// Store is a sessions.Store that keeps the session values in the datastore,
+// so that sessions can be listed and revoked. The cookie only holds the
+// session's secret, signed with the store's keys.
+type Store struct {
+	Dao     *Dao
+	Codecs  []securecookie.Codec
+	Options *sessions.Options // the default options for new sessions
+
+	// UserKey is the session value that holds the ID of the logged in
+	// user. The session is stored against the user, and is given a new
+	// secret whenever the user changes, so that a secret obtained before a
+	// user logged in cannot be used to take over their session.
+	UserKey interface{}
+}
+
+func NewStore(dao *Dao, userKey interface{}, keyPairs ...[]byte) *Store {
+	return &Store{
+		Dao:     dao,
+		Codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{Path: "/"},
+		UserKey: userKey,
+	}
+}
+
+// Get returns the session with the given name, which is only loaded from
+// the datastore once per request.
+func (store *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(store, name)
+}
+
+// New loads the session from the datastore, or returns a new session if the
+// request does not have a usable one.
+func (store *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(store, name)
+	options := *store.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	// Cookies that were not signed with the store's keys are ignored,
+	// as are sessions that have expired or been revoked
+	var secret string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &secret, store.Codecs...); err != nil {
+		return session, nil
+	}
+
+	record, err := store.Dao.GetBySecret(secret)
+	now := time.Now()
+	if err != nil || record == nil {
+		return session, err
+	}
+
+	if record.Expired(now) {
+		return session, store.Dao.Delete(record)
+	}
+
+	if err := securecookie.DecodeMulti(name, record.Data, &session.Values, store.Codecs...); err != nil {
+		return session, nil
+	}
+
+	session.ID = secret
+	session.IsNew = false
+
+	if now.Sub(record.LastSeenTime) >= lastSeenInterval {
+		record.LastSeenTime = now
+		record.IPAddress = routes.ClientIP(r)
+		record.SetUserAgent(r.UserAgent())
+
+		// A conflict means that a concurrent request has just done the same
+		if err := store.Dao.Update(record); err != nil && err != datastore.ErrConflict {
+			return session, err
+		}
+	}
+
+	return session, nil
+}
+
+// Save stores the session and sets its cookie. New sessions are not stored
+// until they have a value, so that visitors who only browse the site do not
+// fill the datastore. Setting a negative MaxAge deletes the session.
+func (store *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	// A conflict means that a concurrent request for the same session saved
+	// it first. The session is reloaded and saved again, so that the last
+	// request to save wins, as it would without the version check.
+	err := store.save(r, w, session)
+	if err == datastore.ErrConflict {
+		err = store.save(r, w, session)
+	}
+	return err
+}
+
+func (store *Store) save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	var record *Session
+	if session.ID != "" {
+		var err error
+		if record, err = store.Dao.GetBySecret(session.ID); err != nil {
+			return err
+		}
+	}
+
+	if session.Options.MaxAge < 0 {
+		if record != nil {
+			if err := store.Dao.Delete(record); err != nil {
+				return err
+			}
+		}
+
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	// A session that was revoked while the request was being served stays
+	// revoked
+	if session.ID != "" && record == nil {
+		return nil
+	}
+
+	userID, _ := session.Values[store.UserKey].(uint64)
+	if record != nil && record.UserID != userID {
+		if err := store.Dao.Delete(record); err != nil {
+			return err
+		}
+		record = nil
+	}
+
+	if record == nil {
+		if len(session.Values) == 0 {
+			return nil
+		}
+
+		secret, err := newSecret()
+		if err != nil {
+			return err
+		}
+
+		session.ID = secret
+		record = &Session{Hash: tokens.Hash(secret)}
+	}
+
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, store.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	lifetime := defaultLifetime
+	if session.Options.MaxAge > 0 {
+		lifetime = time.Duration(session.Options.MaxAge) * time.Second
+	}
+
+	record.UserID = userID
+	record.Data = data
+	record.IPAddress = routes.ClientIP(r)
+	record.SetUserAgent(r.UserAgent())
+	record.LastSeenTime = now
+	record.ExpiryTime = now.Add(lifetime).UTC()
+
+	if record.ID == 0 {
+		err = store.Dao.Insert(record)
+	} else {
+		err = store.Dao.Update(record)
+	}
+	if err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, store.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// IsCurrent reports whether the record is the session with the given
+// secret.
+func IsCurrent(record *Session, secret string) bool {
+	return secret != "" && record.Hash == tokens.Hash(secret)
+}
+
+func newSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,235 @@
+package usersessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/config"
+	"github.com/crob1140/codewiz-server/config/keys"
+	"github.com/crob1140/codewiz-server/datastore"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	testSessionName = "test-session"
+	testUserKey     = "userID"
+)
+
+func createTestStore(t *testing.T) *Store {
+	// Each test has its own database, since the migrations can only be
+	// applied once
+	ds, err := datastore.Open("sqlite3", "file:"+t.Name()+".db?cache=shared&mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationsPath := config.GetString(keys.DatabaseMigrationsPath, "../../datastore/migrations")
+	if errs, ok := ds.UpSync(migrationsPath); !ok {
+		t.Fatal(errs)
+	}
+
+	store := NewStore(NewDao(ds), testUserKey, []byte("test-session-key"))
+	store.Options.MaxAge = 3600
+	return store
+}
+
+// saveTestSession saves the session and returns the request that a browser
+// would make next, with the cookie that was set.
+func saveTestSession(t *testing.T, store *Store, r *http.Request) (*http.Request, *httptest.ResponseRecorder) {
+	session, err := store.Get(r, testSessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := httptest.NewRecorder()
+	if err := session.Save(r, writer); err != nil {
+		t.Fatal(err)
+	}
+
+	next, _ := http.NewRequest("GET", "/", nil)
+	for _, cookie := range writer.Result().Cookies() {
+		next.AddCookie(cookie)
+	}
+	return next, writer
+}
+
+func TestStore_OnlyStoresSessionsWithValues(t *testing.T) {
+	store := createTestStore(t)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	if _, writer := saveTestSession(t, store, request); len(writer.Result().Cookies()) != 0 {
+		t.Errorf("Expected an empty session not to set a cookie")
+	}
+}
+
+func TestStore_RoundTrip(t *testing.T) {
+	store := createTestStore(t)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("User-Agent", "Test Browser")
+	session, _ := store.Get(request, testSessionName)
+	session.Values[testUserKey] = uint64(7)
+	session.AddFlash("Hello", "notices")
+
+	next, _ := saveTestSession(t, store, request)
+	loaded, err := store.New(next, testSessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.IsNew || loaded.Values[testUserKey] != uint64(7) {
+		t.Fatalf("Expected the session to be loaded, got %+v", loaded.Values)
+	}
+
+	if flashes := loaded.Flashes("notices"); len(flashes) != 1 || flashes[0] != "Hello" {
+		t.Errorf("Unexpected flashes: got %v", flashes)
+	}
+
+	records, err := store.Dao.GetByUserID(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 || records[0].UserAgent != "Test Browser" || !IsCurrent(records[0], loaded.ID) {
+		t.Errorf("Expected the session to be stored against the user")
+	}
+}
+
+func TestStore_RevokedSessionsAreNotLoaded(t *testing.T) {
+	store := createTestStore(t)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(request, testSessionName)
+	session.Values[testUserKey] = uint64(8)
+	next, _ := saveTestSession(t, store, request)
+
+	if err := store.Dao.DeleteByUserID(8); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.New(next, testSessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !loaded.IsNew || len(loaded.Values) != 0 {
+		t.Errorf("Expected a revoked session to be replaced, got %+v", loaded.Values)
+	}
+}
+
+func TestStore_NewSecretWhenUserChanges(t *testing.T) {
+	store := createTestStore(t)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(request, testSessionName)
+	session.AddFlash("Before login", "notices")
+	next, _ := saveTestSession(t, store, request)
+
+	visitorSession, _ := store.Get(next, testSessionName)
+	visitorSecret := visitorSession.ID
+	visitorSession.Values[testUserKey] = uint64(9)
+
+	writer := httptest.NewRecorder()
+	if err := visitorSession.Save(next, writer); err != nil {
+		t.Fatal(err)
+	}
+
+	if visitorSession.ID == visitorSecret {
+		t.Errorf("Expected the session to get a new secret when the user logged in")
+	}
+
+	if old, _ := store.Dao.GetBySecret(visitorSecret); old != nil {
+		t.Errorf("Expected the session with the old secret to be revoked")
+	}
+}
+
+func TestStore_DeleteWithNegativeMaxAge(t *testing.T) {
+	store := createTestStore(t)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(request, testSessionName)
+	session.Values[testUserKey] = uint64(10)
+	next, _ := saveTestSession(t, store, request)
+
+	loaded, _ := store.Get(next, testSessionName)
+	loaded.Options.MaxAge = -1
+	writer := httptest.NewRecorder()
+	if err := loaded.Save(next, writer); err != nil {
+		t.Fatal(err)
+	}
+
+	if records, _ := store.Dao.GetByUserID(10); len(records) != 0 {
+		t.Errorf("Expected the session to be deleted")
+	}
+
+	if cookies := writer.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Expected the cookie to be cleared")
+	}
+}
+
+func TestStore_ExpiredSessionsAreDeleted(t *testing.T) {
+	store := createTestStore(t)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(request, testSessionName)
+	session.Values[testUserKey] = uint64(11)
+	next, _ := saveTestSession(t, store, request)
+
+	records, err := store.Dao.GetByUserID(11)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Expected the session to be stored, got %v (%v)", records, err)
+	}
+
+	records[0].ExpiryTime = time.Now().Add(-time.Minute).UTC()
+	if err := store.Dao.Update(records[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.New(next, testSessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !loaded.IsNew {
+		t.Errorf("Expected an expired session to be replaced")
+	}
+
+	if records, _ := store.Dao.GetByUserID(11); len(records) != 0 {
+		t.Errorf("Expected the expired session to be deleted")
+	}
+}
+
+func TestDao_DeleteExpired(t *testing.T) {
+	store := createTestStore(t)
+	now := time.Now()
+
+	for i, expiry := range []time.Time{now.Add(-time.Hour), now.Add(-time.Minute), now.Add(time.Hour)} {
+		secret, _ := newSecret()
+		record := &Session{UserID: uint64(20 + i), Hash: secret, ExpiryTime: expiry.UTC()}
+		if err := store.Dao.Insert(record); err != nil {
+			t.Fatal(err)
+		}
+
+		// Revoked sessions are removed too once they expire
+		if i == 0 {
+			if err := store.Dao.Delete(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	removed, err := store.Dao.DeleteExpired(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 2 {
+		t.Errorf("Unexpected number of sessions removed: got %v want 2", removed)
+	}
+
+	if records, _ := store.Dao.GetByUserID(22); len(records) != 1 {
+		t.Errorf("Expected the session that has not expired to be kept")
+	}
+}
@@ -0,0 +1,56 @@
+package usertokens
+
+import (
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/models/tokens"
+)
+
+type Dao struct {
+	DB *datastore.DB
+}
+
+func NewDao(db *datastore.DB) *Dao {
+	db.AddTableWithName(Token{}, "UserTokens")
+	return &Dao{DB: db}
+}
+
+// GetUsable returns the token with the given purpose and secret, or nil if
+// there is none or it has been used or has expired.
+func (dao *Dao) GetUsable(purpose string, secret string, now time.Time) (*Token, error) {
+	token, err := dao.DB.Get(Token{}, "SELECT * FROM UserTokens WHERE Purpose = ? AND Hash = ?", purpose, tokens.Hash(secret))
+	if err != nil || token == nil {
+		return nil, err
+	}
+
+	if token.(*Token).Expired(now) {
+		return nil, nil
+	}
+	return token.(*Token), nil
+}
+
+func (dao *Dao) Insert(token *Token) error {
+	return dao.DB.Insert(token)
+}
+
+// Use deletes the token so that it cannot be used again.
+func (dao *Dao) Use(token *Token) error {
+	return dao.DB.Delete(token)
+}
+
+// DeleteByUserID deletes the user's tokens with the given purpose, so that
+// the links in earlier emails stop working.
+func (dao *Dao) DeleteByUserID(userID uint64, purpose string) error {
+	var found []*Token
+	if _, err := dao.DB.Select(&found, "SELECT * FROM UserTokens WHERE UserID = ? AND Purpose = ?", userID, purpose); err != nil {
+		return err
+	}
+
+	for _, token := range found {
+		if err := dao.DB.Delete(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
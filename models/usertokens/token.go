@@ -0,0 +1,59 @@
+// Package usertokens stores the single-use tokens that are emailed to
+// users, to prove that they can read the mail sent to their address.
+package usertokens
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/models/tokens"
+)
+
+// Purposes stop a token that was sent for one reason from being used for
+// another.
+const (
+	VerifyEmail   = "verify-email"
+	ResetPassword = "reset-password"
+)
+
+// Lifetimes are how long a token can be used for after it is created.
+var Lifetimes = map[string]time.Duration{
+	VerifyEmail:   48 * time.Hour,
+	ResetPassword: time.Hour,
+}
+
+// Token is sent to a user as part of a link. Only a hash of the secret is
+// stored, and the token is deleted once it has been used.
+type Token struct {
+	datastore.BaseRecord
+	UserID     uint64    `db:"UserID"`
+	Purpose    string    `db:"Purpose"`
+	Hash       string    `db:"Hash"`
+	Email      string    `db:"Email"` // the address the token was sent to
+	ExpiryTime time.Time `db:"ExpiryTime"`
+}
+
+// New creates a token for the user along with its secret. The token expires
+// after the lifetime for its purpose.
+func New(userID uint64, purpose string, email string, now time.Time) (*Token, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(buf)
+
+	token := &Token{
+		UserID:     userID,
+		Purpose:    purpose,
+		Hash:       tokens.Hash(secret),
+		Email:      email,
+		ExpiryTime: now.Add(Lifetimes[purpose]),
+	}
+	return token, secret, nil
+}
+
+func (token *Token) Expired(t time.Time) bool {
+	return !t.Before(token.ExpiryTime)
+}
@@ -0,0 +1,42 @@
+package usertokens
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/models/tokens"
+)
+
+func TestNew(t *testing.T) {
+	now := time.Date(2016, time.June, 1, 12, 0, 0, 0, time.UTC)
+	token, secret, err := New(1, ResetPassword, "test@test.com", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret == "" || token.Hash != tokens.Hash(secret) {
+		t.Errorf("Expected the token to store the hash of its secret")
+	}
+
+	if !token.ExpiryTime.Equal(now.Add(time.Hour)) {
+		t.Errorf("Unexpected expiry time: got %v", token.ExpiryTime)
+	}
+
+	_, other, _ := New(1, ResetPassword, "test@test.com", now)
+	if other == secret {
+		t.Errorf("Expected each token to have a different secret")
+	}
+}
+
+func TestToken_Expired(t *testing.T) {
+	now := time.Date(2016, time.June, 1, 12, 0, 0, 0, time.UTC)
+	token, _, _ := New(1, VerifyEmail, "test@test.com", now)
+
+	if token.Expired(now.Add(47 * time.Hour)) {
+		t.Errorf("Expected the token to still be usable")
+	}
+
+	if !token.Expired(now.Add(48 * time.Hour)) {
+		t.Errorf("Expected the token to have expired")
+	}
+}
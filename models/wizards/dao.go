@@ -1,18 +1,36 @@
 package wizards
 
 import (
+	"context"
+	"errors"
 	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/interpreters"
 )
 
+var ErrScriptOwnerMismatch = errors.New("The script does not belong to the given wizard.")
+
 type Dao struct {
 	DB *datastore.DB
 }
 
 func NewDao(db *datastore.DB) *Dao {
 	db.AddTableWithName(Wizard{}, "Wizards")
+	db.AddTableWithName(WizardScript{}, "WizardScripts")
 	return &Dao{DB : db}
 }
 
+// WithTx returns a copy of the DAO that runs its queries in the given
+// transaction, see datastore.DB.WithTransaction.
+func (dao *Dao) WithTx(tx *datastore.DB) *Dao {
+	return &Dao{DB : tx}
+}
+
+// WithContext returns a copy of the DAO whose queries are cancelled along
+// with ctx, see datastore.DB.WithContext.
+func (dao *Dao) WithContext(ctx context.Context) *Dao {
+	return &Dao{DB : dao.DB.WithContext(ctx)}
+}
+
 func (dao *Dao) GetByID(id uint64) (*Wizard, error) {
 	wizard, err := dao.DB.Get(Wizard{}, "SELECT * FROM Wizards WHERE ID = ?", id)
 	if err != nil || wizard == nil {
@@ -27,6 +45,14 @@ func (dao *Dao) GetByOwnerID(ownerID uint64) ([]*Wizard, error) {
 	return wizards, err
 }
 
+// GetPageByOwnerID returns up to limit of the owner's wizards in the order
+// they were created, starting after the wizard with the given ID.
+func (dao *Dao) GetPageByOwnerID(ownerID uint64, afterID uint64, limit int) ([]*Wizard, error) {
+	var wizards []*Wizard
+	_, err := dao.DB.Select(&wizards, "SELECT * FROM Wizards WHERE OwnerID = ? AND ID > ? ORDER BY ID LIMIT ?", ownerID, afterID, limit)
+	return wizards, err
+}
+
 func (dao *Dao) GetByNameAndOwnerID(name string, ownerID uint64) (*Wizard, error) {
 	wizard, err := dao.DB.Get(Wizard{}, "SELECT * FROM Wizards WHERE Name = ? AND OwnerID = ?", name, ownerID)
 	if err != nil || wizard == nil {
@@ -35,6 +61,13 @@ func (dao *Dao) GetByNameAndOwnerID(name string, ownerID uint64) (*Wizard, error
 	return wizard.(*Wizard), err
 }
 
+// IsNameTaken reports whether the owner has another wizard with the given
+// name. Deleted wizards are included, since their names stay reserved.
+func (dao *Dao) IsNameTaken(name string, ownerID uint64, wizardID uint64) (bool, error) {
+	count, err := dao.DB.SelectInt("SELECT COUNT(*) FROM Wizards WHERE Name = ? AND OwnerID = ? AND ID <> ?", name, ownerID, wizardID)
+	return count > 0, err
+}
+
 func (dao *Dao) Update(wizard *Wizard) error {
 	return dao.DB.Update(wizard)
 }
@@ -45,4 +78,107 @@ func (dao *Dao) Delete(wizard *Wizard) error {
 
 func (dao *Dao) Insert(wizard *Wizard) error {
 	return dao.DB.Insert(wizard)
-}
\ No newline at end of file
+}
+
+// InsertScript saves the script as the newest version of its wizard's AI.
+// The revision number is assigned automatically. The script is compiled
+// first, so that a version that could never be run in battle is not saved;
+// interpreters.ErrUnknownLanguage is returned if its language is not
+// supported, and the interpreter's error if it does not compile.
+func (dao *Dao) InsertScript(script *WizardScript) error {
+	interpreter, err := interpreters.Get(script.Language)
+	if err != nil {
+		return err
+	}
+
+	if _, err := interpreter.Compile(script.Source); err != nil {
+		return err
+	}
+
+	latestRevision, err := dao.DB.SelectInt("SELECT COALESCE(MAX(Revision), 0) FROM WizardScripts WHERE WizardID = ?", script.WizardID)
+	if err != nil {
+		return err
+	}
+
+	previousRevision := script.Revision
+	script.Revision = uint(latestRevision) + 1
+	err = dao.DB.Insert(script)
+	if err != nil {
+		script.Revision = previousRevision
+	}
+
+	return err
+}
+
+func (dao *Dao) GetScriptByID(id uint64) (*WizardScript, error) {
+	script, err := dao.DB.Get(WizardScript{}, "SELECT * FROM WizardScripts WHERE ID = ?", id)
+	if err != nil || script == nil {
+		return nil, err
+	}
+	return script.(*WizardScript), err
+}
+
+// GetScriptVersions returns every saved version of the wizard's AI, newest first.
+func (dao *Dao) GetScriptVersions(wizardID uint64) ([]*WizardScript, error) {
+	var scripts []*WizardScript
+	_, err := dao.DB.Select(&scripts, "SELECT * FROM WizardScripts WHERE WizardID = ? ORDER BY Revision DESC", wizardID)
+	return scripts, err
+}
+
+func (dao *Dao) GetScriptVersion(wizardID uint64, revision uint) (*WizardScript, error) {
+	script, err := dao.DB.Get(WizardScript{}, "SELECT * FROM WizardScripts WHERE WizardID = ? AND Revision = ?", wizardID, revision)
+	if err != nil || script == nil {
+		return nil, err
+	}
+	return script.(*WizardScript), err
+}
+
+// GetActiveScript returns the script the wizard will use in battle, or nil if none has been activated.
+func (dao *Dao) GetActiveScript(wizard *Wizard) (*WizardScript, error) {
+	if wizard.ActiveScriptID == 0 {
+		return nil, nil
+	}
+	return dao.GetScriptByID(wizard.ActiveScriptID)
+}
+
+// SetActiveScript marks the script as the one the wizard will use in battle.
+// Any saved version can be activated, which allows rolling back to older AI.
+func (dao *Dao) SetActiveScript(wizard *Wizard, script *WizardScript) error {
+	if script.WizardID != wizard.ID {
+		return ErrScriptOwnerMismatch
+	}
+
+	previousScriptID := wizard.ActiveScriptID
+	wizard.ActiveScriptID = script.ID
+	err := dao.DB.Update(wizard)
+	if err != nil {
+		wizard.ActiveScriptID = previousScriptID
+	}
+
+	return err
+}
+
+// GetSpells returns the IDs of the spells the wizard has equipped, in slot order.
+func (dao *Dao) GetSpells(wizard *Wizard) ([]string, error) {
+	var spellIDs []string
+	_, err := dao.DB.Select(&spellIDs, "SELECT SpellID FROM WizardSpells WHERE WizardID = ? ORDER BY Slot", wizard.ID)
+	return spellIDs, err
+}
+
+// SetSpells replaces the wizard's equipped spells with the IDs in wizard.Spells.
+// The IDs should already have been checked against the spell catalogue.
+func (dao *Dao) SetSpells(wizard *Wizard) error {
+	return dao.DB.WithTransaction(func(tx *datastore.DB) error {
+		if _, err := tx.Exec("DELETE FROM WizardSpells WHERE WizardID = ?", wizard.ID); err != nil {
+			return err
+		}
+
+		for slot, spellID := range wizard.Spells {
+			_, err := tx.Exec("INSERT INTO WizardSpells (WizardID, Slot, SpellID) VALUES (?, ?, ?)", wizard.ID, slot, spellID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
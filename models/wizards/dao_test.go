@@ -0,0 +1,161 @@
+package wizards
+
+import (
+	"testing"
+
+	"github.com/crob1140/codewiz-server/config"
+	"github.com/crob1140/codewiz-server/config/keys"
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/interpreters"
+	_ "github.com/crob1140/codewiz-server/interpreters/lisp"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const testSource = `(define (decide state) (wait))`
+
+func createTestDao(t *testing.T) *Dao {
+	// Each test has its own database, since the migrations can only be
+	// applied once
+	ds, err := datastore.Open("sqlite3", "file:"+t.Name()+".db?cache=shared&mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrationsPath := config.GetString(keys.DatabaseMigrationsPath, "../../datastore/migrations")
+	if errs, ok := ds.UpSync(migrationsPath); !ok {
+		t.Fatal(errs)
+	}
+	return NewDao(ds)
+}
+
+func createTestWizard(t *testing.T, dao *Dao, name string) *Wizard {
+	wizard := NewWizard(name, male, 1)
+	if err := dao.Insert(wizard); err != nil {
+		t.Fatal(err)
+	}
+	return wizard
+}
+
+// insertTestScripts saves a version of the wizard's AI for each source.
+func insertTestScripts(t *testing.T, dao *Dao, wizard *Wizard, sources ...string) []*WizardScript {
+	var scripts []*WizardScript
+	for _, source := range sources {
+		script := NewWizardScript(wizard.ID, 1, "lisp", source)
+		if err := dao.InsertScript(script); err != nil {
+			t.Fatal(err)
+		}
+		scripts = append(scripts, script)
+	}
+	return scripts
+}
+
+func TestDao_InsertScriptNumbersRevisions(t *testing.T) {
+	dao := createTestDao(t)
+	first := createTestWizard(t, dao, "First")
+	second := createTestWizard(t, dao, "Second")
+
+	insertTestScripts(t, dao, first, testSource, testSource+" ; edited")
+	insertTestScripts(t, dao, second, testSource)
+
+	// A revision given by the caller is replaced by the next one
+	script := NewWizardScript(first.ID, 1, "lisp", testSource+" ; edited again")
+	script.Revision = 1
+	if err := dao.InsertScript(script); err != nil {
+		t.Fatal(err)
+	}
+
+	if script.Revision != 3 {
+		t.Errorf("Unexpected revision: got %v want 3", script.Revision)
+	}
+
+	versions, err := dao.GetScriptVersions(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 3 || versions[0].Revision != 3 || versions[1].Revision != 2 || versions[2].Revision != 1 {
+		t.Errorf("Expected the first wizard's versions newest first, got %d versions", len(versions))
+	}
+
+	// Each wizard's revisions are numbered separately
+	versions, err = dao.GetScriptVersions(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 1 || versions[0].Revision != 1 {
+		t.Errorf("Expected the second wizard to have revision 1 only, got %d versions", len(versions))
+	}
+}
+
+func TestDao_InsertScriptRejectsInvalidScripts(t *testing.T) {
+	dao := createTestDao(t)
+	wizard := createTestWizard(t, dao, "Invalid")
+
+	unknown := NewWizardScript(wizard.ID, 1, "cobol", testSource)
+	if err := dao.InsertScript(unknown); err != interpreters.ErrUnknownLanguage {
+		t.Errorf("Unexpected error for an unknown language: got %v want %v", err, interpreters.ErrUnknownLanguage)
+	}
+
+	broken := NewWizardScript(wizard.ID, 1, "lisp", "(define (decide state)")
+	if err := dao.InsertScript(broken); err == nil {
+		t.Errorf("Expected a script that does not compile to be rejected")
+	}
+
+	if versions, _ := dao.GetScriptVersions(wizard.ID); len(versions) != 0 {
+		t.Errorf("Expected no versions to be saved, got %d", len(versions))
+	}
+}
+
+func TestDao_SetActiveScriptRollsBack(t *testing.T) {
+	dao := createTestDao(t)
+	wizard := createTestWizard(t, dao, "RolledBack")
+	scripts := insertTestScripts(t, dao, wizard, testSource, testSource+" ; bad edit")
+
+	if err := dao.SetActiveScript(wizard, scripts[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	earlier, err := dao.GetScriptVersion(wizard.ID, 1)
+	if err != nil || earlier == nil {
+		t.Fatalf("Expected the first revision to be found, got %v (%v)", earlier, err)
+	}
+
+	if err := dao.SetActiveScript(wizard, earlier); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := dao.GetByID(wizard.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	active, err := dao.GetActiveScript(reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if active == nil || active.ID != scripts[0].ID || active.Revision != 1 {
+		t.Errorf("Expected the wizard to be rolled back to revision 1, got %+v", active)
+	}
+}
+
+func TestDao_SetActiveScriptOfAnotherWizard(t *testing.T) {
+	dao := createTestDao(t)
+	wizard := createTestWizard(t, dao, "Owner")
+	other := createTestWizard(t, dao, "Other")
+	scripts := insertTestScripts(t, dao, other, testSource)
+
+	if err := dao.SetActiveScript(wizard, scripts[0]); err != ErrScriptOwnerMismatch {
+		t.Errorf("Unexpected error: got %v want %v", err, ErrScriptOwnerMismatch)
+	}
+
+	if wizard.ActiveScriptID != 0 {
+		t.Errorf("Expected the wizard's active script not to change")
+	}
+
+	reloaded, _ := dao.GetByID(wizard.ID)
+	if reloaded.ActiveScriptID != 0 {
+		t.Errorf("Expected the wizard's active script not to be saved")
+	}
+}
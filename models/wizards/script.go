@@ -0,0 +1,36 @@
+package wizards
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/crob1140/codewiz-server/datastore"
+)
+
+// WizardScript is a single version of the AI written for a wizard.
+// Scripts are never modified once saved; every edit creates a new
+// revision, so that a wizard can be rolled back to any previous AI.
+type WizardScript struct {
+	datastore.BaseRecord
+	WizardID uint64 `db:"WizardID"`
+	Revision uint   `db:"Revision"`
+	Language string `db:"Language"`
+	Source   string `db:"Source"`
+	Checksum string `db:"Checksum"`
+	AuthorID uint64 `db:"AuthorID"`
+}
+
+func NewWizardScript(wizardID uint64, authorID uint64, language string, source string) *WizardScript {
+	return &WizardScript{
+		WizardID: wizardID,
+		AuthorID: authorID,
+		Language: language,
+		Source:   source,
+		Checksum: Checksum(source),
+	}
+}
+
+// Checksum returns the hex-encoded SHA-256 digest of the source code.
+func Checksum(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,15 +1,22 @@
 package wizards
 
 import (
+	"github.com/crob1140/codewiz-server/interpreters"
 	"github.com/crob1140/codewiz-server/models"
+	"github.com/crob1140/codewiz-server/models/spells"
+)
+
+const (
+	maxSourceLength = 64 * 1024
 )
 
 type Validator struct {
 	Dao *Dao
+	Catalogue *spells.Catalogue
 }
 
-func NewValidator(dao *Dao) *Validator {
-	return &Validator{Dao : dao}
+func NewValidator(dao *Dao, catalogue *spells.Catalogue) *Validator {
+	return &Validator{Dao : dao, Catalogue : catalogue}
 }
 
 func (validator *Validator) Validate(wizard *Wizard) (models.ValidationErrors, error) {
@@ -24,14 +31,40 @@ func (validator *Validator) Validate(wizard *Wizard) (models.ValidationErrors, e
 		errs.Add("Name", "This field cannot be empty.")
 	}
 
-	savedWizard, err := validator.Dao.GetByNameAndOwnerID(wizard.Name, wizard.OwnerID)
+	for _, problem := range validator.Catalogue.ValidateLoadout(wizard.Spells) {
+		errs.Add("Spells", problem)
+	}
+
+	taken, err := validator.Dao.IsNameTaken(wizard.Name, wizard.OwnerID, wizard.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	if savedWizard != nil && savedWizard.ID != wizard.ID {
+	if taken {
 		errs.Add("Name", "A wizard with this name already exists.")
 	}
 
 	return errs, nil
-}
\ No newline at end of file
+}
+
+func (validator *Validator) ValidateScript(script *WizardScript) models.ValidationErrors {
+
+	errs := make(models.ValidationErrors)
+
+	interpreter, err := interpreters.Get(script.Language)
+	if err != nil {
+		errs.Add("Language", "Unsupported language.")
+	}
+
+	if script.Source == "" {
+		errs.Add("Source", "This field cannot be empty.")
+	} else if len(script.Source) > maxSourceLength {
+		errs.Add("Source", "Source code must not exceed 64KB.")
+	} else if interpreter != nil {
+		if err := interpreter.Validate(script.Source); err != nil {
+			errs.Add("Source", err.Error())
+		}
+	}
+
+	return errs
+}
@@ -14,6 +14,8 @@ type Wizard struct {
 	OwnerID uint64 `db:"OwnerID"`
 	Sex string	`db:"Sex"`
 	Name string 	`db:"Name"`
+	ActiveScriptID uint64 `db:"ActiveScriptID"` // zero until a script has been activated
+	Spells []string `db:"-"` // IDs of the equipped spells, stored in the WizardSpells table
 }
 
 func NewWizard(name string, sex string, ownerID uint64) *Wizard {
@@ -0,0 +1,238 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	// clockSkew allows for the provider's clock being slightly different
+	// to the server's.
+	clockSkew = time.Minute
+
+	// keyRefreshInterval limits how often the keys are fetched again when
+	// a token is signed with a key that has not been seen, so that forged
+	// tokens cannot be used to flood the provider with requests.
+	keyRefreshInterval = time.Minute
+)
+
+// Claims are what the provider says about the user in their ID token.
+type Claims struct {
+	Subject           string // the provider's ID for the user, which never changes
+	Email             string
+	EmailVerified     bool // whether the provider has checked that the user owns the address
+	Name              string
+	PreferredUsername string
+}
+
+// idToken is the payload of an ID token. The audience may be a single
+// string or a list, and some providers send email_verified as a string.
+type idToken struct {
+	Issuer            string          `json:"iss"`
+	Subject           string          `json:"sub"`
+	Audience          json.RawMessage `json:"aud"`
+	AuthorizedParty   string          `json:"azp"`
+	Expiry            int64           `json:"exp"`
+	IssuedAt          int64           `json:"iat"`
+	Nonce             string          `json:"nonce"`
+	Email             string          `json:"email"`
+	EmailVerified     interface{}     `json:"email_verified"`
+	Name              string          `json:"name"`
+	PreferredUsername string          `json:"preferred_username"`
+}
+
+// Verify checks that the ID token was signed by the provider for this
+// client in response to the request with the given nonce, and that it has
+// not expired, and returns its claims.
+func (provider *Provider) Verify(rawToken string, nonce string, now time.Time) (*Claims, error) {
+	meta, err := provider.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("ID token is malformed.")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	// Only the algorithm that every provider supports is accepted, which
+	// rules out unsigned tokens as well
+	if header.Algorithm != "RS256" {
+		return nil, errors.New("ID token is signed with an unsupported algorithm.")
+	}
+
+	key, err := provider.key(meta, header.KeyID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("ID token is malformed.")
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("ID token signature is invalid.")
+	}
+
+	var token idToken
+	if err := decodeSegment(parts[1], &token); err != nil {
+		return nil, err
+	}
+
+	if token.Issuer != meta.Issuer {
+		return nil, errors.New("ID token was issued by a different provider.")
+	}
+
+	audiences, err := parseAudience(token.Audience)
+	if err != nil {
+		return nil, err
+	}
+
+	if !contains(audiences, provider.ClientID) || (len(audiences) > 1 && token.AuthorizedParty != provider.ClientID) {
+		return nil, errors.New("ID token was issued to a different client.")
+	}
+
+	if !now.Before(time.Unix(token.Expiry, 0).Add(clockSkew)) {
+		return nil, errors.New("ID token has expired.")
+	}
+
+	if time.Unix(token.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return nil, errors.New("ID token was issued in the future.")
+	}
+
+	if token.Nonce == "" || token.Nonce != nonce {
+		return nil, errors.New("ID token was issued for a different request.")
+	}
+
+	if token.Subject == "" {
+		return nil, errors.New("ID token does not identify the user.")
+	}
+
+	verified, _ := token.EmailVerified.(bool)
+	if text, ok := token.EmailVerified.(string); ok {
+		verified = text == "true"
+	}
+
+	return &Claims{
+		Subject:           token.Subject,
+		Email:             token.Email,
+		EmailVerified:     verified && token.Email != "",
+		Name:              token.Name,
+		PreferredUsername: token.PreferredUsername,
+	}, nil
+}
+
+// key returns the provider's key with the given ID. The keys are fetched
+// again if the ID is not recognised, since providers change their keys
+// from time to time.
+func (provider *Provider) key(meta *metadata, keyID string, now time.Time) (*rsa.PublicKey, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if key, ok := provider.lookupKey(keyID); ok {
+		return key, nil
+	}
+
+	if provider.keys != nil && now.Sub(provider.keysFetched) < keyRefreshInterval {
+		return nil, errors.New("ID token is signed with an unknown key.")
+	}
+
+	var set struct {
+		Keys []struct {
+			KeyType   string `json:"kty"`
+			KeyID     string `json:"kid"`
+			Use       string `json:"use"`
+			Algorithm string `json:"alg"`
+			Modulus   string `json:"n"`
+			Exponent  string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := provider.getJSON(meta.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "RSA" || (jwk.Use != "" && jwk.Use != "sig") || (jwk.Algorithm != "" && jwk.Algorithm != "RS256") {
+			continue
+		}
+
+		modulus, err := base64.RawURLEncoding.DecodeString(jwk.Modulus)
+		if err != nil {
+			continue
+		}
+
+		exponent, err := base64.RawURLEncoding.DecodeString(jwk.Exponent)
+		if err != nil || len(exponent) == 0 || len(exponent) > 4 {
+			continue
+		}
+
+		keys[jwk.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}
+	}
+
+	provider.keys = keys
+	provider.keysFetched = now
+
+	if key, ok := provider.lookupKey(keyID); ok {
+		return key, nil
+	}
+	return nil, errors.New("ID token is signed with an unknown key.")
+}
+
+// lookupKey finds a key that has already been fetched. Tokens without a
+// key ID can only be checked if the provider has a single key.
+func (provider *Provider) lookupKey(keyID string) (*rsa.PublicKey, bool) {
+	if keyID == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, true
+		}
+	}
+
+	key, ok := provider.keys[keyID]
+	return key, ok
+}
+
+func decodeSegment(segment string, result interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("ID token is malformed.")
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return errors.New("ID token is malformed.")
+	}
+	return nil
+}
+
+func parseAudience(raw json.RawMessage) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, errors.New("ID token has an invalid audience.")
+	}
+	return list, nil
+}
@@ -0,0 +1,226 @@
+// Package oidc lets users log in with an account they have elsewhere, using
+// the OpenID Connect authorization code flow with PKCE.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTimeout limits how long the server waits for a provider, since
+// the user is kept waiting as well.
+const requestTimeout = 10 * time.Second
+
+// Config describes a provider that the server has been registered with.
+type Config struct {
+	Name         string // identifies the provider in URLs and the datastore
+	DisplayName  string // shown to users, as in "Sign in with ..."
+	Issuer       string // the URL that the provider's settings are discovered from
+	ClientID     string
+	ClientSecret string   // may be empty if the server is a public client
+	Scopes       []string // requested as well as openid
+}
+
+// Provider is a client of an OpenID Connect provider. The provider's
+// endpoints and keys are fetched when they are first needed and then kept,
+// so that the server can start while a provider is unavailable.
+type Provider struct {
+	Config
+	Client *http.Client
+
+	mutex       sync.Mutex
+	metadata    *metadata
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// metadata is the part of the provider's discovery document that is used.
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	ChallengeMethods      []string `json:"code_challenge_methods_supported"`
+}
+
+func NewProvider(config Config) *Provider {
+	return &Provider{Config: config, Client: &http.Client{Timeout: requestTimeout}}
+}
+
+// AuthRequest holds the values that have to be kept while the user is away
+// at the provider, and checked when they return.
+type AuthRequest struct {
+	State    string // returned with the code, to tie it to the user's session
+	Nonce    string // returned in the ID token, so that it cannot be replayed
+	Verifier string // the PKCE secret, so that a stolen code cannot be used
+}
+
+func NewAuthRequest() (*AuthRequest, error) {
+	var values [3]string
+	for i := range values {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	return &AuthRequest{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// challenge is the S256 PKCE challenge for the request's verifier.
+func (request *AuthRequest) challenge() string {
+	sum := sha256.Sum256([]byte(request.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthURL returns the page at the provider that the user is sent to. The
+// provider sends them back to the redirect URI with a code that can be
+// exchanged for their identity.
+func (provider *Provider) AuthURL(request *AuthRequest, redirectURI string) (string, error) {
+	meta, err := provider.discover()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", errors.New("Provider's authorization endpoint is not a valid URL.")
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(append([]string{"openid"}, provider.Scopes...), " "))
+	query.Set("state", request.State)
+	query.Set("nonce", request.Nonce)
+	query.Set("code_challenge", request.challenge())
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// Exchange swaps the code that the provider returned for the user's ID
+// token, and returns its claims once it has been validated.
+func (provider *Provider) Exchange(code string, request *AuthRequest, redirectURI string, now time.Time) (*Claims, error) {
+	meta, err := provider.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {request.Verifier},
+	}
+
+	// Public clients identify themselves in the form instead of
+	// authenticating
+	if provider.ClientSecret == "" {
+		form.Set("client_id", provider.ClientID)
+	}
+
+	tokenRequest, err := http.NewRequest("POST", meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	tokenRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tokenRequest.Header.Set("Accept", "application/json")
+	if provider.ClientSecret != "" {
+		tokenRequest.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+	}
+
+	response, err := provider.Client.Do(tokenRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return nil, errors.New("Provider's token response is not valid JSON.")
+	}
+
+	if response.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, errors.New("Provider rejected the code: " + strings.TrimSpace(tokens.Error+" "+tokens.ErrorDescription))
+	}
+
+	if tokens.IDToken == "" {
+		return nil, errors.New("Provider did not return an ID token.")
+	}
+
+	return provider.Verify(tokens.IDToken, request.Nonce, now)
+}
+
+// discover fetches the provider's discovery document, which must have been
+// published for the configured issuer.
+func (provider *Provider) discover() (*metadata, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if provider.metadata != nil {
+		return provider.metadata, nil
+	}
+
+	var meta metadata
+	if err := provider.getJSON(strings.TrimSuffix(provider.Issuer, "/")+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, err
+	}
+
+	if meta.Issuer != provider.Issuer {
+		return nil, errors.New("Provider's discovery document is for a different issuer.")
+	}
+
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("Provider's discovery document is missing an endpoint.")
+	}
+
+	// Providers that do not list their challenge methods may still support
+	// PKCE, but providers that list others would ignore the challenge
+	if len(meta.ChallengeMethods) != 0 && !contains(meta.ChallengeMethods, "S256") {
+		return nil, errors.New("Provider does not support S256 code challenges.")
+	}
+
+	provider.metadata = &meta
+	return provider.metadata, nil
+}
+
+func (provider *Provider) getJSON(location string, result interface{}) error {
+	response, err := provider.Client.Get(location)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.New("Provider returned " + response.Status + " for " + location + ".")
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return errors.New("Provider returned invalid JSON for " + location + ".")
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
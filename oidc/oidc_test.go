@@ -0,0 +1,170 @@
+package oidc
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/oidc/oidctest"
+)
+
+const testRedirectURI = "http://codewiz.test/login/test/callback"
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Provider) {
+	stub := oidctest.NewProvider("codewiz", "secret")
+	t.Cleanup(stub.Close)
+
+	provider := NewProvider(Config{
+		Name:         "test",
+		DisplayName:  "Test",
+		Issuer:       stub.Issuer(),
+		ClientID:     "codewiz",
+		ClientSecret: "secret",
+		Scopes:       []string{"email", "profile"},
+	})
+	return provider, stub
+}
+
+// authorize follows the authorization URL and returns the code that the
+// provider sent back.
+func authorize(t *testing.T, provider *Provider, request *AuthRequest) string {
+	authURL, err := provider.AuthURL(request, testRedirectURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state := location.Query().Get("state"); state != request.State {
+		t.Fatalf("Expected the state to be returned, got %v", state)
+	}
+	return location.Query().Get("code")
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	provider, stub := newTestProvider(t)
+	stub.SetAccount(oidctest.Account{Subject: "1234", Email: "wizard@test.com", EmailVerified: true, Name: "Merlin"})
+
+	request, err := NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := provider.Exchange(authorize(t, provider, request), request, testRedirectURI, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Claims{Subject: "1234", Email: "wizard@test.com", EmailVerified: true, Name: "Merlin"}
+	if *claims != expected {
+		t.Errorf("Unexpected claims: got %+v want %+v", *claims, expected)
+	}
+}
+
+func TestProvider_Exchange_RequiresVerifier(t *testing.T) {
+	provider, stub := newTestProvider(t)
+	stub.SetAccount(oidctest.Account{Subject: "1234"})
+
+	request, err := NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := authorize(t, provider, request)
+
+	// A stolen code is no use without the verifier
+	stolen := *request
+	stolen.Verifier = "guessed"
+	if _, err := provider.Exchange(code, &stolen, testRedirectURI, time.Now()); err == nil {
+		t.Error("Expected the code to be rejected without the verifier")
+	}
+
+	// Codes can only be used once
+	if _, err := provider.Exchange(code, request, testRedirectURI, time.Now()); err == nil {
+		t.Error("Expected the code to be rejected after it was used")
+	}
+}
+
+func TestProvider_Verify_RejectsInvalidTokens(t *testing.T) {
+	provider, stub := newTestProvider(t)
+	now := time.Now()
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   stub.Issuer(),
+			"sub":   "1234",
+			"aud":   "codewiz",
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+			"nonce": "nonce",
+		}
+	}
+
+	if _, err := provider.Verify(stub.Sign(valid()), "nonce", now); err != nil {
+		t.Fatalf("Expected a valid token to be accepted, got %v", err)
+	}
+
+	tests := map[string]func(claims map[string]interface{}){
+		"wrong issuer":   func(claims map[string]interface{}) { claims["iss"] = "https://evil.test" },
+		"wrong audience": func(claims map[string]interface{}) { claims["aud"] = "someone-else" },
+		"shared audience": func(claims map[string]interface{}) {
+			claims["aud"] = []string{"codewiz", "someone-else"}
+		},
+		"expired":     func(claims map[string]interface{}) { claims["exp"] = now.Add(-time.Hour).Unix() },
+		"future":      func(claims map[string]interface{}) { claims["iat"] = now.Add(time.Hour).Unix() },
+		"wrong nonce": func(claims map[string]interface{}) { claims["nonce"] = "replayed" },
+		"no nonce":    func(claims map[string]interface{}) { delete(claims, "nonce") },
+		"no subject":  func(claims map[string]interface{}) { delete(claims, "sub") },
+	}
+
+	for name, modify := range tests {
+		claims := valid()
+		modify(claims)
+		if _, err := provider.Verify(stub.Sign(claims), "nonce", now); err == nil {
+			t.Errorf("Expected a token with %v to be rejected", name)
+		}
+	}
+
+	// Changing the claims invalidates the signature
+	parts := strings.Split(stub.Sign(valid()), ".")
+	forged := valid()
+	forged["sub"] = "5678"
+	parts[1] = strings.Split(stub.Sign(forged), ".")[1]
+	if _, err := provider.Verify(strings.Join(parts, "."), "nonce", now); err == nil {
+		t.Error("Expected a token with a forged payload to be rejected")
+	}
+
+	// Unsigned tokens are never accepted
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	if _, err := provider.Verify(header+"."+parts[1]+".", "nonce", now); err == nil {
+		t.Error("Expected an unsigned token to be rejected")
+	}
+}
+
+func TestProvider_AuthURL_RejectsMismatchedIssuer(t *testing.T) {
+	provider, _ := newTestProvider(t)
+	provider.Issuer += "/"
+
+	request, err := NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.AuthURL(request, testRedirectURI); err == nil {
+		t.Error("Expected discovery to fail for a different issuer")
+	}
+}
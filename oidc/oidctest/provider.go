@@ -0,0 +1,238 @@
+// Package oidctest runs a stand-in OpenID Connect provider, so that logins
+// through external providers can be tested without registering with a real
+// one. It logs in as its current account without asking for a password.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const keyID = "test-key"
+
+// Account is the user that the provider says has logged in.
+type Account struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// Provider is a stand-in provider that is served from a local address. It
+// checks the requests it is sent as strictly as a real provider would.
+type Provider struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	mutex   sync.Mutex
+	account Account
+	key     *rsa.PrivateKey
+	grants  map[string]grant
+}
+
+// grant is an authorization code that has been issued but not used.
+type grant struct {
+	account     Account
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// NewProvider starts a provider that the client with the given credentials
+// is registered with. It should be closed once it is no longer needed.
+func NewProvider(clientID string, clientSecret string) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	provider := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		grants:       make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.serveDiscovery)
+	mux.HandleFunc("/authorize", provider.serveAuthorize)
+	mux.HandleFunc("/token", provider.serveToken)
+	mux.HandleFunc("/jwks", provider.serveKeys)
+	provider.Server = httptest.NewServer(mux)
+	return provider
+}
+
+// Issuer is the URL that clients discover the provider from.
+func (provider *Provider) Issuer() string {
+	return provider.URL
+}
+
+// SetAccount changes who is logged in by later authorization requests.
+func (provider *Provider) SetAccount(account Account) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	provider.account = account
+}
+
+// Sign creates a token with the given claims, signed with the provider's
+// key, so that tests can check how clients handle invalid tokens.
+func (provider *Provider) Sign(claims map[string]interface{}) string {
+	return provider.sign(map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": keyID}, claims)
+}
+
+// IDToken creates a valid ID token for the account, as it would be issued
+// to the client for a request with the given nonce.
+func (provider *Provider) IDToken(account Account, nonce string, now time.Time) string {
+	return provider.Sign(map[string]interface{}{
+		"iss":                provider.Issuer(),
+		"sub":                account.Subject,
+		"aud":                provider.ClientID,
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              nonce,
+		"email":              account.Email,
+		"email_verified":     account.EmailVerified,
+		"name":               account.Name,
+		"preferred_username": account.PreferredUsername,
+	})
+}
+
+func (provider *Provider) sign(header map[string]interface{}, claims map[string]interface{}) string {
+	signingInput := encodeSegment(header) + "." + encodeSegment(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, provider.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (provider *Provider) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                provider.Issuer(),
+		"authorization_endpoint":                provider.URL + "/authorize",
+		"token_endpoint":                        provider.URL + "/token",
+		"jwks_uri":                              provider.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// serveAuthorize approves every valid request straight away, and sends the
+// user back to the client with a code.
+func (provider *Provider) serveAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() || query.Get("client_id") != provider.ClientID {
+		http.Error(w, "Unknown client or redirect URI.", http.StatusBadRequest)
+		return
+	}
+
+	response := url.Values{"state": {query.Get("state")}}
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		response.Set("error", "invalid_request")
+	} else {
+		code := randomString()
+		provider.mutex.Lock()
+		provider.grants[code] = grant{
+			account:     provider.account,
+			nonce:       query.Get("nonce"),
+			challenge:   query.Get("code_challenge"),
+			redirectURI: redirectURI.String(),
+		}
+		provider.mutex.Unlock()
+		response.Set("code", code)
+	}
+
+	redirectURI.RawQuery = response.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// serveToken exchanges a code for an ID token. Codes can only be used once,
+// by the client that they were issued to, with the PKCE verifier that
+// matches their challenge.
+func (provider *Provider) serveToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostFormValue("client_id")
+	}
+
+	if r.Method != "POST" || clientID != provider.ClientID || clientSecret != provider.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+	provider.mutex.Lock()
+	issued, ok := provider.grants[code]
+	delete(provider.grants, code)
+	provider.mutex.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != issued.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != issued.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     provider.IDToken(issued.account, issued.nonce, time.Now()),
+	})
+}
+
+func (provider *Provider) serveKeys(w http.ResponseWriter, r *http.Request) {
+	public := provider.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func encodeSegment(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -4,17 +4,16 @@ import (
 	"path"
 	"net/http"
 	"github.com/gorilla/mux"
-	"github.com/crob1140/codewiz-server/models/users"
 	"github.com/crob1140/codewiz-server/routes/api/v1"
 )
 
-func NewRouter(apiPath string, userDao *users.Dao) http.Handler {
+func NewRouter(apiPath string, deps *v1.Dependencies) http.Handler {
 
 	router := mux.NewRouter()
 
 	// Add version one
 	v1Path := path.Join(apiPath, "/v1")
-	v1Router := v1.NewRouter(v1Path, userDao)
+	v1Router := v1.NewRouter(v1Path, deps)
 	router.PathPrefix(v1Path).Handler(v1Router)
 	
 	// ----------------------------------------------------------------
@@ -26,7 +25,7 @@ func NewRouter(apiPath string, userDao *users.Dao) http.Handler {
 	// ----------------------------------------------------------------
 
 	latestVersionPath := path.Join(apiPath, "/latest")
-	latestVersionRouter := v1.NewRouter(latestVersionPath, userDao)
+	latestVersionRouter := v1.NewRouter(latestVersionPath, deps)
 	router.PathPrefix(latestVersionPath).Handler(latestVersionRouter)
 
 	return router
@@ -0,0 +1,202 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/crob1140/codewiz-server/live"
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/jobs"
+	"github.com/crob1140/codewiz-server/models/replays"
+	"github.com/crob1140/codewiz-server/models/tokens"
+	"github.com/crob1140/codewiz-server/models/wizards"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
+)
+
+const (
+	battlesPath    = "/battles"
+	battleJobsPath = "/battles/jobs"
+
+	replayContentType = "application/vnd.codewiz.replay"
+)
+
+type BattleJob struct {
+	URI       string     `json:"uri"`
+	WizardIDs []uint64   `json:"wizardIds"`
+	State     jobs.State `json:"state"`
+	Attempts  int        `json:"attempts"`
+	LiveURI   string     `json:"liveUri,omitempty"`
+	ReplayURI string     `json:"replayUri,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	QueuedAt  time.Time  `json:"queuedAt"`
+}
+
+type BattleRequest struct {
+	WizardIDs []uint64 `json:"wizardIds"`
+}
+
+func addBattleRoutes(router *routes.Router, v1Path string, wizardDao *wizards.Dao, replayDao *replays.Dao, jobDao *jobs.Dao, hub *live.Hub) {
+	router.Path(battlesPath).HandlerFunc(withScope(tokens.BattlesRun, createAddBattleHandler(v1Path, wizardDao, jobDao))).Methods("POST")
+	router.Path(path.Join(battleJobsPath, "/{id:[0-9]+}")).HandlerFunc(withScope(tokens.BattlesRun, createGetBattleJobHandler(v1Path, jobDao))).Methods("GET")
+	router.Path(path.Join(battleJobsPath, "/{id:[0-9]+}/live")).HandlerFunc(createWatchBattleHandler(jobDao, hub)).Methods("GET")
+	router.Path(path.Join(battlesPath, "/{id:[0-9]+}/replay")).HandlerFunc(createGetReplayHandler(replayDao)).Methods("GET")
+}
+
+// createAddBattleHandler queues a friendly battle between the given wizards.
+// The battle is fought by the worker pool, so the response only says where
+// to poll for the result. The user must own at least one of the wizards.
+func createAddBattleHandler(v1Path string, wizardDao *wizards.Dao, jobDao *jobs.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user := context.User
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+			return
+		}
+
+		var request BattleRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not valid JSON.", CodeInvalidRequest)
+			return
+		}
+
+		if len(request.WizardIDs) < 2 {
+			writeError(w, http.StatusBadRequest, "A battle needs at least two wizards.", CodeInvalidRequest)
+			return
+		}
+
+		ownsWizard := false
+		seen := make(map[uint64]bool, len(request.WizardIDs))
+		for _, wizardID := range request.WizardIDs {
+			if seen[wizardID] {
+				writeError(w, http.StatusBadRequest, "A wizard cannot take part in the same battle twice.", CodeInvalidRequest)
+				return
+			}
+			seen[wizardID] = true
+
+			wizard, err := wizardDao.GetByID(wizardID)
+			if err != nil {
+				log.Error("Failed to fetch wizard from datastore", log.Fields{"wizard": wizardID, "error": err})
+				writeInternalError(w)
+				return
+			}
+
+			if wizard == nil {
+				writeError(w, http.StatusNotFound, "Wizard does not exist.", CodeNotFound)
+				return
+			}
+
+			if wizard.ActiveScriptID == 0 {
+				writeError(w, http.StatusBadRequest, "Every wizard must have an active script to battle.", CodeNoActiveScript)
+				return
+			}
+
+			ownsWizard = ownsWizard || wizard.OwnerID == user.ID
+		}
+
+		if !ownsWizard {
+			writeError(w, http.StatusUnauthorized, "User does not have permission to access this resource.", CodeOwnerOnly)
+			return
+		}
+
+		job := jobs.NewJob(user.ID, request.WizardIDs, rand.Int63())
+		if err := jobDao.Insert(job); err != nil {
+			log.Error("Failed to insert battle job", log.Fields{"wizards": request.WizardIDs, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resource := toBattleJobResource(v1Path, job)
+		w.Header().Set("Location", resource.URI)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(toJson(resource))
+	}
+}
+
+func createGetBattleJobHandler(v1Path string, jobDao *jobs.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user := context.User
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+			return
+		}
+
+		jobID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		job, err := jobDao.GetByID(jobID)
+		if err != nil {
+			log.Error("Failed to fetch battle job from datastore", log.Fields{"job": jobID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if job == nil {
+			writeError(w, http.StatusNotFound, "Battle job does not exist.", CodeNotFound)
+			return
+		}
+
+		if job.OwnerID != user.ID {
+			writeError(w, http.StatusUnauthorized, "User does not have permission to access this resource.", CodeOwnerOnly)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(toBattleJobResource(v1Path, job)))
+	}
+}
+
+func toBattleJobResource(v1Path string, job *jobs.Job) BattleJob {
+	resource := BattleJob{
+		URI:       path.Join(v1Path, battleJobsPath, strconv.FormatUint(job.ID, 10)),
+		WizardIDs: job.WizardIDs(),
+		State:     job.State,
+		Attempts:  job.Attempts,
+		Reason:    job.Reason,
+		QueuedAt:  job.CreationTime(),
+	}
+
+	if job.State == jobs.Queued || job.State == jobs.Running {
+		resource.LiveURI = path.Join(resource.URI, "/live")
+	}
+
+	if job.BattleID != 0 {
+		resource.ReplayURI = path.Join(v1Path, battlesPath, strconv.FormatUint(job.BattleID, 10), "/replay")
+	}
+
+	return resource
+}
+
+// createGetReplayHandler returns the encoded replay as-is. It is served
+// with http.ServeContent so that clients can request byte ranges and
+// stream long replays rather than downloading them in one go.
+func createGetReplayHandler(replayDao *replays.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		battleID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+		replay, err := replayDao.GetByBattleID(battleID)
+		if err != nil {
+			log.Error("Failed to fetch replay from datastore", log.Fields{
+				"battle": battleID,
+				"error":  err,
+			})
+
+			writeInternalError(w)
+			return
+		}
+
+		if replay == nil {
+			writeError(w, http.StatusNotFound, "Replay does not exist.", CodeNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", replayContentType)
+		w.Header().Set("X-Replay-Format-Version", strconv.Itoa(replay.FormatVersion))
+		name := fmt.Sprintf("battle-%d.replay", battleID)
+		http.ServeContent(w, r, name, replay.CreationTime(), bytes.NewReader(replay.Data))
+	}
+}
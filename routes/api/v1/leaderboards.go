@@ -0,0 +1,168 @@
+package v1
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/leaderboards"
+	"github.com/crob1140/codewiz-server/models/seasons"
+	"github.com/crob1140/codewiz-server/routes"
+)
+
+const (
+	leaderboardsPath = "/leaderboards"
+
+	currentSeason = "current"
+)
+
+type Leaderboard struct {
+	SeasonURI string             `json:"seasonUri,omitempty"`
+	Entries   []LeaderboardEntry `json:"entries"`
+	Next      string             `json:"next,omitempty"`
+}
+
+type LeaderboardEntry struct {
+	Rank       int     `json:"rank"`
+	WizardID   uint64  `json:"wizardId"`
+	WizardName string  `json:"wizardName"`
+	Rating     float64 `json:"rating"`
+	Deviation  float64 `json:"deviation"`
+	Games      int     `json:"games"`
+	Language   string  `json:"language,omitempty"`
+}
+
+func addLeaderboardRoutes(router *routes.Router, v1Path string, seasonDao *seasons.Dao, leaderboardDao *leaderboards.Dao) {
+	router.Path(leaderboardsPath).HandlerFunc(createGetLeaderboardHandler(v1Path, seasonDao, leaderboardDao)).Methods("GET")
+}
+
+// createGetLeaderboardHandler returns a page of the leaderboard. It accepts
+// the query parameters season (an ID, or "current"), language, from and to
+// (RFC 3339 times), cursor and limit. Without a season the leaderboard
+// ranks every wizard's all-time rating.
+func createGetLeaderboardHandler(v1Path string, seasonDao *seasons.Dao, leaderboardDao *leaderboards.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		params := r.URL.Query()
+
+		query, ok := parseLeaderboardQuery(w, params)
+		if !ok {
+			return
+		}
+
+		season, ok := findLeaderboardSeason(w, params.Get("season"), seasonDao)
+		if !ok {
+			return
+		}
+
+		archived := false
+		if season != nil {
+			var err error
+			query.SeasonID = season.ID
+			archived, err = seasonDao.HasStandings(season.ID)
+			if err != nil {
+				log.Error("Failed to fetch season standings from datastore", log.Fields{"season": season.ID, "error": err})
+				writeInternalError(w)
+				return
+			}
+		}
+
+		page, err := leaderboardDao.Get(query, archived)
+		if err == leaderboards.ErrInvalidCursor {
+			writeError(w, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+			return
+		} else if err != nil {
+			log.Error("Failed to fetch leaderboard from datastore", log.Fields{"error": err})
+			writeInternalError(w)
+			return
+		}
+
+		leaderboard := Leaderboard{Entries: make([]LeaderboardEntry, 0, len(page.Entries))}
+		if season != nil {
+			leaderboard.SeasonURI = seasonURI(v1Path, season)
+		}
+
+		for _, entry := range page.Entries {
+			leaderboard.Entries = append(leaderboard.Entries, LeaderboardEntry{
+				Rank:       entry.Rank,
+				WizardID:   entry.WizardID,
+				WizardName: entry.WizardName,
+				Rating:     entry.Rating,
+				Deviation:  entry.Deviation,
+				Games:      entry.Games,
+				Language:   entry.Language,
+			})
+		}
+
+		if page.NextCursor != "" {
+			params.Set("cursor", page.NextCursor)
+			next := url.URL{Path: v1Path + leaderboardsPath, RawQuery: params.Encode()}
+			leaderboard.Next = next.String()
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(leaderboard))
+	}
+}
+
+func parseLeaderboardQuery(w http.ResponseWriter, params url.Values) (leaderboards.Query, bool) {
+	query := leaderboards.Query{
+		Language: params.Get("language"),
+		Cursor:   params.Get("cursor"),
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			writeError(w, http.StatusBadRequest, "The limit must be a positive number.", CodeInvalidRequest)
+			return query, false
+		}
+		query.Limit = value
+	}
+
+	for name, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if value := params.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "The '"+name+"' parameter must be an RFC 3339 time.", CodeInvalidRequest)
+				return query, false
+			}
+			*target = parsed
+		}
+	}
+
+	return query, true
+}
+
+func findLeaderboardSeason(w http.ResponseWriter, param string, seasonDao *seasons.Dao) (*seasons.Season, bool) {
+	if param == "" {
+		return nil, true
+	}
+
+	var season *seasons.Season
+	var err error
+	if param == currentSeason {
+		season, err = seasonDao.GetAt(time.Now())
+	} else {
+		seasonID, parseErr := strconv.ParseUint(param, 10, 64)
+		if parseErr != nil {
+			writeError(w, http.StatusBadRequest, "The season must be an ID or 'current'.", CodeInvalidRequest)
+			return nil, false
+		}
+		season, err = seasonDao.GetByID(seasonID)
+	}
+
+	if err != nil {
+		log.Error("Failed to fetch season from datastore", log.Fields{"season": param, "error": err})
+		writeInternalError(w)
+		return nil, false
+	}
+
+	if season == nil {
+		writeError(w, http.StatusNotFound, "Season does not exist.", CodeNotFound)
+		return nil, false
+	}
+
+	return season, true
+}
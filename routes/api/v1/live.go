@@ -0,0 +1,136 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/crob1140/codewiz-server/live"
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/jobs"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	liveWriteTimeout = 10 * time.Second
+	livePongTimeout  = time.Minute
+	livePingInterval = livePongTimeout / 2
+	liveReadLimit    = 512
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// createWatchBattleHandler streams a battle to a spectator over a
+// WebSocket while it is being fought. Anyone can watch a battle, and they
+// can connect as soon as it has been queued. Each message is a JSON
+// encoded live.Message, and the socket is closed once the battle is over.
+func createWatchBattleHandler(jobDao *jobs.Dao, hub *live.Hub) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		jobID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		job, err := jobDao.GetByID(jobID)
+		if err != nil {
+			log.Error("Failed to fetch battle job from datastore", log.Fields{"job": jobID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if job == nil {
+			writeError(w, http.StatusNotFound, "Battle job does not exist.", CodeNotFound)
+			return
+		}
+
+		if !isLive(job) {
+			writeError(w, http.StatusConflict, "Battle has already finished.", CodeBattleOver)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has already responded with an error
+			log.Debug("Failed to upgrade spectator connection", log.Fields{"job": jobID, "error": err})
+			return
+		}
+		defer conn.Close()
+
+		spectator := hub.Watch(job.ID)
+		defer hub.Leave(spectator)
+
+		// The battle may have finished before the spectator joined, in
+		// which case nothing will ever be broadcast to them.
+		job, err = jobDao.GetByID(jobID)
+		if err != nil {
+			log.Error("Failed to fetch battle job from datastore", log.Fields{"job": jobID, "error": err})
+		}
+
+		if err != nil || job == nil || !isLive(job) {
+			closeSpectator(conn, "Battle has already finished.")
+			return
+		}
+
+		streamBattle(conn, spectator)
+	}
+}
+
+func isLive(job *jobs.Job) bool {
+	return job.State == jobs.Queued || job.State == jobs.Running
+}
+
+// streamBattle writes the spectator's messages to the connection until the
+// battle is over or the spectator disconnects. A spectator that cannot
+// keep up only holds up its own connection, since the broadcast skips it
+// ahead rather than waiting for it.
+func streamBattle(conn *websocket.Conn, spectator *live.Spectator) {
+	// Spectators have nothing to send, but the connection has to be read
+	// to answer pings and to notice when they leave.
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+
+		conn.SetReadLimit(liveReadLimit)
+		conn.SetReadDeadline(time.Now().Add(livePongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(livePongTimeout))
+		})
+
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(livePingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data, ok := <-spectator.Messages():
+			if !ok {
+				closeSpectator(conn, "")
+				return
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-disconnected:
+			return
+		}
+	}
+}
+
+func closeSpectator(conn *websocket.Conn, reason string) {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason)
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(liveWriteTimeout))
+}
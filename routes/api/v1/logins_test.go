@@ -0,0 +1,137 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	paths "path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/models/logins"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/totp"
+)
+
+func serveFrom(ipAddress string, username string, password string, path string) *httptest.ResponseRecorder {
+	request := createTestRequest("GET", path, "")
+	request.RemoteAddr = ipAddress + ":50000"
+	request.SetBasicAuth(username, password)
+
+	writer := httptest.NewRecorder()
+	testRouter.ServeHTTP(writer, request)
+	return writer
+}
+
+func TestBasicAuth_ThrottlesFailedLogins(t *testing.T) {
+	ds := openTestDatastore(t)
+	user := users.NewUser("Guessed", "guessedpassword", "guessed@test.com")
+	if err := users.NewDao(ds).Insert(user); err != nil {
+		t.Fatal(err)
+	}
+
+	userPath := paths.Join(testAPIPath, "/users", strconv.FormatUint(user.ID, 10))
+	for i := 0; i < logins.AccountPolicy.FreeAttempts; i++ {
+		writer := serveFrom("192.0.2.1", "Guessed", "wrongpassword", userPath)
+		if status := writer.Code; status != http.StatusUnauthorized {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+		}
+	}
+
+	// The correct password is turned away as well until the delay is over,
+	// even from another address
+	writer := serveFrom("192.0.2.2", "Guessed", "guessedpassword", userPath)
+	if status := writer.Code; status != http.StatusTooManyRequests {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusTooManyRequests)
+	}
+
+	if retryAfter := writer.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Errorf("Unexpected Retry-After header: got %v want 1", retryAfter)
+	}
+
+	var response Error
+	if err := json.Unmarshal(writer.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Code != CodeTooManyLoginAttempts {
+		t.Errorf("Unexpected error code: got %v want %v", response.Code, CodeTooManyLoginAttempts)
+	}
+
+	attempts, err := logins.NewDao(ds).GetByUserID(user.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attempts) != 4 || attempts[0].Outcome != logins.Throttled || attempts[0].IPAddress != "192.0.2.2" || attempts[1].Outcome != logins.Failed {
+		t.Errorf("Expected the attempts to be recorded, got %d", len(attempts))
+	}
+}
+
+func TestBasicAuth_TwoFactorRequiresToken(t *testing.T) {
+	ds := openTestDatastore(t)
+	dao := users.NewDao(ds)
+	user := users.NewUser("TwoFactor", "twofactorpassword", "twofactor@test.com")
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if _, err := user.EnableTwoFactor(secret, totp.Counter(now)-2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dao.Insert(user); err != nil {
+		t.Fatal(err)
+	}
+
+	serveWithCode := func(code string, method string, path string, body string) *httptest.ResponseRecorder {
+		request := createTestRequest(method, path, body)
+		request.SetBasicAuth("TwoFactor", "twofactorpassword")
+		if code != "" {
+			request.Header.Set(OneTimeCodeHeader, code)
+		}
+
+		writer := httptest.NewRecorder()
+		testRouter.ServeHTTP(writer, request)
+		return writer
+	}
+
+	// The password alone is not enough
+	userPath := paths.Join(testAPIPath, "/users", strconv.FormatUint(user.ID, 10))
+	writer := serveWithCode("", "GET", userPath, "")
+	if status := writer.Code; status != http.StatusUnauthorized {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+
+	var response Error
+	if err := json.Unmarshal(writer.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Code != CodeTwoFactorRequired {
+		t.Errorf("Unexpected error code: got %v want %v", response.Code, CodeTwoFactorRequired)
+	}
+
+	// A code is not accepted by any other route, and is not used up by it
+	code, _ := totp.Code(secret, totp.Counter(now))
+	writer = serveWithCode(code, "GET", userPath, "")
+	if status := writer.Code; status != http.StatusUnauthorized {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+
+	// A code can be used once, to create a token
+	tokensPath := paths.Join(testAPIPath, "/tokens")
+	writer = serveWithCode(code, "POST", tokensPath, `{"name":"Two factor","scopes":["wizards:read"]}`)
+	if status := writer.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	writer = serveWithCode(code, "POST", tokensPath, `{"name":"Replayed","scopes":["wizards:read"]}`)
+	if status := writer.Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,188 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/matchmaking"
+	"github.com/crob1140/codewiz-server/models/tokens"
+	"github.com/crob1140/codewiz-server/models/wizards"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
+)
+
+const (
+	queuePath = "/matchmaking/queue"
+)
+
+type QueueEntry struct {
+	URI        string            `json:"uri"`
+	WizardID   uint64            `json:"wizardId"`
+	State      matchmaking.State `json:"state"`
+	ReplayURI  string            `json:"replayUri,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	EnqueuedAt time.Time         `json:"enqueuedAt"`
+}
+
+type QueueRequest struct {
+	WizardID uint64 `json:"wizardId"`
+}
+
+func addMatchmakingRoutes(router *routes.Router, v1Path string, wizardDao *wizards.Dao, queueDao *matchmaking.Dao) {
+	router.Path(queuePath).HandlerFunc(withScope(tokens.BattlesRun, createEnqueueHandler(v1Path, wizardDao, queueDao))).Methods("POST")
+	router.Path(path.Join(queuePath, "/{id:[0-9]+}")).HandlerFunc(withScope(tokens.BattlesRun, createGetQueueEntryHandler(v1Path, queueDao))).Methods("GET")
+	router.Path(path.Join(queuePath, "/{id:[0-9]+}")).HandlerFunc(withScope(tokens.BattlesRun, createCancelQueueEntryHandler(v1Path, queueDao))).Methods("DELETE")
+}
+
+func createEnqueueHandler(v1Path string, wizardDao *wizards.Dao, queueDao *matchmaking.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user := context.User
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+			return
+		}
+
+		var request QueueRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not valid JSON.", CodeInvalidRequest)
+			return
+		}
+
+		wizard, err := wizardDao.GetByID(request.WizardID)
+		if err != nil {
+			log.Error("Failed to fetch wizard from datastore", log.Fields{"wizard": request.WizardID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if wizard == nil {
+			writeError(w, http.StatusNotFound, "Wizard does not exist.", CodeNotFound)
+			return
+		}
+
+		if wizard.OwnerID != user.ID {
+			writeError(w, http.StatusUnauthorized, "User does not have permission to access this resource.", CodeOwnerOnly)
+			return
+		}
+
+		if !user.EmailVerified {
+			writeError(w, http.StatusForbidden, "The owner's email address must be verified to enter ranked play.", CodeEmailNotVerified)
+			return
+		}
+
+		if wizard.ActiveScriptID == 0 {
+			writeError(w, http.StatusBadRequest, "The wizard must have an active script to enter ranked play.", CodeNoActiveScript)
+			return
+		}
+
+		existing, err := queueDao.GetWaitingByWizardID(wizard.ID)
+		if err != nil {
+			log.Error("Failed to fetch queue entry from datastore", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if existing != nil {
+			writeError(w, http.StatusConflict, "The wizard is already in the queue.", CodeAlreadyQueued)
+			return
+		}
+
+		entry := matchmaking.NewEntry(wizard.ID, user.ID)
+		if err := queueDao.Insert(entry); err != nil {
+			log.Error("Failed to insert queue entry", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resource := toQueueEntryResource(v1Path, entry)
+		w.Header().Set("Location", resource.URI)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(toJson(resource))
+	}
+}
+
+func createGetQueueEntryHandler(v1Path string, queueDao *matchmaking.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		entry, ok := findOwnedQueueEntry(w, r, context, queueDao)
+		if !ok {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(toQueueEntryResource(v1Path, entry)))
+	}
+}
+
+func createCancelQueueEntryHandler(v1Path string, queueDao *matchmaking.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		entry, ok := findOwnedQueueEntry(w, r, context, queueDao)
+		if !ok {
+			return
+		}
+
+		if entry.State != matchmaking.Waiting {
+			writeError(w, http.StatusConflict, "Only entries that are still waiting can be cancelled.", CodeNotWaiting)
+			return
+		}
+
+		entry.State = matchmaking.Cancelled
+		if err := queueDao.Update(entry); err != nil {
+			log.Error("Failed to cancel queue entry", log.Fields{"entry": entry.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(toQueueEntryResource(v1Path, entry)))
+	}
+}
+
+// findOwnedQueueEntry looks up the entry in the request path, and writes
+// an error response if it cannot be found or belongs to another user.
+func findOwnedQueueEntry(w http.ResponseWriter, r *http.Request, context *routes.Context, queueDao *matchmaking.Dao) (*matchmaking.Entry, bool) {
+	user := context.User
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+		return nil, false
+	}
+
+	entryID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	entry, err := queueDao.GetByID(entryID)
+	if err != nil {
+		log.Error("Failed to fetch queue entry from datastore", log.Fields{"entry": entryID, "error": err})
+		writeInternalError(w)
+		return nil, false
+	}
+
+	if entry == nil {
+		writeError(w, http.StatusNotFound, "Queue entry does not exist.", CodeNotFound)
+		return nil, false
+	}
+
+	if entry.OwnerID != user.ID {
+		writeError(w, http.StatusUnauthorized, "User does not have permission to access this resource.", CodeOwnerOnly)
+		return nil, false
+	}
+
+	return entry, true
+}
+
+func toQueueEntryResource(v1Path string, entry *matchmaking.Entry) QueueEntry {
+	resource := QueueEntry{
+		URI:        path.Join(v1Path, queuePath, strconv.FormatUint(entry.ID, 10)),
+		WizardID:   entry.WizardID,
+		State:      entry.State,
+		Reason:     entry.Reason,
+		EnqueuedAt: entry.CreationTime(),
+	}
+
+	if entry.BattleID != 0 {
+		resource.ReplayURI = path.Join(v1Path, battlesPath, strconv.FormatUint(entry.BattleID, 10), "/replay")
+	}
+
+	return resource
+}
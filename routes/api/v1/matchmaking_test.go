@@ -0,0 +1,54 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	paths "path"
+	"strconv"
+	"testing"
+
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/models/wizards"
+)
+
+func TestEnqueue_RequiresVerifiedEmail(t *testing.T) {
+	ds := openTestDatastore(t)
+	userDao := users.NewDao(ds)
+	wizardDao := wizards.NewDao(ds)
+
+	owner := users.NewUser("Unverified", "ownerpassword", "unverified@test.com")
+	if err := userDao.Insert(owner); err != nil {
+		t.Fatal(err)
+	}
+
+	wizard := wizards.NewWizard("Hopeful", "F", owner.ID)
+	wizard.ActiveScriptID = 1
+	if err := wizardDao.Insert(wizard); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"wizardId":` + strconv.FormatUint(wizard.ID, 10) + `}`
+	writer := serveAs("Unverified", "ownerpassword", "POST", paths.Join(testAPIPath, queuePath), body)
+	if status := writer.Code; status != http.StatusForbidden {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusForbidden)
+	}
+
+	var response Error
+	if err := json.Unmarshal(writer.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Code != CodeEmailNotVerified {
+		t.Errorf("Unexpected error code: got %v want %v", response.Code, CodeEmailNotVerified)
+	}
+
+	owner.EmailVerified = true
+	if err := userDao.Update(owner); err != nil {
+		t.Fatal(err)
+	}
+
+	writer = serveAs("Unverified", "ownerpassword", "POST", paths.Join(testAPIPath, queuePath), body)
+	if status := writer.Code; status != http.StatusAccepted {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusAccepted)
+	}
+}
@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// pageRequest is the position and size of a page of a list that is ordered by ID.
+type pageRequest struct {
+	AfterID uint64 // the ID of the last item on the previous page
+	Limit   int
+}
+
+// parsePage reads the cursor and limit query parameters, writing an error
+// response if either is invalid. The cursor is the ID of the last item on
+// the previous page.
+func parsePage(w http.ResponseWriter, params url.Values, defaultLimit int, maxLimit int) (pageRequest, bool) {
+	paging := pageRequest{Limit: defaultLimit}
+
+	if limit := params.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			writeError(w, http.StatusBadRequest, "The limit must be a positive number.", CodeInvalidRequest)
+			return paging, false
+		}
+
+		paging.Limit = value
+		if paging.Limit > maxLimit {
+			paging.Limit = maxLimit
+		}
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		afterID, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "The cursor is not valid.", CodeInvalidRequest)
+			return paging, false
+		}
+		paging.AfterID = afterID
+	}
+
+	return paging, true
+}
+
+// nextPageURI returns the URI of the page that follows the one ending with
+// the item with the given ID. The other query parameters are kept as-is.
+func nextPageURI(listPath string, params url.Values, lastID uint64) string {
+	next := url.Values{}
+	for key, values := range params {
+		next[key] = values
+	}
+	next.Set("cursor", strconv.FormatUint(lastID, 10))
+
+	uri := url.URL{Path: listPath, RawQuery: next.Encode()}
+	return uri.String()
+}
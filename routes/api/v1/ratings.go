@@ -0,0 +1,87 @@
+package v1
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/ratings"
+	"github.com/crob1140/codewiz-server/models/wizards"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
+)
+
+type Rating struct {
+	WizardID  uint64         `json:"wizardId"`
+	Rating    float64        `json:"rating"`
+	Deviation float64        `json:"deviation"`
+	Games     int            `json:"games"`
+	History   []RatingChange `json:"history"`
+}
+
+type RatingChange struct {
+	BattleID uint64    `json:"battleId"`
+	Rating   float64   `json:"rating"`
+	Change   float64   `json:"change"`
+	Time     time.Time `json:"time"`
+}
+
+func addRatingRoutes(router *routes.Router, wizardDao *wizards.Dao, ratingDao *ratings.Dao) {
+	router.Path(path.Join("/wizards", "/{id:[0-9]+}/rating")).HandlerFunc(createGetRatingHandler(wizardDao, ratingDao)).Methods("GET")
+}
+
+// createGetRatingHandler returns a wizard's ranked rating and its history.
+// Ratings are public, so that players can size up their opponents.
+func createGetRatingHandler(wizardDao *wizards.Dao, ratingDao *ratings.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		wizardID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+		wizard, err := wizardDao.GetByID(wizardID)
+		if err != nil {
+			log.Error("Failed to fetch wizard from datastore", log.Fields{"wizard": wizardID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if wizard == nil {
+			writeError(w, http.StatusNotFound, "Wizard does not exist.", CodeNotFound)
+			return
+		}
+
+		rating, err := ratingDao.GetOrCreate(wizard.ID)
+		if err != nil {
+			log.Error("Failed to fetch rating from datastore", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		history, err := ratingDao.GetHistory(wizard.ID)
+		if err != nil {
+			log.Error("Failed to fetch rating history from datastore", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resource := Rating{
+			WizardID:  wizard.ID,
+			Rating:    rating.Rating,
+			Deviation: rating.Deviation,
+			Games:     rating.Games,
+			History:   make([]RatingChange, 0, len(history)),
+		}
+
+		for _, change := range history {
+			resource.History = append(resource.History, RatingChange{
+				BattleID: change.BattleID,
+				Rating:   change.Rating,
+				Change:   change.Change,
+				Time:     change.CreationTime(),
+			})
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(resource))
+	}
+}
@@ -3,41 +3,149 @@ package v1
 import (
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"encoding/json"
+	"path"
 	"runtime/debug"
+	"strconv"
+	"time"
+	"github.com/crob1140/codewiz-server/live"
 	"github.com/crob1140/codewiz-server/log"
 	"github.com/crob1140/codewiz-server/routes"
+	"github.com/crob1140/codewiz-server/models"
+	"github.com/crob1140/codewiz-server/models/jobs"
+	"github.com/crob1140/codewiz-server/models/leaderboards"
+	"github.com/crob1140/codewiz-server/models/logins"
+	"github.com/crob1140/codewiz-server/models/matchmaking"
+	"github.com/crob1140/codewiz-server/models/ratings"
+	"github.com/crob1140/codewiz-server/models/replays"
+	"github.com/crob1140/codewiz-server/models/seasons"
+	"github.com/crob1140/codewiz-server/models/spells"
+	"github.com/crob1140/codewiz-server/models/tokens"
+	"github.com/crob1140/codewiz-server/models/tournaments"
 	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/models/usersessions"
+	"github.com/crob1140/codewiz-server/models/wizards"
 )
 
 const (
 	CodeInternalError = 50000
+
+	// Malformed requests
+	CodeInvalidRequest = 40000
+	CodeNoActiveScript = 40001
 	
 	// Authorization
 	CodeAdminOnly = 40100
 	CodeOwnerOnly = 40101
+	CodeLoginRequired = 40102
+	CodeInvalidToken = 40103
+	CodeModeratorOnly = 40104
+	CodeAccountDisabled = 40105
+	CodeTwoFactorRequired = 40106
+
+	// Insufficient access
+	CodeMissingScope = 40300
+	CodeEmailNotVerified = 40301
+
+	// Missing resources
+	CodeNotFound = 40400
+
+	// Conflicts with the current state of a resource
+	CodeAlreadyQueued = 40900
+	CodeNotWaiting = 40901
+	CodeAlreadyRegistered = 40902
+	CodeRegistrationClosed = 40903
+	CodeBattleOver = 40904
+	CodeEditConflict = 40905
+
+	// Rate limiting
+	CodeTooManyLoginAttempts = 42900
 )
 
+// OneTimeCodeHeader is where users with two-factor authentication send a
+// code from their authenticator app, so that they can log in with their
+// password to create an access token. It is not accepted by any other route.
+const OneTimeCodeHeader = "X-OTP"
+
 type Error struct {
 	Message string `json:"message"`
 	Code int `json:"code"`
+	Fields models.ValidationErrors `json:"fields,omitempty"`
 }
 
 
-func NewRouter(v1Path string, userDao *users.Dao) *routes.Router {
+// Dependencies holds the data access objects and services used by the
+// v1 handlers.
+type Dependencies struct {
+	UserDao *users.Dao
+	WizardDao *wizards.Dao
+	ReplayDao *replays.Dao
+	RatingDao *ratings.Dao
+	QueueDao *matchmaking.Dao
+	SeasonDao *seasons.Dao
+	LeaderboardDao *leaderboards.Dao
+	TournamentDao *tournaments.Dao
+	JobDao *jobs.Dao
+	TokenDao *tokens.Dao
+	LoginGuard *logins.Guard
+	SessionDao *usersessions.Dao
+	Hub *live.Hub
+	Catalogue *spells.Catalogue
+}
+
+func NewRouter(v1Path string, deps *Dependencies) *routes.Router {
 
 	router := routes.NewRouter(v1Path).StrictSlash(true)
 	router.Use(createRecoveryMiddleware())
-	router.Use(createUserIdentificationMiddleware(userDao))
+	router.Use(createUserIdentificationMiddleware(v1Path, deps.UserDao, deps.TokenDao, deps.LoginGuard))
 	router.Use(createLoggerMiddleware())
 
-	addUserRoutes(router)
-	addWizardRoutes(router)
+	addUserRoutes(router, v1Path, deps.UserDao, deps.WizardDao, deps.QueueDao, deps.SessionDao)
+	addTokenRoutes(router, v1Path, deps.TokenDao)
+	addWizardRoutes(router, v1Path, deps.WizardDao, deps.QueueDao, deps.Catalogue)
+	addSpellRoutes(router, v1Path, deps.Catalogue)
+	addBattleRoutes(router, v1Path, deps.WizardDao, deps.ReplayDao, deps.JobDao, deps.Hub)
+	addRatingRoutes(router, deps.WizardDao, deps.RatingDao)
+	addMatchmakingRoutes(router, v1Path, deps.WizardDao, deps.QueueDao)
+	addSeasonRoutes(router, v1Path, deps.SeasonDao)
+	addLeaderboardRoutes(router, v1Path, deps.SeasonDao, deps.LeaderboardDao)
+	addTournamentRoutes(router, v1Path, deps.WizardDao, deps.TournamentDao)
 
 	return router
 }
 
+var (
+	requireAdmin = routes.RequireRoles(createRoleDeniedHandler("Resource is only available to admin users.", CodeAdminOnly), users.Admin)
+
+	// Restricts a route to admins who have set up two-factor authentication,
+	// as the admin console does. Since they can only log in with a password
+	// to create an access token, the route accepts tokens with the admin scope.
+	adminOnly = routes.MiddlewareFunc(func(w http.ResponseWriter, r *http.Request, context *routes.Context, next routes.HandlerFunc) {
+		withScope(tokens.Admin, func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+			requireAdmin.ServeHTTP(w, r, context, func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+				if !context.User.TwoFactorEnabled() {
+					writeError(w, http.StatusUnauthorized, "Admins have to set up two-factor authentication before they can access this resource.", CodeTwoFactorRequired)
+					return
+				}
+				next(w, r, context)
+			})
+		})(w, r, context)
+	})
+)
+
+func createRoleDeniedHandler(message string, code int) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		if context.User == nil {
+			writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+			return
+		}
+
+		writeError(w, http.StatusUnauthorized, message, code)
+	}
+}
+
 func createRecoveryMiddleware() routes.Middleware {
 	return routes.MiddlewareFunc(func(w http.ResponseWriter, r *http.Request, context *routes.Context, next routes.HandlerFunc) {
 		defer func() {
@@ -93,8 +201,33 @@ func createLoggerMiddleware() routes.Middleware {
 	})
 }
 
-func createUserIdentificationMiddleware(userDao *users.Dao) routes.Middleware {
+func createUserIdentificationMiddleware(v1Path string, userDao *users.Dao, tokenDao *tokens.Dao, guard *logins.Guard) routes.Middleware {
+	createTokenPath := path.Join(v1Path, tokensPath)
+
 	return routes.MiddlewareFunc(func(w http.ResponseWriter, r *http.Request, context *routes.Context, next routes.HandlerFunc) {
+		if secret, ok := bearerToken(r); ok {
+			token, err := findUsableToken(secret, userDao, tokenDao)
+			if err != nil {
+				log.Error("Failed to fetch access token from datastore", log.Fields{
+					"error" : err,
+				})
+
+				writeInternalError(w)
+				return
+			}
+
+			if token == nil {
+				writeError(w, http.StatusUnauthorized, "Access token is not valid.", CodeInvalidToken)
+				return
+			}
+
+			// The token's owner is only treated as logged in by the routes
+			// that accept one of the token's scopes (see withScope)
+			context.Token = token
+			next(w,r,context)
+			return
+		}
+
 		username, password, ok := r.BasicAuth()
 		if ok {
 			user, err := userDao.GetByUsername(username)
@@ -113,12 +246,73 @@ func createUserIdentificationMiddleware(userDao *users.Dao) routes.Middleware {
 				return
 			}
 
+			var userID uint64
 			if user != nil {
-				if user.VerifyPassword(password) {
-					context.User = user
+				userID = user.ID
+			}
+
+			ipAddress := routes.ClientIP(r)
+			now := time.Now()
+			wait, failures, err := guard.Check(username, ipAddress, now)
+			if err != nil {
+				log.Error("Failed to check login attempts", log.Fields{
+					"username" : username,
+					"error" : err,
+				})
+
+				writeInternalError(w)
+				return
+			}
+
+			if wait > 0 {
+				recordLoginAttempt(guard, logins.NewAttempt(username, userID, ipAddress, logins.API, logins.Throttled, now))
+
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, "Too many failed login attempts. Try again later.", CodeTooManyLoginAttempts)
+				return
+			}
+
+			if user != nil && user.VerifyPassword(password) {
+				// Users with two-factor authentication are expected to use
+				// access tokens. Each code can only be used once, so logging in
+				// with a password is only good for creating one.
+				if user.TwoFactorEnabled() {
+					code := r.Header.Get(OneTimeCodeHeader)
+					if code == "" || r.Method != "POST" || r.URL.Path != createTokenPath {
+						writeError(w, http.StatusUnauthorized, "Account uses two-factor authentication, so an access token is required. Create one by sending a one-time code in the " + OneTimeCodeHeader + " header with a POST to " + createTokenPath + ".", CodeTwoFactorRequired)
+						return
+					}
+
+					if !user.VerifySecondFactor(code, now) {
+						recordLoginAttempt(guard, logins.NewAttempt(username, userID, ipAddress, logins.API, logins.Failed, now))
+						writeError(w, http.StatusUnauthorized, "One-time code is not valid.", CodeTwoFactorRequired)
+						return
+					}
+
+					if err := userDao.Update(user); err != nil {
+						log.Error("Failed to update user", log.Fields{
+							"username" : username,
+							"error" : err,
+						})
+
+						writeInternalError(w)
+						return
+					}
+				}
+
+				// Every request logs in again, so successes are only
+				// recorded when they reset the failures
+				if failures > 0 {
+					recordLoginAttempt(guard, logins.NewAttempt(username, userID, ipAddress, logins.API, logins.Succeeded, now))
 				}
+
+				if user.Disabled {
+					writeError(w, http.StatusUnauthorized, "User account has been disabled.", CodeAccountDisabled)
+					return
+				}
+				context.User = user
 			} else {
-				// TODO
+				recordLoginAttempt(guard, logins.NewAttempt(username, userID, ipAddress, logins.API, logins.Failed, now))
 			}
 		}
 
@@ -126,6 +320,39 @@ func createUserIdentificationMiddleware(userDao *users.Dao) routes.Middleware {
 	})
 }
 
+// recordLoginAttempt adds the attempt to the audit trail. A failure to
+// record it is only logged, so that logins keep working if it happens.
+func recordLoginAttempt(guard *logins.Guard, attempt *logins.Attempt) {
+	if err := guard.Record(attempt); err != nil {
+		log.Error("Failed to record login attempt", log.Fields{
+			"username" : attempt.Username,
+			"error" : err,
+		})
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string, code int) {
+	w.WriteHeader(status)
+	w.Write(toJson(Error{
+		Message : message,
+		Code : code,
+	}))
+}
+
+// writeValidationError reports the fields of the request that failed validation.
+func writeValidationError(w http.ResponseWriter, errs models.ValidationErrors) {
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(toJson(Error{
+		Message : "Request contains invalid fields.",
+		Code : CodeInvalidRequest,
+		Fields : errs,
+	}))
+}
+
+func writeInternalError(w http.ResponseWriter) {
+	writeError(w, http.StatusInternalServerError, "An internal server error has occurred.", CodeInternalError)
+}
+
 func toJson(obj interface{}) []byte {
 	objJson, _ := json.Marshal(obj)
 	return objJson
@@ -0,0 +1,88 @@
+package v1
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/seasons"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
+)
+
+const (
+	seasonsPath = "/seasons"
+)
+
+type Season struct {
+	URI            string    `json:"uri"`
+	Name           string    `json:"name"`
+	StartTime      time.Time `json:"startTime"`
+	EndTime        time.Time `json:"endTime"`
+	Carryover      float64   `json:"carryover"`
+	ResetDeviation float64   `json:"resetDeviation"`
+	LeaderboardURI string    `json:"leaderboardUri"`
+}
+
+func addSeasonRoutes(router *routes.Router, v1Path string, seasonDao *seasons.Dao) {
+	router.Path(seasonsPath).HandlerFunc(createGetAllSeasonsHandler(v1Path, seasonDao)).Methods("GET")
+	router.Path(path.Join(seasonsPath, "/{id:[0-9]+}")).HandlerFunc(createGetSeasonHandler(v1Path, seasonDao)).Methods("GET")
+}
+
+func createGetAllSeasonsHandler(v1Path string, seasonDao *seasons.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		all, err := seasonDao.GetAll()
+		if err != nil {
+			log.Error("Failed to fetch seasons from datastore", log.Fields{"error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resources := make([]Season, 0, len(all))
+		for _, season := range all {
+			resources = append(resources, toSeasonResource(v1Path, season))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(resources))
+	}
+}
+
+func createGetSeasonHandler(v1Path string, seasonDao *seasons.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		seasonID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+		season, err := seasonDao.GetByID(seasonID)
+		if err != nil {
+			log.Error("Failed to fetch season from datastore", log.Fields{"season": seasonID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if season == nil {
+			writeError(w, http.StatusNotFound, "Season does not exist.", CodeNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(toSeasonResource(v1Path, season)))
+	}
+}
+
+func seasonURI(v1Path string, season *seasons.Season) string {
+	return path.Join(v1Path, seasonsPath, strconv.FormatUint(season.ID, 10))
+}
+
+func toSeasonResource(v1Path string, season *seasons.Season) Season {
+	return Season{
+		URI:            seasonURI(v1Path, season),
+		Name:           season.Name,
+		StartTime:      season.StartTime,
+		EndTime:        season.EndTime,
+		Carryover:      season.Carryover,
+		ResetDeviation: season.ResetDeviation,
+		LeaderboardURI: path.Join(v1Path, leaderboardsPath) + "?season=" + strconv.FormatUint(season.ID, 10),
+	}
+}
@@ -0,0 +1,84 @@
+package v1
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/crob1140/codewiz-server/arena"
+	"github.com/crob1140/codewiz-server/models/spells"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
+)
+
+const (
+	spellsPath = "/spells"
+)
+
+type Spell struct {
+	URI         string           `json:"uri"`
+	ID          string           `json:"id,omitempty"`
+	Name        string           `json:"name,omitempty"`
+	Description string           `json:"description,omitempty"`
+	ManaCost    int              `json:"manaCost"`
+	Cooldown    int              `json:"cooldown"`
+	Range       int              `json:"range"`
+	Effect      arena.EffectType `json:"effect,omitempty"`
+	Power       int              `json:"power"`
+	Area        int              `json:"area"`
+}
+
+type SpellList struct {
+	Version     string  `json:"version"`
+	MaxEquipped int     `json:"maxEquipped"`
+	Spells      []Spell `json:"spells"`
+}
+
+func addSpellRoutes(router *routes.Router, v1Path string, catalogue *spells.Catalogue) {
+	router.Path(spellsPath).HandlerFunc(createGetAllSpellsHandler(v1Path, catalogue)).Methods("GET")
+	router.Path(path.Join(spellsPath, "/{id}")).HandlerFunc(createGetSpellHandler(v1Path, catalogue)).Methods("GET")
+}
+
+func createGetAllSpellsHandler(v1Path string, catalogue *spells.Catalogue) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		list := SpellList{
+			Version:     catalogue.Version(),
+			MaxEquipped: catalogue.MaxEquipped(),
+			Spells:      make([]Spell, 0, len(catalogue.All())),
+		}
+
+		for _, spell := range catalogue.All() {
+			list.Spells = append(list.Spells, toSpellResource(v1Path, spell))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(list))
+	}
+}
+
+func createGetSpellHandler(v1Path string, catalogue *spells.Catalogue) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		spell := catalogue.Get(mux.Vars(r)["id"])
+		if spell == nil {
+			writeError(w, http.StatusNotFound, "Spell does not exist.", CodeNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(toSpellResource(v1Path, spell)))
+	}
+}
+
+func toSpellResource(v1Path string, spell *spells.Spell) Spell {
+	return Spell{
+		URI:         path.Join(v1Path, spellsPath, spell.ID),
+		ID:          spell.ID,
+		Name:        spell.Name,
+		Description: spell.Description,
+		ManaCost:    spell.ManaCost,
+		Cooldown:    spell.Cooldown,
+		Range:       spell.Range,
+		Effect:      spell.Effect,
+		Power:       spell.Power,
+		Area:        spell.Area,
+	}
+}
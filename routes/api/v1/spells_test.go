@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	paths "path"
+	"testing"
+)
+
+func TestGetAllSpells(t *testing.T) {
+	request := createTestRequest("GET", paths.Join(testAPIPath, "/spells"), "")
+	writer := httptest.NewRecorder()
+
+	testRouter.ServeHTTP(writer, request)
+
+	if status := writer.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var list SpellList
+	if err := json.Unmarshal(writer.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list.Spells) == 0 || list.MaxEquipped <= 0 {
+		t.Fatalf("Expected the catalogue to be listed, got %+v", list)
+	}
+
+	if expected := paths.Join(testAPIPath, "/spells", list.Spells[0].ID); list.Spells[0].URI != expected {
+		t.Errorf("Unexpected spell URI: got %v want %v", list.Spells[0].URI, expected)
+	}
+}
+
+func TestGetSpell_Missing(t *testing.T) {
+	request := createTestRequest("GET", paths.Join(testAPIPath, "/spells/teleport"), "")
+	writer := httptest.NewRecorder()
+
+	testRouter.ServeHTTP(writer, request)
+
+	if status := writer.Code; status != http.StatusNotFound {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+
+	expected := string(toJson(Error{Message: "Spell does not exist.", Code: CodeNotFound}))
+	if writer.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", writer.Body.String(), expected)
+	}
+}
@@ -0,0 +1,216 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/tokens"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
+)
+
+const (
+	tokensPath = "/tokens"
+)
+
+// Token is a personal access token. The secret is only included in the
+// response to the request that created the token.
+type Token struct {
+	URI          string     `json:"uri"`
+	Name         string     `json:"name"`
+	Scopes       []string   `json:"scopes"`
+	CreationTime time.Time  `json:"creationTime"`
+	ExpiryTime   *time.Time `json:"expiryTime,omitempty"`
+	Secret       string     `json:"secret,omitempty"`
+}
+
+// TokenRequest is the body of a request to create a token. The token never
+// expires if no expiry time is given.
+type TokenRequest struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiryTime *time.Time `json:"expiryTime"`
+}
+
+// Tokens with the account scope can list and revoke tokens, so that users
+// with two-factor authentication, who can only log in with their password
+// to create a token, can still revoke one that has leaked. Only a password
+// can be used to create a token.
+func addTokenRoutes(router *routes.Router, v1Path string, tokenDao *tokens.Dao) {
+	router.Path(tokensPath).HandlerFunc(withScope(tokens.Account, createGetAllTokensHandler(v1Path, tokenDao))).Methods("GET")
+	router.Path(tokensPath).HandlerFunc(createAddTokenHandler(v1Path, tokenDao)).Methods("POST")
+	router.Path(path.Join(tokensPath, "/{id:[0-9]+}")).HandlerFunc(withScope(tokens.Account, createRevokeTokenHandler(tokenDao))).Methods("DELETE")
+}
+
+func createGetAllTokensHandler(v1Path string, tokenDao *tokens.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user := context.User
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+			return
+		}
+
+		owned, err := tokenDao.GetByUserID(user.ID)
+		if err != nil {
+			log.Error("Failed to fetch access tokens from datastore", log.Fields{"user": user.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resources := make([]Token, 0, len(owned))
+		for _, token := range owned {
+			resources = append(resources, toTokenResource(v1Path, token))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(resources))
+	}
+}
+
+func createAddTokenHandler(v1Path string, tokenDao *tokens.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user := context.User
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+			return
+		}
+
+		var request TokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not valid JSON.", CodeInvalidRequest)
+			return
+		}
+
+		var expiryTime time.Time
+		if request.ExpiryTime != nil {
+			expiryTime = request.ExpiryTime.UTC()
+		}
+
+		token, secret, err := tokens.NewAccessToken(user.ID, request.Name, request.Scopes, expiryTime)
+		if err != nil {
+			log.Error("Failed to generate access token", log.Fields{"user": user.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if validationErrs := tokens.NewValidator().Validate(token, time.Now()); len(validationErrs) != 0 {
+			writeValidationError(w, validationErrs)
+			return
+		}
+
+		if err := tokenDao.Insert(token); err != nil {
+			log.Error("Failed to insert access token", log.Fields{"user": user.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resource := toTokenResource(v1Path, token)
+		resource.Secret = secret
+
+		w.Header().Set("Location", resource.URI)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(toJson(resource))
+	}
+}
+
+func createRevokeTokenHandler(tokenDao *tokens.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user := context.User
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+			return
+		}
+
+		tokenID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		token, err := tokenDao.GetByID(tokenID)
+		if err != nil {
+			log.Error("Failed to fetch access token from datastore", log.Fields{"token": tokenID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		// Other users' tokens are reported as missing, so that their IDs
+		// are not given away
+		if token == nil || token.UserID != user.ID {
+			writeError(w, http.StatusNotFound, "Access token does not exist.", CodeNotFound)
+			return
+		}
+
+		if err := tokenDao.Delete(token); err != nil {
+			log.Error("Failed to revoke access token", log.Fields{"token": tokenID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// withScope lets requests made with an access token reach the handler as
+// the token's owner, provided that the token was granted the scope.
+// Requests that were authenticated some other way are passed through
+// unchanged, and any route that is not wrapped treats a token as a visitor.
+func withScope(scope string, handler routes.HandlerFunc) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		if token := context.Token; token != nil {
+			if !token.HasScope(scope) {
+				writeError(w, http.StatusForbidden, "Access token does not have the '"+scope+"' scope.", CodeMissingScope)
+				return
+			}
+			context.User = token.Owner
+		}
+
+		handler(w, r, context)
+	}
+}
+
+// bearerToken returns the secret from the request's Authorization header,
+// if it uses the Bearer scheme.
+func bearerToken(r *http.Request) (string, bool) {
+	const scheme = "Bearer "
+
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(scheme) || !strings.EqualFold(header[:len(scheme)], scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(scheme):]), true
+}
+
+// findUsableToken returns the token with the given secret along with its
+// owner, or nil if it has expired or been revoked, or its owner has been
+// deleted or disabled.
+func findUsableToken(secret string, userDao *users.Dao, tokenDao *tokens.Dao) (*tokens.AccessToken, error) {
+	token, err := tokenDao.GetBySecret(secret)
+	if err != nil || token == nil || token.Expired(time.Now()) {
+		return nil, err
+	}
+
+	owner, err := userDao.GetByID(token.UserID)
+	if err != nil || owner == nil || owner.Disabled {
+		return nil, err
+	}
+
+	token.Owner = owner
+	return token, nil
+}
+
+func toTokenResource(v1Path string, token *tokens.AccessToken) Token {
+	resource := Token{
+		URI:          path.Join(v1Path, tokensPath, strconv.FormatUint(token.ID, 10)),
+		Name:         token.Name,
+		Scopes:       token.ScopeList(),
+		CreationTime: token.CreationTime(),
+	}
+
+	if !token.ExpiryTime.IsZero() {
+		expiryTime := token.ExpiryTime
+		resource.ExpiryTime = &expiryTime
+	}
+	return resource
+}
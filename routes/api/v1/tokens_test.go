@@ -0,0 +1,191 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	paths "path"
+	"testing"
+	"time"
+
+	"github.com/crob1140/codewiz-server/models/tokens"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/totp"
+)
+
+func createTestToken(t *testing.T, body string) Token {
+	writer := serveAs("TestUser", "testpassword", "POST", paths.Join(testAPIPath, "/tokens"), body)
+	if status := writer.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	var token Token
+	if err := json.Unmarshal(writer.Body.Bytes(), &token); err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Secret == "" {
+		t.Fatalf("Expected the secret to be returned when the token is created, got %+v", token)
+	}
+	return token
+}
+
+func serveWithToken(secret string, method string, path string, body string) *httptest.ResponseRecorder {
+	request := createTestRequest(method, path, body)
+	request.Header.Set("Authorization", "Bearer "+secret)
+
+	writer := httptest.NewRecorder()
+	testRouter.ServeHTTP(writer, request)
+	return writer
+}
+
+func TestAddToken_InvalidFields(t *testing.T) {
+	writer := serveAs("TestUser", "testpassword", "POST", paths.Join(testAPIPath, "/tokens"),
+		`{"name":"","scopes":["everything"],"expiryTime":"2000-01-01T00:00:00Z"}`)
+
+	if status := writer.Code; status != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	var response Error
+	if err := json.Unmarshal(writer.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"Name", "Scopes", "ExpiryTime"} {
+		if len(response.Fields[field]) == 0 {
+			t.Errorf("Expected %v to be reported as invalid, got %+v", field, response)
+		}
+	}
+}
+
+func TestToken_LimitedToScopes(t *testing.T) {
+	token := createTestToken(t, `{"name":"Read only","scopes":["wizards:read"]}`)
+
+	writer := serveWithToken(token.Secret, "GET", paths.Join(testAPIPath, "/wizards"), "")
+	if status := writer.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	writer = serveWithToken(token.Secret, "POST", paths.Join(testAPIPath, "/wizards"), `{"name":"Token","sex":"F"}`)
+	if status := writer.Code; status != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusForbidden)
+	}
+
+	// Tokens can only manage tokens or accounts with the account scope
+	for _, path := range []string{"/tokens", "/users/1"} {
+		writer = serveWithToken(token.Secret, "GET", paths.Join(testAPIPath, path), "")
+		if status := writer.Code; status != http.StatusForbidden {
+			t.Errorf("%v returned wrong status code: got %v want %v", path, status, http.StatusForbidden)
+		}
+	}
+
+	// and no token can create another
+	writer = serveWithToken(token.Secret, "POST", paths.Join(testAPIPath, "/tokens"), `{"name":"Copy","scopes":["wizards:read"]}`)
+	if status := writer.Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
+
+func TestToken_Revoke(t *testing.T) {
+	token := createTestToken(t, `{"name":"Revoked","scopes":["wizards:read"],"expiryTime":"2999-01-01T00:00:00Z"}`)
+
+	writer := serveAs("TestUser", "testpassword", "DELETE", token.URI, "")
+	if status := writer.Code; status != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+
+	writer = serveWithToken(token.Secret, "GET", paths.Join(testAPIPath, "/wizards"), "")
+	if status := writer.Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+
+	writer = serveAs("TestUser", "testpassword", "GET", paths.Join(testAPIPath, "/tokens"), "")
+	var listed []Token
+	if err := json.Unmarshal(writer.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, other := range listed {
+		if other.URI == token.URI {
+			t.Errorf("Expected revoked tokens to be left out, got %+v", listed)
+		}
+		if other.Secret != "" {
+			t.Errorf("Expected secrets to be left out of the list, got %+v", listed)
+		}
+	}
+}
+
+func TestToken_RevokeAsTwoFactorUser(t *testing.T) {
+	ds := openTestDatastore(t)
+	user := users.NewUser("TwoFactorRevoker", "revokerpassword", "revoker@test.com")
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if _, err := user.EnableTwoFactor(secret, totp.Counter(now)-2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := users.NewDao(ds).Insert(user); err != nil {
+		t.Fatal(err)
+	}
+
+	// A token that has leaked
+	leaked, leakedSecret, err := tokens.NewAccessToken(user.ID, "Leaked", []string{tokens.WizardsRead}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tokens.NewDao(ds).Insert(leaked); err != nil {
+		t.Fatal(err)
+	}
+
+	// The user can only log in with their password to create a token, so
+	// they create one that can manage their tokens
+	code, _ := totp.Code(secret, totp.Counter(now))
+	request := createTestRequest("POST", paths.Join(testAPIPath, "/tokens"), `{"name":"Account","scopes":["account"]}`)
+	request.SetBasicAuth("TwoFactorRevoker", "revokerpassword")
+	request.Header.Set(OneTimeCodeHeader, code)
+
+	writer := httptest.NewRecorder()
+	testRouter.ServeHTTP(writer, request)
+	if status := writer.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	var account Token
+	if err := json.Unmarshal(writer.Body.Bytes(), &account); err != nil {
+		t.Fatal(err)
+	}
+
+	writer = serveWithToken(account.Secret, "GET", paths.Join(testAPIPath, "/tokens"), "")
+	var listed []Token
+	if err := json.Unmarshal(writer.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+
+	var leakedURI string
+	for _, token := range listed {
+		if token.Name == "Leaked" {
+			leakedURI = token.URI
+		}
+	}
+
+	if leakedURI == "" {
+		t.Fatalf("Expected the leaked token to be listed, got %+v", listed)
+	}
+
+	writer = serveWithToken(account.Secret, "DELETE", leakedURI, "")
+	if status := writer.Code; status != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+
+	writer = serveWithToken(leakedSecret, "GET", paths.Join(testAPIPath, "/wizards"), "")
+	if status := writer.Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,381 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/tokens"
+	"github.com/crob1140/codewiz-server/models/tournaments"
+	"github.com/crob1140/codewiz-server/models/wizards"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
+)
+
+const (
+	tournamentsPath = "/tournaments"
+)
+
+type Tournament struct {
+	URI                  string             `json:"uri"`
+	Name                 string             `json:"name"`
+	Format               tournaments.Format `json:"format"`
+	State                tournaments.State  `json:"state"`
+	RegistrationDeadline time.Time          `json:"registrationDeadline"`
+	MaxEntrants          int                `json:"maxEntrants"`
+	WinnerID             uint64             `json:"winnerId,omitempty"`
+	Reason               string             `json:"reason,omitempty"`
+	EntrantsURI          string             `json:"entrantsUri"`
+	MatchesURI           string             `json:"matchesUri"`
+	StandingsURI         string             `json:"standingsUri"`
+}
+
+type TournamentRequest struct {
+	Name                 string             `json:"name"`
+	Format               tournaments.Format `json:"format"`
+	RegistrationDeadline time.Time          `json:"registrationDeadline"`
+	MaxEntrants          int                `json:"maxEntrants"`
+}
+
+type TournamentEntrant struct {
+	WizardID     uint64    `json:"wizardId"`
+	Seed         int       `json:"seed,omitempty"`
+	RegisteredAt time.Time `json:"registeredAt"`
+}
+
+type TournamentEntrantRequest struct {
+	WizardID uint64 `json:"wizardId"`
+}
+
+type TournamentMatch struct {
+	Bracket        tournaments.Bracket    `json:"bracket"`
+	Round          int                    `json:"round"`
+	Slot           int                    `json:"slot"`
+	State          tournaments.MatchState `json:"state"`
+	FirstWizardID  uint64                 `json:"firstWizardId,omitempty"`
+	SecondWizardID uint64                 `json:"secondWizardId,omitempty"`
+	WinnerID       uint64                 `json:"winnerId,omitempty"`
+	ReplayURI      string                 `json:"replayUri,omitempty"`
+}
+
+type TournamentStanding struct {
+	Place    int     `json:"place"`
+	WizardID uint64  `json:"wizardId"`
+	Seed     int     `json:"seed"`
+	Wins     int     `json:"wins"`
+	Draws    int     `json:"draws"`
+	Losses   int     `json:"losses"`
+	Points   float64 `json:"points"`
+}
+
+func addTournamentRoutes(router *routes.Router, v1Path string, wizardDao *wizards.Dao, tournamentDao *tournaments.Dao) {
+	tournamentPath := path.Join(tournamentsPath, "/{id:[0-9]+}")
+
+	router.Path(tournamentsPath).HandlerFunc(createGetAllTournamentsHandler(v1Path, tournamentDao)).Methods("GET")
+	router.Path(tournamentsPath).Use(adminOnly).HandlerFunc(createAddTournamentHandler(v1Path, tournamentDao)).Methods("POST")
+	router.Path(tournamentPath).HandlerFunc(createGetTournamentHandler(v1Path, tournamentDao)).Methods("GET")
+	router.Path(path.Join(tournamentPath, "/entrants")).HandlerFunc(createGetEntrantsHandler(tournamentDao)).Methods("GET")
+	router.Path(path.Join(tournamentPath, "/entrants")).HandlerFunc(withScope(tokens.BattlesRun, createRegisterEntrantHandler(wizardDao, tournamentDao))).Methods("POST")
+	router.Path(path.Join(tournamentPath, "/matches")).HandlerFunc(createGetMatchesHandler(v1Path, tournamentDao)).Methods("GET")
+	router.Path(path.Join(tournamentPath, "/standings")).HandlerFunc(createGetStandingsHandler(tournamentDao)).Methods("GET")
+}
+
+func createGetAllTournamentsHandler(v1Path string, tournamentDao *tournaments.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		all, err := tournamentDao.GetAll()
+		if err != nil {
+			log.Error("Failed to fetch tournaments from datastore", log.Fields{"error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resources := make([]Tournament, 0, len(all))
+		for _, tournament := range all {
+			resources = append(resources, toTournamentResource(v1Path, tournament))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(resources))
+	}
+}
+
+// createAddTournamentHandler opens a new tournament for registration. Only
+// admins can create tournaments.
+func createAddTournamentHandler(v1Path string, tournamentDao *tournaments.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user := context.User
+
+		var request TournamentRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not valid JSON.", CodeInvalidRequest)
+			return
+		}
+
+		tournament := tournaments.NewTournament(request.Name, request.Format, request.RegistrationDeadline, user.ID)
+		tournament.MaxEntrants = request.MaxEntrants
+
+		validationErrs, err := tournaments.NewValidator(tournamentDao).Validate(tournament)
+		if err != nil {
+			log.Error("Failed to validate tournament", log.Fields{"error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if len(validationErrs) != 0 {
+			writeValidationError(w, validationErrs)
+			return
+		}
+
+		if err := tournamentDao.Insert(tournament); err != nil {
+			log.Error("Failed to insert tournament", log.Fields{"error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resource := toTournamentResource(v1Path, tournament)
+		w.Header().Set("Location", resource.URI)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(toJson(resource))
+	}
+}
+
+func createGetTournamentHandler(v1Path string, tournamentDao *tournaments.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		tournament, ok := findTournament(w, r, tournamentDao)
+		if !ok {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(toTournamentResource(v1Path, tournament)))
+	}
+}
+
+func createGetEntrantsHandler(tournamentDao *tournaments.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		tournament, ok := findTournament(w, r, tournamentDao)
+		if !ok {
+			return
+		}
+
+		entrants, err := tournamentDao.GetEntrants(tournament.ID)
+		if err != nil {
+			log.Error("Failed to fetch tournament entrants from datastore", log.Fields{"tournament": tournament.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resources := make([]TournamentEntrant, 0, len(entrants))
+		for _, entrant := range entrants {
+			resources = append(resources, toTournamentEntrantResource(entrant))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(resources))
+	}
+}
+
+// createRegisterEntrantHandler enters one of the user's wizards into a
+// tournament that is still open for registration.
+func createRegisterEntrantHandler(wizardDao *wizards.Dao, tournamentDao *tournaments.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user := context.User
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+			return
+		}
+
+		tournament, ok := findTournament(w, r, tournamentDao)
+		if !ok {
+			return
+		}
+
+		var request TournamentEntrantRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not valid JSON.", CodeInvalidRequest)
+			return
+		}
+
+		wizard, err := wizardDao.GetByID(request.WizardID)
+		if err != nil {
+			log.Error("Failed to fetch wizard from datastore", log.Fields{"wizard": request.WizardID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if wizard == nil {
+			writeError(w, http.StatusNotFound, "Wizard does not exist.", CodeNotFound)
+			return
+		}
+
+		if wizard.OwnerID != user.ID {
+			writeError(w, http.StatusUnauthorized, "User does not have permission to access this resource.", CodeOwnerOnly)
+			return
+		}
+
+		if wizard.ActiveScriptID == 0 {
+			writeError(w, http.StatusBadRequest, "The wizard must have an active script to enter a tournament.", CodeNoActiveScript)
+			return
+		}
+
+		if !tournament.IsOpen(time.Now()) {
+			writeError(w, http.StatusConflict, "Registration for the tournament has closed.", CodeRegistrationClosed)
+			return
+		}
+
+		entrants, err := tournamentDao.GetEntrants(tournament.ID)
+		if err != nil {
+			log.Error("Failed to fetch tournament entrants from datastore", log.Fields{"tournament": tournament.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		for _, entrant := range entrants {
+			if entrant.OwnerID == user.ID {
+				writeError(w, http.StatusConflict, "The user already has a wizard registered in the tournament.", CodeAlreadyRegistered)
+				return
+			}
+		}
+
+		if tournament.MaxEntrants != 0 && len(entrants) >= tournament.MaxEntrants {
+			writeError(w, http.StatusConflict, "The tournament is full.", CodeRegistrationClosed)
+			return
+		}
+
+		entrant := tournaments.NewEntrant(tournament.ID, wizard.ID, user.ID)
+		if err := tournamentDao.InsertEntrant(entrant); err != nil {
+			log.Error("Failed to insert tournament entrant", log.Fields{"tournament": tournament.ID, "wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write(toJson(toTournamentEntrantResource(entrant)))
+	}
+}
+
+func createGetMatchesHandler(v1Path string, tournamentDao *tournaments.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		tournament, ok := findTournament(w, r, tournamentDao)
+		if !ok {
+			return
+		}
+
+		matches, err := tournamentDao.GetMatches(tournament.ID)
+		if err != nil {
+			log.Error("Failed to fetch tournament matches from datastore", log.Fields{"tournament": tournament.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resources := make([]TournamentMatch, 0, len(matches))
+		for _, match := range matches {
+			resource := TournamentMatch{
+				Bracket:        match.Bracket,
+				Round:          match.Round,
+				Slot:           match.Slot,
+				State:          match.State,
+				FirstWizardID:  match.FirstWizardID,
+				SecondWizardID: match.SecondWizardID,
+				WinnerID:       match.WinnerID,
+			}
+
+			if match.BattleID != 0 {
+				resource.ReplayURI = path.Join(v1Path, battlesPath, strconv.FormatUint(match.BattleID, 10), "/replay")
+			}
+			resources = append(resources, resource)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(resources))
+	}
+}
+
+// createGetStandingsHandler returns the entrants ranked by their results.
+// The standings are final once the tournament has finished.
+func createGetStandingsHandler(tournamentDao *tournaments.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		tournament, ok := findTournament(w, r, tournamentDao)
+		if !ok {
+			return
+		}
+
+		entrants, err := tournamentDao.GetEntrants(tournament.ID)
+		if err != nil {
+			log.Error("Failed to fetch tournament entrants from datastore", log.Fields{"tournament": tournament.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		matches, err := tournamentDao.GetMatches(tournament.ID)
+		if err != nil {
+			log.Error("Failed to fetch tournament matches from datastore", log.Fields{"tournament": tournament.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		standings := tournaments.Standings(tournament.Format, matches, entrants)
+		resources := make([]TournamentStanding, 0, len(standings))
+		for _, standing := range standings {
+			resources = append(resources, TournamentStanding{
+				Place:    standing.Place,
+				WizardID: standing.WizardID,
+				Seed:     standing.Seed,
+				Wins:     standing.Wins,
+				Draws:    standing.Draws,
+				Losses:   standing.Losses,
+				Points:   standing.Points,
+			})
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(resources))
+	}
+}
+
+// findTournament looks up the tournament in the request path, and writes
+// an error response if it cannot be found.
+func findTournament(w http.ResponseWriter, r *http.Request, tournamentDao *tournaments.Dao) (*tournaments.Tournament, bool) {
+	tournamentID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	tournament, err := tournamentDao.GetByID(tournamentID)
+	if err != nil {
+		log.Error("Failed to fetch tournament from datastore", log.Fields{"tournament": tournamentID, "error": err})
+		writeInternalError(w)
+		return nil, false
+	}
+
+	if tournament == nil {
+		writeError(w, http.StatusNotFound, "Tournament does not exist.", CodeNotFound)
+		return nil, false
+	}
+
+	return tournament, true
+}
+
+func toTournamentResource(v1Path string, tournament *tournaments.Tournament) Tournament {
+	uri := path.Join(v1Path, tournamentsPath, strconv.FormatUint(tournament.ID, 10))
+	return Tournament{
+		URI:                  uri,
+		Name:                 tournament.Name,
+		Format:               tournament.Format,
+		State:                tournament.State,
+		RegistrationDeadline: tournament.RegistrationDeadline,
+		MaxEntrants:          tournament.MaxEntrants,
+		WinnerID:             tournament.WinnerID,
+		Reason:               tournament.Reason,
+		EntrantsURI:          path.Join(uri, "/entrants"),
+		MatchesURI:           path.Join(uri, "/matches"),
+		StandingsURI:         path.Join(uri, "/standings"),
+	}
+}
+
+func toTournamentEntrantResource(entrant *tournaments.Entrant) TournamentEntrant {
+	return TournamentEntrant{
+		WizardID:     entrant.WizardID,
+		Seed:         entrant.Seed,
+		RegisteredAt: entrant.CreationTime(),
+	}
+}
@@ -1,81 +1,399 @@
 package v1
 
 import (
-	"path"
-	"github.com/gorilla/mux"
+	"encoding/json"
 	"net/http"
+	"path"
 	"strconv"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models"
+	"github.com/crob1140/codewiz-server/models/matchmaking"
+	"github.com/crob1140/codewiz-server/models/tokens"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/models/usersessions"
+	"github.com/crob1140/codewiz-server/models/wizards"
 	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
 )
 
 const (
 	usersPath = "/users"
+
+	defaultUserLimit = 50
+	maxUserLimit     = 100
 )
 
 type User struct {
-	Username string `json:"username"`
-	Name string `json:"name"`
-	TimeZone string `json:"timeZone"`
-	Email string	`json:"emailAddress"`
+	URI      string   `json:"uri"`
+	Username string   `json:"username"`
+	Name     string   `json:"name"`
+	TimeZone string   `json:"timeZone"`
+	Email    string   `json:"emailAddress"`
+	Verified bool     `json:"emailVerified"`
+	Roles    []string `json:"roles"`
+	Version  int64    `json:"version"`
+}
+
+type UserList struct {
+	Users []User `json:"users"`
+	Next  string `json:"next,omitempty"`
 }
 
+// UserRequest is the body of a request to register or update a user. The
+// current password is only needed to change the password of the user
+// making the request. An update that gives the version of the user it was
+// based on fails with a conflict if the user has been changed since.
+type UserRequest struct {
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	CurrentPassword string `json:"currentPassword"`
+	Name            string `json:"name"`
+	TimeZone        string `json:"timeZone"`
+	Email           string `json:"emailAddress"`
+	Version         int64  `json:"version"`
+}
 
-func addUserRoutes(router *routes.Router) {
-	router.Path(usersPath).HandlerFunc(getAllUsersHandler).Methods("GET")
-	router.Path(usersPath).HandlerFunc(addUserHandler).Methods("POST")
-	router.Path(path.Join(usersPath, "/{id:[0-9]+}")).HandlerFunc(getUserHandler).Methods("GET")
-	router.Path(path.Join(usersPath, "/{id:[0-9]+}")).HandlerFunc(modifyUserHandler).Methods("POST", "PUT")
+// RolesRequest is the body of a request to change the roles that have been
+// granted to a user. Every user has the standard role without it being
+// granted.
+type RolesRequest struct {
+	Roles []string `json:"roles"`
 }
 
-func getAllUsersHandler(w http.ResponseWriter, r *http.Request, context *routes.Context) {
-	user := context.User
+func addUserRoutes(router *routes.Router, v1Path string, userDao *users.Dao, wizardDao *wizards.Dao, queueDao *matchmaking.Dao, sessionDao *usersessions.Dao) {
+	router.Path(usersPath).Use(adminOnly).HandlerFunc(createGetAllUsersHandler(v1Path, userDao)).Methods("GET")
+	router.Path(usersPath).HandlerFunc(createAddUserHandler(v1Path, userDao)).Methods("POST")
+
+	userPath := path.Join(usersPath, "/{id:[0-9]+}")
+	router.Path(userPath).HandlerFunc(withScope(tokens.Account, createGetUserHandler(v1Path, userDao))).Methods("GET")
+	router.Path(userPath).HandlerFunc(withScope(tokens.Account, createModifyUserHandler(v1Path, userDao, sessionDao))).Methods("POST", "PUT")
+	router.Path(userPath).HandlerFunc(withScope(tokens.Account, createDeleteUserHandler(userDao, wizardDao, queueDao, sessionDao))).Methods("DELETE")
+	router.Path(path.Join(userPath, "/roles")).Use(adminOnly).HandlerFunc(createSetRolesHandler(v1Path, userDao)).Methods("PUT")
+}
+
+// createGetAllUsersHandler returns a page of every user, oldest first. It
+// accepts the query parameters search, cursor and limit, where search
+// matches part of a username, name or email address.
+func createGetAllUsersHandler(v1Path string, userDao *users.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		params := r.URL.Query()
+		paging, ok := parsePage(w, params, defaultUserLimit, maxUserLimit)
+		if !ok {
+			return
+		}
+
+		// Fetch one more user than is needed to find out whether there is
+		// another page after this one. The search is abandoned if the
+		// client goes away.
+		found, err := userDao.WithContext(r.Context()).Search(params.Get("search"), paging.AfterID, paging.Limit+1)
+		if err != nil {
+			log.Error("Failed to fetch users from datastore", log.Fields{"error": err})
+			writeInternalError(w)
+			return
+		}
+
+		list := UserList{Users: make([]User, 0, paging.Limit)}
+		for i, user := range found {
+			if i == paging.Limit {
+				list.Next = nextPageURI(v1Path+usersPath, params, found[i-1].ID)
+				break
+			}
+			list.Users = append(list.Users, toUserResource(v1Path, user))
+		}
 
-	isAuthorised := true // user.Role == users.AdminRole
-	if isAuthorised{
 		w.WriteHeader(http.StatusOK)
-		w.Write(toJson(User{
-			Username : user.Username,
-			// Name : "TODO",
-			Email : user.Email,
-			// TimeZone : "TODO",	
-		}))
-	} else {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write(toJson(Error{
-			Message : "Resource is only available to admin users.",
-			Code : CodeAdminOnly,
-		}))
+		w.Write(toJson(list))
 	}
 }
 
+// createAddUserHandler registers a new user. No login is required.
+func createAddUserHandler(v1Path string, userDao *users.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		request := UserRequest{TimeZone: users.DefaultTimeZone}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not valid JSON.", CodeInvalidRequest)
+			return
+		}
+
+		user := users.NewUser(request.Username, request.Password, request.Email)
+		user.Name = request.Name
+		user.TimeZone = request.TimeZone
+
+		validator := users.NewValidator(userDao)
+		validationErrs, err := validator.Validate(user)
+		if err != nil {
+			log.Error("Failed to validate user", log.Fields{"error": err})
+			writeInternalError(w)
+			return
+		}
+
+		for field, problems := range validator.ValidatePassword(request.Password) {
+			validationErrs[field] = append(validationErrs[field], problems...)
+		}
 
-func addUserHandler(w http.ResponseWriter, r *http.Request, context *routes.Context) {
-	// TODO: auth with user??
-	w.Write([]byte(`{"user" : true}`))
+		if len(validationErrs) != 0 {
+			writeValidationError(w, validationErrs)
+			return
+		}
+
+		// The user is checked again as they are inserted, in case someone
+		// else has registered the username in the meantime
+		validationErrs, err = userDao.InsertValid(user)
+		if err != nil {
+			log.Error("Failed to insert user", log.Fields{"error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if len(validationErrs) != 0 {
+			writeValidationError(w, validationErrs)
+			return
+		}
+
+		resource := toUserResource(v1Path, user)
+		w.Header().Set("Location", resource.URI)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(toJson(resource))
+	}
 }
 
-func getUserHandler(w http.ResponseWriter, r *http.Request, context *routes.Context) {
-	user := context.User
-	pathUserID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 32) 
+func createGetUserHandler(v1Path string, userDao *users.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user, ok := findAccessibleUser(w, r, context, userDao)
+		if !ok {
+			return
+		}
 
-	isAuthorised := user != nil && (user.ID == pathUserID) // || user.Role == users.AdminRole)
-	if isAuthorised{
 		w.WriteHeader(http.StatusOK)
-		w.Write(toJson(User{
-			Username : user.Username,
-			// Name : "TODO",
-			Email : user.Email,
-			// TimeZone : "TODO",	
-		}))
-	} else {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write(toJson(Error{
-			Message : "User does not have permission to access this resource.",
-			Code : CodeOwnerOnly,
-		}))
+		w.Write(toJson(toUserResource(v1Path, user)))
 	}
 }
 
-func modifyUserHandler(w http.ResponseWriter, r *http.Request, context *routes.Context) {
-	w.Write([]byte(`{"user" : true}`))
+// createModifyUserHandler updates a user's profile. Fields that are left
+// out of the request keep their current values, and usernames cannot be
+// changed. Users must give their current password to change it; admins
+// can reset other users' passwords without it. Changing the password logs
+// the user out of every website session.
+func createModifyUserHandler(v1Path string, userDao *users.Dao, sessionDao *usersessions.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user, ok := findAccessibleUser(w, r, context, userDao)
+		if !ok {
+			return
+		}
+
+		request := UserRequest{Name: user.Name, TimeZone: user.TimeZone, Email: user.Email}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not valid JSON.", CodeInvalidRequest)
+			return
+		}
+
+		user.Name = request.Name
+		user.TimeZone = request.TimeZone
+		user.SetEmail(request.Email)
+		if request.Version != 0 {
+			user.SetVersion(request.Version)
+		}
+
+		validator := users.NewValidator(userDao)
+		validationErrs := make(models.ValidationErrors)
+		if request.Password != "" {
+			if user.ID == context.User.ID && !user.VerifyPassword(request.CurrentPassword) {
+				validationErrs.Add("CurrentPassword", "The current password is incorrect.")
+			}
+
+			for field, problems := range validator.ValidatePassword(request.Password) {
+				validationErrs[field] = append(validationErrs[field], problems...)
+			}
+
+			if err := user.SetPassword(request.Password); err != nil {
+				log.Error("Failed to hash password", log.Fields{"user": user.ID, "error": err})
+				writeInternalError(w)
+				return
+			}
+		}
+
+		profileErrs, err := validator.Validate(user)
+		if err != nil {
+			log.Error("Failed to validate user", log.Fields{"user": user.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		for field, problems := range profileErrs {
+			validationErrs[field] = append(validationErrs[field], problems...)
+		}
+
+		if len(validationErrs) != 0 {
+			writeValidationError(w, validationErrs)
+			return
+		}
+
+		if err := userDao.Update(user); err == datastore.ErrConflict {
+			writeError(w, http.StatusConflict, "User has been changed since it was fetched.", CodeEditConflict)
+			return
+		} else if err != nil {
+			log.Error("Failed to update user", log.Fields{"user": user.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if request.Password != "" {
+			if err := sessionDao.DeleteByUserID(user.ID); err != nil {
+				log.Error("Failed to revoke sessions", log.Fields{"user": user.ID, "error": err})
+				writeInternalError(w)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(toUserResource(v1Path, user)))
+	}
+}
+
+// createDeleteUserHandler deletes a user along with their wizards and
+// sessions.
+func createDeleteUserHandler(userDao *users.Dao, wizardDao *wizards.Dao, queueDao *matchmaking.Dao, sessionDao *usersessions.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user, ok := findAccessibleUser(w, r, context, userDao)
+		if !ok {
+			return
+		}
+
+		// Everything is deleted in one transaction, so that a failure cannot
+		// leave a user who can still log in without their wizards, or
+		// wizards whose owner has gone
+		err := userDao.DB.WithTransaction(func(tx *datastore.DB) error {
+			wizardDao, queueDao := wizardDao.WithTx(tx), queueDao.WithTx(tx)
+			owned, err := wizardDao.GetByOwnerID(user.ID)
+			if err != nil {
+				return err
+			}
+
+			for _, wizard := range owned {
+				if err := deleteWizard(wizard, wizardDao, queueDao); err != nil {
+					return err
+				}
+			}
+
+			if err := sessionDao.WithTx(tx).DeleteByUserID(user.ID); err != nil {
+				return err
+			}
+			return userDao.WithTx(tx).Delete(user)
+		})
+
+		if err == datastore.ErrConflict {
+			writeError(w, http.StatusConflict, "User has been changed since it was fetched.", CodeEditConflict)
+			return
+		} else if err != nil {
+			log.Error("Failed to delete user", log.Fields{"user": user.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// createSetRolesHandler replaces the roles that have been granted to a
+// user. Admins cannot take the admin role away from themselves, so that
+// there is always at least one admin.
+func createSetRolesHandler(v1Path string, userDao *users.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		userID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		user, err := userDao.GetByID(userID)
+		if err != nil {
+			log.Error("Failed to fetch user from datastore", log.Fields{"user": userID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if user == nil {
+			writeError(w, http.StatusNotFound, "User does not exist.", CodeNotFound)
+			return
+		}
+
+		var request RolesRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not valid JSON.", CodeInvalidRequest)
+			return
+		}
+
+		user.SetRoles(request.Roles)
+
+		validationErrs, err := users.NewValidator(userDao).Validate(user)
+		if err != nil {
+			log.Error("Failed to validate user", log.Fields{"user": user.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if user.ID == context.User.ID && !user.HasRole(users.Admin) {
+			validationErrs.Add("Roles", "Admins cannot remove their own admin role.")
+		}
+
+		if len(validationErrs) != 0 {
+			writeValidationError(w, validationErrs)
+			return
+		}
+
+		if err := userDao.Update(user); err == datastore.ErrConflict {
+			writeError(w, http.StatusConflict, "User has been changed since it was fetched.", CodeEditConflict)
+			return
+		} else if err != nil {
+			log.Error("Failed to update user roles", log.Fields{"user": user.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(toUserResource(v1Path, user)))
+	}
+}
+
+// findAccessibleUser fetches the user named in the request path, and
+// writes an error response unless it is the current user or the current
+// user is an admin.
+func findAccessibleUser(w http.ResponseWriter, r *http.Request, context *routes.Context, userDao *users.Dao) (*users.User, bool) {
+	currentUser := context.User
+	if currentUser == nil {
+		writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+		return nil, false
+	}
+
+	// Check permission first, so that other users cannot find out which
+	// IDs are in use
+	userID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if userID != currentUser.ID && !currentUser.HasRole(users.Admin) {
+		writeError(w, http.StatusUnauthorized, "User does not have permission to access this resource.", CodeOwnerOnly)
+		return nil, false
+	}
+
+	user, err := userDao.WithContext(r.Context()).GetByID(userID)
+	if err != nil {
+		log.Error("Failed to fetch user from datastore", log.Fields{"user": userID, "error": err})
+		writeInternalError(w)
+		return nil, false
+	}
+
+	if user == nil {
+		writeError(w, http.StatusNotFound, "User does not exist.", CodeNotFound)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func toUserResource(v1Path string, user *users.User) User {
+	return User{
+		URI:      path.Join(v1Path, usersPath, strconv.FormatUint(user.ID, 10)),
+		Username: user.Username,
+		Name:     user.Name,
+		TimeZone: user.TimeZone,
+		Email:    user.Email,
+		Verified: user.EmailVerified,
+		Roles:    user.Roles(),
+		Version:  user.Version(),
+	}
 }
@@ -7,12 +7,29 @@ import (
     "strings"
 	"net/http"
     "encoding/base64"
+    "encoding/json"
+    "strconv"
+    "time"
 	"net/http/httptest"
     "github.com/crob1140/codewiz-server/config"
     "github.com/crob1140/codewiz-server/config/keys"
     "github.com/crob1140/codewiz-server/datastore"
+    "github.com/crob1140/codewiz-server/live"
+    "github.com/crob1140/codewiz-server/models/jobs"
+    "github.com/crob1140/codewiz-server/models/leaderboards"
+    "github.com/crob1140/codewiz-server/models/logins"
+    "github.com/crob1140/codewiz-server/models/matchmaking"
+    "github.com/crob1140/codewiz-server/models/ratings"
+    "github.com/crob1140/codewiz-server/models/replays"
+    "github.com/crob1140/codewiz-server/models/seasons"
+    "github.com/crob1140/codewiz-server/models/spells"
+    "github.com/crob1140/codewiz-server/models/tokens"
+    "github.com/crob1140/codewiz-server/models/tournaments"
     "github.com/crob1140/codewiz-server/models/users"
+    "github.com/crob1140/codewiz-server/models/usersessions"
+    "github.com/crob1140/codewiz-server/models/wizards"
     "github.com/crob1140/codewiz-server/routes"
+    "github.com/crob1140/codewiz-server/totp"
     _ "github.com/mattn/go-sqlite3"
 )
 
@@ -22,7 +39,9 @@ const (
 
 var (
     testUser = users.NewUser("TestUser", "testpassword", "test@test.com")
-    testAdmin = users.NewUser("TestAdmin", "testpassword", "test@test.com")
+    testAdmin = users.NewUser("TestAdmin", "testpassword", "admin@test.com")
+    testSecureAdmin = users.NewUser("SecureAdmin", "testpassword", "secureadmin@test.com")
+    testAdminToken string // has the admin scope, and belongs to testSecureAdmin
     testRouter *routes.Router   
 )
 
@@ -46,8 +65,8 @@ func TestGetUser_AsVisitor(t *testing.T) {
     }
 
     expected := string(toJson(Error{
-        Message : "Current user does not have permission to access this resource.",
-        Code : CodeOwnerOnly,
+        Message : "Login is required to access this resource.",
+        Code : CodeLoginRequired,
     }))
 
     if writer.Body.String() != expected {
@@ -57,10 +76,35 @@ func TestGetUser_AsVisitor(t *testing.T) {
 }
 
 func TestGetUser_AsAdmin(t *testing.T) {
-    // TODO: need to implement admin role
+    requestPath := paths.Join(testAPIPath, "/users/1")
+    writer := serveAs("TestAdmin", "testpassword", "GET", requestPath, "")
+
+    if status := writer.Code; status != http.StatusOK {
+        t.Errorf("handler returned wrong status code: got %v want %v",
+            status, http.StatusOK)
+    }
+
+    expected := string(toJson(User{
+        URI : requestPath,
+        Username : "TestUser",
+        TimeZone : "UTC",
+        Email : "test@test.com",
+        Roles : []string{users.Standard},
+        Version : 1,
+    }))
+
+    if writer.Body.String() != expected {
+        t.Errorf("handler returned unexpected body: got %v want %v",
+            writer.Body.String(), expected)
+    }
 }
 
 func TestGetUser_AsDifferentUser(t *testing.T) {
+    otherUser := users.NewUser("OtherUser", "otherpassword", "other@test.com")
+    if err := users.NewDao(openTestDatastore(t)).Insert(otherUser); err != nil {
+        t.Fatal(err)
+    }
+
     requestPath := paths.Join(testAPIPath, "/users/1")
     request := createTestRequest("GET", requestPath, "")
 
@@ -70,14 +114,14 @@ func TestGetUser_AsDifferentUser(t *testing.T) {
     writer := httptest.NewRecorder()
     testRouter.ServeHTTP(writer, request)
 
-    if status := writer.Code; status != http.StatusOK {
+    if status := writer.Code; status != http.StatusUnauthorized {
         t.Errorf("handler returned wrong status code: got %v want %v",
-            status, http.StatusOK)
+            status, http.StatusUnauthorized)
     }
 
-    expected := string(toJson(User{
-        Username : "TestUser",
-        Email : "test@test.com",
+    expected := string(toJson(Error{
+        Message : "User does not have permission to access this resource.",
+        Code : CodeOwnerOnly,
     }))
 
     if writer.Body.String() != expected {
@@ -96,14 +140,18 @@ func TestGetUser_AsMatchingUser(t *testing.T) {
     writer := httptest.NewRecorder()
     testRouter.ServeHTTP(writer, request)
 
-    if writer.Code != http.StatusOK {
+    if status := writer.Code; status != http.StatusOK {
         t.Errorf("handler returned wrong status code: got %v want %v",
             status, http.StatusOK)
     }
 
     expected := string(toJson(User{
+        URI : requestPath,
         Username : "TestUser",
+        TimeZone : "UTC",
         Email : "test@test.com",
+        Roles : []string{users.Standard},
+        Version : 1,
     }))
 
     if writer.Body.String() != expected {
@@ -116,6 +164,259 @@ func TestGetUser_UserDoesNotExist(t *testing.T) {
 
 }
 
+func TestAddUser(t *testing.T) {
+    writer := serveAs("", "", "POST", paths.Join(testAPIPath, "/users"),
+        `{"username":"NewUser","password":"newpassword","name":"New User","timeZone":"Australia/Sydney","emailAddress":"new@test.com"}`)
+
+    if status := writer.Code; status != http.StatusCreated {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusCreated)
+    }
+
+    var user User
+    if err := json.Unmarshal(writer.Body.Bytes(), &user); err != nil {
+        t.Fatal(err)
+    }
+
+    if user.Name != "New User" || user.TimeZone != "Australia/Sydney" || writer.Header().Get("Location") != user.URI {
+        t.Errorf("handler returned unexpected user: got %+v", user)
+    }
+
+    writer = serveAs("NewUser", "newpassword", "GET", user.URI, "")
+    if status := writer.Code; status != http.StatusOK {
+        t.Errorf("handler returned wrong status code: got %v want %v",
+            status, http.StatusOK)
+    }
+}
+
+func TestAddUser_InvalidFields(t *testing.T) {
+    writer := serveAs("", "", "POST", paths.Join(testAPIPath, "/users"),
+        `{"username":"TestUser","password":"short","timeZone":"Nowhere/Special","emailAddress":"taken@test.com"}`)
+
+    if status := writer.Code; status != http.StatusBadRequest {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusBadRequest)
+    }
+
+    var response Error
+    if err := json.Unmarshal(writer.Body.Bytes(), &response); err != nil {
+        t.Fatal(err)
+    }
+
+    for _, field := range []string{"Username", "Password", "TimeZone"} {
+        if len(response.Fields[field]) == 0 {
+            t.Errorf("Expected %v to be reported as invalid, got %+v", field, response)
+        }
+    }
+}
+
+func TestModifyUser_PasswordChangeRequiresCurrentPassword(t *testing.T) {
+    dao := users.NewDao(openTestDatastore(t))
+    user := users.NewUser("ChangingUser", "oldpassword", "changing@test.com")
+    if err := dao.Insert(user); err != nil {
+        t.Fatal(err)
+    }
+    userPath := paths.Join(testAPIPath, "/users", strconv.FormatUint(user.ID, 10))
+
+    sessionDao := usersessions.NewDao(openTestDatastore(t))
+    session := &usersessions.Session{UserID : user.ID, Hash : "changing-session", ExpiryTime : time.Now().Add(time.Hour)}
+    if err := sessionDao.Insert(session); err != nil {
+        t.Fatal(err)
+    }
+
+    writer := serveAs("ChangingUser", "oldpassword", "PUT", userPath,
+        `{"password":"newpassword","currentPassword":"wrongpassword"}`)
+    if status := writer.Code; status != http.StatusBadRequest {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusBadRequest)
+    }
+
+    writer = serveAs("ChangingUser", "oldpassword", "PUT", userPath,
+        `{"password":"newpassword","currentPassword":"oldpassword","name":"Changed"}`)
+    if status := writer.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusOK)
+    }
+
+    changed, err := dao.GetByID(user.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if !changed.VerifyPassword("newpassword") || changed.Name != "Changed" || changed.Email != "changing@test.com" {
+        t.Errorf("Expected the password and name to change, got %+v", changed)
+    }
+
+    // Changing the password logs the user out of the website
+    remaining, err := sessionDao.GetByUserID(user.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(remaining) != 0 {
+        t.Errorf("Expected the user's sessions to be revoked, got %+v", remaining)
+    }
+}
+
+func TestDeleteUser(t *testing.T) {
+    writer := serveAs("", "", "POST", paths.Join(testAPIPath, "/users"),
+        `{"username":"LeavingUser","password":"leavingpassword","emailAddress":"leaving@test.com"}`)
+    if status := writer.Code; status != http.StatusCreated {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusCreated)
+    }
+    userPath := writer.Header().Get("Location")
+
+    writer = serveAs("LeavingUser", "leavingpassword", "DELETE", userPath, "")
+    if status := writer.Code; status != http.StatusNoContent {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusNoContent)
+    }
+
+    // Deleted users can no longer log in
+    writer = serveAs("LeavingUser", "leavingpassword", "GET", userPath, "")
+    if status := writer.Code; status != http.StatusUnauthorized {
+        t.Errorf("handler returned wrong status code: got %v want %v",
+            status, http.StatusUnauthorized)
+    }
+}
+
+func TestDeleteUser_FailureKeepsWizards(t *testing.T) {
+    writer := serveAs("", "", "POST", paths.Join(testAPIPath, "/users"),
+        `{"username":"StuckUser","password":"stuckpassword","emailAddress":"stuck@test.com"}`)
+    if status := writer.Code; status != http.StatusCreated {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusCreated)
+    }
+    userPath := writer.Header().Get("Location")
+
+    writer = serveAs("StuckUser", "stuckpassword", "POST", paths.Join(testAPIPath, "/wizards"), `{"name":"Stuck","sex":"F"}`)
+    if status := writer.Code; status != http.StatusCreated {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusCreated)
+    }
+    wizardPath := writer.Header().Get("Location")
+
+    // The user is deleted last, after their wizards
+    ds := openTestDatastore(t)
+    if _, err := ds.Exec(`CREATE TRIGGER FailStuckUserDeletion BEFORE UPDATE OF Status ON Users
+        WHEN OLD.Username = 'StuckUser' BEGIN SELECT RAISE(ABORT, 'The user cannot be deleted.'); END`); err != nil {
+        t.Fatal(err)
+    }
+    defer ds.Exec("DROP TRIGGER FailStuckUserDeletion")
+
+    writer = serveAs("StuckUser", "stuckpassword", "DELETE", userPath, "")
+    if status := writer.Code; status != http.StatusInternalServerError {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusInternalServerError)
+    }
+
+    writer = serveAs("StuckUser", "stuckpassword", "GET", wizardPath, "")
+    if status := writer.Code; status != http.StatusOK {
+        t.Errorf("Expected the wizard to be kept when the user could not be deleted, got status %v", status)
+    }
+}
+
+func TestGetAllUsers_AsNonAdmin(t *testing.T) {
+    writer := serveAs("TestUser", "testpassword", "GET", paths.Join(testAPIPath, "/users"), "")
+
+    if status := writer.Code; status != http.StatusUnauthorized {
+        t.Errorf("handler returned wrong status code: got %v want %v",
+            status, http.StatusUnauthorized)
+    }
+
+    expected := string(toJson(Error{
+        Message : "Resource is only available to admin users.",
+        Code : CodeAdminOnly,
+    }))
+
+    if writer.Body.String() != expected {
+        t.Errorf("handler returned unexpected body: got %v want %v",
+            writer.Body.String(), expected)
+    }
+}
+
+func TestGetAllUsers_AsAdminWithoutTwoFactor(t *testing.T) {
+    writer := serveAs("TestAdmin", "testpassword", "GET", paths.Join(testAPIPath, "/users"), "")
+
+    if status := writer.Code; status != http.StatusUnauthorized {
+        t.Errorf("handler returned wrong status code: got %v want %v",
+            status, http.StatusUnauthorized)
+    }
+
+    var response Error
+    if err := json.Unmarshal(writer.Body.Bytes(), &response); err != nil {
+        t.Fatal(err)
+    }
+
+    if response.Code != CodeTwoFactorRequired {
+        t.Errorf("Unexpected error code: got %v want %v", response.Code, CodeTwoFactorRequired)
+    }
+}
+
+func TestGetAllUsers_AsAdmin(t *testing.T) {
+    writer := serveWithToken(testAdminToken, "GET", paths.Join(testAPIPath, "/users") + "?search=test.com", "")
+
+    if status := writer.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusOK)
+    }
+
+    var list UserList
+    if err := json.Unmarshal(writer.Body.Bytes(), &list); err != nil {
+        t.Fatal(err)
+    }
+
+    if len(list.Users) == 0 || list.Users[0].Username != "TestUser" {
+        t.Errorf("Expected the users to be listed oldest first, got %+v", list)
+    }
+}
+
+func TestSetRoles(t *testing.T) {
+    dao := users.NewDao(openTestDatastore(t))
+    user := users.NewUser("PromotedUser", "promotedpassword", "promoted@test.com")
+    if err := dao.Insert(user); err != nil {
+        t.Fatal(err)
+    }
+    rolesPath := paths.Join(testAPIPath, "/users", strconv.FormatUint(user.ID, 10), "/roles")
+
+    // Only admins can grant roles
+    writer := serveAs("PromotedUser", "promotedpassword", "PUT", rolesPath, `{"roles":["admin"]}`)
+    if status := writer.Code; status != http.StatusUnauthorized {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusUnauthorized)
+    }
+
+    writer = serveWithToken(testAdminToken, "PUT", rolesPath, `{"roles":["moderator","superuser"]}`)
+    if status := writer.Code; status != http.StatusBadRequest {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusBadRequest)
+    }
+
+    writer = serveWithToken(testAdminToken, "PUT", rolesPath, `{"roles":["moderator"]}`)
+    if status := writer.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v",
+            status, http.StatusOK)
+    }
+
+    promoted, err := dao.GetByID(user.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if !promoted.HasRole(users.Moderator) || promoted.HasRole(users.Admin) {
+        t.Errorf("Expected the user to become a moderator, got %v", promoted.Roles())
+    }
+
+    // Admins cannot demote themselves
+    adminPath := paths.Join(testAPIPath, "/users", strconv.FormatUint(testSecureAdmin.ID, 10), "/roles")
+    writer = serveWithToken(testAdminToken, "PUT", adminPath, `{"roles":[]}`)
+    if status := writer.Code; status != http.StatusBadRequest {
+        t.Errorf("handler returned wrong status code: got %v want %v",
+            status, http.StatusBadRequest)
+    }
+}
+
 func createTestRouter(apiPath string) *routes.Router {
     ds, err := datastore.Open("sqlite3", "file:test.db?cache=shared&mode=memory")
     if err != nil {
@@ -144,7 +445,63 @@ func createTestRouter(apiPath string) *routes.Router {
         panic(err)
     }
 
-    return NewRouter(apiPath, dao) 
+    testAdmin.SetRoles([]string{users.Admin})
+    err = dao.Insert(testAdmin)
+    if err != nil {
+        panic(err)
+    }
+
+    // Admins can only use the admin routes once they have set up two-factor
+    // authentication, and then only with an access token
+    secret, err := totp.GenerateSecret()
+    if err != nil {
+        panic(err)
+    }
+
+    if _, err := testSecureAdmin.EnableTwoFactor(secret, totp.Counter(time.Now())); err != nil {
+        panic(err)
+    }
+
+    testSecureAdmin.SetRoles([]string{users.Admin})
+    err = dao.Insert(testSecureAdmin)
+    if err != nil {
+        panic(err)
+    }
+
+    tokenDao := tokens.NewDao(ds)
+    adminToken, adminSecret, err := tokens.NewAccessToken(testSecureAdmin.ID, "Admin", []string{tokens.Admin}, time.Time{})
+    if err != nil {
+        panic(err)
+    }
+
+    err = tokenDao.Insert(adminToken)
+    if err != nil {
+        panic(err)
+    }
+    testAdminToken = adminSecret
+
+    spellsPath := config.GetString(keys.SpellsPath, "../../../models/spells/resources/spells.json")
+    catalogue, err := spells.LoadCatalogue(spellsPath)
+    if err != nil {
+        panic(err)
+    }
+
+    return NewRouter(apiPath, &Dependencies{
+        UserDao : dao,
+        WizardDao : wizards.NewDao(ds),
+        ReplayDao : replays.NewDao(ds),
+        RatingDao : ratings.NewDao(ds),
+        QueueDao : matchmaking.NewDao(ds),
+        SeasonDao : seasons.NewDao(ds),
+        LeaderboardDao : leaderboards.NewDao(ds),
+        TournamentDao : tournaments.NewDao(ds),
+        JobDao : jobs.NewDao(ds),
+        TokenDao : tokenDao,
+        LoginGuard : logins.NewGuard(logins.NewDao(ds)),
+        SessionDao : usersessions.NewDao(ds),
+        Hub : live.NewHub(),
+        Catalogue : catalogue,
+    }) 
 }
 
 func createTestRequest(method string, path string, body string) *http.Request {
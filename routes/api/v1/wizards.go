@@ -1,45 +1,329 @@
 package v1
 
 import (
-	"log"
-	"path"
+	"encoding/json"
 	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/matchmaking"
+	"github.com/crob1140/codewiz-server/models/spells"
+	"github.com/crob1140/codewiz-server/models/tokens"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/models/wizards"
 	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
 )
 
+const (
+	wizardsPath = "/wizards"
 
-type Spell struct {
-	URI string `json:"uri"`
-}
+	defaultWizardLimit = 20
+	maxWizardLimit     = 100
+)
 
 type Wizard struct {
-	Name string `json:"name"`
-	Spells []Spell `json:"spells"`
+	URI             string  `json:"uri"`
+	Name            string  `json:"name"`
+	Sex             string  `json:"sex"`
+	Spells          []Spell `json:"spells"`
+	HasActiveScript bool    `json:"hasActiveScript"`
+	Version         int64   `json:"version"`
+}
+
+type WizardList struct {
+	Wizards []Wizard `json:"wizards"`
+	Next    string   `json:"next,omitempty"`
+}
+
+// WizardRequest is the body of a request to create or update a wizard.
+// Spells holds the IDs of the spells to equip, in slot order. An update
+// that gives the version of the wizard it was based on fails with a
+// conflict if the wizard has been changed since.
+type WizardRequest struct {
+	Name    string   `json:"name"`
+	Sex     string   `json:"sex"`
+	Spells  []string `json:"spells"`
+	Version int64    `json:"version"`
+}
+
+func addWizardRoutes(router *routes.Router, v1Path string, wizardDao *wizards.Dao, queueDao *matchmaking.Dao, catalogue *spells.Catalogue) {
+	router.Path(wizardsPath).HandlerFunc(withScope(tokens.WizardsRead, createGetAllWizardsHandler(v1Path, wizardDao, catalogue))).Methods("GET")
+	router.Path(wizardsPath).HandlerFunc(withScope(tokens.WizardsWrite, createAddWizardHandler(v1Path, wizardDao, catalogue))).Methods("POST")
+
+	wizardPath := path.Join(wizardsPath, "/{id:[0-9]+}")
+	router.Path(wizardPath).HandlerFunc(withScope(tokens.WizardsRead, createGetWizardHandler(v1Path, wizardDao, catalogue))).Methods("GET")
+	router.Path(wizardPath).HandlerFunc(withScope(tokens.WizardsWrite, createModifyWizardHandler(v1Path, wizardDao, catalogue))).Methods("POST", "PUT")
+	router.Path(wizardPath).HandlerFunc(withScope(tokens.WizardsWrite, createDeleteWizardHandler(wizardDao, queueDao))).Methods("DELETE")
+}
+
+// createGetAllWizardsHandler returns a page of the user's own wizards,
+// oldest first. It accepts the query parameters cursor and limit.
+func createGetAllWizardsHandler(v1Path string, wizardDao *wizards.Dao, catalogue *spells.Catalogue) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user := context.User
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+			return
+		}
+
+		params := r.URL.Query()
+		paging, ok := parsePage(w, params, defaultWizardLimit, maxWizardLimit)
+		if !ok {
+			return
+		}
+
+		// Fetch one more wizard than is needed to find out whether there
+		// is another page after this one. The queries are abandoned if the
+		// client goes away.
+		pageDao := wizardDao.WithContext(r.Context())
+		owned, err := pageDao.GetPageByOwnerID(user.ID, paging.AfterID, paging.Limit+1)
+		if err != nil {
+			log.Error("Failed to fetch wizards from datastore", log.Fields{"user": user.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		list := WizardList{Wizards: make([]Wizard, 0, paging.Limit)}
+		for i, wizard := range owned {
+			if i == paging.Limit {
+				list.Next = nextPageURI(v1Path+wizardsPath, params, owned[i-1].ID)
+				break
+			}
+
+			resource, err := toWizardResource(v1Path, wizard, pageDao, catalogue)
+			if err != nil {
+				log.Error("Failed to fetch wizard spells from datastore", log.Fields{"wizard": wizard.ID, "error": err})
+				writeInternalError(w)
+				return
+			}
+			list.Wizards = append(list.Wizards, resource)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(list))
+	}
+}
+
+func createAddWizardHandler(v1Path string, wizardDao *wizards.Dao, catalogue *spells.Catalogue) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		user := context.User
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+			return
+		}
+
+		var request WizardRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not valid JSON.", CodeInvalidRequest)
+			return
+		}
+
+		wizard := wizards.NewWizard(request.Name, request.Sex, user.ID)
+		wizard.Spells = request.Spells
+
+		validationErrs, err := wizards.NewValidator(wizardDao, catalogue).Validate(wizard)
+		if err != nil {
+			log.Error("Failed to validate wizard", log.Fields{"error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if len(validationErrs) != 0 {
+			writeValidationError(w, validationErrs)
+			return
+		}
+
+		if err := wizardDao.Insert(wizard); err != nil {
+			log.Error("Failed to insert wizard", log.Fields{"error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if err := wizardDao.SetSpells(wizard); err != nil {
+			log.Error("Failed to equip wizard spells", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		resource := newWizardResource(v1Path, wizard, catalogue)
+		w.Header().Set("Location", resource.URI)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(toJson(resource))
+	}
+}
+
+func createGetWizardHandler(v1Path string, wizardDao *wizards.Dao, catalogue *spells.Catalogue) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		wizard, ok := findOwnedWizard(w, r, context, wizardDao)
+		if !ok {
+			return
+		}
+
+		resource, err := toWizardResource(v1Path, wizard, wizardDao, catalogue)
+		if err != nil {
+			log.Error("Failed to fetch wizard spells from datastore", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(resource))
+	}
+}
+
+// createModifyWizardHandler updates a wizard. Fields that are left out of
+// the request keep their current values.
+func createModifyWizardHandler(v1Path string, wizardDao *wizards.Dao, catalogue *spells.Catalogue) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		wizard, ok := findOwnedWizard(w, r, context, wizardDao)
+		if !ok {
+			return
+		}
+
+		equipped, err := wizardDao.GetSpells(wizard)
+		if err != nil {
+			log.Error("Failed to fetch wizard spells from datastore", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		request := WizardRequest{Name: wizard.Name, Sex: wizard.Sex, Spells: equipped}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not valid JSON.", CodeInvalidRequest)
+			return
+		}
+
+		wizard.Name = request.Name
+		wizard.Sex = request.Sex
+		wizard.Spells = request.Spells
+		if request.Version != 0 {
+			wizard.SetVersion(request.Version)
+		}
+
+		validationErrs, err := wizards.NewValidator(wizardDao, catalogue).Validate(wizard)
+		if err != nil {
+			log.Error("Failed to validate wizard", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if len(validationErrs) != 0 {
+			writeValidationError(w, validationErrs)
+			return
+		}
+
+		if err := wizardDao.Update(wizard); err == datastore.ErrConflict {
+			writeError(w, http.StatusConflict, "Wizard has been changed since it was fetched.", CodeEditConflict)
+			return
+		} else if err != nil {
+			log.Error("Failed to update wizard", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		if err := wizardDao.SetSpells(wizard); err != nil {
+			log.Error("Failed to equip wizard spells", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(toJson(newWizardResource(v1Path, wizard, catalogue)))
+	}
 }
 
-func addWizardRoutes(router *routes.Router) {
-	wizardsPath := "/wizards"
+// createDeleteWizardHandler deletes a wizard and takes it out of the
+// matchmaking queue. Its battles and ratings are kept.
+func createDeleteWizardHandler(wizardDao *wizards.Dao, queueDao *matchmaking.Dao) routes.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, context *routes.Context) {
+		wizard, ok := findOwnedWizard(w, r, context, wizardDao)
+		if !ok {
+			return
+		}
 
-	router.Path(wizardsPath).HandlerFunc(getAllWizardsHandler).Methods("GET")
-	router.Path(wizardsPath).HandlerFunc(addWizardHandler).Methods("POST")
+		if err := deleteWizard(wizard, wizardDao, queueDao); err == datastore.ErrConflict {
+			writeError(w, http.StatusConflict, "Wizard has been changed since it was fetched.", CodeEditConflict)
+			return
+		} else if err != nil {
+			log.Error("Failed to delete wizard", log.Fields{"wizard": wizard.ID, "error": err})
+			writeInternalError(w)
+			return
+		}
 
-	router.Path(path.Join(wizardsPath, "/{id}")).HandlerFunc(getWizardHandler).Methods("GET")
-	router.Path(path.Join(wizardsPath, "/{id}")).HandlerFunc(modifyWizardHandler).Methods("POST")
+		w.WriteHeader(http.StatusNoContent)
+	}
 }
 
-func getAllWizardsHandler(w http.ResponseWriter, r *http.Request, context *routes.Context) {
-	log.Printf("Get all wizards v1")
+func deleteWizard(wizard *wizards.Wizard, wizardDao *wizards.Dao, queueDao *matchmaking.Dao) error {
+	if err := queueDao.CancelWaiting(wizard.ID, "The wizard was deleted."); err != nil {
+		return err
+	}
+	return wizardDao.Delete(wizard)
 }
 
+// findOwnedWizard fetches the wizard named in the request path, and
+// writes an error response unless it belongs to the current user.
+// Moderators and admins can access every wizard, so that they can rename
+// or remove offensive ones.
+func findOwnedWizard(w http.ResponseWriter, r *http.Request, context *routes.Context, wizardDao *wizards.Dao) (*wizards.Wizard, bool) {
+	user := context.User
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "Login is required to access this resource.", CodeLoginRequired)
+		return nil, false
+	}
 
-func addWizardHandler(w http.ResponseWriter, r *http.Request, context *routes.Context) {
-	log.Printf("Add wizard v1")
+	wizardID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	wizard, err := wizardDao.WithContext(r.Context()).GetByID(wizardID)
+	if err != nil {
+		log.Error("Failed to fetch wizard from datastore", log.Fields{"wizard": wizardID, "error": err})
+		writeInternalError(w)
+		return nil, false
+	}
+
+	if wizard == nil {
+		writeError(w, http.StatusNotFound, "Wizard does not exist.", CodeNotFound)
+		return nil, false
+	}
+
+	if wizard.OwnerID != user.ID && !user.HasAnyRole(users.Moderator, users.Admin) {
+		writeError(w, http.StatusUnauthorized, "User does not have permission to access this resource.", CodeOwnerOnly)
+		return nil, false
+	}
+
+	return wizard, true
 }
 
-func getWizardHandler(w http.ResponseWriter, r *http.Request, context *routes.Context) {
-	log.Printf("Get wizard v1")
+// toWizardResource loads the wizard's equipped spells before converting it.
+func toWizardResource(v1Path string, wizard *wizards.Wizard, wizardDao *wizards.Dao, catalogue *spells.Catalogue) (Wizard, error) {
+	equipped, err := wizardDao.GetSpells(wizard)
+	if err != nil {
+		return Wizard{}, err
+	}
+
+	wizard.Spells = equipped
+	return newWizardResource(v1Path, wizard, catalogue), nil
 }
 
-func modifyWizardHandler(w http.ResponseWriter, r *http.Request, context *routes.Context) {
-	log.Printf("Modify wizard v1")
+func newWizardResource(v1Path string, wizard *wizards.Wizard, catalogue *spells.Catalogue) Wizard {
+	resource := Wizard{
+		URI:             path.Join(v1Path, wizardsPath, strconv.FormatUint(wizard.ID, 10)),
+		Name:            wizard.Name,
+		Sex:             wizard.Sex,
+		Spells:          make([]Spell, 0, len(wizard.Spells)),
+		HasActiveScript: wizard.ActiveScriptID != 0,
+		Version:         wizard.Version(),
+	}
+
+	for _, spellID := range wizard.Spells {
+		// Spells that have been removed from the catalogue since they were
+		// equipped are left out
+		if spell := catalogue.Get(spellID); spell != nil {
+			resource.Spells = append(resource.Spells, toSpellResource(v1Path, spell))
+		}
+	}
+
+	return resource
 }
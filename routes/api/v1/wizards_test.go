@@ -1,2 +1,269 @@
 package v1
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	paths "path"
+	"testing"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/models/wizards"
+)
+
+// openTestDatastore connects to the in-memory database used by the test router.
+func openTestDatastore(t *testing.T) *datastore.DB {
+	ds, err := datastore.Open("sqlite3", "file:test.db?cache=shared&mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+func serveAs(username string, password string, method string, path string, body string) *httptest.ResponseRecorder {
+	request := createTestRequest(method, path, body)
+	if username != "" {
+		request.SetBasicAuth(username, password)
+	}
+
+	writer := httptest.NewRecorder()
+	testRouter.ServeHTTP(writer, request)
+	return writer
+}
+
+func createTestWizard(t *testing.T, name string) Wizard {
+	writer := serveAs("TestUser", "testpassword", "POST", paths.Join(testAPIPath, "/wizards"), `{"name":"`+name+`","sex":"F"}`)
+	if status := writer.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	var wizard Wizard
+	if err := json.Unmarshal(writer.Body.Bytes(), &wizard); err != nil {
+		t.Fatal(err)
+	}
+
+	if location := writer.Header().Get("Location"); location != wizard.URI {
+		t.Errorf("Unexpected location: got %v want %v", location, wizard.URI)
+	}
+	return wizard
+}
+
+func TestAddWizard_InvalidFields(t *testing.T) {
+	writer := serveAs("TestUser", "testpassword", "POST", paths.Join(testAPIPath, "/wizards"), `{"name":"","sex":"X"}`)
+
+	if status := writer.Code; status != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	var response Error
+	if err := json.Unmarshal(writer.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Code != CodeInvalidRequest || len(response.Fields["Name"]) == 0 || len(response.Fields["Sex"]) == 0 {
+		t.Errorf("Expected the name and sex to be reported as invalid, got %+v", response)
+	}
+}
+
+func TestAddWizard_AsVisitor(t *testing.T) {
+	writer := serveAs("", "", "POST", paths.Join(testAPIPath, "/wizards"), `{"name":"Visitor","sex":"M"}`)
+
+	if status := writer.Code; status != http.StatusUnauthorized {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
+
+func TestGetAllWizards_OnlyListsOwnWizards(t *testing.T) {
+	ds := openTestDatastore(t)
+	other := users.NewUser("WizardOwner", "ownerpassword", "owner@test.com")
+	if err := users.NewDao(ds).Insert(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := wizards.NewDao(ds).Insert(wizards.NewWizard("Someone Else's", "M", other.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	created := createTestWizard(t, "Listed")
+
+	writer := serveAs("TestUser", "testpassword", "GET", paths.Join(testAPIPath, "/wizards")+"?limit=100", "")
+	if status := writer.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var list WizardList
+	if err := json.Unmarshal(writer.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, wizard := range list.Wizards {
+		if wizard.Name == "Someone Else's" {
+			t.Errorf("Expected other users' wizards to be left out, got %+v", list)
+		}
+		found = found || wizard.URI == created.URI
+	}
+
+	if !found {
+		t.Errorf("Expected the user's wizard to be listed, got %+v", list)
+	}
+}
+
+func TestGetAllWizards_Paging(t *testing.T) {
+	for _, name := range []string{"First Page", "Second Page", "Third Page"} {
+		createTestWizard(t, name)
+	}
+
+	seen := make(map[string]bool)
+	next := paths.Join(testAPIPath, "/wizards") + "?limit=2"
+	for pages := 0; next != ""; pages++ {
+		if pages > 50 {
+			t.Fatal("Expected paging to finish")
+		}
+
+		writer := serveAs("TestUser", "testpassword", "GET", next, "")
+		if status := writer.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+
+		var list WizardList
+		if err := json.Unmarshal(writer.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(list.Wizards) > 2 {
+			t.Errorf("Expected at most two wizards per page, got %d", len(list.Wizards))
+		}
+
+		for _, wizard := range list.Wizards {
+			if seen[wizard.URI] {
+				t.Errorf("Wizard %v was listed twice", wizard.URI)
+			}
+			seen[wizard.URI] = true
+		}
+		next = list.Next
+	}
+
+	if len(seen) < 3 {
+		t.Errorf("Expected every wizard to be listed, got %v", seen)
+	}
+}
+
+func TestModifyWizard_KeepsMissingFields(t *testing.T) {
+	created := createTestWizard(t, "Before")
+
+	writer := serveAs("TestUser", "testpassword", "PUT", created.URI, `{"name":"After"}`)
+	if status := writer.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var wizard Wizard
+	if err := json.Unmarshal(writer.Body.Bytes(), &wizard); err != nil {
+		t.Fatal(err)
+	}
+
+	if wizard.Name != "After" || wizard.Sex != created.Sex {
+		t.Errorf("Expected only the name to change, got %+v", wizard)
+	}
+}
+
+func TestModifyWizard_StaleVersion(t *testing.T) {
+	created := createTestWizard(t, "Contested")
+
+	// Both edits are based on the version that was created
+	body := fmt.Sprintf(`{"name":"First","version":%d}`, created.Version)
+	writer := serveAs("TestUser", "testpassword", "PUT", created.URI, body)
+	if status := writer.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	body = fmt.Sprintf(`{"name":"Second","version":%d}`, created.Version)
+	writer = serveAs("TestUser", "testpassword", "PUT", created.URI, body)
+	if status := writer.Code; status != http.StatusConflict {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	expected := string(toJson(Error{Message: "Wizard has been changed since it was fetched.", Code: CodeEditConflict}))
+	if writer.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", writer.Body.String(), expected)
+	}
+
+	writer = serveAs("TestUser", "testpassword", "GET", created.URI, "")
+	var wizard Wizard
+	if err := json.Unmarshal(writer.Body.Bytes(), &wizard); err != nil {
+		t.Fatal(err)
+	}
+
+	if wizard.Name != "First" || wizard.Version != created.Version+1 {
+		t.Errorf("Expected the first edit to be kept, got %+v", wizard)
+	}
+}
+
+func TestGetWizard_AsDifferentUser(t *testing.T) {
+	ds := openTestDatastore(t)
+	other := users.NewUser("Snooper", "snooperpassword", "snooper@test.com")
+	if err := users.NewDao(ds).Insert(other); err != nil {
+		t.Fatal(err)
+	}
+
+	created := createTestWizard(t, "Private")
+
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		writer := serveAs("Snooper", "snooperpassword", method, created.URI, `{"name":"Stolen"}`)
+		if status := writer.Code; status != http.StatusUnauthorized {
+			t.Errorf("%v returned wrong status code: got %v want %v", method, status, http.StatusUnauthorized)
+		}
+
+		expected := string(toJson(Error{Message: "User does not have permission to access this resource.", Code: CodeOwnerOnly}))
+		if writer.Body.String() != expected {
+			t.Errorf("%v returned unexpected body: got %v want %v", method, writer.Body.String(), expected)
+		}
+	}
+}
+
+func TestDeleteWizard(t *testing.T) {
+	created := createTestWizard(t, "Doomed")
+
+	writer := serveAs("TestUser", "testpassword", "DELETE", created.URI, "")
+	if status := writer.Code; status != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+
+	writer = serveAs("TestUser", "testpassword", "GET", created.URI, "")
+	if status := writer.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+
+	// Deleted wizards keep their names reserved
+	writer = serveAs("TestUser", "testpassword", "POST", paths.Join(testAPIPath, "/wizards"), `{"name":"Doomed","sex":"F"}`)
+	if status := writer.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestModifyWizard_AsModerator(t *testing.T) {
+	ds := openTestDatastore(t)
+	moderator := users.NewUser("Moderator", "moderatorpassword", "moderator@test.com")
+	moderator.SetRoles([]string{users.Moderator})
+	if err := users.NewDao(ds).Insert(moderator); err != nil {
+		t.Fatal(err)
+	}
+
+	created := createTestWizard(t, "Offensive")
+
+	writer := serveAs("Moderator", "moderatorpassword", "PUT", created.URI, `{"name":"Renamed"}`)
+	if status := writer.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	writer = serveAs("TestUser", "testpassword", "GET", created.URI, "")
+	var wizard Wizard
+	if err := json.Unmarshal(writer.Body.Bytes(), &wizard); err != nil {
+		t.Fatal(err)
+	}
+
+	if wizard.Name != "Renamed" {
+		t.Errorf("Expected the moderator to rename the wizard, got %+v", wizard)
+	}
+}
@@ -27,6 +27,19 @@ var voidMiddleware = MiddlewareFunc(func(w http.ResponseWriter, r *http.Request,
 	next(w,r,context)
 })
 
+// RequireRoles returns middleware that only lets a request through if the
+// current user has at least one of the given roles, and passes any other
+// request to denied.
+func RequireRoles(denied HandlerFunc, roles ...string) Middleware {
+	return MiddlewareFunc(func(w http.ResponseWriter, r *http.Request, context *Context, next HandlerFunc) {
+		if context.User.HasAnyRole(roles...) {
+			next(w, r, context)
+		} else {
+			denied(w, r, context)
+		}
+	})
+}
+
 // -----------------------
 // - Middleware Node
 // -----------------------
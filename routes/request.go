@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/crob1140/codewiz-server/config"
+	"github.com/crob1140/codewiz-server/config/keys"
+)
+
+// ClientIP returns the address that the request came from. Behind a reverse
+// proxy every request comes from the proxy, so if the proxy is trusted the
+// address it added to the X-Forwarded-For header is used instead. The
+// header is ignored otherwise, since clients can set it to anything.
+func ClientIP(r *http.Request) string {
+	if config.GetBool(keys.ProxyTrusted, false) {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			addresses := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
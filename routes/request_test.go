@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/crob1140/codewiz-server/config"
+	"github.com/crob1140/codewiz-server/config/keys"
+)
+
+func TestClientIP(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.0.0.1:54321"
+	request.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+
+	variable := config.GetEnvironmentVariableName(keys.ProxyTrusted)
+	defer os.Unsetenv(variable)
+
+	os.Setenv(variable, "false")
+	if ip := ClientIP(request); ip != "10.0.0.1" {
+		t.Errorf("Expected the forwarded address to be ignored, got %v", ip)
+	}
+
+	os.Setenv(variable, "true")
+	if ip := ClientIP(request); ip != "198.51.100.7" {
+		t.Errorf("Expected the address added by the proxy, got %v", ip)
+	}
+}
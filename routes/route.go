@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"github.com/crob1140/codewiz-server/models/tokens"
 	"github.com/crob1140/codewiz-server/models/users"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
@@ -14,6 +15,7 @@ import (
 
 type Context struct {
 	User    *users.User
+	Token   *tokens.AccessToken // set when the request was authenticated with an access token
 	Session *sessions.Session
 	Router  *Router
 }
@@ -71,6 +73,14 @@ func (route *Route) Methods(methods ...string) *Route {
 	return route
 }
 
+// Use adds middleware that only applies to this route. It runs after the
+// router's middleware, in the order it was added.
+func (route *Route) Use(middleware Middleware) *Route {
+	route.middleware.Add(middleware)
+	route.middleware.last.next = route.handlerNode
+	return route
+}
+
 func (route *Route) HandlerFunc(handlerFunc HandlerFunc) *Route {
 	// TODO: this could be simplified by making 'middleware' a wrapper that just doesn't call next,
 	// so that we don't need to always create the void node that follows
@@ -186,6 +186,72 @@ func TestMiddlewareExecuteInOrderOfAddition(t *testing.T) {
 	}
 }
 
+func TestRouteMiddlewareOnlyAppliesToRoute(t *testing.T) {
+	router := createTestRouter()
+
+	var middlewareReached bool
+	middleware := MiddlewareFunc(func(w http.ResponseWriter, r *http.Request, context *Context, next HandlerFunc) {
+		middlewareReached = true
+		next(w, r, context)
+	})
+
+	var handlerReached bool
+	handler := func(w http.ResponseWriter, r *http.Request, context *Context) {
+		handlerReached = true
+	}
+
+	router.Path("other/route").Methods("GET").HandlerFunc(handler)
+	createTestRoute(router).Use(middleware).HandlerFunc(handler)
+
+	request, _ := http.NewRequest("GET", paths.Join(testRouterPath, "other/route"), strings.NewReader(""))
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	if middlewareReached || !handlerReached {
+		t.Errorf("Route middleware was used by a different route")
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), createTestRequest())
+
+	if !middlewareReached {
+		t.Errorf("Route middleware was not called")
+	}
+}
+
+func TestRequireRoles(t *testing.T) {
+	admin := users.NewUser("TestAdmin", "testpassword", "admin@test.com")
+	admin.SetRoles([]string{users.Admin})
+
+	for _, test := range []struct {
+		user    *users.User
+		allowed bool
+	}{
+		{nil, false},
+		{users.NewUser("TestUsername", "testpassword", "test@test.com"), false},
+		{admin, true},
+	} {
+		router := createTestRouter()
+		router.Use(MiddlewareFunc(func(w http.ResponseWriter, r *http.Request, context *Context, next HandlerFunc) {
+			context.User = test.user
+			next(w, r, context)
+		}))
+
+		var deniedReached, handlerReached bool
+		denied := func(w http.ResponseWriter, r *http.Request, context *Context) {
+			deniedReached = true
+		}
+		handler := func(w http.ResponseWriter, r *http.Request, context *Context) {
+			handlerReached = true
+		}
+
+		createTestRoute(router).Use(RequireRoles(denied, users.Moderator, users.Admin)).HandlerFunc(handler)
+		router.ServeHTTP(httptest.NewRecorder(), createTestRequest())
+
+		if handlerReached != test.allowed || deniedReached == test.allowed {
+			t.Errorf("Expected roles %v to be allowed: %v", test.user.Roles(), test.allowed)
+		}
+	}
+}
+
 func createTestRouter() *Router {
 	return NewRouter(testRouterPath)
 }
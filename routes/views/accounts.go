@@ -0,0 +1,361 @@
+package views
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/mail"
+	"github.com/crob1140/codewiz-server/models"
+	"github.com/crob1140/codewiz-server/models/logins"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/models/usertokens"
+)
+
+// verifyEmailPageHandler marks the user's email address as verified, if the
+// link they followed is still valid and their address has not changed
+// since it was sent.
+func verifyEmailPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	verified, err := verifyEmail(router, r.FormValue("token"))
+	if err != nil {
+		log.Error("Failed to verify email address", log.Fields{"error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	data := struct {
+		Verified      bool
+		DashboardPath string
+	}{
+		verified,
+		router.Dashboard().String(),
+	}
+
+	context.render(w, "verifyemail.html", data)
+}
+
+func verifyEmail(router *Router, secret string) (bool, error) {
+	token, err := router.userTokenDao.GetUsable(usertokens.VerifyEmail, secret, time.Now())
+	if err != nil || token == nil {
+		return false, err
+	}
+
+	user, err := router.userDao.GetByID(token.UserID)
+	if err != nil || user == nil || user.Email != token.Email {
+		return false, err
+	}
+
+	user.EmailVerified = true
+	if err := router.userDao.Update(user); err != nil {
+		return false, err
+	}
+
+	return true, router.userTokenDao.Use(token)
+}
+
+// resendVerificationActionHandler sends the logged in user a new
+// verification email, in case the first one was lost or has expired.
+func resendVerificationActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+	user := context.User
+
+	if !user.EmailVerified {
+		if err := sendVerificationEmail(r, router, user); err != nil {
+			log.Error("Failed to send verification email", log.Fields{"user": user.ID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+
+		session.AddFlash("A new verification email has been sent to "+user.Email+".", "notices")
+		if err := session.Save(r, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.Redirect(w, r, router.Dashboard().String(), http.StatusSeeOther)
+}
+
+func forgotPasswordPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	data := struct {
+		SubmitPath       string
+		Sent             bool
+		ValidationErrors models.ValidationErrors
+	}{
+		router.ForgotPassword().String(),
+		false,
+		nil,
+	}
+
+	context.render(w, "forgotpassword.html", data)
+}
+
+// forgotPasswordActionHandler emails a password reset link to every active
+// account registered with the address. The response is the same whether or
+// not there are any, so that the page cannot be used to find out who has an
+// account.
+func forgotPasswordActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	email := r.FormValue("email")
+	validationErrs := make(models.ValidationErrors)
+	if email == "" {
+		validationErrs.Add("Email", "This field is required.")
+	} else {
+		found, err := router.userDao.GetByEmail(email)
+		if err != nil {
+			log.Error("Failed to fetch users by email", log.Fields{"error": err})
+			custom500Handler(w, r)
+			return
+		}
+
+		for _, user := range found {
+			if user.Disabled {
+				continue
+			}
+
+			if err := sendPasswordResetEmail(r, router, user); err != nil {
+				log.Error("Failed to send password reset email", log.Fields{"user": user.ID, "error": err})
+				custom500Handler(w, r)
+				return
+			}
+		}
+	}
+
+	data := struct {
+		SubmitPath       string
+		Sent             bool
+		ValidationErrors models.ValidationErrors
+	}{
+		router.ForgotPassword().String(),
+		len(validationErrs) == 0,
+		validationErrs,
+	}
+
+	context.render(w, "forgotpassword.html", data)
+}
+
+// resetPasswordPageHandler asks for a new password, if the link the user
+// followed is still valid. The token is only used up once the new password
+// has been accepted.
+func resetPasswordPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+
+	errList := session.Flashes("errs")
+	var validationErrs models.ValidationErrors
+	if len(errList) != 0 {
+		validationErrs = errList[0].(models.ValidationErrors)
+	}
+
+	// Save the session to ensure the flash messages are removed.
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	secret := r.FormValue("token")
+	token, err := router.userTokenDao.GetUsable(usertokens.ResetPassword, secret, time.Now())
+	if err != nil {
+		log.Error("Failed to fetch password reset token", log.Fields{"error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	data := struct {
+		SubmitPath         string
+		ForgotPasswordPath string
+		Token              string
+		Valid              bool
+		ValidationErrors   models.ValidationErrors
+	}{
+		router.ResetPassword().String(),
+		router.ForgotPassword().String(),
+		secret,
+		token != nil,
+		validationErrs,
+	}
+
+	context.render(w, "resetpassword.html", data)
+}
+
+// resetPasswordActionHandler changes the user's password and logs them in.
+// Following the link also proves that the user can read the mail sent to
+// their address, so it is marked as verified.
+func resetPasswordActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+
+	secret := r.FormValue("token")
+	token, err := router.userTokenDao.GetUsable(usertokens.ResetPassword, secret, time.Now())
+	if err != nil {
+		log.Error("Failed to fetch password reset token", log.Fields{"error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	var user *users.User
+	if token != nil {
+		if user, err = router.userDao.GetByID(token.UserID); err != nil {
+			log.Error("Failed to fetch user", log.Fields{"user": token.UserID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+	}
+
+	// Show the page again, which explains that the link is no longer valid
+	if user == nil || user.Disabled {
+		http.Redirect(w, r, resetPasswordPath(router, secret), http.StatusSeeOther)
+		return
+	}
+
+	password := r.FormValue("password")
+	validationErrs := users.NewValidator(router.userDao).ValidatePassword(password)
+	if len(validationErrs) != 0 {
+		session.AddFlash(validationErrs, "errs")
+		if err := session.Save(r, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, resetPasswordPath(router, secret), http.StatusSeeOther)
+		return
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		custom500Handler(w, r)
+		return
+	}
+
+	if user.Email == token.Email {
+		user.EmailVerified = true
+	}
+
+	if err := router.userDao.Update(user); err != nil {
+		log.Error("Failed to update user", log.Fields{"user": user.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	// Any other reset links that were sent stop working as well
+	if err := router.userTokenDao.DeleteByUserID(user.ID, usertokens.ResetPassword); err != nil {
+		log.Error("Failed to delete password reset tokens", log.Fields{"user": user.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	// Whoever knew the old password is logged out everywhere
+	if err := router.sessionDao.DeleteByUserID(user.ID); err != nil {
+		log.Error("Failed to revoke sessions", log.Fields{"user": user.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	log.Info("User has reset their password", log.Fields{"username": user.Username})
+
+	// Start a new session, since the current one may have just been revoked
+	session.ID = ""
+
+	// Users with two-factor authentication still need a code, since the
+	// link only proves that they can read their email
+	destination := logIn(router, session, user, logins.Web)
+	session.AddFlash("Your password has been changed.", "notices")
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, destination.String(), http.StatusSeeOther)
+}
+
+func resetPasswordPath(router *Router, secret string) string {
+	return router.ResetPassword().String() + "?" + url.Values{"token": {secret}}.Encode()
+}
+
+// sendVerificationEmail sends the user a link that verifies their email
+// address. Links from earlier emails stop working.
+func sendVerificationEmail(r *http.Request, router *Router, user *users.User) error {
+	link, err := createTokenLink(r, router, user, usertokens.VerifyEmail, router.VerifyEmail())
+	if err != nil {
+		return err
+	}
+
+	return router.mailSender.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your CodeWiz email address",
+		Body: "Hi " + user.Username + ",\n\n" +
+			"Follow the link below to verify your email address. Your wizards can enter ranked battles once it has been verified.\n\n" +
+			link + "\n\n" +
+			"The link expires in 48 hours. If you did not register for CodeWiz, you can ignore this email.\n",
+	})
+}
+
+// sendPasswordResetEmail sends the user a link that lets them choose a new
+// password.
+func sendPasswordResetEmail(r *http.Request, router *Router, user *users.User) error {
+	link, err := createTokenLink(r, router, user, usertokens.ResetPassword, router.ResetPassword())
+	if err != nil {
+		return err
+	}
+
+	return router.mailSender.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your CodeWiz password",
+		Body: "Hi " + user.Username + ",\n\n" +
+			"Follow the link below to choose a new password.\n\n" +
+			link + "\n\n" +
+			"The link expires in 1 hour. If you did not ask to reset your password, you can ignore this email.\n",
+	})
+}
+
+// createTokenLink stores a new token for the user, replacing any they had
+// for the same purpose, and returns a link to the page that uses it.
+func createTokenLink(r *http.Request, router *Router, user *users.User, purpose string, page *url.URL) (string, error) {
+	if err := router.userTokenDao.DeleteByUserID(user.ID, purpose); err != nil {
+		return "", err
+	}
+
+	token, secret, err := usertokens.New(user.ID, purpose, user.Email, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	if err := router.userTokenDao.Insert(token); err != nil {
+		return "", err
+	}
+
+	link := router.absoluteURL(r, page)
+	link.RawQuery = url.Values{"token": {secret}}.Encode()
+	return link.String(), nil
+}
+
+// absoluteURL turns a page's URL into one that can be followed from an
+// email, using the configured public URL if there is one.
+func (router *Router) absoluteURL(r *http.Request, page *url.URL) *url.URL {
+	var link url.URL
+	if router.publicURL != nil {
+		link = *router.publicURL
+	} else {
+		link.Scheme = "http"
+		if r.TLS != nil {
+			link.Scheme = "https"
+		}
+		link.Host = r.Host
+	}
+
+	link.Path = path.Join("/", link.Path, page.Path)
+	return &link
+}
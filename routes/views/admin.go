@@ -0,0 +1,378 @@
+package views
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models"
+	"github.com/crob1140/codewiz-server/models/jobs"
+	"github.com/crob1140/codewiz-server/models/logins"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/models/wizards"
+	"github.com/gorilla/mux"
+)
+
+const (
+	adminUsersPerPage = 50
+	adminLoginsShown  = 20
+)
+
+type adminUserRow struct {
+	*users.User
+	DetailPath string
+}
+
+type adminWizardRow struct {
+	*wizards.Wizard
+	Spells     []string
+	DeletePath string
+}
+
+type adminJobRow struct {
+	*jobs.Job
+	WizardNames string
+	RequeuePath string
+}
+
+func adminPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	data := struct {
+		UsersPath string
+		JobsPath  string
+		LogsPath  string
+	}{
+		router.AdminUsers().String(),
+		router.AdminJobs().String(),
+		router.AdminLogs().String(),
+	}
+
+	context.render(w, "admin.html", data)
+}
+
+// adminUsersPageHandler lists the users whose username, name or email
+// address contains the search text, a page at a time.
+func adminUsersPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	search := r.FormValue("search")
+	afterID, _ := strconv.ParseUint(r.FormValue("cursor"), 10, 64)
+
+	// Fetch one more user than is shown to find out whether there is
+	// another page after this one
+	found, err := router.userDao.Search(search, afterID, adminUsersPerPage+1)
+	if err != nil {
+		log.Error("Failed to search users", log.Fields{"search": search, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	rows := make([]adminUserRow, 0, len(found))
+	nextPath := ""
+	for i, user := range found {
+		if i == adminUsersPerPage {
+			params := url.Values{"search": {search}, "cursor": {strconv.FormatUint(found[i-1].ID, 10)}}
+			nextPath = router.AdminUsers().String() + "?" + params.Encode()
+			break
+		}
+		rows = append(rows, adminUserRow{user, router.AdminUser(user.ID).String()})
+	}
+
+	data := struct {
+		SearchPath string
+		Search     string
+		Users      []adminUserRow
+		NextPath   string
+	}{
+		router.AdminUsers().String(),
+		search,
+		rows,
+		nextPath,
+	}
+
+	context.render(w, "adminusers.html", data)
+}
+
+// adminUserPageHandler shows a user's account, wizards and recent login
+// attempts, with the actions that admins can take against them.
+func adminUserPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+
+	user, ok := findAdminUser(w, r, context)
+	if !ok {
+		return
+	}
+
+	errList := session.Flashes("errs")
+	var validationErrs models.ValidationErrors
+	if len(errList) != 0 {
+		validationErrs = errList[0].(models.ValidationErrors)
+	}
+
+	// Save the session to ensure the flash messages are removed.
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	owned, err := router.wizardDao.GetByOwnerID(user.ID)
+	if err != nil {
+		log.Error("Failed to fetch wizards", log.Fields{"user": user.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	rows := make([]adminWizardRow, 0, len(owned))
+	for _, wizard := range owned {
+		equipped, err := router.wizardDao.GetSpells(wizard)
+		if err != nil {
+			log.Error("Failed to fetch wizard spells", log.Fields{"wizard": wizard.ID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+
+		names := make([]string, 0, len(equipped))
+		for _, spellID := range equipped {
+			if spell := router.spellCatalogue.Get(spellID); spell != nil {
+				names = append(names, spell.Name)
+			}
+		}
+
+		rows = append(rows, adminWizardRow{wizard, names, router.AdminWizardDeletion(wizard.ID).String()})
+	}
+
+	attempts, err := router.loginGuard.Dao.GetByUserID(user.ID, adminLoginsShown)
+	if err != nil {
+		log.Error("Failed to fetch login attempts", log.Fields{"user": user.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	data := struct {
+		User             *users.User
+		Roles            string
+		IsCurrentUser    bool
+		StatusPath       string
+		Wizards          []adminWizardRow
+		Logins           []*logins.Attempt
+		ValidationErrors models.ValidationErrors
+	}{
+		user,
+		strings.Join(user.Roles(), ", "),
+		user.ID == context.User.ID,
+		router.AdminUserStatus(user.ID).String(),
+		rows,
+		attempts,
+		validationErrs,
+	}
+
+	context.render(w, "adminuser.html", data)
+}
+
+// setUserStatusActionHandler disables or re-enables a user's account.
+// Disabled users have their sessions revoked, cannot log in or use their access tokens,
+// and have their wizards taken out of the matchmaking queue.
+func setUserStatusActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+
+	user, ok := findAdminUser(w, r, context)
+	if !ok {
+		return
+	}
+
+	disabled := r.FormValue("disabled") == "true"
+	if disabled && user.ID == context.User.ID {
+		validationErrs := make(models.ValidationErrors)
+		validationErrs.Add("Disabled", "Admins cannot disable their own account.")
+
+		session.AddFlash(validationErrs, "errs")
+		if err := session.Save(r, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, router.AdminUser(user.ID).String(), http.StatusSeeOther)
+		return
+	}
+
+	user.Disabled = disabled
+	if err := router.userDao.Update(user); err != nil {
+		log.Error("Failed to update user", log.Fields{"user": user.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	if disabled {
+		if err := router.sessionDao.DeleteByUserID(user.ID); err != nil {
+			log.Error("Failed to revoke sessions", log.Fields{"user": user.ID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+
+		owned, err := router.wizardDao.GetByOwnerID(user.ID)
+		if err != nil {
+			log.Error("Failed to fetch wizards", log.Fields{"user": user.ID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+
+		for _, wizard := range owned {
+			if err := router.queueDao.CancelWaiting(wizard.ID, "The owner's account was disabled."); err != nil {
+				log.Error("Failed to cancel queue entry", log.Fields{"wizard": wizard.ID, "error": err})
+				custom500Handler(w, r)
+				return
+			}
+		}
+	}
+
+	log.Info("User account status changed", log.Fields{"user": user.ID, "disabled": disabled, "admin": context.User.Username})
+	http.Redirect(w, r, router.AdminUser(user.ID).String(), http.StatusSeeOther)
+}
+
+// deleteWizardActionHandler deletes any user's wizard and takes it out of
+// the matchmaking queue.
+func deleteWizardActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	wizardID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	wizard, err := router.wizardDao.GetByID(wizardID)
+	if err != nil {
+		log.Error("Failed to fetch wizard", log.Fields{"wizard": wizardID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	if wizard == nil {
+		render(w, "404.html", nil)
+		return
+	}
+
+	if err := router.queueDao.CancelWaiting(wizard.ID, "The wizard was deleted."); err != nil {
+		log.Error("Failed to cancel queue entry", log.Fields{"wizard": wizard.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	if err := router.wizardDao.Delete(wizard); err != nil {
+		log.Error("Failed to delete wizard", log.Fields{"wizard": wizard.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	log.Info("Wizard deleted by admin", log.Fields{"wizard": wizard.ID, "admin": context.User.Username})
+	http.Redirect(w, r, router.AdminUser(wizard.OwnerID).String(), http.StatusSeeOther)
+}
+
+func adminJobsPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	failed, err := router.jobDao.GetFailed()
+	if err != nil {
+		log.Error("Failed to fetch failed battle jobs", log.Fields{"error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	rows := make([]adminJobRow, 0, len(failed))
+	for _, job := range failed {
+		var names []string
+		for _, wizardID := range job.WizardIDs() {
+			wizard, err := router.wizardDao.GetByID(wizardID)
+			if err != nil {
+				log.Error("Failed to fetch wizard", log.Fields{"wizard": wizardID, "error": err})
+				custom500Handler(w, r)
+				return
+			}
+
+			if wizard != nil {
+				names = append(names, wizard.Name)
+			} else {
+				names = append(names, "(deleted wizard)")
+			}
+		}
+
+		rows = append(rows, adminJobRow{job, strings.Join(names, " vs "), router.AdminJobRequeue(job.ID).String()})
+	}
+
+	data := struct {
+		Jobs []adminJobRow
+	}{
+		rows,
+	}
+
+	context.render(w, "adminjobs.html", data)
+}
+
+// requeueJobActionHandler gives a failed battle job another set of
+// attempts. Jobs that have not failed are left alone.
+func requeueJobActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	jobID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	job, err := router.jobDao.GetByID(jobID)
+	if err != nil {
+		log.Error("Failed to fetch battle job", log.Fields{"job": jobID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	if job == nil {
+		render(w, "404.html", nil)
+		return
+	}
+
+	if job.State == jobs.Failed {
+		job.Requeue()
+		if err := router.jobDao.Update(job); err != nil {
+			log.Error("Failed to requeue battle job", log.Fields{"job": job.ID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+
+		log.Info("Battle job requeued by admin", log.Fields{"job": job.ID, "admin": context.User.Username})
+	}
+
+	http.Redirect(w, r, router.AdminJobs().String(), http.StatusSeeOther)
+}
+
+// adminLogsPageHandler shows the errors that have been logged since the
+// server started, up to log.RecentSize of them.
+func adminLogsPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	data := struct {
+		Records []log.Record
+	}{
+		log.Recent(),
+	}
+
+	context.render(w, "adminlogs.html", data)
+}
+
+func findAdminUser(w http.ResponseWriter, r *http.Request, context *context) (*users.User, bool) {
+	userID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	user, err := context.Router.userDao.GetByID(userID)
+	if err != nil {
+		log.Error("Failed to fetch user", log.Fields{"user": userID, "error": err})
+		custom500Handler(w, r)
+		return nil, false
+	}
+
+	if user == nil {
+		render(w, "404.html", nil)
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,73 @@
+package views
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/jobs"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// The spectator page reads the battle straight from the v1 API
+	liveSocketPath = "/api/v1/battles/jobs/%d/live"
+	replayPath     = "/api/v1/battles/%d/replay"
+)
+
+// watchBattlePageHandler shows a battle as it is being fought. The page
+// can be opened while the battle is still queued, and starts playing as
+// soon as a worker picks it up.
+func watchBattlePageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	jobID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	job, err := router.jobDao.GetByID(jobID)
+	if err != nil {
+		log.Error("Failed to fetch battle job", log.Fields{"job": jobID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	if job == nil {
+		render(w, "404.html", nil)
+		return
+	}
+
+	var names []string
+	for _, wizardID := range job.WizardIDs() {
+		wizard, err := router.wizardDao.GetByID(wizardID)
+		if err != nil {
+			log.Error("Failed to fetch wizard", log.Fields{"wizard": wizardID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+
+		if wizard != nil {
+			names = append(names, wizard.Name)
+		} else {
+			names = append(names, "(deleted wizard)")
+		}
+	}
+
+	data := struct {
+		Job         *jobs.Job
+		WizardNames []string
+		Live        bool
+		SocketPath  string
+		ReplayPath  string
+	}{
+		Job:         job,
+		WizardNames: names,
+		Live:        job.State == jobs.Queued || job.State == jobs.Running,
+		SocketPath:  fmt.Sprintf(liveSocketPath, job.ID),
+	}
+
+	if job.BattleID != 0 {
+		data.ReplayPath = fmt.Sprintf(replayPath, job.BattleID)
+	}
+
+	context.render(w, "battle.html", data)
+}
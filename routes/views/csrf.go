@@ -0,0 +1,121 @@
+package views
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	csrfTokenKey   = "csrfToken"    // the session value that holds the token
+	csrfFieldName  = "csrfToken"    // the form field that forms submit it in
+	csrfHeaderName = "X-CSRF-Token" // the header that scripts can send it in
+	csrfCookieName = "codewiz-csrf" // the cookie that holds the token until the session is stored
+)
+
+// csrfCookie keeps the CSRF token of a visitor whose session has not been
+// stored. Sessions are only stored once they have a value, so that visitors
+// who only browse the site do not fill the datastore. The cookie is signed,
+// so another site cannot set it to a token of its choosing.
+type csrfCookie struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+}
+
+func newCSRFCookie(options sessions.Options, keyPairs ...[]byte) *csrfCookie {
+	// The cookie lasts until the browser is closed, like a session that has
+	// not been stored yet
+	options.MaxAge = 0
+	return &csrfCookie{Codecs: securecookie.CodecsFromPairs(keyPairs...), Options: &options}
+}
+
+// read returns the token in the request's cookie, if it has a valid one.
+func (cookie *csrfCookie) read(r *http.Request) (string, bool) {
+	value, err := r.Cookie(csrfCookieName)
+	if err != nil {
+		return "", false
+	}
+
+	var token string
+	if err := securecookie.DecodeMulti(csrfCookieName, value.Value, &token, cookie.Codecs...); err != nil || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func (cookie *csrfCookie) write(w http.ResponseWriter, token string) error {
+	encoded, err := securecookie.EncodeMulti(csrfCookieName, token, cookie.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessions.NewCookie(csrfCookieName, encoded, cookie.Options))
+	return nil
+}
+
+// issueCSRFToken returns the session's CSRF token, giving the session a new
+// one if it does not have one yet. Every form on the site must submit the
+// token, which another site cannot read, so that other sites cannot make
+// the browser submit forms on the user's behalf. Until the session has a
+// value of its own, the token is kept in a cookie instead.
+func issueCSRFToken(w http.ResponseWriter, r *http.Request, session *sessions.Session, cookie *csrfCookie) (string, error) {
+	if token, ok := session.Values[csrfTokenKey].(string); ok && token != "" {
+		return token, nil
+	}
+
+	if len(session.Values) == 0 {
+		if token, ok := cookie.read(r); ok {
+			return token, nil
+		}
+
+		token, err := newCSRFToken()
+		if err != nil {
+			return "", err
+		}
+		return token, cookie.write(w, token)
+	}
+
+	token, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	session.Values[csrfTokenKey] = token
+	return token, session.Save(r, w)
+}
+
+// resetCSRFToken removes the session's CSRF token, so that a new one is
+// issued on the next request. It should be called whenever a user logs in,
+// in case the token was obtained before then.
+func resetCSRFToken(session *sessions.Session) {
+	delete(session.Values, csrfTokenKey)
+}
+
+// checkCSRFToken reports whether the request can be served. Requests that
+// only read pages are always allowed, and every other request must carry
+// the session's token.
+func checkCSRFToken(r *http.Request, token string) bool {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+
+	submitted := r.Header.Get(csrfHeaderName)
+	if submitted == "" {
+		submitted = r.PostFormValue(csrfFieldName)
+	}
+
+	return submitted != "" && subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) == 1
+}
+
+func newCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
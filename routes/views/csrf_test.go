@@ -0,0 +1,175 @@
+package views
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+var testKey = []byte("test-session-key")
+
+func TestMain(m *testing.M) {
+	// Templates are found relative to the root of the repository
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestCheckCSRFToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		header   string
+		form     string
+		expected bool
+	}{
+		{"GET is exempt", "GET", "", "", true},
+		{"HEAD is exempt", "HEAD", "", "", true},
+		{"OPTIONS is exempt", "OPTIONS", "", "", true},
+		{"header token", "POST", "token", "", true},
+		{"form token", "POST", "", "token", true},
+		{"missing token", "POST", "", "", false},
+		{"wrong header token", "POST", "other", "", false},
+		{"wrong form token", "POST", "", "other", false},
+		{"header takes precedence", "POST", "other", "token", false},
+	}
+
+	for _, test := range tests {
+		form := url.Values{}
+		if test.form != "" {
+			form.Set(csrfFieldName, test.form)
+		}
+
+		request := httptest.NewRequest(test.method, "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.header != "" {
+			request.Header.Set(csrfHeaderName, test.header)
+		}
+
+		if allowed := checkCSRFToken(request, "token"); allowed != test.expected {
+			t.Errorf("%s: got %v want %v", test.name, allowed, test.expected)
+		}
+	}
+}
+
+// createTestHandler returns a handler for a page that anyone can use, and
+// reports whether the page was served and the token it was given.
+func createTestHandler() (*handler, *bool, *string) {
+	router := &Router{
+		sessionStore: sessions.NewCookieStore(testKey),
+		csrfCookie:   newCSRFCookie(sessions.Options{Path: "/"}, testKey),
+	}
+
+	served := false
+	token := ""
+	return newHandler(func(w http.ResponseWriter, r *http.Request, context *context) {
+		served = true
+		token = context.CSRFToken
+	}, router, nil), &served, &token
+}
+
+func TestHandler_RejectsFormWithoutCSRFToken(t *testing.T) {
+	handler, served, _ := createTestHandler()
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader("name=value"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+
+	if status := writer.Code; status != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusForbidden)
+	}
+
+	if !strings.Contains(writer.Body.String(), "This form has expired.") {
+		t.Errorf("Expected the form expired page, got %v", writer.Body.String())
+	}
+
+	if *served {
+		t.Errorf("Expected the page not to be served")
+	}
+}
+
+func TestHandler_KeepsVisitorTokenInCookie(t *testing.T) {
+	handler, served, token := createTestHandler()
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest("GET", "/", nil))
+	if !*served || *token == "" {
+		t.Fatalf("Expected the page to be served with a token")
+	}
+
+	// The session has no values, so it is not saved
+	var cookies []*http.Cookie
+	for _, cookie := range writer.Result().Cookies() {
+		if cookie.Name == sessionName {
+			t.Errorf("Expected the visitor's session not to be saved")
+		}
+		cookies = append(cookies, cookie)
+	}
+
+	issued := *token
+	form := url.Values{csrfFieldName: {issued}}
+	request := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	*served = false
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	if !*served || *token != issued {
+		t.Errorf("Expected the form to be accepted with the token from the cookie, got status %v", writer.Code)
+	}
+
+	// A token that was not issued by the server is rejected, even if the
+	// cookie is set to match it
+	forged := url.Values{csrfFieldName: {"forged"}}
+	request = httptest.NewRequest("POST", "/", strings.NewReader(forged.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "forged"})
+
+	*served = false
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	if *served || writer.Code != http.StatusForbidden {
+		t.Errorf("Expected a forged cookie to be rejected, got status %v", writer.Code)
+	}
+}
+
+func TestHandler_KeepsTokenInSessionWithValues(t *testing.T) {
+	handler, served, token := createTestHandler()
+	store := handler.Router.sessionStore
+
+	// Give the visitor a session with a value of its own
+	request := httptest.NewRequest("GET", "/", nil)
+	session, _ := store.Get(request, sessionName)
+	session.Values["flash"] = "value"
+	writer := httptest.NewRecorder()
+	if err := session.Save(request, writer); err != nil {
+		t.Fatal(err)
+	}
+
+	request = httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range writer.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	if !*served || *token == "" {
+		t.Fatalf("Expected the page to be served with a token")
+	}
+
+	for _, cookie := range writer.Result().Cookies() {
+		if cookie.Name == csrfCookieName {
+			t.Errorf("Expected the token to be kept in the session rather than a cookie")
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package views
 
 import (
+	"github.com/crob1140/codewiz-server/models/users"
 	"github.com/crob1140/codewiz-server/models/wizards"
 	"net/http"
 )
@@ -10,24 +11,61 @@ func dashboardPageHandler(w http.ResponseWriter, r *http.Request, context *conte
 
 	user := context.User
 	router := context.Router
+	session := context.Session
 
 	if user != nil {
+		notices := session.Flashes("notices")
+
+		// Save the session to ensure the flash messages are removed.
+		if err := session.Save(r, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		userWizards, err := router.wizardDao.GetByOwnerID(user.ID)
 		if err != nil {
 			custom500Handler(w, r)
 		}
 
+		// Only admins are shown the way into the admin console
+		adminPath := ""
+		if user.HasRole(users.Admin) {
+			adminPath = router.Admin().String()
+		}
+
+		// Accounts can only be linked if there are providers to link them from
+		identityListPath := ""
+		if len(router.identityProviders) != 0 {
+			identityListPath = router.IdentityList().String()
+		}
+
 		data := struct {
 			Username string
 			Wizards []*wizards.Wizard
 			CreateWizardPath string
+			AdminPath string
+			Notices []interface{}
+			EmailVerified bool
+			VerificationResendPath string
+			SessionListPath string
+			IdentityListPath string
+			TwoFactorPath string
+			LogoutPath string
 		}{
 			user.Username,
 			userWizards,
 			router.WizardCreation().String(),
+			adminPath,
+			notices,
+			user.EmailVerified,
+			router.VerificationResend().String(),
+			router.SessionList().String(),
+			identityListPath,
+			router.TwoFactor().String(),
+			router.Logout().String(),
 		}
 
-		render(w, "dashboard.html", data)		
+		context.render(w, "dashboard.html", data)		
 	} else {
 		// TODO: show index page
 	}
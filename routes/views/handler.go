@@ -1,6 +1,7 @@
 package views
 
 import (
+	"github.com/crob1140/codewiz-server/log"
 	"github.com/crob1140/codewiz-server/models/users"
 	"github.com/gorilla/sessions"
 	"net/http"
@@ -8,28 +9,30 @@ import (
 
 const (
 	sessionName  = "codewiz-session"
+	userIDKey = "userID" // the session value that holds the logged in user's ID
 )
 
 type context struct {
 	Router *Router
 	User *users.User
 	Session *sessions.Session
+	CSRFToken string // the token that forms on the page must submit
 }
 
 type handlerFunc func(http.ResponseWriter, *http.Request, *context)
 
 type handler struct {
 	Router *Router
-	RequiresLogin bool
+	Roles []string // the roles that can use the page, or empty if anyone can
 	HandlerFunc handlerFunc
 }
 
-func newContext(router *Router, user *users.User, session *sessions.Session) *context {
-	return &context{User : user, Session : session, Router : router}
+func newContext(router *Router, user *users.User, session *sessions.Session, csrfToken string) *context {
+	return &context{User : user, Session : session, Router : router, CSRFToken : csrfToken}
 }
 
-func newHandler(handlerFunc handlerFunc, router *Router, requiresLogin bool) *handler {
-	return &handler{Router: router, HandlerFunc: handlerFunc, RequiresLogin : requiresLogin}
+func newHandler(handlerFunc handlerFunc, router *Router, roles []string) *handler {
+	return &handler{Router: router, HandlerFunc: handlerFunc, Roles : roles}
 }
 
 // This method performs all of the common code and passes down the
@@ -50,21 +53,62 @@ func (handler *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if user == nil && handler.RequiresLogin {
-		loginUrl := router.Login()
-		http.Redirect(w, r, loginUrl.String(), http.StatusUnauthorized)
+	if len(handler.Roles) != 0 && !user.HasAnyRole(handler.Roles...) {
+		if user == nil {
+			loginUrl := router.Login()
+			http.Redirect(w, r, loginUrl.String(), http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+		render(w, "403.html", nil)
+		return
+	}
+
+	csrfToken, err := issueCSRFToken(w, r, session, router.csrfCookie)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !checkCSRFToken(r, csrfToken) {
+		log.Warn("Rejected request without a valid CSRF token", log.Fields{"method" : r.Method, "path" : r.URL.Path})
+		w.WriteHeader(http.StatusForbidden)
+		render(w, "csrf.html", nil)
 		return
 	}
 
-	context := newContext(router, user, session)
+	// Admins have to set up two-factor authentication before they can use
+	// the pages that only they can see
+	if handler.adminOnly() && !requireTwoFactor(w, r, router, user) {
+		return
+	}
+
+	context := newContext(router, user, session, csrfToken)
 	handler.HandlerFunc(w, r, context)
 }
 
+// adminOnly reports whether the page can only be used by admins.
+func (handler *handler) adminOnly() bool {
+	return len(handler.Roles) == 1 && handler.Roles[0] == users.Admin
+}
+
 func getUserForSession(session *sessions.Session, userDao *users.Dao) (*users.User, error) {
-	userID := session.Values["userID"]
+	userID := session.Values[userIDKey]
 	if userID == nil {
 		return nil, nil
 	}
 
-	return userDao.GetByID(userID.(uint64))
+	user, err := userDao.GetByID(userID.(uint64))
+	if err != nil || user == nil || user.Disabled {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// render shows a page that may contain forms, which are given the
+// session's CSRF token.
+func (context *context) render(w http.ResponseWriter, templateName string, data interface{}) {
+	renderWithCSRFToken(w, templateName, data, context.CSRFToken)
 }
\ No newline at end of file
@@ -0,0 +1,554 @@
+package views
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models"
+	"github.com/crob1140/codewiz-server/models/identities"
+	"github.com/crob1140/codewiz-server/models/logins"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/oidc"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/gorilla/mux"
+)
+
+const (
+	externalLoginKey = "externalLogin" // the session value that holds the login in progress
+
+	// maxGeneratedUsernameLength keeps the usernames of users who register
+	// through a provider short enough to show on the leaderboard.
+	maxGeneratedUsernameLength = 32
+)
+
+// externalLogin is kept in the session while the user is away at a
+// provider, so that their return can be checked.
+type externalLogin struct {
+	Provider   string
+	State      string
+	Nonce      string
+	Verifier   string
+	LinkUserID uint64 // the user to link the account to, or zero to log in with it
+}
+
+func init() {
+	gob.Register(externalLogin{})
+}
+
+type identityRow struct {
+	*identities.Identity
+	DisplayName string
+	UnlinkPath  string
+}
+
+type providerLink struct {
+	DisplayName string
+	Path        string
+}
+
+// identityProvider returns the configured provider with the given name, or
+// nil if there is none.
+func (router *Router) identityProvider(name string) *oidc.Provider {
+	for _, provider := range router.identityProviders {
+		if provider.Name == name {
+			return provider
+		}
+	}
+	return nil
+}
+
+// externalLoginPageHandler sends the user to the provider to log in.
+func externalLoginPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+	startExternalLogin(w, r, context, 0)
+}
+
+// linkIdentityActionHandler sends the user to the provider to log in, so
+// that the account they log in with can be linked to theirs.
+func linkIdentityActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+	startExternalLogin(w, r, context, context.User.ID)
+}
+
+func startExternalLogin(w http.ResponseWriter, r *http.Request, context *context, linkUserID uint64) {
+
+	router := context.Router
+	session := context.Session
+
+	provider := router.identityProvider(mux.Vars(r)["provider"])
+	if provider == nil {
+		render(w, "404.html", nil)
+		return
+	}
+
+	request, err := oidc.NewAuthRequest()
+	if err != nil {
+		log.Error("Failed to create authorization request", log.Fields{"error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	authURL, err := provider.AuthURL(request, externalLoginRedirectURI(r, router, provider))
+	if err != nil {
+		log.Error("Failed to contact identity provider", log.Fields{"provider": provider.Name, "error": err})
+		failExternalLogin(w, r, context, linkUserID != 0, provider.DisplayName+" is not available at the moment. Please try again later.")
+		return
+	}
+
+	session.Values[externalLoginKey] = externalLogin{
+		Provider:   provider.Name,
+		State:      request.State,
+		Nonce:      request.Nonce,
+		Verifier:   request.Verifier,
+		LinkUserID: linkUserID,
+	}
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// externalLoginCallbackHandler is where the provider sends the user back
+// to. The account they logged in with is either linked to the current user,
+// or used to log them in. Users who have not logged in with the account
+// before are matched to an existing user by their email address if both
+// sides have verified it, and are registered otherwise.
+func externalLoginCallbackHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+
+	provider := router.identityProvider(mux.Vars(r)["provider"])
+	if provider == nil {
+		render(w, "404.html", nil)
+		return
+	}
+
+	// The login can only be completed once
+	pending, ok := session.Values[externalLoginKey].(externalLogin)
+	delete(session.Values, externalLoginKey)
+	linking := ok && pending.LinkUserID != 0
+
+	query := r.URL.Query()
+	if !ok || pending.Provider != provider.Name || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(pending.State)) != 1 {
+		failExternalLogin(w, r, context, linking, "Signing in with "+provider.DisplayName+" could not be completed. Please try again.")
+		return
+	}
+
+	if reason := query.Get("error"); reason != "" {
+		message := provider.DisplayName + " could not sign you in. Please try again."
+		if reason == "access_denied" {
+			message = "Signing in with " + provider.DisplayName + " was cancelled."
+		}
+		failExternalLogin(w, r, context, linking, message)
+		return
+	}
+
+	now := time.Now()
+	request := &oidc.AuthRequest{State: pending.State, Nonce: pending.Nonce, Verifier: pending.Verifier}
+	claims, err := provider.Exchange(query.Get("code"), request, externalLoginRedirectURI(r, router, provider), now)
+	if err != nil {
+		log.Warn("Failed to complete external login", log.Fields{"provider": provider.Name, "error": err})
+		failExternalLogin(w, r, context, linking, provider.DisplayName+" could not sign you in. Please try again.")
+		return
+	}
+
+	identity, err := findIdentity(router, provider.Name, claims.Subject)
+	if err != nil {
+		log.Error("Failed to fetch identity", log.Fields{"provider": provider.Name, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	if linking {
+		linkIdentity(w, r, context, provider, pending.LinkUserID, identity, claims, now)
+	} else {
+		loginWithIdentity(w, r, context, provider, identity, claims, now)
+	}
+}
+
+// linkIdentity links the account to the user who asked for it to be.
+func linkIdentity(w http.ResponseWriter, r *http.Request, context *context, provider *oidc.Provider, userID uint64, identity *identities.Identity, claims *oidc.Claims, now time.Time) {
+
+	router := context.Router
+	session := context.Session
+
+	if context.User == nil || context.User.ID != userID {
+		failExternalLogin(w, r, context, false, "You were logged out before your "+provider.DisplayName+" account could be linked. Please log in and try again.")
+		return
+	}
+
+	if identity != nil && identity.UserID != userID {
+		failExternalLogin(w, r, context, true, "This "+provider.DisplayName+" account is already linked to another user.")
+		return
+	}
+
+	if identity == nil {
+		if err := router.identityDao.Insert(identities.NewIdentity(userID, provider.Name, claims.Subject, claims.Email, now)); err != nil {
+			log.Error("Failed to link identity", log.Fields{"user": userID, "provider": provider.Name, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+		log.Info("User has linked an external account", log.Fields{"username": context.User.Username, "provider": provider.Name})
+	}
+
+	session.AddFlash("Your "+provider.DisplayName+" account has been linked.", "notices")
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, router.IdentityList().String(), http.StatusSeeOther)
+}
+
+// loginWithIdentity logs in the user that the account is linked to,
+// linking or registering a user first if it has not been used before.
+func loginWithIdentity(w http.ResponseWriter, r *http.Request, context *context, provider *oidc.Provider, identity *identities.Identity, claims *oidc.Claims, now time.Time) {
+
+	router := context.Router
+	session := context.Session
+
+	var user *users.User
+	var err error
+	if identity != nil {
+		user, err = router.userDao.GetByID(identity.UserID)
+		if err != nil {
+			log.Error("Failed to fetch user", log.Fields{"user": identity.UserID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+
+		identity.Email = claims.Email
+		identity.LastLoginTime = now
+		err = router.identityDao.Update(identity)
+	} else {
+		// The account is linked in the same transaction that registers the
+		// user, so that a failure cannot leave a user nobody can log in as
+		var problem string
+		var registered bool
+		err = router.userDao.DB.WithTransaction(func(tx *datastore.DB) error {
+			var err error
+			user, registered, problem, err = findOrRegisterUser(router.userDao.WithTx(tx), provider, claims)
+			if err != nil || user == nil {
+				return err
+			}
+			return router.identityDao.WithTx(tx).Insert(identities.NewIdentity(user.ID, provider.Name, claims.Subject, claims.Email, now))
+		})
+
+		if err == nil && user == nil {
+			failExternalLogin(w, r, context, false, problem)
+			return
+		}
+
+		if err == nil && registered {
+			log.Info("User has registered with an external account", log.Fields{"username": user.Username, "provider": provider.Name})
+			if !user.EmailVerified {
+				if err := sendVerificationEmail(r, router, user); err != nil {
+					log.Error("Failed to send verification email", log.Fields{"user": user.ID, "error": err})
+				}
+			}
+		}
+	}
+
+	if err != nil {
+		log.Error("Failed to log in with identity", log.Fields{"provider": provider.Name, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	if user.Disabled {
+		failExternalLogin(w, r, context, false, "This account has been disabled.")
+		return
+	}
+
+	// Users with two-factor authentication still have to enter a code,
+	// and the attempt is recorded once they have
+	if !user.TwoFactorEnabled() {
+		attempt := logins.NewAttempt(user.Username, user.ID, routes.ClientIP(r), logins.External, logins.Succeeded, now)
+		if err := router.loginGuard.Record(attempt); err != nil {
+			log.Error("Failed to record login attempt", log.Fields{"username": user.Username, "error": err})
+		}
+	}
+
+	destination := logIn(router, session, user, logins.External)
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Debug("User has signed in with an external account", log.Fields{"username": user.Username, "provider": provider.Name})
+	http.Redirect(w, r, destination.String(), http.StatusSeeOther)
+}
+
+// findIdentity returns the identity for the provider's account. Identities
+// of users who have since been deleted are removed, so that the account can
+// be used again.
+func findIdentity(router *Router, provider string, subject string) (*identities.Identity, error) {
+	identity, err := router.identityDao.GetBySubject(provider, subject)
+	if err != nil || identity == nil {
+		return nil, err
+	}
+
+	user, err := router.userDao.GetByID(identity.UserID)
+	if err != nil || user != nil {
+		return identity, err
+	}
+
+	return nil, router.identityDao.Delete(identity)
+}
+
+// findOrRegisterUser returns the user that a new account should be linked
+// to, and whether they were registered for it. If there is none, it returns
+// a message explaining why.
+func findOrRegisterUser(userDao *users.Dao, provider *oidc.Provider, claims *oidc.Claims) (*users.User, bool, string, error) {
+
+	// Matching by email address is only safe if both sides have checked
+	// that the user owns it, since anyone could otherwise take over an
+	// account by registering its address with the provider
+	if claims.EmailVerified {
+		found, err := userDao.GetByEmail(claims.Email)
+		if err != nil {
+			return nil, false, "", err
+		}
+
+		var verified []*users.User
+		for _, user := range found {
+			if user.EmailVerified {
+				verified = append(verified, user)
+			}
+		}
+
+		if len(verified) == 1 {
+			log.Info("Linked external account by email address", log.Fields{"username": verified[0].Username, "provider": provider.Name})
+			return verified[0], false, "", nil
+		}
+
+		if len(verified) > 1 {
+			return nil, false, "More than one user has the email address " + claims.Email + ". Log in with your password and link your " + provider.DisplayName + " account from the linked accounts page.", nil
+		}
+	}
+
+	if claims.Email == "" {
+		return nil, false, provider.DisplayName + " did not share your email address, so an account could not be created for you.", nil
+	}
+
+	username, err := availableUsername(userDao, claims)
+	if err != nil {
+		return nil, false, "", err
+	}
+
+	// The user has no password of their own until they reset it
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, false, "", err
+	}
+
+	user := users.NewUser(username, base64.RawURLEncoding.EncodeToString(buf), claims.Email)
+	user.Name = truncateRunes(claims.Name, 128)
+	user.EmailVerified = claims.EmailVerified
+
+	validationErrs, err := userDao.InsertValid(user)
+	if err != nil {
+		return nil, false, "", err
+	}
+
+	if len(validationErrs) != 0 {
+		log.Warn("Failed to register user from external account", log.Fields{"provider": provider.Name, "errors": validationErrs})
+		return nil, false, "An account could not be created from your " + provider.DisplayName + " account. Please register with a password instead.", nil
+	}
+
+	return user, true, "", nil
+}
+
+// availableUsername picks a username for a user who registers through a
+// provider, based on what the provider knows them as. A number is added if
+// the username has been taken.
+func availableUsername(userDao *users.Dao, claims *oidc.Claims) (string, error) {
+	base := ""
+	for _, candidate := range []string{claims.PreferredUsername, strings.Split(claims.Email, "@")[0], claims.Name} {
+		if base = sanitizeUsername(candidate); base != "" {
+			break
+		}
+	}
+
+	if base == "" {
+		base = "wizard"
+	}
+
+	for attempt := 1; ; attempt++ {
+		username := base
+		if attempt > 1 {
+			suffix := strconv.Itoa(attempt)
+			username = truncateRunes(base, maxGeneratedUsernameLength-len(suffix)) + suffix
+		}
+
+		taken, err := userDao.IsUsernameTaken(username, 0)
+		if err != nil || !taken {
+			return username, err
+		}
+	}
+}
+
+// sanitizeUsername keeps the letters, digits, dashes, dots and underscores
+// of the name.
+func sanitizeUsername(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' || r == '_' {
+			return r
+		}
+		return -1
+	}, name)
+	return truncateRunes(sanitized, maxGeneratedUsernameLength)
+}
+
+func truncateRunes(text string, length int) string {
+	if runes := []rune(text); len(runes) > length {
+		return string(runes[:length])
+	}
+	return text
+}
+
+// externalLoginRedirectURI is where the provider sends the user back to,
+// which has to be registered with the provider.
+func externalLoginRedirectURI(r *http.Request, router *Router, provider *oidc.Provider) string {
+	return router.absoluteURL(r, router.ExternalLoginCallback(provider.Name)).String()
+}
+
+// failExternalLogin sends the user back to where they started, with a
+// message explaining what went wrong.
+func failExternalLogin(w http.ResponseWriter, r *http.Request, context *context, linking bool, message string) {
+
+	router := context.Router
+	session := context.Session
+
+	validationErrs := make(models.ValidationErrors)
+	validationErrs.Add("External", message)
+	session.AddFlash(validationErrs, "errs")
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	destination := router.Login()
+	if linking {
+		destination = router.IdentityList()
+	}
+	http.Redirect(w, r, destination.String(), http.StatusSeeOther)
+}
+
+// listIdentitiesPageHandler shows the accounts that the user can log in
+// with, and the providers whose accounts they can link.
+func listIdentitiesPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+
+	errList := session.Flashes("errs")
+	var validationErrs models.ValidationErrors
+	if len(errList) != 0 {
+		validationErrs = errList[0].(models.ValidationErrors)
+	}
+	notices := session.Flashes("notices")
+
+	// Save the session to ensure the flash messages are removed.
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	linked, err := router.identityDao.GetByUserID(context.User.ID)
+	if err != nil {
+		log.Error("Failed to fetch identities", log.Fields{"user": context.User.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	rows := make([]identityRow, 0, len(linked))
+	isLinked := make(map[string]bool)
+	for _, identity := range linked {
+		// Providers that have been removed from the configuration are still
+		// listed, so that their accounts can be unlinked
+		displayName := identity.Provider
+		if provider := router.identityProvider(identity.Provider); provider != nil {
+			displayName = provider.DisplayName
+		}
+
+		rows = append(rows, identityRow{
+			Identity:    identity,
+			DisplayName: displayName,
+			UnlinkPath:  router.IdentityUnlink(identity.ID).String(),
+		})
+		isLinked[identity.Provider] = true
+	}
+
+	var available []providerLink
+	for _, provider := range router.identityProviders {
+		if !isLinked[provider.Name] {
+			available = append(available, providerLink{provider.DisplayName, router.IdentityLink(provider.Name).String()})
+		}
+	}
+
+	data := struct {
+		Identities         []identityRow
+		Providers          []providerLink
+		ForgotPasswordPath string
+		Notices            []interface{}
+		ValidationErrors   models.ValidationErrors
+	}{
+		rows,
+		available,
+		router.ForgotPassword().String(),
+		notices,
+		validationErrs,
+	}
+
+	context.render(w, "identities.html", data)
+}
+
+// unlinkIdentityActionHandler stops the user from logging in with one of
+// their linked accounts.
+func unlinkIdentityActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+
+	identityID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	identity, err := router.identityDao.GetByID(identityID)
+	if err != nil {
+		log.Error("Failed to fetch identity", log.Fields{"identity": identityID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	// Other users' identities are reported as missing, so that their IDs
+	// are not given away
+	if identity == nil || identity.UserID != context.User.ID {
+		render(w, "404.html", nil)
+		return
+	}
+
+	if err := router.identityDao.Delete(identity); err != nil {
+		log.Error("Failed to unlink identity", log.Fields{"identity": identity.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	log.Info("User has unlinked an external account", log.Fields{"username": context.User.Username, "provider": identity.Provider})
+
+	session.AddFlash("The account has been unlinked.", "notices")
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, router.IdentityList().String(), http.StatusSeeOther)
+}
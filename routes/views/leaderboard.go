@@ -0,0 +1,89 @@
+package views
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/crob1140/codewiz-server/interpreters"
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/leaderboards"
+	"github.com/crob1140/codewiz-server/models/seasons"
+)
+
+func leaderboardPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	params := r.URL.Query()
+
+	allSeasons, err := router.seasonDao.GetAll()
+	if err != nil {
+		log.Error("Failed to fetch seasons", log.Fields{"error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	query := leaderboards.Query{
+		Language: params.Get("language"),
+		Cursor:   params.Get("cursor"),
+	}
+
+	// An unknown season falls back to the global leaderboard
+	var selected *seasons.Season
+	seasonID, _ := strconv.ParseUint(params.Get("season"), 10, 64)
+	for _, season := range allSeasons {
+		if season.ID == seasonID {
+			selected = season
+		}
+	}
+
+	archived := false
+	if selected != nil {
+		query.SeasonID = selected.ID
+		archived, err = router.seasonDao.HasStandings(selected.ID)
+		if err != nil {
+			log.Error("Failed to fetch season standings", log.Fields{"season": selected.ID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+	}
+
+	page, err := router.leaderboardDao.Get(query, archived)
+	if err == leaderboards.ErrInvalidCursor {
+		// Start again from the top rather than showing an error for a stale link
+		query.Cursor = ""
+		page, err = router.leaderboardDao.Get(query, archived)
+	}
+	if err != nil {
+		log.Error("Failed to fetch leaderboard", log.Fields{"error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	nextPath := ""
+	if page.NextCursor != "" {
+		params.Set("cursor", page.NextCursor)
+		next := url.URL{Path: router.Leaderboard().Path, RawQuery: params.Encode()}
+		nextPath = next.String()
+	}
+
+	data := struct {
+		SubmitPath       string
+		Seasons          []*seasons.Season
+		SelectedSeasonID uint64
+		Languages        []string
+		SelectedLanguage string
+		Entries          []*leaderboards.Entry
+		NextPath         string
+	}{
+		router.Leaderboard().String(),
+		allSeasons,
+		query.SeasonID,
+		interpreters.Languages(),
+		query.Language,
+		page.Entries,
+		nextPath,
+	}
+
+	context.render(w, "leaderboard.html", data)
+}
@@ -2,9 +2,14 @@ package views
 
 import (
 	"github.com/crob1140/codewiz-server/models"
+	"github.com/crob1140/codewiz-server/models/logins"
 	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/routes"
 	"github.com/crob1140/codewiz-server/log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 
@@ -29,16 +34,25 @@ func loginPageHandler(w http.ResponseWriter, r *http.Request, context *context)
 		return
 	}
 
+	var providers []providerLink
+	for _, provider := range router.identityProviders {
+		providers = append(providers, providerLink{provider.DisplayName, router.ExternalLogin(provider.Name).String()})
+	}
+
 	loginUrl := router.Login()
 	data := struct {
 		SubmitPath  string
+		ForgotPasswordPath string
+		Providers []providerLink
 		ValidationErrors models.ValidationErrors
 	}{
 		loginUrl.String(), 
+		router.ForgotPassword().String(),
+		providers,
 		validationErrs,
 	}
 
-	render(w, "login.html", data)
+	context.render(w, "login.html", data)
 }
 
 func loginActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
@@ -46,25 +60,25 @@ func loginActionHandler(w http.ResponseWriter, r *http.Request, context *context
 	router := context.Router
 	session := context.Session
 
-	user, validationErrs, err := validateLoginRequest(r, router.userDao)
+	user, validationErrs, err := validateLoginRequest(r, router.userDao, router.loginGuard)
 	if err != nil {
 		custom500Handler(w,r)
 		return
 	}
 
 	if len(validationErrs) == 0 {
-		// Log the user in by saving their username as a session attribute
-		session.Values["userID"] = user.ID
+		// Log the user in by saving their username as a session attribute,
+		// or ask for their code first if they use two-factor authentication
+		destination := logIn(router, session, user, logins.Web)
 		if err := session.Save(r, w); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		log.Debug("User has logged in", log.Fields{"username" : user.Username})
+		log.Debug("User has entered their password", log.Fields{"username" : user.Username})
 
 		// Redirect the user to the dashboard
-		dashboardUrl := router.Dashboard()
-		http.Redirect(w, r, dashboardUrl.String(), http.StatusSeeOther)
+		http.Redirect(w, r, destination.String(), http.StatusSeeOther)
 	} else {
 		// Add the errors to a flash message so that we can access them
 		// after redirection
@@ -80,7 +94,11 @@ func loginActionHandler(w http.ResponseWriter, r *http.Request, context *context
 	}
 }
 
-func validateLoginRequest(r *http.Request, userDao *users.Dao) (*users.User, models.ValidationErrors, error) {
+// validateLoginRequest checks the username and password, unless there have
+// been too many failed attempts to log in as the user or from the client's
+// address recently. Every attempt that reaches the password check is added
+// to the audit trail.
+func validateLoginRequest(r *http.Request, userDao *users.Dao, guard *logins.Guard) (*users.User, models.ValidationErrors, error) {
 	errs := make(models.ValidationErrors)
 
 	password := r.FormValue("password")
@@ -101,10 +119,54 @@ func validateLoginRequest(r *http.Request, userDao *users.Dao) (*users.User, mod
 			return nil, nil, err
 		}
 
-		if user == nil || !user.VerifyPassword(password) {
+		var userID uint64
+		if user != nil {
+			userID = user.ID
+		}
+
+		ipAddress := routes.ClientIP(r)
+		now := time.Now()
+		wait, _, err := guard.Check(username, ipAddress, now)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		outcome := logins.Failed
+		if wait > 0 {
+			outcome = logins.Throttled
+			errs.Add("Username", "Too many failed login attempts. Please try again in " + describeWait(wait) + ".")
+		} else if user == nil || !user.VerifyPassword(password) {
 			errs.Add("Username", "The username or password you have entered is invalid.")
+		} else if user.Disabled {
+			errs.Add("Username", "This account has been disabled.")
+			outcome = logins.Succeeded
+		} else if user.TwoFactorEnabled() {
+			// The outcome is only known once the user has entered their
+			// code, so that the password cannot be used to clear the
+			// failures from guessing it
+			return user, errs, nil
+		} else {
+			outcome = logins.Succeeded
+		}
+
+		if err := guard.Record(logins.NewAttempt(username, userID, ipAddress, logins.Web, outcome, now)); err != nil {
+			log.Error("Failed to record login attempt", log.Fields{"username" : username, "error" : err})
 		}
 	}
 
 	return user, errs, nil
-}
\ No newline at end of file
+}
+
+// describeWait rounds the wait up to whole seconds or minutes.
+func describeWait(wait time.Duration) string {
+	if wait <= time.Minute {
+		seconds := int(math.Ceil(wait.Seconds()))
+		if seconds == 1 {
+			return "1 second"
+		}
+		return strconv.Itoa(seconds) + " seconds"
+	}
+
+	minutes := int(math.Ceil(wait.Minutes()))
+	return strconv.Itoa(minutes) + " minutes"
+}
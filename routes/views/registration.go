@@ -1,6 +1,7 @@
 package views
 
 import (
+	"github.com/crob1140/codewiz-server/log"
 	"github.com/crob1140/codewiz-server/models"
 	"github.com/crob1140/codewiz-server/models/users"
 	"net/http"
@@ -37,7 +38,7 @@ func registerPageHandler(w http.ResponseWriter, r *http.Request, context *contex
 		validationErrs,
 	}
 
-	render(w, "register.html", data)
+	context.render(w, "register.html", data)
 }
 
 func registerActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
@@ -45,23 +46,26 @@ func registerActionHandler(w http.ResponseWriter, r *http.Request, context *cont
 	router := context.Router
 	session := context.Session
 
+	// Create a new User and store it in the database, if it is valid
 	user := extractUserFromRegistrationRequest(r)
-	validator := users.NewValidator(router.userDao)
-	validationErrs, err := validator.Validate(user)
+	validationErrs, err := router.userDao.InsertValid(user)
 	if err != nil {
+		log.Error("Failed to register user", log.Fields{"username" : user.Username, "error" : err})
 		custom500Handler(w,r)
 		return
 	}
 
 	if len(validationErrs) == 0 {
-		// Create a new User and store it in the database
-		if err := router.userDao.Insert(user); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		// The account is usable without a verified address, so a failure
+		// to send the email is logged rather than reported to the user,
+		// who can ask for another one from the dashboard
+		if err := sendVerificationEmail(r, router, user); err != nil {
+			log.Error("Failed to send verification email", log.Fields{"user" : user.ID, "error" : err})
 		}
 
 		// Log the user in by saving their username as a session attribute
-		session.Values["userID"] = user.ID
+		session.Values[userIDKey] = user.ID
+		resetCSRFToken(session)
 		if err := session.Save(r, w); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -1,15 +1,29 @@
 package views
 
 import (
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/mail"
+	"github.com/crob1140/codewiz-server/models/identities"
+	"github.com/crob1140/codewiz-server/models/jobs"
+	"github.com/crob1140/codewiz-server/models/leaderboards"
+	"github.com/crob1140/codewiz-server/models/logins"
+	"github.com/crob1140/codewiz-server/models/matchmaking"
+	"github.com/crob1140/codewiz-server/models/seasons"
+	"github.com/crob1140/codewiz-server/models/spells"
+	"github.com/crob1140/codewiz-server/models/tournaments"
 	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/models/usersessions"
+	"github.com/crob1140/codewiz-server/models/usertokens"
 	"github.com/crob1140/codewiz-server/models/wizards"
 	"github.com/crob1140/codewiz-server/config"
 	"github.com/crob1140/codewiz-server/config/keys"
+	"github.com/crob1140/codewiz-server/oidc"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 )
 
 
@@ -21,38 +35,115 @@ type Router struct {
 	*mux.Router
 	path         string
 	sessionStore sessions.Store
+	csrfCookie   *csrfCookie
 
 	userDao      *users.Dao
 	wizardDao	 *wizards.Dao
+	seasonDao	 *seasons.Dao
+	leaderboardDao *leaderboards.Dao
+	tournamentDao *tournaments.Dao
+	jobDao *jobs.Dao
+	queueDao *matchmaking.Dao
+	userTokenDao *usertokens.Dao
+	sessionDao *usersessions.Dao
+	identityDao *identities.Dao
+	loginGuard *logins.Guard
+	mailSender mail.Sender
+	spellCatalogue *spells.Catalogue
+
+	// The providers that users can log in with instead of a password, in
+	// the order they are shown on the login page.
+	identityProviders []*oidc.Provider
+
+	// The address that users reach the server at, which is used to build
+	// links in emails. It is nil if it has not been configured.
+	publicURL *url.URL
 
 	// Static URLs
 	resourceURL *url.URL
 	dashboardURL   *url.URL
 	registrationURL *url.URL
 	loginURL        *url.URL
+	twoFactorLoginURL *url.URL
+	twoFactorURL *url.URL
+	twoFactorEnableURL *url.URL
+	twoFactorDisableURL *url.URL
+	recoveryCodesURL *url.URL
 	wizardListURL   *url.URL
 	wizardCreationURL *url.URL
+	leaderboardURL  *url.URL
+	tournamentListURL *url.URL
+	adminURL *url.URL
+	adminUsersURL *url.URL
+	adminJobsURL *url.URL
+	adminLogsURL *url.URL
+	logoutURL *url.URL
+	sessionListURL *url.URL
+	identityListURL *url.URL
+	verifyEmailURL *url.URL
+	verificationResendURL *url.URL
+	forgotPasswordURL *url.URL
+	resetPasswordURL *url.URL
 
 	// Dynamic URLs
 	wizardViewRoute *mux.Route
+	tournamentViewRoute *mux.Route
+	liveBattleRoute *mux.Route
+	adminUserRoute *mux.Route
+	adminUserStatusRoute *mux.Route
+	adminWizardDeletionRoute *mux.Route
+	adminJobRequeueRoute *mux.Route
+	sessionRevocationRoute *mux.Route
+	externalLoginRoute *mux.Route
+	externalLoginCallbackRoute *mux.Route
+	identityLinkRoute *mux.Route
+	identityUnlinkRoute *mux.Route
 }
 
-func NewRouter(viewsPath string, userDao *users.Dao, wizardDao *wizards.Dao) http.Handler {
+func NewRouter(viewsPath string, userDao *users.Dao, wizardDao *wizards.Dao, seasonDao *seasons.Dao, leaderboardDao *leaderboards.Dao, tournamentDao *tournaments.Dao, jobDao *jobs.Dao, queueDao *matchmaking.Dao, userTokenDao *usertokens.Dao, sessionDao *usersessions.Dao, identityDao *identities.Dao, loginGuard *logins.Guard, mailSender mail.Sender, identityProviders []*oidc.Provider, spellCatalogue *spells.Catalogue) http.Handler {
 
-	// Initialise the session store with the necessary keys
-	sessionStore := sessions.NewCookieStore([]byte(config.GetString(keys.SessionKey))) // TODO: read this directly from config? make it another arg?
+	// Initialise the session store with the necessary keys. Sessions are
+	// kept in the datastore so that they can be revoked.
+	sessionStore := usersessions.NewStore(sessionDao, userIDKey, []byte(config.GetString(keys.SessionKey)))
 	sessionStore.Options = &sessions.Options{
 		Path:   "/",
 		MaxAge: secondsPerHour,
 		Secure: config.GetBool(keys.SessionSecure, false),	
+		HttpOnly: true,
 	}
+	csrfCookie := newCSRFCookie(*sessionStore.Options, []byte(config.GetString(keys.SessionKey)))
 
 	// Create a new router instance with the obtained data
 	router := &Router{Router: mux.NewRouter(), 
 		path: viewsPath, 
 		userDao: userDao,
 		wizardDao : wizardDao,
+		seasonDao : seasonDao,
+		leaderboardDao : leaderboardDao,
+		tournamentDao : tournamentDao,
+		jobDao : jobDao,
+		queueDao : queueDao,
+		userTokenDao : userTokenDao,
+		sessionDao : sessionDao,
+		identityDao : identityDao,
+		loginGuard : loginGuard,
+		mailSender : mailSender,
+		identityProviders : identityProviders,
+		spellCatalogue : spellCatalogue,
 		sessionStore: sessionStore,
+		csrfCookie: csrfCookie,
+	}
+
+	if publicURL := config.GetString(keys.PublicURL); publicURL != "" {
+		parsed, err := url.Parse(publicURL)
+		if err != nil || !parsed.IsAbs() {
+			log.Fatal("Invalid public URL", log.Fields{"url" : publicURL})
+		}
+		router.publicURL = parsed
+	} else {
+		log.Warn("Public URL has not been configured, so links in emails will use the address of each request", log.Fields{
+			"variable" : config.GetEnvironmentVariableName(keys.PublicURL),
+		})
 	}
 
 	// Add all of the routes to the router
@@ -70,40 +161,147 @@ func initRoutes(router *Router) {
 
 	// Add dashboard page
 	dashboardPath := router.path
-	dashboardRoute := router.addHandler("GET", dashboardPath, dashboardPageHandler, false)
+	dashboardRoute := router.addHandler("GET", dashboardPath, dashboardPageHandler)
 	router.dashboardURL, _ = dashboardRoute.URL()
 
 	// Add registration page
 	registrationPath := path.Join(router.path, "/register")
-	registrationRoute := router.addHandler("GET", registrationPath, registerPageHandler, false)
+	registrationRoute := router.addHandler("GET", registrationPath, registerPageHandler)
 	router.registrationURL, _ = registrationRoute.URL()
-	router.addHandler("POST", registrationPath, registerActionHandler, false)
+	router.addHandler("POST", registrationPath, registerActionHandler)
 
 	// Add login page
 	loginPath := path.Join(router.path, "/login")
-	loginRoute := router.addHandler("GET", loginPath, loginPageHandler, false)
+	loginRoute := router.addHandler("GET", loginPath, loginPageHandler)
 	router.loginURL, _ = loginRoute.URL() 
-	router.addHandler("POST", loginPath, loginActionHandler, false)
+	router.addHandler("POST", loginPath, loginActionHandler)
+
+	// Add the second step of logging in for users with two-factor
+	// authentication
+	twoFactorLoginPath := path.Join(loginPath, "/two-factor")
+	twoFactorLoginRoute := router.addHandler("GET", twoFactorLoginPath, twoFactorLoginPageHandler)
+	router.twoFactorLoginURL, _ = twoFactorLoginRoute.URL()
+	router.addHandler("POST", twoFactorLoginPath, twoFactorLoginActionHandler)
+
+	// Add logins through external identity providers
+	externalLoginPath := path.Join(loginPath, "/{provider:[a-z0-9]+}")
+	router.externalLoginRoute = router.addHandler("GET", externalLoginPath, externalLoginPageHandler)
+	router.externalLoginCallbackRoute = router.addHandler("GET", path.Join(externalLoginPath, "/callback"), externalLoginCallbackHandler)
+
+	// Add logout action
+	logoutRoute := router.addHandler("POST", path.Join(router.path, "/logout"), logoutActionHandler, users.Standard)
+	router.logoutURL, _ = logoutRoute.URL()
+
+	// Add active sessions page
+	sessionListPath := path.Join(router.path, "/sessions")
+	sessionListRoute := router.addHandler("GET", sessionListPath, listSessionsPageHandler, users.Standard)
+	router.sessionListURL, _ = sessionListRoute.URL()
+	router.sessionRevocationRoute = router.addHandler("POST", path.Join(sessionListPath, "/{id:[0-9]+}/revoke"), revokeSessionActionHandler, users.Standard)
+
+	// Add linked accounts page
+	identityListPath := path.Join(router.path, "/identities")
+	identityListRoute := router.addHandler("GET", identityListPath, listIdentitiesPageHandler, users.Standard)
+	router.identityListURL, _ = identityListRoute.URL()
+	router.identityLinkRoute = router.addHandler("POST", path.Join(identityListPath, "/link/{provider:[a-z0-9]+}"), linkIdentityActionHandler, users.Standard)
+	router.identityUnlinkRoute = router.addHandler("POST", path.Join(identityListPath, "/{id:[0-9]+}/unlink"), unlinkIdentityActionHandler, users.Standard)
+
+	// Add two-factor authentication settings
+	twoFactorPath := path.Join(router.path, "/two-factor")
+	twoFactorRoute := router.addHandler("GET", twoFactorPath, twoFactorPageHandler, users.Standard)
+	router.twoFactorURL, _ = twoFactorRoute.URL()
+
+	twoFactorEnableRoute := router.addHandler("POST", path.Join(twoFactorPath, "/enable"), enableTwoFactorActionHandler, users.Standard)
+	router.twoFactorEnableURL, _ = twoFactorEnableRoute.URL()
+
+	twoFactorDisableRoute := router.addHandler("POST", path.Join(twoFactorPath, "/disable"), disableTwoFactorActionHandler, users.Standard)
+	router.twoFactorDisableURL, _ = twoFactorDisableRoute.URL()
+
+	recoveryCodesRoute := router.addHandler("POST", path.Join(twoFactorPath, "/recovery-codes"), regenerateRecoveryCodesActionHandler, users.Standard)
+	router.recoveryCodesURL, _ = recoveryCodesRoute.URL()
+
+	// Add email verification pages
+	verifyEmailPath := path.Join(router.path, "/verify-email")
+	verifyEmailRoute := router.addHandler("GET", verifyEmailPath, verifyEmailPageHandler)
+	router.verifyEmailURL, _ = verifyEmailRoute.URL()
+
+	verificationResendRoute := router.addHandler("POST", path.Join(verifyEmailPath, "/resend"), resendVerificationActionHandler, users.Standard)
+	router.verificationResendURL, _ = verificationResendRoute.URL()
+
+	// Add password recovery pages
+	forgotPasswordPath := path.Join(router.path, "/forgot-password")
+	forgotPasswordRoute := router.addHandler("GET", forgotPasswordPath, forgotPasswordPageHandler)
+	router.forgotPasswordURL, _ = forgotPasswordRoute.URL()
+	router.addHandler("POST", forgotPasswordPath, forgotPasswordActionHandler)
+
+	resetPasswordPath := path.Join(router.path, "/reset-password")
+	resetPasswordRoute := router.addHandler("GET", resetPasswordPath, resetPasswordPageHandler)
+	router.resetPasswordURL, _ = resetPasswordRoute.URL()
+	router.addHandler("POST", resetPasswordPath, resetPasswordActionHandler)
 
 	// Add wizard list page
 	wizardListPath := path.Join(router.path, "/wizards")
-	wizardListRoute := router.addHandler("GET", wizardListPath, listWizardsPageHandler, true)
+	wizardListRoute := router.addHandler("GET", wizardListPath, listWizardsPageHandler, users.Standard)
 	router.wizardListURL, _ = wizardListRoute.URL()
 
 	// Add wizard creation page
 	wizardCreationPath := path.Join(router.path, "/wizards/create")
-	wizardCreationRoute := router.addHandler("GET", wizardCreationPath, createWizardPageHandler, true)
+	wizardCreationRoute := router.addHandler("GET", wizardCreationPath, createWizardPageHandler, users.Standard)
 	router.wizardCreationURL, _ = wizardCreationRoute.URL()
-	router.addHandler("POST", wizardCreationPath, createWizardActionHandler, true)
+	router.addHandler("POST", wizardCreationPath, createWizardActionHandler, users.Standard)
 
 	// Add wizard view/update page
 	wizardViewPath := path.Join(router.path, "/wizards/{id}")
-	router.wizardViewRoute = router.addHandler("GET", wizardViewPath, viewWizardPageHandler, true)
-	router.addHandler("POST", wizardViewPath, modifyWizardActionHandler, true)
+	router.wizardViewRoute = router.addHandler("GET", wizardViewPath, viewWizardPageHandler, users.Standard)
+	router.addHandler("POST", wizardViewPath, modifyWizardActionHandler, users.Standard)
+
+	// Add leaderboard page
+	leaderboardPath := path.Join(router.path, "/leaderboard")
+	leaderboardRoute := router.addHandler("GET", leaderboardPath, leaderboardPageHandler)
+	router.leaderboardURL, _ = leaderboardRoute.URL()
+
+	// Add tournament list page
+	tournamentListPath := path.Join(router.path, "/tournaments")
+	tournamentListRoute := router.addHandler("GET", tournamentListPath, listTournamentsPageHandler)
+	router.tournamentListURL, _ = tournamentListRoute.URL()
+
+	// Add tournament view/registration page
+	tournamentViewPath := path.Join(router.path, "/tournaments/{id:[0-9]+}")
+	router.tournamentViewRoute = router.addHandler("GET", tournamentViewPath, viewTournamentPageHandler)
+	router.addHandler("POST", tournamentViewPath, registerTournamentActionHandler, users.Standard)
+
+	// Add live battle spectator page
+	liveBattlePath := path.Join(router.path, "/battles/jobs/{id:[0-9]+}/live")
+	router.liveBattleRoute = router.addHandler("GET", liveBattlePath, watchBattlePageHandler)
+
+	// Add admin console
+	adminPath := path.Join(router.path, "/admin")
+	adminRoute := router.addHandler("GET", adminPath, adminPageHandler, users.Admin)
+	router.adminURL, _ = adminRoute.URL()
+
+	adminUsersPath := path.Join(adminPath, "/users")
+	adminUsersRoute := router.addHandler("GET", adminUsersPath, adminUsersPageHandler, users.Admin)
+	router.adminUsersURL, _ = adminUsersRoute.URL()
+
+	adminUserPath := path.Join(adminUsersPath, "/{id:[0-9]+}")
+	router.adminUserRoute = router.addHandler("GET", adminUserPath, adminUserPageHandler, users.Admin)
+	router.adminUserStatusRoute = router.addHandler("POST", path.Join(adminUserPath, "/status"), setUserStatusActionHandler, users.Admin)
+	router.adminWizardDeletionRoute = router.addHandler("POST", path.Join(adminPath, "/wizards/{id:[0-9]+}/delete"), deleteWizardActionHandler, users.Admin)
+
+	adminJobsPath := path.Join(adminPath, "/jobs")
+	adminJobsRoute := router.addHandler("GET", adminJobsPath, adminJobsPageHandler, users.Admin)
+	router.adminJobsURL, _ = adminJobsRoute.URL()
+	router.adminJobRequeueRoute = router.addHandler("POST", path.Join(adminJobsPath, "/{id:[0-9]+}/requeue"), requeueJobActionHandler, users.Admin)
+
+	adminLogsPath := path.Join(adminPath, "/logs")
+	adminLogsRoute := router.addHandler("GET", adminLogsPath, adminLogsPageHandler, users.Admin)
+	router.adminLogsURL, _ = adminLogsRoute.URL()
 }
 
-func (router *Router) addHandler(method string, path string, handlerFunc handlerFunc, requiresLogin bool) *mux.Route {
-	return router.Path(path).Handler(newHandler(handlerFunc, router, requiresLogin)).Methods(method)
+// addHandler adds a page that is only available to users with at least
+// one of the given roles, or to everyone if no roles are given. Pages that
+// need a login should require the standard role.
+func (router *Router) addHandler(method string, path string, handlerFunc handlerFunc, roles ...string) *mux.Route {
+	return router.Path(path).Handler(newHandler(handlerFunc, router, roles)).Methods(method)
 }
 
 func (router *Router) Dashboard() *url.URL {
@@ -118,6 +316,79 @@ func (router *Router) Login() *url.URL {
 	return router.loginURL
 }
 
+func (router *Router) TwoFactorLogin() *url.URL {
+	return router.twoFactorLoginURL
+}
+
+func (router *Router) TwoFactor() *url.URL {
+	return router.twoFactorURL
+}
+
+func (router *Router) TwoFactorEnable() *url.URL {
+	return router.twoFactorEnableURL
+}
+
+func (router *Router) TwoFactorDisable() *url.URL {
+	return router.twoFactorDisableURL
+}
+
+func (router *Router) RecoveryCodes() *url.URL {
+	return router.recoveryCodesURL
+}
+
+func (router *Router) Logout() *url.URL {
+	return router.logoutURL
+}
+
+func (router *Router) SessionList() *url.URL {
+	return router.sessionListURL
+}
+
+func (router *Router) SessionRevocation(sessionID uint64) *url.URL {
+	url, _ := router.sessionRevocationRoute.URL("id", strconv.FormatUint(sessionID, 10))
+	return url
+}
+
+func (router *Router) ExternalLogin(provider string) *url.URL {
+	url, _ := router.externalLoginRoute.URL("provider", provider)
+	return url
+}
+
+func (router *Router) ExternalLoginCallback(provider string) *url.URL {
+	url, _ := router.externalLoginCallbackRoute.URL("provider", provider)
+	return url
+}
+
+func (router *Router) IdentityList() *url.URL {
+	return router.identityListURL
+}
+
+func (router *Router) IdentityLink(provider string) *url.URL {
+	url, _ := router.identityLinkRoute.URL("provider", provider)
+	return url
+}
+
+func (router *Router) IdentityUnlink(identityID uint64) *url.URL {
+	url, _ := router.identityUnlinkRoute.URL("id", strconv.FormatUint(identityID, 10))
+	return url
+}
+
+func (router *Router) VerifyEmail() *url.URL {
+	return router.verifyEmailURL
+}
+
+func (router *Router) VerificationResend() *url.URL {
+	return router.verificationResendURL
+}
+
+func (router *Router) ForgotPassword() *url.URL {
+	return router.forgotPasswordURL
+}
+
+func (router *Router) ResetPassword() *url.URL {
+	return router.resetPasswordURL
+}
+
 func (router *Router) WizardList() *url.URL {
 	return router.wizardListURL
 }
@@ -126,7 +397,61 @@ func (router *Router) WizardCreation() *url.URL {
 	return router.wizardCreationURL
 }
 
+func (router *Router) Leaderboard() *url.URL {
+	return router.leaderboardURL
+}
+
+func (router *Router) TournamentList() *url.URL {
+	return router.tournamentListURL
+}
+
+func (router *Router) TournamentDetails(tournamentID uint64) *url.URL {
+	url, _ := router.tournamentViewRoute.URL("id", strconv.FormatUint(tournamentID, 10))
+	return url
+}
+
+func (router *Router) LiveBattle(jobID uint64) *url.URL {
+	url, _ := router.liveBattleRoute.URL("id", strconv.FormatUint(jobID, 10))
+	return url
+}
+
+func (router *Router) Admin() *url.URL {
+	return router.adminURL
+}
+
+func (router *Router) AdminUsers() *url.URL {
+	return router.adminUsersURL
+}
+
+func (router *Router) AdminUser(userID uint64) *url.URL {
+	url, _ := router.adminUserRoute.URL("id", strconv.FormatUint(userID, 10))
+	return url
+}
+
+func (router *Router) AdminUserStatus(userID uint64) *url.URL {
+	url, _ := router.adminUserStatusRoute.URL("id", strconv.FormatUint(userID, 10))
+	return url
+}
+
+func (router *Router) AdminWizardDeletion(wizardID uint64) *url.URL {
+	url, _ := router.adminWizardDeletionRoute.URL("id", strconv.FormatUint(wizardID, 10))
+	return url
+}
+
+func (router *Router) AdminJobs() *url.URL {
+	return router.adminJobsURL
+}
+
+func (router *Router) AdminJobRequeue(jobID uint64) *url.URL {
+	url, _ := router.adminJobRequeueRoute.URL("id", strconv.FormatUint(jobID, 10))
+	return url
+}
+
+func (router *Router) AdminLogs() *url.URL {
+	return router.adminLogsURL
+}
+
 func (router *Router) WizardDetails(wizardID int) *url.URL {
-	url, _ := router.wizardViewRoute.URL(string(wizardID))
+	url, _ := router.wizardViewRoute.URL("id", strconv.Itoa(wizardID))
 	return url
 }
\ No newline at end of file
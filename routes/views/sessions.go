@@ -0,0 +1,106 @@
+package views
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/usersessions"
+	"github.com/gorilla/mux"
+)
+
+type sessionRow struct {
+	*usersessions.Session
+	Current    bool
+	Expired    bool
+	RevokePath string
+}
+
+// logoutActionHandler deletes the current session, which logs the user out
+// on this browser only.
+func logoutActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+
+	session.Options.MaxAge = -1
+	if err := session.Save(r, w); err != nil {
+		log.Error("Failed to delete session", log.Fields{"user": context.User.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	log.Debug("User has logged out", log.Fields{"username": context.User.Username})
+	http.Redirect(w, r, router.Login().String(), http.StatusSeeOther)
+}
+
+// listSessionsPageHandler shows everywhere the user is logged in, so that
+// they can revoke sessions they do not recognise.
+func listSessionsPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	found, err := router.sessionDao.GetByUserID(context.User.ID)
+	if err != nil {
+		log.Error("Failed to fetch sessions", log.Fields{"user": context.User.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	now := time.Now()
+	rows := make([]sessionRow, 0, len(found))
+	for _, session := range found {
+		rows = append(rows, sessionRow{
+			Session:    session,
+			Current:    usersessions.IsCurrent(session, context.Session.ID),
+			Expired:    session.Expired(now),
+			RevokePath: router.SessionRevocation(session.ID).String(),
+		})
+	}
+
+	data := struct {
+		Sessions   []sessionRow
+		LogoutPath string
+	}{
+		rows,
+		router.Logout().String(),
+	}
+
+	context.render(w, "sessions.html", data)
+}
+
+// revokeSessionActionHandler logs the user out of one of their sessions.
+// Revoking the current session is the same as logging out.
+func revokeSessionActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	sessionID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	session, err := router.sessionDao.GetByID(sessionID)
+	if err != nil {
+		log.Error("Failed to fetch session", log.Fields{"session": sessionID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	// Other users' sessions are reported as missing, so that their IDs are
+	// not given away
+	if session == nil || session.UserID != context.User.ID {
+		render(w, "404.html", nil)
+		return
+	}
+
+	if usersessions.IsCurrent(session, context.Session.ID) {
+		logoutActionHandler(w, r, context)
+		return
+	}
+
+	if err := router.sessionDao.Delete(session); err != nil {
+		log.Error("Failed to revoke session", log.Fields{"session": session.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	http.Redirect(w, r, router.SessionList().String(), http.StatusSeeOther)
+}
@@ -0,0 +1,314 @@
+package views
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models"
+	"github.com/crob1140/codewiz-server/models/tournaments"
+	"github.com/crob1140/codewiz-server/models/wizards"
+	"github.com/gorilla/mux"
+)
+
+// tournamentRound is a column of the bracket shown on the tournament page.
+type tournamentRound struct {
+	Title   string
+	Matches []tournamentMatch
+}
+
+type tournamentMatch struct {
+	First  string
+	Second string
+	Result string
+}
+
+type tournamentStanding struct {
+	*tournaments.Standing
+	WizardName string
+}
+
+func listTournamentsPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+
+	all, err := router.tournamentDao.GetAll()
+	if err != nil {
+		log.Error("Failed to fetch tournaments", log.Fields{"error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	detailPaths := make(map[uint64]string, len(all))
+	for _, tournament := range all {
+		detailPaths[tournament.ID] = router.TournamentDetails(tournament.ID).String()
+	}
+
+	data := struct {
+		Tournaments []*tournaments.Tournament
+		DetailPaths map[uint64]string
+	}{
+		all,
+		detailPaths,
+	}
+
+	context.render(w, "tournaments.html", data)
+}
+
+func viewTournamentPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+
+	tournament, ok := findTournament(w, r, context)
+	if !ok {
+		return
+	}
+
+	errList := session.Flashes("errs")
+	var validationErrs models.ValidationErrors
+	if len(errList) != 0 {
+		validationErrs = errList[0].(models.ValidationErrors)
+	}
+
+	// Save the session to ensure the flash messages are removed.
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entrants, err := router.tournamentDao.GetEntrants(tournament.ID)
+	if err != nil {
+		log.Error("Failed to fetch tournament entrants", log.Fields{"tournament": tournament.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	matches, err := router.tournamentDao.GetMatches(tournament.ID)
+	if err != nil {
+		log.Error("Failed to fetch tournament matches", log.Fields{"tournament": tournament.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	names := make(map[uint64]string, len(entrants))
+	registered := false
+	for _, entrant := range entrants {
+		wizard, err := router.wizardDao.GetByID(entrant.WizardID)
+		if err != nil {
+			log.Error("Failed to fetch wizard", log.Fields{"wizard": entrant.WizardID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+
+		names[entrant.WizardID] = "(deleted wizard)"
+		if wizard != nil {
+			names[entrant.WizardID] = wizard.Name
+		}
+
+		if context.User != nil && entrant.OwnerID == context.User.ID {
+			registered = true
+		}
+	}
+
+	// Only offer registration to players who can still enter a wizard
+	var eligible []*wizards.Wizard
+	if context.User != nil && !registered && tournament.IsOpen(time.Now()) {
+		owned, err := router.wizardDao.GetByOwnerID(context.User.ID)
+		if err != nil {
+			log.Error("Failed to fetch wizards", log.Fields{"user": context.User.ID, "error": err})
+			custom500Handler(w, r)
+			return
+		}
+
+		for _, wizard := range owned {
+			if wizard.ActiveScriptID != 0 {
+				eligible = append(eligible, wizard)
+			}
+		}
+	}
+
+	standings := make([]tournamentStanding, 0, len(entrants))
+	if len(matches) != 0 {
+		for _, standing := range tournaments.Standings(tournament.Format, matches, entrants) {
+			standings = append(standings, tournamentStanding{standing, names[standing.WizardID]})
+		}
+	}
+
+	data := struct {
+		Tournament       *tournaments.Tournament
+		SubmitPath       string
+		Entrants         []*tournaments.Entrant
+		WizardNames      map[uint64]string
+		Registered       bool
+		EligibleWizards  []*wizards.Wizard
+		Rounds           []tournamentRound
+		Standings        []tournamentStanding
+		ValidationErrors models.ValidationErrors
+	}{
+		tournament,
+		router.TournamentDetails(tournament.ID).String(),
+		entrants,
+		names,
+		registered,
+		eligible,
+		groupRounds(tournament.Format, matches, names),
+		standings,
+		validationErrs,
+	}
+
+	context.render(w, "tournament.html", data)
+}
+
+func registerTournamentActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	user := context.User
+	router := context.Router
+	session := context.Session
+
+	tournament, ok := findTournament(w, r, context)
+	if !ok {
+		return
+	}
+
+	validationErrs := make(models.ValidationErrors)
+
+	wizardID, _ := strconv.ParseUint(r.FormValue("wizard"), 10, 64)
+	wizard, err := router.wizardDao.GetByID(wizardID)
+	if err != nil {
+		log.Error("Failed to fetch wizard", log.Fields{"wizard": wizardID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	existing, err := router.tournamentDao.GetEntrantByOwnerID(tournament.ID, user.ID)
+	if err != nil {
+		log.Error("Failed to fetch tournament entrant", log.Fields{"tournament": tournament.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	entrants, err := router.tournamentDao.GetEntrants(tournament.ID)
+	if err != nil {
+		log.Error("Failed to fetch tournament entrants", log.Fields{"tournament": tournament.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	switch {
+	case wizard == nil || wizard.OwnerID != user.ID:
+		validationErrs.Add("Wizard", "Choose one of your wizards.")
+	case wizard.ActiveScriptID == 0:
+		validationErrs.Add("Wizard", "The wizard must have an active script to enter a tournament.")
+	case !tournament.IsOpen(time.Now()):
+		validationErrs.Add("Wizard", "Registration for the tournament has closed.")
+	case existing != nil:
+		validationErrs.Add("Wizard", "You already have a wizard registered in the tournament.")
+	case tournament.MaxEntrants != 0 && len(entrants) >= tournament.MaxEntrants:
+		validationErrs.Add("Wizard", "The tournament is full.")
+	}
+
+	if len(validationErrs) == 0 {
+		entrant := tournaments.NewEntrant(tournament.ID, wizard.ID, user.ID)
+		if err := router.tournamentDao.InsertEntrant(entrant); err != nil {
+			log.Error("Error occurred while registering tournament entrant", log.Fields{"error": err})
+			custom500Handler(w, r)
+			return
+		}
+	} else {
+		// Add the errors to a flash message so that we can access them
+		// after redirection
+		session.AddFlash(validationErrs, "errs")
+		if err := session.Save(r, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Send the user back to the tournament page
+	tournamentUrl := router.TournamentDetails(tournament.ID)
+	http.Redirect(w, r, tournamentUrl.String(), http.StatusSeeOther)
+}
+
+func findTournament(w http.ResponseWriter, r *http.Request, context *context) (*tournaments.Tournament, bool) {
+	tournamentID, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	tournament, err := context.Router.tournamentDao.GetByID(tournamentID)
+	if err != nil {
+		log.Error("Failed to fetch tournament", log.Fields{"tournament": tournamentID, "error": err})
+		custom500Handler(w, r)
+		return nil, false
+	}
+
+	if tournament == nil {
+		render(w, "404.html", nil)
+		return nil, false
+	}
+
+	return tournament, true
+}
+
+// groupRounds splits the sorted matches into the rounds of each bracket.
+func groupRounds(format tournaments.Format, matches []*tournaments.Match, names map[uint64]string) []tournamentRound {
+	var rounds []tournamentRound
+	for _, match := range matches {
+		title := roundTitle(format, match)
+		if len(rounds) == 0 || rounds[len(rounds)-1].Title != title {
+			rounds = append(rounds, tournamentRound{Title: title})
+		}
+
+		current := &rounds[len(rounds)-1]
+		current.Matches = append(current.Matches, tournamentMatch{
+			First:  sideName(match, match.FirstWizardID, names),
+			Second: sideName(match, match.SecondWizardID, names),
+			Result: matchResult(match, names),
+		})
+	}
+	return rounds
+}
+
+func sideName(match *tournaments.Match, wizardID uint64, names map[uint64]string) string {
+	switch {
+	case wizardID != 0:
+		return names[wizardID]
+	case match.State.Decided():
+		return "Bye"
+	default:
+		return "TBD"
+	}
+}
+
+func matchResult(match *tournaments.Match, names map[uint64]string) string {
+	switch {
+	case match.State == tournaments.Walkover && match.LoserID == 0 && match.FirstWizardID != 0 && match.SecondWizardID != 0:
+		// A grand final reset that the winners bracket champion did not need
+		return "Not needed"
+	case match.WinnerID != 0:
+		return names[match.WinnerID] + " won"
+	case match.State == tournaments.Played:
+		return "Draw"
+	case match.State.Decided():
+		return "No result"
+	case match.State == tournaments.Ready:
+		return "Waiting for battle"
+	default:
+		return "Waiting for earlier matches"
+	}
+}
+
+func roundTitle(format tournaments.Format, match *tournaments.Match) string {
+	switch {
+	case match.Bracket == tournaments.Winners && format == tournaments.DoubleElimination:
+		return fmt.Sprintf("Winners round %d", match.Round)
+	case match.Bracket == tournaments.Losers:
+		return fmt.Sprintf("Losers round %d", match.Round)
+	case match.Bracket == tournaments.Final:
+		if match.Round == 1 {
+			return "Grand final"
+		}
+		return "Grand final reset"
+	default:
+		return fmt.Sprintf("Round %d", match.Round)
+	}
+}
@@ -0,0 +1,437 @@
+package views
+
+import (
+	"encoding/base64"
+	"encoding/gob"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models"
+	"github.com/crob1140/codewiz-server/models/logins"
+	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/routes"
+	"github.com/crob1140/codewiz-server/totp"
+	"github.com/gorilla/sessions"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	pendingLoginKey  = "pendingLogin"  // the session value that holds a login waiting for a code
+	pendingSecretKey = "pendingSecret" // the session value that holds the secret being set up
+
+	// pendingLoginLifetime is how long a user has to enter their code
+	// after entering their password.
+	pendingLoginLifetime = 5 * time.Minute
+
+	// totpIssuer is the name that authenticator apps show the account under.
+	totpIssuer = "Codewiz"
+
+	qrCodeSize = 256 // pixels
+)
+
+// pendingLogin is kept in the session between a user proving who they are
+// and entering a code from their authenticator app.
+type pendingLogin struct {
+	UserID     uint64
+	Source     string // how the user proved who they are, see logins.Attempt
+	ExpiryTime time.Time
+}
+
+func init() {
+	gob.Register(pendingLogin{})
+}
+
+// logIn logs the user in, unless they have two-factor authentication
+// enabled, in which case they are only logged in once they have entered a
+// code. It returns the page to send them to once the session is saved.
+func logIn(router *Router, session *sessions.Session, user *users.User, source string) *url.URL {
+	if user.TwoFactorEnabled() {
+		delete(session.Values, userIDKey)
+		session.Values[pendingLoginKey] = pendingLogin{
+			UserID:     user.ID,
+			Source:     source,
+			ExpiryTime: time.Now().Add(pendingLoginLifetime),
+		}
+		return router.TwoFactorLogin()
+	}
+
+	delete(session.Values, pendingLoginKey)
+	session.Values[userIDKey] = user.ID
+	resetCSRFToken(session)
+	return router.Dashboard()
+}
+
+// twoFactorLoginPageHandler asks a user who has entered their password for
+// a code from their authenticator app.
+func twoFactorLoginPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+
+	if pending, ok := session.Values[pendingLoginKey].(pendingLogin); !ok || time.Now().After(pending.ExpiryTime) {
+		http.Redirect(w, r, router.Login().String(), http.StatusSeeOther)
+		return
+	}
+
+	errList := session.Flashes("errs")
+	var validationErrs models.ValidationErrors
+	if len(errList) != 0 {
+		validationErrs = errList[0].(models.ValidationErrors)
+	}
+
+	// Save the session to ensure the flash messages are removed.
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		SubmitPath       string
+		LoginPath        string
+		ValidationErrors models.ValidationErrors
+	}{
+		router.TwoFactorLogin().String(),
+		router.Login().String(),
+		validationErrs,
+	}
+
+	context.render(w, "twofactorlogin.html", data)
+}
+
+// twoFactorLoginActionHandler finishes logging the user in if they have
+// entered a valid code. Wrong codes count towards the limit on failed
+// logins, so that codes cannot be guessed any faster than passwords.
+func twoFactorLoginActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+	now := time.Now()
+
+	pending, ok := session.Values[pendingLoginKey].(pendingLogin)
+	if !ok || now.After(pending.ExpiryTime) {
+		delete(session.Values, pendingLoginKey)
+		validationErrs := make(models.ValidationErrors)
+		validationErrs.Add("Username", "Your login has expired. Please log in again.")
+		session.AddFlash(validationErrs, "errs")
+		if err := session.Save(r, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, router.Login().String(), http.StatusSeeOther)
+		return
+	}
+
+	user, err := router.userDao.GetByID(pending.UserID)
+	if err != nil {
+		log.Error("Failed to fetch user", log.Fields{"user": pending.UserID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	if user == nil || user.Disabled || !user.TwoFactorEnabled() {
+		delete(session.Values, pendingLoginKey)
+		if err := session.Save(r, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, router.Login().String(), http.StatusSeeOther)
+		return
+	}
+
+	ipAddress := routes.ClientIP(r)
+	wait, _, err := router.loginGuard.Check(user.Username, ipAddress, now)
+	if err != nil {
+		log.Error("Failed to check login attempts", log.Fields{"username": user.Username, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	validationErrs := make(models.ValidationErrors)
+	outcome := logins.Failed
+	if wait > 0 {
+		outcome = logins.Throttled
+		validationErrs.Add("Code", "Too many failed login attempts. Please try again in "+describeWait(wait)+".")
+	} else if !user.VerifySecondFactor(r.FormValue("code"), now) {
+		validationErrs.Add("Code", "The code you have entered is invalid.")
+	} else if err := router.userDao.Update(user); err != nil {
+		// The code has to be marked as used before it is accepted
+		log.Error("Failed to update user", log.Fields{"user": user.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	} else {
+		outcome = logins.Succeeded
+	}
+
+	attempt := logins.NewAttempt(user.Username, user.ID, ipAddress, pending.Source, outcome, now)
+	if err := router.loginGuard.Record(attempt); err != nil {
+		log.Error("Failed to record login attempt", log.Fields{"username": user.Username, "error": err})
+	}
+
+	if outcome != logins.Succeeded {
+		session.AddFlash(validationErrs, "errs")
+		if err := session.Save(r, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, router.TwoFactorLogin().String(), http.StatusSeeOther)
+		return
+	}
+
+	delete(session.Values, pendingLoginKey)
+	session.Values[userIDKey] = user.ID
+	resetCSRFToken(session)
+
+	if left := user.RecoveryCodesLeft(); left < 3 {
+		session.AddFlash("You have "+strconv.Itoa(left)+" recovery codes left. Create new ones from the two-factor authentication page.", "notices")
+	}
+
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Debug("User has logged in", log.Fields{"username": user.Username})
+	http.Redirect(w, r, router.Dashboard().String(), http.StatusSeeOther)
+}
+
+// twoFactorPageHandler lets the user set up two-factor authentication, or
+// manage it if it has already been set up.
+func twoFactorPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
+	renderTwoFactorPage(w, r, context, nil)
+}
+
+// renderTwoFactorPage shows the two-factor authentication page. Recovery
+// codes are only given when they have just been created, since only their
+// hashes are kept.
+func renderTwoFactorPage(w http.ResponseWriter, r *http.Request, context *context, recoveryCodes []string) {
+
+	router := context.Router
+	session := context.Session
+	user := context.User
+
+	errList := session.Flashes("errs")
+	var validationErrs models.ValidationErrors
+	if len(errList) != 0 {
+		validationErrs = errList[0].(models.ValidationErrors)
+	}
+	notices := session.Flashes("notices")
+
+	// The secret being set up is kept until it is confirmed, so that the
+	// account added to the user's app keeps working if they get the code
+	// wrong and the page is shown again
+	var secret string
+	var qrCode template.URL
+	if !user.TwoFactorEnabled() {
+		secret, _ = session.Values[pendingSecretKey].(string)
+		if secret == "" {
+			var err error
+			if secret, err = totp.GenerateSecret(); err != nil {
+				log.Error("Failed to generate two-factor secret", log.Fields{"error": err})
+				custom500Handler(w, r)
+				return
+			}
+			session.Values[pendingSecretKey] = secret
+		}
+
+		png, err := qrcode.Encode(totp.ProvisioningURI(totpIssuer, user.Username, secret), qrcode.Medium, qrCodeSize)
+		if err != nil {
+			log.Error("Failed to create QR code", log.Fields{"error": err})
+			custom500Handler(w, r)
+			return
+		}
+		qrCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+
+	// Save the session to ensure the flash messages are removed.
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Enabled           bool
+		Required          bool
+		Secret            string
+		QRCode            template.URL
+		RecoveryCodes     []string
+		RecoveryCodesLeft int
+		EnablePath        string
+		DisablePath       string
+		RecoveryCodesPath string
+		DashboardPath     string
+		Notices           []interface{}
+		ValidationErrors  models.ValidationErrors
+	}{
+		user.TwoFactorEnabled(),
+		user.HasRole(users.Admin),
+		secret,
+		qrCode,
+		recoveryCodes,
+		user.RecoveryCodesLeft(),
+		router.TwoFactorEnable().String(),
+		router.TwoFactorDisable().String(),
+		router.RecoveryCodes().String(),
+		router.Dashboard().String(),
+		notices,
+		validationErrs,
+	}
+
+	context.render(w, "twofactor.html", data)
+}
+
+// enableTwoFactorActionHandler turns on two-factor authentication once the
+// user has entered a code for the secret they were shown, which proves
+// that their app has been set up.
+func enableTwoFactorActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+	user := context.User
+
+	secret, _ := session.Values[pendingSecretKey].(string)
+	if user.TwoFactorEnabled() || secret == "" {
+		http.Redirect(w, r, router.TwoFactor().String(), http.StatusSeeOther)
+		return
+	}
+
+	counter, ok := totp.Validate(secret, r.FormValue("code"), time.Now(), 0)
+	if !ok {
+		failTwoFactorAction(w, r, context, "The code you have entered is invalid. Check that your device's clock is correct.")
+		return
+	}
+
+	recoveryCodes, err := user.EnableTwoFactor(secret, counter)
+	if err != nil {
+		log.Error("Failed to generate recovery codes", log.Fields{"error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	if err := router.userDao.Update(user); err != nil {
+		log.Error("Failed to update user", log.Fields{"user": user.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	log.Info("User has enabled two-factor authentication", log.Fields{"username": user.Username})
+
+	delete(session.Values, pendingSecretKey)
+	session.AddFlash("Two-factor authentication has been enabled.", "notices")
+	renderTwoFactorPage(w, r, context, recoveryCodes)
+}
+
+// regenerateRecoveryCodesActionHandler replaces the user's recovery codes,
+// in case they have used most of them or think they have been seen.
+func regenerateRecoveryCodesActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+	user := context.User
+
+	if !user.TwoFactorEnabled() {
+		http.Redirect(w, r, router.TwoFactor().String(), http.StatusSeeOther)
+		return
+	}
+
+	if !user.VerifySecondFactor(r.FormValue("code"), time.Now()) {
+		failTwoFactorAction(w, r, context, "The code you have entered is invalid.")
+		return
+	}
+
+	recoveryCodes, err := user.GenerateRecoveryCodes()
+	if err != nil {
+		log.Error("Failed to generate recovery codes", log.Fields{"error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	if err := router.userDao.Update(user); err != nil {
+		log.Error("Failed to update user", log.Fields{"user": user.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	log.Info("User has replaced their recovery codes", log.Fields{"username": user.Username})
+
+	session.AddFlash("Your recovery codes have been replaced. The old ones no longer work.", "notices")
+	renderTwoFactorPage(w, r, context, recoveryCodes)
+}
+
+// disableTwoFactorActionHandler turns off two-factor authentication. A
+// code is needed, so that someone who finds the user logged in cannot do
+// it. Admins have to keep it on.
+func disableTwoFactorActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
+
+	router := context.Router
+	session := context.Session
+	user := context.User
+
+	if !user.TwoFactorEnabled() {
+		http.Redirect(w, r, router.TwoFactor().String(), http.StatusSeeOther)
+		return
+	}
+
+	if user.HasRole(users.Admin) {
+		failTwoFactorAction(w, r, context, "Admin accounts cannot disable two-factor authentication.")
+		return
+	}
+
+	if !user.VerifySecondFactor(r.FormValue("code"), time.Now()) {
+		failTwoFactorAction(w, r, context, "The code you have entered is invalid.")
+		return
+	}
+
+	user.DisableTwoFactor()
+	if err := router.userDao.Update(user); err != nil {
+		log.Error("Failed to update user", log.Fields{"user": user.ID, "error": err})
+		custom500Handler(w, r)
+		return
+	}
+
+	log.Info("User has disabled two-factor authentication", log.Fields{"username": user.Username})
+
+	session.AddFlash("Two-factor authentication has been disabled.", "notices")
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, router.TwoFactor().String(), http.StatusSeeOther)
+}
+
+// failTwoFactorAction sends the user back to the two-factor authentication
+// page with a message explaining what went wrong.
+func failTwoFactorAction(w http.ResponseWriter, r *http.Request, context *context, message string) {
+
+	router := context.Router
+	session := context.Session
+
+	validationErrs := make(models.ValidationErrors)
+	validationErrs.Add("Code", message)
+	session.AddFlash(validationErrs, "errs")
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, router.TwoFactor().String(), http.StatusSeeOther)
+}
+
+// requireTwoFactor sends admins who have not set up two-factor
+// authentication to do so, so that a stolen password is not enough to use
+// the admin console. It reports whether the request can go ahead.
+func requireTwoFactor(w http.ResponseWriter, r *http.Request, router *Router, user *users.User) bool {
+	if user.TwoFactorEnabled() {
+		return true
+	}
+
+	http.Redirect(w, r, router.TwoFactor().String(), http.StatusSeeOther)
+	return false
+}
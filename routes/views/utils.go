@@ -14,8 +14,20 @@ const (
 )
 
 func render(w http.ResponseWriter, templateName string, data interface{}) {
+	renderWithCSRFToken(w, templateName, data, "")
+}
+
+// renderWithCSRFToken shows a page whose forms can include the token with
+// {{csrfField}}.
+func renderWithCSRFToken(w http.ResponseWriter, templateName string, data interface{}, csrfToken string) {
+	funcs := template.FuncMap{
+		"csrfField" : func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` + template.HTMLEscapeString(csrfToken) + `" />`)
+		},
+	}
+
 	path, _ := filepath.Abs(templateDirectory + "/" + templateName)
-	tmpl, err := template.ParseFiles(path)
+	tmpl, err := template.New(templateName).Funcs(funcs).ParseFiles(path)
 	if err != nil {
 		log.Error("Failed to parse template", log.Fields{"template" : templateName, "error" : err})
 	}
@@ -3,6 +3,7 @@ package views
 import (
 	"github.com/crob1140/codewiz-server/log"
 	"github.com/crob1140/codewiz-server/models"
+	"github.com/crob1140/codewiz-server/models/spells"
 	"github.com/crob1140/codewiz-server/models/wizards"
 	"net/http"
 )
@@ -32,13 +33,15 @@ func createWizardPageHandler(w http.ResponseWriter, r *http.Request, context *co
 
 	data := struct {
 		SubmitPath string
+		Spells []*spells.Spell
 		ValidationErrors models.ValidationErrors
 	}{
 		wizardCreationPath,
+		router.spellCatalogue.All(),
 		validationErrs,
 	}
 
-	render(w, "createwizard.html", data)
+	context.render(w, "createwizard.html", data)
 }
 
 func createWizardActionHandler(w http.ResponseWriter, r *http.Request, context *context) {
@@ -48,7 +51,7 @@ func createWizardActionHandler(w http.ResponseWriter, r *http.Request, context *
 	session := context.Session
 
 	wizard := extractWizardFromRequest(r, user.ID)
-	validator := wizards.NewValidator(router.wizardDao)
+	validator := wizards.NewValidator(router.wizardDao, router.spellCatalogue)
 	validationErrs, err := validator.Validate(wizard)
 	if err != nil {
 		custom500Handler(w,r)
@@ -62,6 +65,12 @@ func createWizardActionHandler(w http.ResponseWriter, r *http.Request, context *
 			return
 		}
 
+		if err := router.wizardDao.SetSpells(wizard); err != nil {
+			log.Error("Error occurred while equipping wizard spells", log.Fields{"error" : err})
+			custom500Handler(w,r)
+			return
+		}
+
 		// Send the user back to the dasboard
 		dashboardUrl := router.Dashboard()
 		http.Redirect(w, r, dashboardUrl.String(), http.StatusSeeOther)
@@ -83,7 +92,10 @@ func createWizardActionHandler(w http.ResponseWriter, r *http.Request, context *
 func extractWizardFromRequest(r *http.Request, userID uint64) *wizards.Wizard {
 	name := r.FormValue("name")
 	sex := r.FormValue("sex")
-	return wizards.NewWizard(name, sex, userID)
+	wizard := wizards.NewWizard(name, sex, userID)
+	r.ParseForm()
+	wizard.Spells = r.Form["spells"]
+	return wizard
 }
 
 func viewWizardPageHandler(w http.ResponseWriter, r *http.Request, context *context) {
@@ -2,38 +2,127 @@ package main
 
 import (
 	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/director"
+	"github.com/crob1140/codewiz-server/live"
+	"github.com/crob1140/codewiz-server/mail"
+	"github.com/crob1140/codewiz-server/matchmaker"
+	"github.com/crob1140/codewiz-server/models/battles"
+	"github.com/crob1140/codewiz-server/models/identities"
+	"github.com/crob1140/codewiz-server/models/jobs"
+	"github.com/crob1140/codewiz-server/models/leaderboards"
+	"github.com/crob1140/codewiz-server/models/logins"
+	"github.com/crob1140/codewiz-server/models/matchmaking"
+	"github.com/crob1140/codewiz-server/models/ratings"
+	"github.com/crob1140/codewiz-server/models/replays"
+	"github.com/crob1140/codewiz-server/models/seasons"
+	"github.com/crob1140/codewiz-server/models/spells"
+	"github.com/crob1140/codewiz-server/models/tokens"
+	"github.com/crob1140/codewiz-server/models/tournaments"
 	"github.com/crob1140/codewiz-server/models/users"
+	"github.com/crob1140/codewiz-server/models/usersessions"
+	"github.com/crob1140/codewiz-server/models/usertokens"
 	"github.com/crob1140/codewiz-server/models/wizards"
+	"github.com/crob1140/codewiz-server/oidc"
 	"github.com/crob1140/codewiz-server/routes/api"
+	"github.com/crob1140/codewiz-server/routes/api/v1"
 	"github.com/crob1140/codewiz-server/routes/views"
+	"github.com/crob1140/codewiz-server/simulator"
+	"github.com/crob1140/codewiz-server/workers"
+	"github.com/crob1140/codewiz-server/log"
 	"github.com/gorilla/mux"
 	"net/http"
+	"time"
 )
 
 const (
 	apiPath   = "/api"
 	viewsPath = "/"
+
+	// sessionCleanupInterval is how often expired sessions are removed.
+	sessionCleanupInterval = time.Hour
 )
 
 type Server struct {
-	Router http.Handler
+	Router   http.Handler
+	Matcher  *matchmaker.Matcher
+	Director *director.Director
+	Workers  *workers.Pool
+
+	SessionDao *usersessions.Dao
 }
 
-func NewServer(db *datastore.DB) *Server {
+func NewServer(db *datastore.DB, catalogue *spells.Catalogue, mailSender mail.Sender, identityProviders []*oidc.Provider) *Server {
 	userDao := users.NewDao(db)
 	wizardDao := wizards.NewDao(db)
+	battleDao := battles.NewDao(db)
+	replayDao := replays.NewDao(db)
+	ratingDao := ratings.NewDao(db)
+	queueDao := matchmaking.NewDao(db)
+	seasonDao := seasons.NewDao(db)
+	leaderboardDao := leaderboards.NewDao(db)
+	tournamentDao := tournaments.NewDao(db)
+	jobDao := jobs.NewDao(db)
+	tokenDao := tokens.NewDao(db)
+	userTokenDao := usertokens.NewDao(db)
+	sessionDao := usersessions.NewDao(db)
+	identityDao := identities.NewDao(db)
+	loginGuard := logins.NewGuard(logins.NewDao(db))
+
+	sim := simulator.New(wizardDao, battleDao, replayDao, catalogue)
+	scheduler := seasons.NewScheduler(seasonDao, ratingDao, wizardDao)
+	matcher := matchmaker.New(queueDao, ratingDao, sim, scheduler)
+	tournamentDirector := director.New(tournamentDao, wizardDao, ratingDao, battleDao, sim)
+	hub := live.NewHub()
+	pool := workers.NewPool(jobDao, sim, hub)
 
 	router := mux.NewRouter()
 
 	// Add API endpoints
-	apiRouter := api.NewRouter(apiPath, userDao)
+	apiRouter := api.NewRouter(apiPath, &v1.Dependencies{
+		UserDao:        userDao,
+		WizardDao:      wizardDao,
+		ReplayDao:      replayDao,
+		RatingDao:      ratingDao,
+		QueueDao:       queueDao,
+		SeasonDao:      seasonDao,
+		LeaderboardDao: leaderboardDao,
+		TournamentDao:  tournamentDao,
+		JobDao:         jobDao,
+		TokenDao:       tokenDao,
+		LoginGuard:     loginGuard,
+		SessionDao:     sessionDao,
+		Hub:            hub,
+		Catalogue:      catalogue,
+	})
 	router.PathPrefix(apiPath).Handler(apiRouter)
 
 	// Add view endpoints
-	viewsRouter := views.NewRouter(viewsPath, userDao, wizardDao)
+	viewsRouter := views.NewRouter(viewsPath, userDao, wizardDao, seasonDao, leaderboardDao, tournamentDao, jobDao, queueDao, userTokenDao, sessionDao, identityDao, loginGuard, mailSender, identityProviders, catalogue)
 	router.PathPrefix(viewsPath).Handler(viewsRouter)
 
-	return &Server{Router: router}
+	return &Server{Router: router, Matcher: matcher, Director: tournamentDirector, Workers: pool, SessionDao: sessionDao}
+}
+
+// CleanUpSessions removes expired sessions from the datastore in the
+// background, every interval. They would otherwise be kept forever, since
+// a session is only looked up again if its cookie is sent.
+func (server *Server) CleanUpSessions(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			removed, err := server.SessionDao.DeleteExpired(time.Now())
+			if err != nil {
+				log.Error("Failed to remove expired sessions", log.Fields{"error": err})
+				continue
+			}
+
+			if removed > 0 {
+				log.Debug("Removed expired sessions", log.Fields{"count": removed})
+			}
+		}
+	}()
 }
 
 func (server *Server) ListenAndServe(address string) {
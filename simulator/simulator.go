@@ -0,0 +1,211 @@
+// Package simulator runs battles between stored wizards, and saves the
+// outcome and replay of each battle to the datastore.
+package simulator
+
+import (
+	"errors"
+
+	"github.com/crob1140/codewiz-server/arena"
+	"github.com/crob1140/codewiz-server/arena/replay"
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/interpreters"
+	"github.com/crob1140/codewiz-server/models/battles"
+	"github.com/crob1140/codewiz-server/models/replays"
+	"github.com/crob1140/codewiz-server/models/spells"
+	"github.com/crob1140/codewiz-server/models/wizards"
+)
+
+var (
+	ErrWizardNotFound = errors.New("One of the wizards does not exist.")
+	ErrNoActiveScript = errors.New("One of the wizards does not have an active script.")
+	ErrUnresponsive   = errors.New("A script stopped responding, so the battle could not be decided.")
+)
+
+// WizardError is returned when a battle could not be fought because of one
+// of the wizards, such as when its script does not compile or stops
+// responding, rather than because of a problem with the server.
+type WizardError struct {
+	WizardID uint64
+	Err      error
+}
+
+func (err *WizardError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *WizardError) Unwrap() error {
+	return err.Err
+}
+
+type Simulator struct {
+	WizardDao *wizards.Dao
+	BattleDao *battles.Dao
+	ReplayDao *replays.Dao
+	Catalogue *spells.Catalogue
+
+	Map    arena.Map
+	Rules  arena.Rules
+	Limits interpreters.Limits
+}
+
+func New(wizardDao *wizards.Dao, battleDao *battles.Dao, replayDao *replays.Dao, catalogue *spells.Catalogue) *Simulator {
+	return &Simulator{
+		WizardDao: wizardDao,
+		BattleDao: battleDao,
+		ReplayDao: replayDao,
+		Catalogue: catalogue,
+		Map:       arena.DefaultMap,
+		Rules:     arena.DefaultRules,
+		Limits:    interpreters.DefaultLimits,
+	}
+}
+
+// RecordFunc records something about a battle as it is saved. It runs in the
+// transaction that saves the battle, so that what it records is committed
+// along with the battle or not at all.
+type RecordFunc func(tx *datastore.DB, battle *battles.Battle) error
+
+// entrant is a wizard that has been prepared for battle.
+type entrant struct {
+	participant arena.Participant
+	sandbox     *interpreters.Sandbox
+	scriptID    uint64
+}
+
+// Run fights a battle between the given wizards using their active scripts
+// and equipped spells, then saves the battle, its participants and its replay.
+// Any observers given are notified as the battle is fought. Nothing is
+// saved if a script stops responding, since the battle cannot be decided.
+// Errors caused by one of the wizards are returned as a *WizardError.
+func (simulator *Simulator) Run(wizardIDs []uint64, seed int64, observers ...arena.Observer) (*battles.Battle, error) {
+	return simulator.RunAndRecord(wizardIDs, seed, nil, observers...)
+}
+
+// RunAndRecord is like Run, but also calls record, if it is not nil, in the
+// transaction that saves the battle.
+func (simulator *Simulator) RunAndRecord(wizardIDs []uint64, seed int64, record RecordFunc, observers ...arena.Observer) (*battles.Battle, error) {
+	var entrants []entrant
+	for _, wizardID := range wizardIDs {
+		entrant, err := simulator.prepare(wizardID)
+		if err != nil {
+			return nil, err
+		}
+		entrants = append(entrants, entrant)
+	}
+
+	participants := make([]arena.Participant, len(entrants))
+	for i, entrant := range entrants {
+		participants[i] = entrant.participant
+	}
+
+	config := arena.Config{
+		Map:    simulator.Map,
+		Spells: simulator.Catalogue.Arena(),
+		Rules:  simulator.Rules,
+		Seed:   seed,
+	}
+
+	battle, err := arena.New(config, participants)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := replay.NewRecorder()
+	battle.Observe(recorder)
+	for _, observer := range observers {
+		battle.Observe(observer)
+	}
+	result := battle.Run()
+
+	// A script that was stopped by the wall clock rather than its budget
+	// would have been stopped at a different point on a less busy server,
+	// so the result would not play out the same way again
+	for _, entrant := range entrants {
+		if entrant.sandbox.Killed() == interpreters.ErrTimeLimit {
+			return nil, &WizardError{WizardID: entrant.participant.WizardID, Err: ErrUnresponsive}
+		}
+	}
+
+	data, err := recorder.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return simulator.save(result, entrants, data, record)
+}
+
+func (simulator *Simulator) prepare(wizardID uint64) (entrant, error) {
+	wizard, err := simulator.WizardDao.GetByID(wizardID)
+	if err != nil {
+		return entrant{}, err
+	}
+	if wizard == nil {
+		return entrant{}, &WizardError{WizardID: wizardID, Err: ErrWizardNotFound}
+	}
+
+	script, err := simulator.WizardDao.GetActiveScript(wizard)
+	if err != nil {
+		return entrant{}, err
+	}
+	if script == nil {
+		return entrant{}, &WizardError{WizardID: wizardID, Err: ErrNoActiveScript}
+	}
+
+	equipped, err := simulator.WizardDao.GetSpells(wizard)
+	if err != nil {
+		return entrant{}, err
+	}
+
+	compiled, err := interpreters.Compile(script.Language, script.Source)
+	if err != nil {
+		return entrant{}, &WizardError{WizardID: wizardID, Err: err}
+	}
+
+	sandbox := interpreters.NewSandbox(compiled, simulator.Limits)
+	return entrant{
+		participant: arena.Participant{
+			WizardID:   wizard.ID,
+			Name:       wizard.Name,
+			Controller: sandbox,
+			Spells:     simulator.Catalogue.Loadout(equipped),
+		},
+		sandbox:  sandbox,
+		scriptID: script.ID,
+	}, nil
+}
+
+// save saves the battle, its participants and its replay in one transaction,
+// so that a battle is never saved without the participants or replay that
+// are needed to show it.
+func (simulator *Simulator) save(result *arena.Result, entrants []entrant, data []byte, record RecordFunc) (*battles.Battle, error) {
+	battle := battles.NewBattle(result, simulator.Catalogue.Version())
+	err := simulator.BattleDao.DB.WithTransaction(func(tx *datastore.DB) error {
+		battleDao := simulator.BattleDao.WithTx(tx)
+		replayDao := simulator.ReplayDao.WithTx(tx)
+
+		if err := battleDao.Insert(battle); err != nil {
+			return err
+		}
+
+		for i, wizardResult := range result.Wizards {
+			participant := battles.NewParticipant(battle.ID, entrants[i].scriptID, wizardResult)
+			if err := battleDao.InsertParticipant(participant); err != nil {
+				return err
+			}
+		}
+
+		if err := replayDao.Insert(replays.NewReplay(battle.ID, replay.FormatVersion, data)); err != nil {
+			return err
+		}
+
+		if record != nil {
+			return record(tx, battle)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return battle, nil
+}
@@ -0,0 +1,108 @@
+// Package totp generates and checks the time-based one-time passwords
+// (RFC 6238) that authenticator apps show, for two-factor authentication.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is how long each code can be used for. Authenticator apps
+	// assume 30 seconds.
+	Period = 30 * time.Second
+
+	// Digits is the length of each code.
+	Digits  = 6
+	modulus = 1000000 // 10^Digits
+
+	// skew is how many periods either side of the current one are accepted,
+	// since the phone's clock may be slightly different to the server's and
+	// the user takes time to type the code in.
+	skew = 1
+
+	secretLength = 20 // bytes, as recommended for HMAC-SHA1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret creates a random secret, encoded in base32 as
+// authenticator apps expect.
+func GenerateSecret() (string, error) {
+	buf := make([]byte, secretLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(buf), nil
+}
+
+// ProvisioningURI returns the otpauth URI that authenticator apps read from
+// a QR code to add the account.
+func ProvisioningURI(issuer string, account string, secret string) string {
+	query := url.Values{
+		"secret": {secret},
+		"issuer": {issuer},
+	}
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Counter returns the number of the period that the time falls in.
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code for the given period.
+func Code(secret string, counter int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, as described in RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%modulus), nil
+}
+
+// Validate checks the code against the periods around the given time, and
+// returns the period that it matched. Codes from periods up to and
+// including lastCounter are rejected, so that each code can only be used
+// once.
+func Validate(secret string, code string, t time.Time, lastCounter int64) (int64, bool) {
+	code = strings.Replace(code, " ", "", -1)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	now := Counter(t)
+	for counter := now - skew; counter <= now+skew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+
+		expected, err := Code(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,67 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 secret from the test vectors in RFC 6238.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC's codes have 8 digits, of which these are the last 6
+	tests := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for seconds, expected := range tests {
+		code, err := Code(rfcSecret, Counter(time.Unix(seconds, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != expected {
+			t.Errorf("Unexpected code at %d: got %v want %v", seconds, code, expected)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1500000000, 0)
+	current := Counter(now)
+	code, _ := Code(secret, current)
+
+	counter, ok := Validate(secret, code, now, 0)
+	if !ok || counter != current {
+		t.Fatalf("Expected the current code to be accepted, got %v %v", counter, ok)
+	}
+
+	if _, ok := Validate(secret, code, now, current); ok {
+		t.Error("Expected a code to be rejected once it has been used")
+	}
+
+	previous, _ := Code(secret, current-1)
+	if _, ok := Validate(secret, previous, now, 0); !ok {
+		t.Error("Expected the previous code to be accepted")
+	}
+
+	stale, _ := Code(secret, current-2)
+	if _, ok := Validate(secret, stale, now, 0); ok {
+		t.Error("Expected an old code to be rejected")
+	}
+
+	if _, ok := Validate(secret, "", now, 0); ok {
+		t.Error("Expected an empty code to be rejected")
+	}
+}
@@ -0,0 +1,177 @@
+// Package workers runs queued battle jobs in the background, so that
+// battles are never simulated while a request is waiting.
+package workers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/crob1140/codewiz-server/datastore"
+	"github.com/crob1140/codewiz-server/live"
+	"github.com/crob1140/codewiz-server/log"
+	"github.com/crob1140/codewiz-server/models/jobs"
+	"github.com/crob1140/codewiz-server/simulator"
+)
+
+const (
+	DefaultSize         = 4
+	DefaultPollInterval = time.Second
+	DefaultLease        = 5 * time.Minute
+	DefaultMaxAttempts  = 3
+)
+
+// Pool is a fixed number of workers that each claim and run one job at a
+// time. A job whose worker panics, or whose lease expires because the
+// server stopped mid-battle, is retried until it has been attempted
+// MaxAttempts times. Jobs that fail with an error are not retried, since
+// the same wizards would fail in the same way.
+//
+// Every battle is broadcast on the hub under the ID of its job, so that
+// it can be watched while it is being fought.
+type Pool struct {
+	JobDao    *jobs.Dao
+	Simulator *simulator.Simulator
+	Hub       *live.Hub
+
+	Size         int
+	PollInterval time.Duration // how long idle workers wait before checking for new jobs
+	Lease        time.Duration // how long a job can run before it is presumed abandoned
+	MaxAttempts  int
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func NewPool(jobDao *jobs.Dao, simulator *simulator.Simulator, hub *live.Hub) *Pool {
+	return &Pool{
+		JobDao:       jobDao,
+		Simulator:    simulator,
+		Hub:          hub,
+		Size:         DefaultSize,
+		PollInterval: DefaultPollInterval,
+		Lease:        DefaultLease,
+		MaxAttempts:  DefaultMaxAttempts,
+	}
+}
+
+// Start launches the workers, which run until Stop is called.
+func (pool *Pool) Start() {
+	pool.stop = make(chan struct{})
+	for i := 0; i < pool.Size; i++ {
+		pool.done.Add(1)
+		go pool.work()
+	}
+}
+
+// Stop waits for the running jobs to finish and then stops the workers.
+func (pool *Pool) Stop() {
+	close(pool.stop)
+	pool.done.Wait()
+}
+
+func (pool *Pool) work() {
+	defer pool.done.Done()
+
+	for {
+		select {
+		case <-pool.stop:
+			return
+		default:
+		}
+
+		job, err := pool.Next()
+		if err != nil {
+			log.Error("Failed to claim battle job", log.Fields{"error": err})
+		}
+
+		if job != nil {
+			pool.Process(job)
+			continue
+		}
+
+		select {
+		case <-pool.stop:
+			return
+		case <-time.After(pool.PollInterval):
+		}
+	}
+}
+
+// Next claims the oldest job that is ready to run, or returns nil if there
+// is nothing to do. Abandoned jobs that have run out of attempts are
+// failed instead of being claimed.
+func (pool *Pool) Next() (*jobs.Job, error) {
+	now := time.Now()
+
+	candidates, err := pool.JobDao.GetClaimable(now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range candidates {
+		if job.Attempts >= pool.MaxAttempts {
+			job.State = jobs.Failed
+			job.Reason = "The battle was abandoned too many times."
+			if err := pool.JobDao.Update(job); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		claimed, err := pool.JobDao.Claim(job, now, pool.Lease)
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			return job, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Process runs a claimed job and records the outcome. If the battle
+// panics, the job is returned to the queue for another attempt.
+func (pool *Pool) Process(job *jobs.Job) {
+	// Spectators are only disconnected once the job has been saved, so
+	// that anyone who joins afterwards can see that the battle is over.
+	broadcast := pool.Hub.Open(job.ID)
+	defer pool.Hub.Close(job.ID)
+
+	defer func() {
+		if recovery := recover(); recovery != nil {
+			log.Error("Panic occurred while running battle job", log.Fields{
+				"job":   job.ID,
+				"error": fmt.Sprintf("%v", recovery),
+			})
+
+			job.State = jobs.Queued
+			pool.save(job)
+		}
+	}()
+
+	battle, err := pool.Simulator.Run(job.WizardIDs(), job.Seed, broadcast)
+	if err != nil {
+		job.State = jobs.Failed
+		job.Reason = err.Error()
+	} else {
+		job.State = jobs.Finished
+		job.BattleID = battle.ID
+	}
+
+	pool.save(job)
+}
+
+// save records the outcome of a job. If the worker's lease expired and
+// another worker has claimed the job since, the job belongs to the other
+// worker and this outcome is discarded.
+func (pool *Pool) save(job *jobs.Job) {
+	err := pool.JobDao.Update(job)
+	switch {
+	case err == datastore.ErrConflict:
+		log.Warn("Lost the lease on battle job, so its outcome was discarded", log.Fields{"job": job.ID, "state": job.State})
+	case err != nil:
+		log.Error("Failed to update battle job", log.Fields{"job": job.ID, "error": err})
+	}
+}